@@ -59,8 +59,10 @@ func init() {
 	}
 
 	websitesCmd := cmd.Command("websites", "")
-	inputFile := websitesCmd.Flag("input-file", "File containing input URLs").Strings()
+	inputFile := websitesCmd.Flag(
+		"input-file", "File containing input URLs (use .jsonl or .csv to add category codes)").Strings()
 	input := websitesCmd.Flag("input", "Test the specified URL").Strings()
+	resume := websitesCmd.Flag("resume", "Resume the previous run if it was interrupted").Bool()
 	websitesCmd.Action(func(_ *kingpin.ParseContext) error {
 		log.Infof("Running %s tests", color.BlueString("websites"))
 		return nettests.RunGroup(nettests.RunGroupConfig{
@@ -68,6 +70,7 @@ func init() {
 			Probe:      probe,
 			InputFiles: *inputFile,
 			Inputs:     *input,
+			Resume:     *resume,
 			RunType:    "manual",
 		})
 	})
@@ -1,17 +1,62 @@
 package upload
 
 import (
+	"context"
+
 	"github.com/alecthomas/kingpin"
 	"github.com/apex/log"
 	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/cli/root"
+	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/ooni"
+	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/output"
 )
 
 func init() {
-	cmd := root.Command("upload", "Upload a specific measurement")
-
+	cmd := root.Command("upload", "Upload the measurements we could not upload before")
 	cmd.Action(func(_ *kingpin.ParseContext) error {
-		log.Info("Uploading")
-		log.Error("this function is not implemented")
-		return nil
+		return doupload(defaultconfig)
 	})
 }
+
+type douploadconfig struct {
+	Logger       log.Interface
+	NewProbeCLI  func() (ooni.ProbeCLI, error)
+	SectionTitle func(string)
+}
+
+var defaultconfig = douploadconfig{
+	Logger:       log.Log,
+	NewProbeCLI:  root.NewProbeCLI,
+	SectionTitle: output.SectionTitle,
+}
+
+func doupload(config douploadconfig) error {
+	config.SectionTitle("Uploading queued measurements")
+	probeCLI, err := config.NewProbeCLI()
+	if err != nil {
+		return err
+	}
+
+	engine, err := probeCLI.NewProbeEngine(context.Background())
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+
+	queue := engine.SubmitQueue()
+	submitted, err := queue.Flush(context.Background())
+	if err != nil {
+		return err
+	}
+	pending, err := queue.Pending()
+	if err != nil {
+		return err
+	}
+
+	config.Logger.WithFields(log.Fields{
+		"type":      "table",
+		"submitted": submitted,
+		"pending":   pending,
+	}).Info("Uploaded queued measurements")
+
+	return nil
+}
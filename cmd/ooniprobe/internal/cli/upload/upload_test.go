@@ -0,0 +1,123 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/ooni"
+	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/oonitest"
+	"github.com/ooni/probe-cli/v3/internal/engine/submitqueue"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestNewProbeCLIFailed(t *testing.T) {
+	fo := &oonitest.FakeOutput{}
+	expected := errors.New("mocked error")
+	err := doupload(douploadconfig{
+		SectionTitle: fo.SectionTitle,
+		NewProbeCLI: func() (ooni.ProbeCLI, error) {
+			return nil, expected
+		},
+	})
+	if !errors.Is(err, expected) {
+		t.Fatalf("not the error we expected: %+v", err)
+	}
+	if len(fo.FakeSectionTitle) != 1 {
+		t.Fatal("invalid section title list size")
+	}
+}
+
+func TestNewProbeEngineFailed(t *testing.T) {
+	fo := &oonitest.FakeOutput{}
+	expected := errors.New("mocked error")
+	cli := &oonitest.FakeProbeCLI{
+		FakeProbeEngineErr: expected,
+	}
+	err := doupload(douploadconfig{
+		SectionTitle: fo.SectionTitle,
+		NewProbeCLI: func() (ooni.ProbeCLI, error) {
+			return cli, nil
+		},
+	})
+	if !errors.Is(err, expected) {
+		t.Fatalf("not the error we expected: %+v", err)
+	}
+}
+
+type fakeSubmitter struct {
+	err error
+}
+
+func (fs *fakeSubmitter) Submit(ctx context.Context, m *model.Measurement) error {
+	return fs.err
+}
+
+func newQueue(kvs model.KeyValueStore, submitter *fakeSubmitter, delta time.Duration) *submitqueue.Queue {
+	return submitqueue.New(submitqueue.Config{
+		KVStore: kvs,
+		Logger:  log.Log,
+		NewSubmitter: func(ctx context.Context) (submitqueue.Submitter, error) {
+			return submitter, submitter.err
+		},
+		TimeNow: func() time.Time {
+			return time.Now().Add(delta)
+		},
+	})
+}
+
+func TestFlushFailed(t *testing.T) {
+	fo := &oonitest.FakeOutput{}
+	expected := errors.New("mocked error")
+	kvs := &kvstore.Memory{}
+	m := &model.Measurement{Input: "https://www.example.com/"}
+	if err := newQueue(kvs, nil, 0).Add(m, nil); err != nil {
+		t.Fatal(err)
+	}
+	// the next attempt is due when we flush
+	queue := newQueue(kvs, &fakeSubmitter{err: expected}, time.Hour)
+	cli := &oonitest.FakeProbeCLI{
+		FakeProbeEnginePtr: &oonitest.FakeProbeEngine{FakeSubmitQueue: queue},
+	}
+	err := doupload(douploadconfig{
+		SectionTitle: fo.SectionTitle,
+		NewProbeCLI: func() (ooni.ProbeCLI, error) {
+			return cli, nil
+		},
+	})
+	if !errors.Is(err, expected) {
+		t.Fatalf("not the error we expected: %+v", err)
+	}
+}
+
+func TestSuccess(t *testing.T) {
+	fo := &oonitest.FakeOutput{}
+	queue := newQueue(&kvstore.Memory{}, &fakeSubmitter{}, 0)
+	cli := &oonitest.FakeProbeCLI{
+		FakeProbeEnginePtr: &oonitest.FakeProbeEngine{FakeSubmitQueue: queue},
+	}
+	handler := &oonitest.FakeLoggerHandler{}
+	err := doupload(douploadconfig{
+		Logger: &log.Logger{
+			Handler: handler,
+			Level:   log.DebugLevel,
+		},
+		SectionTitle: fo.SectionTitle,
+		NewProbeCLI: func() (ooni.ProbeCLI, error) {
+			return cli, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(handler.FakeEntries) != 1 {
+		t.Fatal("invalid number of written entries")
+	}
+	entry := handler.FakeEntries[0]
+	if entry.Fields["submitted"] != 0 || entry.Fields["pending"] != 0 {
+		t.Fatal("unexpected fields", entry.Fields)
+	}
+}
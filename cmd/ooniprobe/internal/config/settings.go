@@ -13,4 +13,5 @@ type Nettests struct {
 	WebsitesMaxRuntime           int64    `json:"websites_max_runtime"`
 	WebsitesURLLimit             int64    `json:"websites_url_limit"`
 	WebsitesEnabledCategoryCodes []string `json:"websites_enabled_category_codes"`
+	WebsitesParallelism          int64    `json:"websites_parallelism"`
 }
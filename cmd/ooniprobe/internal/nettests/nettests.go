@@ -1,8 +1,10 @@
 package nettests
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/apex/log"
@@ -43,7 +45,8 @@ type Controller struct {
 	ntIndex     int
 	ntStartTime time.Time // used to calculate the eta
 	msmts       map[int64]*database.Measurement
-	inputIdxMap map[int64]int64 // Used to map mk idx to database id
+	inputIdxMap map[int64]int64      // Used to map mk idx to database id
+	testlist    []model.OOAPIURLInfo // Used to annotate measurements
 
 	// InputFiles optionally contains the names of the input
 	// files to read inputs from (only for nettests that take
@@ -58,11 +61,27 @@ type Controller struct {
 	// not set, the underlying code defaults to "timed".
 	RunType string
 
+	// Resume indicates that we should resume the previous run of
+	// the nettest if it has been interrupted (only for nettests
+	// that checkpoint their progress, of course)
+	Resume bool
+
+	// checkpoint contains the progress of the current run when
+	// the nettest checkpoints its progress (see Resume)
+	checkpoint *engine.Checkpoint
+
+	// checkpointer saves the checkpoint
+	checkpointer *engine.Checkpointer
+
 	// numInputs is the total number of inputs
 	numInputs int
 
 	// curInputIdx is the current input index
 	curInputIdx int
+
+	// mu protects curInputIdx, which we read from OnProgress, which
+	// may be called concurrently when measuring in parallel
+	mu sync.Mutex
 }
 
 // BuildAndSetInputIdxMap takes in input a list of URLs in the format
@@ -74,7 +93,11 @@ type Controller struct {
 // 2. builds a list of bare URLs to be tested;
 //
 // 3. registers a mapping between each URL and an index
-// and stores it into the controller.
+// and stores it into the controller;
+//
+// 4. stores the list itself into the controller, so that we
+// can annotate each measurement with the URL's category code
+// and country code (see engine.InputAnnotations).
 //
 // Arguments:
 //
@@ -102,14 +125,63 @@ func (c *Controller) BuildAndSetInputIdxMap(
 			log.Error("failed to add to the URL table")
 			return nil, err
 		}
+		if len(url.Options) > 0 {
+			log.Warnf("ignoring the per-input options of %s: not supported by ooniprobe", url.URL)
+		}
 		log.Debugf("Mapped URL %s to idx %d and urlID %d", url.URL, idx, urlID)
 		urlIDMap[int64(idx)] = urlID
 		urls = append(urls, url.URL)
 	}
 	c.inputIdxMap = urlIDMap
+	c.testlist = testlist
 	return urls, nil
 }
 
+// maybeResume enables checkpointing the progress of the given experiment
+// and returns the inputs of the previous run if we should resume it, or
+// nil if we should start a new run. When starting a new run, the caller
+// MUST call startCheckpoint with the inputs of the new run.
+func (c *Controller) maybeResume(experimentName string) ([]model.OOAPIURLInfo, error) {
+	c.checkpointer = engine.NewCheckpointer(engine.CheckpointerConfig{
+		ExperimentName: experimentName,
+		KVStore:        c.Session.KeyValueStore(),
+	})
+	if !c.Resume {
+		return nil, nil
+	}
+	checkpoint, err := c.checkpointer.LoadCheckpoint()
+	if errors.Is(err, engine.ErrNoCheckpoint) {
+		log.Info("No interrupted run to resume; starting a new run")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load checkpoint")
+	}
+	log.Infof("Resuming the previous run: %d/%d inputs already measured",
+		len(checkpoint.Completed), len(checkpoint.Inputs))
+	c.checkpoint = checkpoint
+	return checkpoint.Inputs, nil
+}
+
+// startCheckpoint starts checkpointing a new run with the given inputs.
+func (c *Controller) startCheckpoint(inputs []model.OOAPIURLInfo) {
+	c.checkpoint = &engine.Checkpoint{Inputs: inputs}
+}
+
+// saveCheckpoint records that we have completed the input with the
+// given index, if we are checkpointing the current run.
+func (c *Controller) saveCheckpoint(idx int, reportID string) error {
+	if c.checkpoint == nil {
+		return nil
+	}
+	c.checkpoint.Completed = append(c.checkpoint.Completed, idx)
+	c.checkpoint.ReportID = reportID
+	if err := c.checkpointer.SaveCheckpoint(c.checkpoint); err != nil {
+		return errors.Wrap(err, "failed to save checkpoint")
+	}
+	return nil
+}
+
 // SetNettestIndex is used to set the current nettest index and total nettest
 // count to compute a different progress percentage.
 func (c *Controller) SetNettestIndex(i, n int) {
@@ -143,6 +215,13 @@ func (c *Controller) Run(builder *engine.ExperimentBuilder, inputs []string) err
 	log.Debug(color.RedString("status.started"))
 
 	if c.Probe.Config().Sharing.UploadResults {
+		if c.checkpoint != nil && c.checkpoint.ReportID != "" {
+			err := exp.ResumeReportContext(context.Background(), c.checkpoint.ReportID)
+			if err != nil {
+				log.WithError(err).Info("Cannot resume the previous report; opening a new one")
+			}
+		}
+		// Note: OpenReport is a no-op if we have resumed the report
 		if err := exp.OpenReport(); err != nil {
 			log.Debugf(
 				"%s: %s", color.RedString("failure.report_create"), err.Error(),
@@ -169,16 +248,53 @@ func (c *Controller) Run(builder *engine.ExperimentBuilder, inputs []string) err
 	}
 	start := time.Now()
 	c.ntStartTime = start
+	parallelism := int(c.Probe.Config().Nettests.WebsitesParallelism)
+	if !isWebConnectivity && parallelism > 1 {
+		log.Debug("disabling parallelism without Web Connectivity")
+		parallelism = 0
+	}
+	// skip the inputs measured by the run we're resuming, if any
+	completed := make(map[int]bool)
+	if c.checkpoint != nil {
+		for _, idx := range c.checkpoint.Completed {
+			completed[idx] = true
+		}
+	}
+	var todo []int
+	var todoInputs []string
 	for idx, input := range inputs {
+		if !completed[idx] {
+			todo = append(todo, idx)
+			todoInputs = append(todoInputs, input)
+		}
+	}
+	measure := func(pos int, input string) (*model.Measurement, error) {
+		return exp.Measure(input)
+	}
+	if parallelism > 1 {
+		log.Debugf("measuring up to %d inputs in parallel", parallelism)
+		pm := newParallelMeasurer(exp, todoInputs, parallelism)
+		defer pm.Close()
+		measure = func(pos int, input string) (*model.Measurement, error) {
+			return pm.Measure(pos)
+		}
+	}
+	interrupted := false
+	for pos, idx := range todo {
+		input := inputs[idx]
 		if c.Probe.IsTerminated() {
 			log.Info("user requested us to terminate using Ctrl-C")
+			interrupted = true
 			break
 		}
 		if maxRuntime > 0 && time.Since(start) > maxRuntime {
 			log.Info("exceeded maximum runtime")
+			interrupted = true
 			break
 		}
+		c.mu.Lock()
 		c.curInputIdx = idx // allow for precise progress
+		c.mu.Unlock()
 		idx64 := int64(idx)
 		log.Debug(color.RedString("status.measurement_start"))
 		var urlID sql.NullInt64
@@ -197,12 +313,15 @@ func (c *Controller) Run(builder *engine.ExperimentBuilder, inputs []string) err
 		if input != "" {
 			c.OnProgress(0, fmt.Sprintf("processing input: %s", input))
 		}
-		measurement, err := exp.Measure(input)
+		measurement, err := measure(pos, input)
 		if err != nil {
 			log.WithError(err).Debug(color.RedString("failure.measurement"))
 			if err := c.msmts[idx64].Failed(c.Probe.DB(), err.Error()); err != nil {
 				return errors.Wrap(err, "failed to mark measurement as failed")
 			}
+			if err := c.saveCheckpoint(idx, exp.ReportID()); err != nil {
+				return err
+			}
 			// Since https://github.com/ooni/probe-cli/pull/527, the Measure
 			// function returns EITHER a valid measurement OR an error. Before
 			// that, instead, the measurement was valid EVEN in case of an
@@ -212,6 +331,9 @@ func (c *Controller) Run(builder *engine.ExperimentBuilder, inputs []string) err
 			// through and attempting to do something with the measurement.
 			continue
 		}
+		if idx < len(c.testlist) {
+			measurement.AddAnnotations(engine.InputAnnotations(c.testlist[idx]))
+		}
 
 		saveToDisk := true
 		if c.Probe.Config().Sharing.UploadResults {
@@ -220,6 +342,9 @@ func (c *Controller) Run(builder *engine.ExperimentBuilder, inputs []string) err
 			// bit of a spew in the logs, perhaps, but stopping seems less efficient.
 			if err := exp.SubmitAndUpdateMeasurement(measurement); err != nil {
 				log.Debug(color.RedString("failure.measurement_submission"))
+				if err := c.Session.SubmitQueue().Add(measurement, err); err != nil {
+					log.WithError(err).Warn("failed to queue measurement for later submission")
+				}
 				if err := c.msmts[idx64].UploadFailed(c.Probe.DB(), err.Error()); err != nil {
 					return errors.Wrap(err, "failed to mark upload as failed")
 				}
@@ -240,6 +365,9 @@ func (c *Controller) Run(builder *engine.ExperimentBuilder, inputs []string) err
 		if err := c.msmts[idx64].Done(c.Probe.DB()); err != nil {
 			return errors.Wrap(err, "failed to mark measurement as done")
 		}
+		if err := c.saveCheckpoint(idx, exp.ReportID()); err != nil {
+			return err
+		}
 
 		// We're not sure whether it's enough to log the error or we should
 		// instead also mark the measurement as failed. Strictly speaking this
@@ -256,6 +384,11 @@ func (c *Controller) Run(builder *engine.ExperimentBuilder, inputs []string) err
 			return errors.Wrap(err, "failed to add test keys to summary")
 		}
 	}
+	if c.checkpoint != nil && !interrupted {
+		if err := c.checkpointer.ClearCheckpoint(); err != nil {
+			return errors.Wrap(err, "failed to clear checkpoint")
+		}
+	}
 	database.UpdateUploadedStatus(c.Probe.DB(), c.res)
 	log.Debugf("status.end")
 	return nil
@@ -281,12 +414,15 @@ func (c *Controller) OnProgress(perc float64, msg string) {
 	var eta float64
 	eta = -1.0
 	if c.numInputs > 1 {
+		c.mu.Lock()
+		curInputIdx := c.curInputIdx
+		c.mu.Unlock()
 		// make the percentage relative to the current input over all inputs
-		floor := (float64(c.curInputIdx) / float64(c.numInputs))
+		floor := (float64(curInputIdx) / float64(c.numInputs))
 		step := 1.0 / float64(c.numInputs)
 		perc = floor + perc*step
-		if c.curInputIdx > 0 {
-			eta = (time.Since(c.ntStartTime).Seconds() / float64(c.curInputIdx)) * float64(c.numInputs-c.curInputIdx)
+		if curInputIdx > 0 {
+			eta = (time.Since(c.ntStartTime).Seconds() / float64(curInputIdx)) * float64(c.numInputs-curInputIdx)
 		}
 	}
 	if c.ntCount > 0 {
@@ -9,6 +9,7 @@ import (
 
 	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/database"
 	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/ooni"
+	"github.com/ooni/probe-cli/v3/internal/model"
 )
 
 func copyfile(source, dest string) error {
@@ -61,3 +62,71 @@ func TestRun(t *testing.T) {
 	ctl := NewController(nt, probe, res, sess)
 	nt.Run(ctl)
 }
+
+func TestCheckpoint(t *testing.T) {
+	probe := newOONIProbe(t)
+	sess, err := probe.NewSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	ctl := NewController(WebConnectivity{}, probe, nil, sess)
+	ctl.Resume = true
+	inputs, err := ctl.maybeResume("web_connectivity")
+	if err != nil || inputs != nil {
+		t.Fatal("there should be nothing to resume", inputs, err)
+	}
+	ctl.startCheckpoint([]model.OOAPIURLInfo{{
+		URL: "https://www.example.com/",
+	}, {
+		URL: "https://www.example.org/",
+	}})
+	if err := ctl.saveCheckpoint(0, "xx"); err != nil {
+		t.Fatal(err)
+	}
+	// we only resume when the user asks us to do so
+	ctl = NewController(WebConnectivity{}, probe, nil, sess)
+	if inputs, err := ctl.maybeResume("web_connectivity"); err != nil || inputs != nil {
+		t.Fatal("we should not resume", inputs, err)
+	}
+	ctl.Resume = true
+	inputs, err = ctl.maybeResume("web_connectivity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) != 2 || inputs[1].URL != "https://www.example.org/" {
+		t.Fatal("unexpected inputs", inputs)
+	}
+	if ctl.checkpoint.ReportID != "xx" || len(ctl.checkpoint.Completed) != 1 {
+		t.Fatal("unexpected checkpoint", ctl.checkpoint)
+	}
+}
+
+func TestBuildAndSetInputIdxMap(t *testing.T) {
+	probe := newOONIProbe(t)
+	sess, err := probe.NewSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	ctl := NewController(WebConnectivity{}, probe, nil, sess)
+	testlist := []model.OOAPIURLInfo{{
+		CategoryCode: "NEWS",
+		CountryCode:  "IT",
+		URL:          "https://www.example.com/",
+	}, {
+		CategoryCode: "HUMR",
+		CountryCode:  "XX",
+		URL:          "https://www.example.org/",
+	}}
+	urls, err := ctl.BuildAndSetInputIdxMap(probe.DB(), testlist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 2 || urls[1] != "https://www.example.org/" {
+		t.Fatal("unexpected urls", urls)
+	}
+	if len(ctl.inputIdxMap) != 2 || len(ctl.testlist) != 2 || ctl.testlist[1].CategoryCode != "HUMR" {
+		t.Fatal("unexpected controller state", ctl.inputIdxMap, ctl.testlist)
+	}
+}
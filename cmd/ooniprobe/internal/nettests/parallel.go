@@ -0,0 +1,90 @@
+package nettests
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// parallelMeasurerExperiment is the experiment according
+// to the parallelMeasurer (e.g., an *engine.Experiment).
+type parallelMeasurerExperiment interface {
+	MeasureWithContext(ctx context.Context, input string) (*model.Measurement, error)
+}
+
+// parallelMeasurerResult is the result of measuring an input.
+type parallelMeasurerResult struct {
+	measurement *model.Measurement
+	err         error
+}
+
+// parallelMeasurer measures inputs in the background using up to
+// a given number of goroutines and returns the measurements following
+// the order of the inputs. This allows the Controller to measure
+// concurrently while still writing into the database, submitting,
+// and saving measurements from a single goroutine.
+type parallelMeasurer struct {
+	// cancel cancels the pending measurements.
+	cancel context.CancelFunc
+
+	// results contains a channel for each input.
+	results []chan *parallelMeasurerResult
+
+	// sema limits the number of measurements we are running
+	// or we have completed but Measure has not returned yet.
+	sema chan bool
+
+	// wg allows us to wait for background goroutines.
+	wg *sync.WaitGroup
+}
+
+// newParallelMeasurer creates a new parallelMeasurer that immediately
+// starts measuring the given inputs. The caller MUST call Close when
+// done to cancel the pending measurements and release resources.
+func newParallelMeasurer(
+	exp parallelMeasurerExperiment, inputs []string, parallelism int) *parallelMeasurer {
+	ctx, cancel := context.WithCancel(context.Background())
+	pm := &parallelMeasurer{
+		cancel:  cancel,
+		results: make([]chan *parallelMeasurerResult, len(inputs)),
+		sema:    make(chan bool, parallelism),
+		wg:      &sync.WaitGroup{},
+	}
+	for idx := range pm.results {
+		pm.results[idx] = make(chan *parallelMeasurerResult, 1) // buffered
+	}
+	pm.wg.Add(1)
+	go func() {
+		defer pm.wg.Done()
+		for idx, input := range inputs {
+			select {
+			case pm.sema <- true:
+			case <-ctx.Done():
+				return
+			}
+			pm.wg.Add(1)
+			go func(idx int, input string) {
+				defer pm.wg.Done()
+				measurement, err := exp.MeasureWithContext(ctx, input)
+				pm.results[idx] <- &parallelMeasurerResult{measurement: measurement, err: err}
+			}(idx, input)
+		}
+	}()
+	return pm
+}
+
+// Measure waits for the measurement of the idx-th input. You MUST call
+// this function following the order of the inputs, without skipping any
+// input, and you MUST NOT call this function after Close.
+func (pm *parallelMeasurer) Measure(idx int) (*model.Measurement, error) {
+	result := <-pm.results[idx]
+	<-pm.sema // allow measuring another input
+	return result.measurement, result.err
+}
+
+// Close cancels the pending measurements and waits for them to terminate.
+func (pm *parallelMeasurer) Close() {
+	pm.cancel()
+	pm.wg.Wait()
+}
@@ -0,0 +1,85 @@
+package nettests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+type fakeParallelMeasurerExperiment struct {
+	active    int
+	maxActive int
+	mu        sync.Mutex
+}
+
+func (e *fakeParallelMeasurerExperiment) MeasureWithContext(
+	ctx context.Context, input string) (*model.Measurement, error) {
+	e.mu.Lock()
+	e.active++
+	if e.active > e.maxActive {
+		e.maxActive = e.active
+	}
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.active--
+		e.mu.Unlock()
+	}()
+	if input == "fail" {
+		return nil, errors.New("mocked error")
+	}
+	var idx int
+	fmt.Sscanf(input, "%d", &idx)
+	select {
+	case <-time.After(time.Duration(10-idx) * 5 * time.Millisecond):
+		return &model.Measurement{Input: model.MeasurementTarget(input)}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestParallelMeasurer(t *testing.T) {
+	t.Run("we get measurements in order", func(t *testing.T) {
+		var inputs []string
+		for idx := 0; idx < 10; idx++ {
+			inputs = append(inputs, fmt.Sprintf("%d", idx))
+		}
+		inputs = append(inputs, "fail")
+		exp := &fakeParallelMeasurerExperiment{}
+		pm := newParallelMeasurer(exp, inputs, 3)
+		defer pm.Close()
+		for idx, input := range inputs[:10] {
+			measurement, err := pm.Measure(idx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(measurement.Input) != input {
+				t.Fatal("unexpected input", measurement.Input, input)
+			}
+		}
+		if _, err := pm.Measure(10); err == nil {
+			t.Fatal("expected an error")
+		}
+		if exp.maxActive <= 1 || exp.maxActive > 3 {
+			t.Fatal("unexpected parallelism", exp.maxActive)
+		}
+	})
+
+	t.Run("Close cancels pending measurements", func(t *testing.T) {
+		inputs := []string{"0", "0", "0", "0", "0"}
+		exp := &fakeParallelMeasurerExperiment{}
+		pm := newParallelMeasurer(exp, inputs, 2)
+		if _, err := pm.Measure(0); err != nil {
+			t.Fatal(err)
+		}
+		pm.Close()
+		if exp.active != 0 {
+			t.Fatal("there are still active measurements")
+		}
+	})
+}
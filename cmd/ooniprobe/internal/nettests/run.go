@@ -8,6 +8,7 @@ import (
 	"github.com/apex/log"
 	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/database"
 	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/ooni"
+	"github.com/ooni/probe-cli/v3/internal/engine/submitqueue"
 	"github.com/pkg/errors"
 )
 
@@ -17,6 +18,7 @@ type RunGroupConfig struct {
 	InputFiles []string
 	Inputs     []string
 	Probe      *ooni.Probe
+	Resume     bool   // resume interrupted run
 	RunType    string // hint for check-in API
 }
 
@@ -106,14 +108,38 @@ func RunGroup(config RunGroupConfig) error {
 		ctl.InputFiles = config.InputFiles
 		ctl.Inputs = config.Inputs
 		ctl.RunType = config.RunType
+		ctl.Resume = config.Resume
 		ctl.SetNettestIndex(i, len(group.Nettests))
 		if err = nt.Run(ctl); err != nil {
 			log.WithError(err).Errorf("Failed to run %s", group.Label)
 		}
 	}
 
+	if config.Probe.Config().Sharing.UploadResults && !config.Probe.IsTerminated() {
+		flushSubmitQueue(sess.SubmitQueue())
+	}
+
 	if err = result.Finished(config.Probe.DB()); err != nil {
 		return err
 	}
 	return nil
 }
+
+// flushSubmitQueue submits the measurements that we previously failed
+// to submit and logs how many of them are still pending.
+func flushSubmitQueue(queue *submitqueue.Queue) {
+	submitted, err := queue.Flush(context.Background())
+	if err != nil {
+		log.WithError(err).Warn("Failed to flush the submission queue")
+	}
+	if submitted > 0 {
+		log.Infof("Submitted %d previously queued measurements", submitted)
+	}
+	pending, err := queue.Pending()
+	if err != nil {
+		log.WithError(err).Warn("Failed to read the submission queue")
+	}
+	if pending > 0 {
+		log.Infof("%d measurements are queued for later submission", pending)
+	}
+}
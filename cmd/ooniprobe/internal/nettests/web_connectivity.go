@@ -9,6 +9,13 @@ import (
 )
 
 func (n WebConnectivity) lookupURLs(ctl *Controller, categories []string) ([]string, error) {
+	testlist, err := ctl.maybeResume("web_connectivity")
+	if err != nil {
+		return nil, err
+	}
+	if testlist != nil {
+		return ctl.BuildAndSetInputIdxMap(ctl.Probe.DB(), testlist)
+	}
 	inputloader := &engine.InputLoader{
 		CheckInConfig: &model.OOAPICheckInConfig{
 			// Setting Charging and OnWiFi to true causes the CheckIn
@@ -27,10 +34,11 @@ func (n WebConnectivity) lookupURLs(ctl *Controller, categories []string) ([]str
 		SourceFiles:    ctl.InputFiles,
 		StaticInputs:   ctl.Inputs,
 	}
-	testlist, err := inputloader.Load(context.Background())
+	testlist, err = inputloader.Load(context.Background())
 	if err != nil {
 		return nil, err
 	}
+	ctl.startCheckpoint(testlist)
 	return ctl.BuildAndSetInputIdxMap(ctl.Probe.DB(), testlist)
 }
 
@@ -16,6 +16,7 @@ import (
 	"github.com/ooni/probe-cli/v3/internal/atomicx"
 	"github.com/ooni/probe-cli/v3/internal/engine"
 	"github.com/ooni/probe-cli/v3/internal/engine/legacy/assetsdir"
+	"github.com/ooni/probe-cli/v3/internal/engine/submitqueue"
 	"github.com/ooni/probe-cli/v3/internal/kvstore"
 	"github.com/pkg/errors"
 	"upper.io/db.v3/lib/sqlbuilder"
@@ -39,6 +40,7 @@ type ProbeEngine interface {
 	ProbeCC() string
 	ProbeIP() string
 	ProbeNetworkName() string
+	SubmitQueue() *submitqueue.Queue
 }
 
 // Probe contains the ooniprobe CLI context.
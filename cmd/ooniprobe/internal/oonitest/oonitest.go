@@ -8,6 +8,7 @@ import (
 	"github.com/apex/log"
 	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/config"
 	"github.com/ooni/probe-cli/v3/cmd/ooniprobe/internal/ooni"
+	"github.com/ooni/probe-cli/v3/internal/engine/submitqueue"
 	"upper.io/db.v3/lib/sqlbuilder"
 )
 
@@ -75,6 +76,7 @@ type FakeProbeEngine struct {
 	FakeProbeCC             string
 	FakeProbeIP             string
 	FakeProbeNetworkName    string
+	FakeSubmitQueue         *submitqueue.Queue
 }
 
 // Close implements ProbeEngine.Close
@@ -107,6 +109,11 @@ func (eng *FakeProbeEngine) ProbeNetworkName() string {
 	return eng.FakeProbeNetworkName
 }
 
+// SubmitQueue implements ProbeEngine.SubmitQueue
+func (eng *FakeProbeEngine) SubmitQueue() *submitqueue.Queue {
+	return eng.FakeSubmitQueue
+}
+
 var _ ooni.ProbeEngine = &FakeProbeEngine{}
 
 // FakeLoggerHandler fakes apex.log.Handler.
@@ -8,7 +8,9 @@ import (
 	"context"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
 // DNSLookupEvent contains the results of a DNS lookup.
@@ -19,6 +21,8 @@ type DNSLookupEvent struct {
 	Failure         error
 	Finished        time.Time
 	LookupType      string
+	QueryType       string
+	Reply           *model.DNSReply
 	ResolverAddress string
 	ResolverNetwork string
 	Started         time.Time
@@ -74,6 +78,35 @@ func (s *Saver) appendLookupHTTPSEvent(ev *DNSLookupEvent) {
 	s.mu.Unlock()
 }
 
+// LookupRaw sends a query for the given qtype (e.g., dns.TypeCNAME) using
+// the given resolver and saves the results into the saver. The resolver
+// must implement model.RawResolver, otherwise the lookup fails.
+func (s *Saver) LookupRaw(ctx context.Context, reso model.Resolver,
+	domain string, qtype uint16) (*model.DNSReply, error) {
+	started := time.Now()
+	reply, err := netxlite.LookupRaw(ctx, reso, domain, qtype)
+	s.appendLookupRawEvent(&DNSLookupEvent{
+		ALPNs:           nil,
+		Addresses:       nil,
+		Domain:          domain,
+		Failure:         err,
+		Finished:        time.Now(),
+		LookupType:      "raw",
+		QueryType:       dns.TypeToString[qtype],
+		Reply:           reply,
+		ResolverAddress: reso.Address(),
+		ResolverNetwork: reso.Network(),
+		Started:         started,
+	})
+	return reply, err
+}
+
+func (s *Saver) appendLookupRawEvent(ev *DNSLookupEvent) {
+	s.mu.Lock()
+	s.trace.DNSLookupRaw = append(s.trace.DNSLookupRaw, ev)
+	s.mu.Unlock()
+}
+
 func (s *Saver) safeALPNs(https *model.HTTPSSvc) (out []string) {
 	if https != nil {
 		out = https.ALPN
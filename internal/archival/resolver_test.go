@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/fakefill"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/model/mocks"
@@ -175,12 +176,95 @@ func TestSaverLookupHTTPS(t *testing.T) {
 	})
 }
 
+func TestSaverLookupRaw(t *testing.T) {
+	// newResolver helps to create a new resolver.
+	newResolver := func(reply *model.DNSReply, err error) model.Resolver {
+		return &mocks.Resolver{
+			MockLookupRaw: func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+				return reply, err
+			},
+			MockAddress: func() string {
+				return "8.8.8.8:53"
+			},
+			MockNetwork: func() string {
+				return "udp"
+			},
+		}
+	}
+
+	t.Run("on success", func(t *testing.T) {
+		const domain = "www.example.com"
+		expectReply := &model.DNSReply{
+			Answer: []*model.DNSRecord{{
+				Name: "www.example.com.",
+				Type: "CNAME",
+				TTL:  300,
+				Data: "example.com.",
+			}},
+		}
+		saver := NewSaver()
+		v := &SingleDNSLookupValidator{
+			ExpectDomain:          domain,
+			ExpectLookupType:      "raw",
+			ExpectFailure:         nil,
+			ExpectQueryType:       "CNAME",
+			ExpectReply:           expectReply,
+			ExpectResolverAddress: "8.8.8.8:53",
+			ExpectResolverNetwork: "udp",
+			Saver:                 saver,
+		}
+		reso := newResolver(expectReply, nil)
+		ctx := context.Background()
+		reply, err := saver.LookupRaw(ctx, reso, domain, dns.TypeCNAME)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply != expectReply {
+			t.Fatal("not the reply we expected")
+		}
+		if err := v.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("on failure with reply", func(t *testing.T) {
+		mockedError := netxlite.NewTopLevelGenericErrWrapper(netxlite.ErrOODNSNoSuchHost)
+		const domain = "www.example.com"
+		expectReply := &model.DNSReply{}
+		saver := NewSaver()
+		v := &SingleDNSLookupValidator{
+			ExpectDomain:          domain,
+			ExpectLookupType:      "raw",
+			ExpectFailure:         mockedError,
+			ExpectQueryType:       "NS",
+			ExpectReply:           expectReply,
+			ExpectResolverAddress: "8.8.8.8:53",
+			ExpectResolverNetwork: "udp",
+			Saver:                 saver,
+		}
+		reso := newResolver(expectReply, mockedError)
+		ctx := context.Background()
+		reply, err := saver.LookupRaw(ctx, reso, domain, dns.TypeNS)
+		if !errors.Is(err, mockedError) {
+			t.Fatal("unexpected err", err)
+		}
+		if reply != expectReply {
+			t.Fatal("not the reply we expected")
+		}
+		if err := v.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
 type SingleDNSLookupValidator struct {
 	ExpectALPNs           []string
 	ExpectAddrs           []string
 	ExpectDomain          string
 	ExpectLookupType      string
 	ExpectFailure         error
+	ExpectQueryType       string
+	ExpectReply           *model.DNSReply
 	ExpectResolverAddress string
 	ExpectResolverNetwork string
 	Saver                 *Saver
@@ -194,6 +278,8 @@ func (v *SingleDNSLookupValidator) Validate() error {
 		entries = trace.DNSLookupHost
 	case "https":
 		entries = trace.DNSLookupHTTPS
+	case "raw":
+		entries = trace.DNSLookupRaw
 	default:
 		return errors.New("invalid v.ExpectLookupType")
 	}
@@ -213,6 +299,12 @@ func (v *SingleDNSLookupValidator) Validate() error {
 	if !errors.Is(entry.Failure, v.ExpectFailure) {
 		return errors.New("invalid .Failure value")
 	}
+	if entry.QueryType != v.ExpectQueryType {
+		return errors.New("invalid .QueryType value")
+	}
+	if entry.Reply != v.ExpectReply {
+		return errors.New("invalid .Reply value")
+	}
 	if !entry.Finished.After(entry.Started) {
 		return errors.New(".Finished is not after .Started")
 	}
@@ -25,6 +25,9 @@ type Trace struct {
 	// DNSLookupHost contains DNSLookupHost events.
 	DNSLookupHost []*DNSLookupEvent
 
+	// DNSLookupRaw contains DNSLookupRaw events.
+	DNSLookupRaw []*DNSLookupEvent
+
 	// DNSRoundTrip contains DNSRoundTrip events.
 	DNSRoundTrip []*DNSRoundTripEvent
 
@@ -198,6 +201,26 @@ func (t *Trace) NewArchivalDNSLookupResultList(begin time.Time) (out []model.Arc
 			T:                ev.Finished.Sub(begin).Seconds(),
 		})
 	}
+	for _, ev := range t.DNSLookupRaw {
+		entry := model.ArchivalDNSLookupResult{
+			Engine:           ev.ResolverNetwork,
+			Failure:          t.newFailure(ev.Failure),
+			Hostname:         ev.Domain,
+			QueryType:        ev.QueryType,
+			ResolverHostname: nil, // legacy
+			ResolverPort:     nil, // legacy
+			ResolverAddress:  ev.ResolverAddress,
+			T:                ev.Finished.Sub(begin).Seconds(),
+		}
+		if ev.Reply != nil {
+			// Note: the reply may be available also on failure, e.g., when
+			// the RCODE is NXDOMAIN, and the authority may contain a SOA.
+			entry.Answers = NewArchivalDNSAnswerList(ev.Reply.Answer)
+			entry.Authority = NewArchivalDNSAnswerList(ev.Reply.Authority)
+			entry.Additional = NewArchivalDNSAnswerList(ev.Reply.Additional)
+		}
+		out = append(out, entry)
+	}
 	return
 }
 
@@ -231,6 +254,33 @@ func (t *Trace) gatherAAAA(addrs []string) (out []model.ArchivalDNSAnswer) {
 	return
 }
 
+// NewArchivalDNSAnswerList converts a list of generic DNS records
+// to a list of answers in the OONI archival data format. This is the
+// converter we use everywhere we serialize a model.DNSReply.
+func NewArchivalDNSAnswerList(records []*model.DNSRecord) (out []model.ArchivalDNSAnswer) {
+	for _, record := range records {
+		ttl := record.TTL
+		answer := model.ArchivalDNSAnswer{AnswerType: record.Type, TTL: &ttl}
+		switch record.Type {
+		case "A", "AAAA":
+			asn, org, _ := geolocate.LookupASN(record.Data)
+			answer.ASN = int64(asn)
+			answer.ASOrgName = org
+			if record.Type == "A" {
+				answer.IPv4 = record.Data
+			} else {
+				answer.IPv6 = record.Data
+			}
+		case "CNAME", "NS", "PTR":
+			answer.Hostname = record.Data
+		default:
+			answer.Data = record.Data
+		}
+		out = append(out, answer)
+	}
+	return
+}
+
 //
 // NetworkEvents
 //
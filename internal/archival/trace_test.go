@@ -738,6 +738,137 @@ func TestTraceNewArchivalDNSLookupResultList(t *testing.T) {
 	}
 }
 
+func TestTraceNewArchivalDNSLookupResultListWithRawLookups(t *testing.T) {
+	t.Run("with failure and no reply", func(t *testing.T) {
+		tr := &Trace{
+			DNSLookupRaw: []*DNSLookupEvent{{
+				Domain:          "example.com",
+				Failure:         netxlite.NewTopLevelGenericErrWrapper(io.EOF),
+				Finished:        traceTime(2),
+				LookupType:      "raw",
+				QueryType:       "NS",
+				ResolverAddress: "8.8.8.8:53",
+				ResolverNetwork: "udp",
+				Started:         traceTime(1),
+			}},
+		}
+		expect := []model.ArchivalDNSLookupResult{{
+			Engine:          "udp",
+			Failure:         failureFromString(netxlite.FailureEOFError),
+			Hostname:        "example.com",
+			QueryType:       "NS",
+			ResolverAddress: "8.8.8.8:53",
+			T:               deltaSinceTraceTime(2),
+		}}
+		out := tr.NewArchivalDNSLookupResultList(traceTime(0))
+		if diff := cmp.Diff(expect, out); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with NXDOMAIN and SOA in the authority", func(t *testing.T) {
+		tr := &Trace{
+			DNSLookupRaw: []*DNSLookupEvent{{
+				Domain:     "www.example.com",
+				Failure:    netxlite.NewTopLevelGenericErrWrapper(netxlite.ErrOODNSNoSuchHost),
+				Finished:   traceTime(2),
+				LookupType: "raw",
+				QueryType:  "CNAME",
+				Reply: &model.DNSReply{
+					Authority: []*model.DNSRecord{{
+						Name: "example.com.",
+						Type: "SOA",
+						TTL:  60,
+						Data: "ns.example.com. root.example.com. 1 2 3 4 5",
+					}},
+				},
+				ResolverAddress: "8.8.8.8:53",
+				ResolverNetwork: "udp",
+				Started:         traceTime(1),
+			}},
+		}
+		ttl60 := uint32(60)
+		expect := []model.ArchivalDNSLookupResult{{
+			Authority: []model.ArchivalDNSAnswer{{
+				AnswerType: "SOA",
+				Data:       "ns.example.com. root.example.com. 1 2 3 4 5",
+				TTL:        &ttl60,
+			}},
+			Engine:          "udp",
+			Failure:         failureFromString(netxlite.FailureDNSNXDOMAINError),
+			Hostname:        "www.example.com",
+			QueryType:       "CNAME",
+			ResolverAddress: "8.8.8.8:53",
+			T:               deltaSinceTraceTime(2),
+		}}
+		out := tr.NewArchivalDNSLookupResultList(traceTime(0))
+		if diff := cmp.Diff(expect, out); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with CNAME chain, authority, and additional", func(t *testing.T) {
+		tr := &Trace{
+			DNSLookupRaw: []*DNSLookupEvent{{
+				Domain:     "www.example.com",
+				Finished:   traceTime(2),
+				LookupType: "raw",
+				QueryType:  "CNAME",
+				Reply: &model.DNSReply{
+					Answer: []*model.DNSRecord{{
+						Name: "www.example.com.",
+						Type: "CNAME",
+						TTL:  300,
+						Data: "blocked.example.net.",
+					}},
+					Authority: []*model.DNSRecord{{
+						Name: "example.net.",
+						Type: "NS",
+						TTL:  3600,
+						Data: "ns.example.net.",
+					}},
+					Additional: []*model.DNSRecord{{
+						Name: "example.net.",
+						Type: "MX",
+						TTL:  3600,
+						Data: "10 mx.example.net.",
+					}},
+				},
+				ResolverAddress: "8.8.8.8:53",
+				ResolverNetwork: "udp",
+				Started:         traceTime(1),
+			}},
+		}
+		ttl300, ttl3600 := uint32(300), uint32(3600)
+		expect := []model.ArchivalDNSLookupResult{{
+			Additional: []model.ArchivalDNSAnswer{{
+				AnswerType: "MX",
+				Data:       "10 mx.example.net.",
+				TTL:        &ttl3600,
+			}},
+			Answers: []model.ArchivalDNSAnswer{{
+				AnswerType: "CNAME",
+				Hostname:   "blocked.example.net.",
+				TTL:        &ttl300,
+			}},
+			Authority: []model.ArchivalDNSAnswer{{
+				AnswerType: "NS",
+				Hostname:   "ns.example.net.",
+				TTL:        &ttl3600,
+			}},
+			Engine:          "udp",
+			Hostname:        "www.example.com",
+			QueryType:       "CNAME",
+			ResolverAddress: "8.8.8.8:53",
+			T:               deltaSinceTraceTime(2),
+		}}
+		out := tr.NewArchivalDNSLookupResultList(traceTime(0))
+		if diff := cmp.Diff(expect, out); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
 func TestTraceNewArchivalNetworkEventList(t *testing.T) {
 	type fields struct {
 		DNSLookupHTTPS []*DNSLookupEvent
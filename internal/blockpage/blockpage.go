@@ -0,0 +1,239 @@
+// Package blockpage identifies known blockpages.
+//
+// A Rule describes a known blockpage using regular expressions on the
+// body, the title, the headers, and the redirect location, as well as
+// the IP addresses of known blockpage servers and (optionally) the
+// fingerprint of the blockpage (see the pagefingerprint package). We
+// bundle a default set of rules and users can add their own rules using
+// a rules file stored inside the key-value store (see Load).
+package blockpage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/ooni/probe-cli/v3/internal/pagefingerprint"
+)
+
+// Rule is a rule matching a known blockpage. A Rule matches a Page
+// when all its nonempty conditions match the Page.
+type Rule struct {
+	// ID is the MANDATORY rule ID (e.g., "ir_01"). When several rules
+	// have the same ID, we only use the last one we loaded.
+	ID string `json:"id"`
+
+	// Description is the OPTIONAL rule description.
+	Description string `json:"description,omitempty"`
+
+	// Body is the OPTIONAL regexp matching the body.
+	Body string `json:"body,omitempty"`
+
+	// Title is the OPTIONAL regexp matching the title.
+	Title string `json:"title,omitempty"`
+
+	// Headers OPTIONALLY maps header names to regexps matching
+	// any of the values of such headers.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Location is the OPTIONAL regexp matching any redirect location.
+	Location string `json:"location,omitempty"`
+
+	// Addrs OPTIONALLY contains the IP addresses of blockpage servers. It
+	// matches if any of the Page addresses is one of these addresses.
+	Addrs []string `json:"addrs,omitempty"`
+
+	// SimHash is the OPTIONAL simhash of the blockpage's visible text.
+	SimHash uint64 `json:"simhash,string,omitempty"`
+
+	// DOMHash is the OPTIONAL hash of the blockpage's DOM. We only
+	// use it along with SimHash (see pagefingerprint.Signature).
+	DOMHash uint64 `json:"domhash,string,omitempty"`
+
+	// MaxDistance is the OPTIONAL maximum simhash distance.
+	MaxDistance int `json:"max_distance,omitempty"`
+}
+
+// Page contains what we know about a web page we fetched.
+type Page struct {
+	// Body is the body (possibly truncated).
+	Body string
+
+	// Headers contains the response headers.
+	Headers http.Header
+
+	// Locations contains the redirect locations, if any.
+	Locations []string
+
+	// Addrs contains the addresses of the server that returned this
+	// page, as well as the addresses returned by DNS.
+	Addrs []string
+}
+
+// ErrInvalidRule indicates that a rule is not valid.
+var ErrInvalidRule = errors.New("blockpage: invalid rule")
+
+// compiledRule is a Rule ready to be used.
+type compiledRule struct {
+	rule      *Rule
+	body      *regexp.Regexp
+	title     *regexp.Regexp
+	headers   map[string]*regexp.Regexp
+	location  *regexp.Regexp
+	addrs     map[string]bool
+	signature *pagefingerprint.DB
+}
+
+// compileRule compiles a rule.
+func compileRule(r *Rule) (*compiledRule, error) {
+	if r == nil || r.ID == "" {
+		return nil, fmt.Errorf("%w: missing ID", ErrInvalidRule)
+	}
+	cr := &compiledRule{rule: r}
+	var err error
+	compile := func(expr string) *regexp.Regexp {
+		if expr == "" || err != nil {
+			return nil
+		}
+		var re *regexp.Regexp
+		if re, err = regexp.Compile(expr); err != nil {
+			err = fmt.Errorf("%w: %s: %s", ErrInvalidRule, r.ID, err.Error())
+		}
+		return re
+	}
+	cr.body = compile(r.Body)
+	cr.title = compile(r.Title)
+	cr.location = compile(r.Location)
+	for key, expr := range r.Headers {
+		if cr.headers == nil {
+			cr.headers = map[string]*regexp.Regexp{}
+		}
+		cr.headers[http.CanonicalHeaderKey(key)] = compile(expr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range r.Addrs {
+		if cr.addrs == nil {
+			cr.addrs = map[string]bool{}
+		}
+		cr.addrs[addr] = true
+	}
+	if r.SimHash != 0 {
+		cr.signature = pagefingerprint.NewDB(&pagefingerprint.Signature{
+			ID:          r.ID,
+			SimHash:     r.SimHash,
+			DOMHash:     r.DOMHash,
+			MaxDistance: r.MaxDistance,
+		})
+	}
+	if cr.body == nil && cr.title == nil && cr.location == nil &&
+		cr.headers == nil && cr.addrs == nil && cr.signature == nil {
+		return nil, fmt.Errorf("%w: %s: no conditions", ErrInvalidRule, r.ID)
+	}
+	return cr, nil
+}
+
+// match returns whether the rule matches the page. The fp argument
+// is the page's fingerprint, which we compute only once.
+func (cr *compiledRule) match(page *Page, fp *pagefingerprint.Fingerprint) bool {
+	if cr.body != nil && !cr.body.MatchString(page.Body) {
+		return false
+	}
+	if cr.title != nil && (fp.Title == "" || !cr.title.MatchString(fp.Title)) {
+		return false
+	}
+	if cr.location != nil && !matchAny(cr.location, page.Locations) {
+		return false
+	}
+	for key, re := range cr.headers {
+		if !matchAny(re, page.Headers.Values(key)) {
+			return false
+		}
+	}
+	if cr.addrs != nil && !cr.matchAddrs(page.Addrs) {
+		return false
+	}
+	if cr.signature != nil && cr.signature.Match(fp) == nil {
+		return false
+	}
+	return true
+}
+
+// matchAddrs returns whether any of addrs is a blockpage server address.
+func (cr *compiledRule) matchAddrs(addrs []string) bool {
+	for _, addr := range addrs {
+		if cr.addrs[addr] {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny returns whether re matches any of the values.
+func matchAny(re *regexp.Regexp, values []string) bool {
+	for _, v := range values {
+		if re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// DB is a database of blockpage rules. A nil DB is valid and
+// does not contain any rule.
+type DB struct {
+	rules []*compiledRule
+}
+
+// NewDB creates a new DB from the given rules. When several rules
+// have the same ID, the last one replaces the previous ones. This
+// function fails if any rule is not valid.
+func NewDB(rules ...*Rule) (*DB, error) {
+	var (
+		db    = &DB{}
+		index = map[string]int{}
+	)
+	for _, r := range rules {
+		cr, err := compileRule(r)
+		if err != nil {
+			return nil, err
+		}
+		if idx, found := index[r.ID]; found {
+			db.rules[idx] = cr
+			continue
+		}
+		index[r.ID] = len(db.rules)
+		db.rules = append(db.rules, cr)
+	}
+	return db, nil
+}
+
+// Len returns the number of rules in the DB.
+func (db *DB) Len() int {
+	if db == nil {
+		return 0
+	}
+	return len(db.rules)
+}
+
+// Match returns the first rule matching the given page or nil.
+func (db *DB) Match(page *Page) *Rule {
+	if db == nil || page == nil {
+		return nil
+	}
+	fp := pagefingerprint.Compute([]byte(page.Body))
+	for _, cr := range db.rules {
+		if cr.match(page, fp) {
+			return cr.rule
+		}
+	}
+	return nil
+}
+
+// BlockingType returns the blocking type for the given rule, i.e.,
+// "blockpage:" followed by the rule ID.
+func BlockingType(r *Rule) string {
+	return "blockpage:" + r.ID
+}
@@ -0,0 +1,188 @@
+package blockpage
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ooni/probe-cli/v3/internal/pagefingerprint"
+)
+
+// sampleBlockpage is a sample blockpage.
+const sampleBlockpage = `<html><head><title>Blocked</title></head><body>
+<h1>Access denied</h1>
+<p>Access to this website has been restricted in accordance with the
+decision of the competent authority. If you believe this is a mistake
+please contact your Internet service provider customer care.</p>
+</body></html>`
+
+func TestNewDB(t *testing.T) {
+	t.Run("we reject invalid rules", func(t *testing.T) {
+		inputs := map[string]*Rule{
+			"nil rule":            nil,
+			"missing ID":          {Body: "x"},
+			"no conditions":       {ID: "xx_01"},
+			"invalid body":        {ID: "xx_01", Body: "("},
+			"invalid title":       {ID: "xx_01", Title: "["},
+			"invalid location":    {ID: "xx_01", Location: "(?"},
+			"invalid header":      {ID: "xx_01", Headers: map[string]string{"Server": "("}},
+			"invalid after valid": {ID: "xx_01", Body: "x", Title: "("},
+		}
+		for name, r := range inputs {
+			t.Run(name, func(t *testing.T) {
+				db, err := NewDB(r)
+				if !errors.Is(err, ErrInvalidRule) {
+					t.Fatal("unexpected error", err)
+				}
+				if db != nil {
+					t.Fatal("expected nil DB")
+				}
+			})
+		}
+	})
+
+	t.Run("later rules replace rules with the same ID", func(t *testing.T) {
+		first := &Rule{ID: "xx_01", Body: "first"}
+		second := &Rule{ID: "xx_02", Body: "second"}
+		replacement := &Rule{ID: "xx_01", Body: "replacement"}
+		db, err := NewDB(first, second, replacement)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if db.Len() != 2 {
+			t.Fatal("unexpected number of rules", db.Len())
+		}
+		if m := db.Match(&Page{Body: "first"}); m != nil {
+			t.Fatal("the replaced rule should not match")
+		}
+		if m := db.Match(&Page{Body: "replacement"}); m != replacement {
+			t.Fatal("the replacement rule should match")
+		}
+	})
+}
+
+func TestDBMatch(t *testing.T) {
+	sig := pagefingerprint.NewSignature("xx_05", []byte(sampleBlockpage))
+	rules := []*Rule{{
+		ID:   "xx_01",
+		Body: `decision of the competent authority`,
+	}, {
+		ID:    "xx_02",
+		Title: `^Filtered by ISP$`,
+	}, {
+		ID:      "xx_03",
+		Headers: map[string]string{"server": `^blocker/\d+`},
+	}, {
+		ID:       "xx_04",
+		Location: `^http://blocked\.example\.com/`,
+	}, {
+		ID:      "xx_05",
+		SimHash: sig.SimHash,
+		DOMHash: sig.DOMHash,
+	}, {
+		ID:    "xx_06",
+		Addrs: []string{"10.10.34.34"},
+		Body:  `iframe`,
+	}, {
+		ID:    "xx_07",
+		Addrs: []string{"10.10.34.35"},
+	}}
+	db, err := NewDB(rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		page   *Page
+		expect string
+	}{{
+		name:   "body regexp",
+		page:   &Page{Body: sampleBlockpage},
+		expect: "xx_01",
+	}, {
+		name:   "title regexp",
+		page:   &Page{Body: "<html><title>Filtered by ISP</title></html>"},
+		expect: "xx_02",
+	}, {
+		name: "header regexp",
+		page: &Page{Headers: http.Header{
+			"Server": {"nginx", "blocker/1.0"},
+		}},
+		expect: "xx_03",
+	}, {
+		name:   "redirect location",
+		page:   &Page{Locations: []string{"http://blocked.example.com/?u=x"}},
+		expect: "xx_04",
+	}, {
+		name: "page fingerprint",
+		page: &Page{Body: `<html><head><title>Blocked</title></head><body>
+<h1>Access denied</h1>
+<p>Access to this website has been restricted in accordance with the
+decision of the competent authorities. If you believe this is a mistake
+please contact your Internet service provider customer care.</p>
+</body></html>`},
+		expect: "xx_05",
+	}, {
+		name: "all conditions must match",
+		page: &Page{
+			Body:  "<html><body>nothing here</body></html>",
+			Addrs: []string{"10.10.34.34"},
+		},
+		expect: "",
+	}, {
+		name: "address and body",
+		page: &Page{
+			Body:  `<iframe src="http://10.10.34.34">`,
+			Addrs: []string{"8.8.8.8", "10.10.34.34"},
+		},
+		expect: "xx_06",
+	}, {
+		name:   "address only",
+		page:   &Page{Addrs: []string{"10.10.34.35"}},
+		expect: "xx_07",
+	}, {
+		name: "normal page",
+		page: &Page{
+			Body:      "<html><title>Example Domain</title><body>Hello</body></html>",
+			Headers:   http.Header{"Server": {"nginx"}},
+			Locations: []string{"https://www.example.com/"},
+			Addrs:     []string{"93.184.216.34"},
+		},
+		expect: "",
+	}, {
+		name:   "empty page",
+		page:   &Page{},
+		expect: "",
+	}, {
+		name:   "nil page",
+		page:   nil,
+		expect: "",
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := db.Match(tc.page)
+			switch {
+			case tc.expect == "" && m != nil:
+				t.Fatal("unexpected match", m.ID)
+			case tc.expect != "" && m == nil:
+				t.Fatal("expected a match")
+			case tc.expect != "" && m.ID != tc.expect:
+				t.Fatal("unexpected match", m.ID)
+			}
+		})
+	}
+
+	t.Run("a nil DB is empty", func(t *testing.T) {
+		var db *DB
+		if db.Len() != 0 || db.Match(&Page{Body: sampleBlockpage}) != nil {
+			t.Fatal("a nil DB should be empty")
+		}
+	})
+}
+
+func TestBlockingType(t *testing.T) {
+	if v := BlockingType(&Rule{ID: "ir_01"}); v != "blockpage:ir_01" {
+		t.Fatal("unexpected blocking type", v)
+	}
+}
@@ -0,0 +1,94 @@
+package blockpage
+
+//
+// Loading rules
+//
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// UserRulesKey is the key-value store key containing the JSON
+// list of rules provided by the user (see Load and Install).
+const UserRulesKey = "blockpage_rules.json"
+
+//go:embed rules.json
+var bundledRules []byte
+
+// Parse parses a JSON list of rules.
+func Parse(data []byte) ([]*Rule, error) {
+	var rules []*Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRule, err.Error())
+	}
+	return rules, nil
+}
+
+// Bundled returns the rules we bundle with the probe.
+func Bundled() []*Rule {
+	rules, err := Parse(bundledRules)
+	if err != nil {
+		panic(err) // we test that the bundled rules are valid
+	}
+	return rules
+}
+
+// DefaultDB returns a DB containing the bundled rules.
+func DefaultDB() *DB {
+	db, err := NewDB(Bundled()...)
+	if err != nil {
+		panic(err) // we test that the bundled rules are valid
+	}
+	return db
+}
+
+// Load returns a DB containing the bundled rules as well as the
+// rules stored by the user at UserRulesKey inside kvs. The user's rules
+// replace bundled rules having the same ID. It's fine for the key-value
+// store not to contain any user rule. This function fails if the
+// user's rules are not valid or we cannot read the key-value store.
+func Load(kvs model.KeyValueStore) (*DB, error) {
+	rules := Bundled()
+	data, err := kvs.Get(UserRulesKey)
+	switch {
+	case errors.Is(err, kvstore.ErrNoSuchKey):
+		return NewDB(rules...)
+	case err != nil:
+		return nil, err
+	}
+	user, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewDB(append(rules, user...)...)
+}
+
+// Install validates the given JSON list of rules and stores it
+// at UserRulesKey inside kvs, replacing previous user rules.
+func Install(kvs model.KeyValueStore, data []byte) error {
+	rules, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	if _, err := NewDB(rules...); err != nil {
+		return err
+	}
+	return kvs.Set(UserRulesKey, data)
+}
+
+// LoadOrDefault is like Load but, on failure, it emits a warning
+// using the given logger and returns the DefaultDB.
+func LoadOrDefault(logger model.Logger, kvs model.KeyValueStore) *DB {
+	db, err := Load(kvs)
+	if err != nil {
+		logger.Warnf("blockpage: cannot load user rules: %s", err.Error())
+		return DefaultDB()
+	}
+	return db
+}
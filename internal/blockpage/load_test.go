@@ -0,0 +1,150 @@
+package blockpage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+)
+
+func TestDefaultDB(t *testing.T) {
+	db := DefaultDB()
+	if db.Len() <= 0 || db.Len() != len(Bundled()) {
+		t.Fatal("unexpected number of bundled rules", db.Len())
+	}
+	cases := map[string]*Page{
+		"ir_01": {Body: `<html><head></head><body><iframe src="http://10.10.34.34?type=Invalid Site&policy=MainPolicy " style="width: 100%; height: 100%" scrolling="no" marginwidth="0" marginheight="0" frameborder="0" vspace="0" hspace="0"></iframe></body></html>`},
+		"ir_02": {Addrs: []string{"10.10.34.36"}},
+		"tr_01": {Body: `<html><head><title>Telekomünikasyon İletişim Başkanlığı</title></head></html>`},
+		"gr_01": {Locations: []string{"http://www.gamingcommission.gov.gr/index.php/forbidden-access-black-list/"}},
+		"id_01": {Locations: []string{"http://internet-positif.info/"}},
+	}
+	for id, page := range cases {
+		t.Run(id, func(t *testing.T) {
+			m := db.Match(page)
+			if m == nil || m.ID != id {
+				t.Fatal("unexpected match", m)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("without user rules", func(t *testing.T) {
+		db, err := Load(&kvstore.Memory{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if db.Len() != DefaultDB().Len() {
+			t.Fatal("unexpected number of rules", db.Len())
+		}
+	})
+
+	t.Run("with user rules", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		err := Install(kvs, []byte(`[
+			{"id": "xx_01", "body": "blocked by xx"},
+			{"id": "ir_02", "addrs": ["10.10.34.37"]}
+		]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		db, err := Load(kvs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if db.Len() != DefaultDB().Len()+1 {
+			t.Fatal("unexpected number of rules", db.Len())
+		}
+		if m := db.Match(&Page{Body: "blocked by xx"}); m == nil || m.ID != "xx_01" {
+			t.Fatal("the user rule should match", m)
+		}
+		if m := db.Match(&Page{Addrs: []string{"10.10.34.34"}}); m != nil {
+			t.Fatal("the user rule should replace the bundled rule", m.ID)
+		}
+		if m := db.Match(&Page{Addrs: []string{"10.10.34.37"}}); m == nil || m.ID != "ir_02" {
+			t.Fatal("the user rule should match", m)
+		}
+	})
+
+	t.Run("with invalid user rules", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		if err := kvs.Set(UserRulesKey, []byte(`[{"id": "xx_01"}]`)); err != nil {
+			t.Fatal(err)
+		}
+		db, err := Load(kvs)
+		if !errors.Is(err, ErrInvalidRule) || db != nil {
+			t.Fatal("unexpected result", db, err)
+		}
+	})
+
+	t.Run("with invalid JSON", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		if err := kvs.Set(UserRulesKey, []byte(`{`)); err != nil {
+			t.Fatal(err)
+		}
+		db, err := Load(kvs)
+		if !errors.Is(err, ErrInvalidRule) || db != nil {
+			t.Fatal("unexpected result", db, err)
+		}
+	})
+
+	t.Run("when we cannot read the key-value store", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		kvs := &mockableKVStore{err: expected}
+		db, err := Load(kvs)
+		if !errors.Is(err, expected) || db != nil {
+			t.Fatal("unexpected result", db, err)
+		}
+	})
+}
+
+func TestInstall(t *testing.T) {
+	t.Run("we do not store invalid rules", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		inputs := []string{`{`, `[{"id": "xx_01", "body": "("}]`}
+		for _, input := range inputs {
+			if err := Install(kvs, []byte(input)); !errors.Is(err, ErrInvalidRule) {
+				t.Fatal("unexpected error", err)
+			}
+		}
+		if _, err := kvs.Get(UserRulesKey); !errors.Is(err, kvstore.ErrNoSuchKey) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+}
+
+// mockableKVStore is a key-value store that always fails.
+type mockableKVStore struct {
+	err error
+}
+
+func (kvs *mockableKVStore) Get(key string) ([]byte, error) {
+	return nil, kvs.err
+}
+
+func (kvs *mockableKVStore) Set(key string, value []byte) error {
+	return kvs.err
+}
+
+func TestLoadOrDefault(t *testing.T) {
+	t.Run("on success", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		if err := Install(kvs, []byte(`[{"id": "xx_01", "body": "x"}]`)); err != nil {
+			t.Fatal(err)
+		}
+		db := LoadOrDefault(log.Log, kvs)
+		if db.Len() != DefaultDB().Len()+1 {
+			t.Fatal("unexpected number of rules", db.Len())
+		}
+	})
+
+	t.Run("on failure", func(t *testing.T) {
+		kvs := &mockableKVStore{err: errors.New("mocked error")}
+		db := LoadOrDefault(log.Log, kvs)
+		if db.Len() != DefaultDB().Len() {
+			t.Fatal("unexpected number of rules", db.Len())
+		}
+	})
+}
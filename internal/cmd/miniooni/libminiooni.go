@@ -17,11 +17,13 @@ import (
 	"github.com/apex/log"
 	"github.com/ooni/probe-cli/v3/internal/engine"
 	"github.com/ooni/probe-cli/v3/internal/engine/legacy/assetsdir"
+	"github.com/ooni/probe-cli/v3/internal/engine/submitqueue"
 	"github.com/ooni/probe-cli/v3/internal/humanize"
 	"github.com/ooni/probe-cli/v3/internal/kvstore"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 	"github.com/ooni/probe-cli/v3/internal/netxlite/filtering"
+	"github.com/ooni/probe-cli/v3/internal/netxlite/replay"
 	"github.com/ooni/probe-cli/v3/internal/runtimex"
 	"github.com/ooni/probe-cli/v3/internal/version"
 	"github.com/pborman/getopt/v2"
@@ -39,10 +41,14 @@ type Options struct {
 	MaxRuntime       int64
 	NoJSON           bool
 	NoCollector      bool
+	Parallelism      int64
 	ProbeServicesURL string
 	Proxy            string
 	Random           bool
+	Record           string
+	Replay           string
 	ReportFile       string
+	Resume           bool
 	TorArgs          []string
 	TorBinary        string
 	Tunnel           string
@@ -75,7 +81,8 @@ func init() {
 	)
 	getopt.FlagLong(
 		&globalOptions.InputFilePaths, "input-file", 'f',
-		"Path to input file to supply test-dependent input. File must contain one input per line.", "PATH",
+		"Path to input file to supply test-dependent input. File must contain one input per line "+
+			"or, for .jsonl and .csv files, one input with category, country, and options per line.", "PATH",
 	)
 	getopt.FlagLong(
 		&globalOptions.HomeDir, "home", 0,
@@ -99,6 +106,10 @@ func init() {
 	getopt.FlagLong(
 		&globalOptions.NoCollector, "no-collector", 'n', "Don't use a collector",
 	)
+	getopt.FlagLong(
+		&globalOptions.Parallelism, "parallelism", 0,
+		"Number of inputs to measure concurrently (zero or one means sequentially)", "N",
+	)
 	getopt.FlagLong(
 		&globalOptions.ProbeServicesURL, "probe-services", 0,
 		"Set the URL of the probe-services instance you want to use", "URL",
@@ -109,10 +120,22 @@ func init() {
 	getopt.FlagLong(
 		&globalOptions.Random, "random", 0, "Randomize inputs",
 	)
+	getopt.FlagLong(
+		&globalOptions.Record, "record", 0,
+		"Records the network activity into FILE for later replay", "FILE",
+	)
+	getopt.FlagLong(
+		&globalOptions.Replay, "replay", 0,
+		"Replays the network activity recorded into FILE using --record", "FILE",
+	)
 	getopt.FlagLong(
 		&globalOptions.ReportFile, "reportfile", 'o',
 		"Set the report file path", "PATH",
 	)
+	getopt.FlagLong(
+		&globalOptions.Resume, "resume", 0,
+		"Resume the previous run of this experiment if it was interrupted",
+	)
 	getopt.FlagLong(
 		&globalOptions.TorArgs, "tor-args", 0,
 		"Extra args for tor binary (may be specified multiple times)",
@@ -327,6 +350,21 @@ func MainWithConfiguration(experimentName string, currentOptions Options) {
 		currentOptions.NoCollector = true
 	}
 
+	if currentOptions.Replay != "" {
+		replayer, err := replay.NewReplayerFromFile(currentOptions.Replay)
+		runtimex.PanicOnError(err, "cannot parse --replay file")
+		netxlite.TProxy = replayer
+		log.Infof("miniooni: disabling submission with --replay to avoid pulluting OONI data")
+		currentOptions.NoCollector = true
+	}
+
+	if currentOptions.Record != "" {
+		filep, err := os.Create(currentOptions.Record)
+		runtimex.PanicOnError(err, "cannot create --record file")
+		defer filep.Close()
+		netxlite.TProxy = replay.NewRecorder(netxlite.TProxy, filep)
+	}
+
 	//Mon Jan 2 15:04:05 -0700 MST 2006
 	log.Infof("Current time: %s", time.Now().Format("2006-01-02 15:04:05 MST"))
 
@@ -410,26 +448,46 @@ func MainWithConfiguration(experimentName string, currentOptions Options) {
 	builder, err := sess.NewExperimentBuilder(experimentName)
 	fatalOnError(err, "cannot create experiment builder")
 
-	inputLoader := &engine.InputLoader{
-		CheckInConfig: &model.OOAPICheckInConfig{
-			RunType:  "manual",
-			OnWiFi:   true, // meaning: not on 4G
-			Charging: true,
-		},
+	checkpointer := engine.NewCheckpointer(engine.CheckpointerConfig{
 		ExperimentName: experimentName,
-		InputPolicy:    builder.InputPolicy(),
-		StaticInputs:   currentOptions.Inputs,
-		SourceFiles:    currentOptions.InputFilePaths,
-		Session:        sess,
+		KVStore:        sess.KeyValueStore(),
+	})
+	checkpoint := &engine.Checkpoint{}
+	if currentOptions.Resume {
+		checkpoint, err = checkpointer.LoadCheckpoint()
+		if errors.Is(err, engine.ErrNoCheckpoint) {
+			log.Info("no interrupted run to resume; starting a new run")
+			checkpoint, err = &engine.Checkpoint{}, nil
+		}
+		fatalOnError(err, "cannot load checkpoint")
 	}
-	inputs, err := inputLoader.Load(context.Background())
-	fatalOnError(err, "cannot load inputs")
-
-	if currentOptions.Random {
-		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
-		rnd.Shuffle(len(inputs), func(i, j int) {
-			inputs[i], inputs[j] = inputs[j], inputs[i]
-		})
+
+	inputs := checkpoint.Inputs
+	if len(inputs) > 0 {
+		log.Infof("resuming the previous run: %d/%d inputs already measured",
+			len(checkpoint.Completed), len(inputs))
+	} else {
+		inputLoader := &engine.InputLoader{
+			CheckInConfig: &model.OOAPICheckInConfig{
+				RunType:  "manual",
+				OnWiFi:   true, // meaning: not on 4G
+				Charging: true,
+			},
+			ExperimentName: experimentName,
+			InputPolicy:    builder.InputPolicy(),
+			StaticInputs:   currentOptions.Inputs,
+			SourceFiles:    currentOptions.InputFilePaths,
+			Session:        sess,
+		}
+		inputs, err = inputLoader.Load(context.Background())
+		fatalOnError(err, "cannot load inputs")
+
+		if currentOptions.Random {
+			rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+			rnd.Shuffle(len(inputs), func(i, j int) {
+				inputs[i], inputs[j] = inputs[j], inputs[i]
+			})
+		}
 	}
 
 	err = builder.SetOptionsGuessType(extraOptions)
@@ -444,9 +502,11 @@ func MainWithConfiguration(experimentName string, currentOptions Options) {
 	}()
 
 	submitter, err := engine.NewSubmitter(ctx, engine.SubmitterConfig{
-		Enabled: !currentOptions.NoCollector,
-		Session: sess,
-		Logger:  log.Log,
+		Enabled:  !currentOptions.NoCollector,
+		Session:  sess,
+		Logger:   log.Log,
+		Queue:    sess.SubmitQueue(),
+		ReportID: checkpoint.ReportID,
 	})
 	fatalOnError(err, "cannot create submitter")
 
@@ -459,21 +519,54 @@ func MainWithConfiguration(experimentName string, currentOptions Options) {
 	fatalOnError(err, "cannot create saver")
 
 	inputProcessor := &engine.InputProcessor{
-		Annotations: annotations,
+		Annotations:  annotations,
+		Checkpointer: checkpointer,
+		Completed:    checkpoint.Completed,
 		Experiment: &experimentWrapper{
 			child: engine.NewInputProcessorExperimentWrapper(experiment),
 			total: len(inputs),
 		},
 		Inputs:     inputs,
 		MaxRuntime: time.Duration(currentOptions.MaxRuntime) * time.Second,
-		Options:    currentOptions.ExtraOptions,
-		Saver:      engine.NewInputProcessorSaverWrapper(saver),
+		NewExperimentWithOptions: func(
+			options map[string]string) (engine.InputProcessorExperimentWrapper, error) {
+			experiment, err := builder.NewExperimentWithOptions(options)
+			if err != nil {
+				return nil, err
+			}
+			return &experimentWrapper{
+				child: engine.NewInputProcessorExperimentWrapper(experiment),
+				total: len(inputs),
+			}, nil
+		},
+		Options:     currentOptions.ExtraOptions,
+		Parallelism: int(currentOptions.Parallelism),
+		Saver:       engine.NewInputProcessorSaverWrapper(saver),
 		Submitter: submitterWrapper{
 			child: engine.NewInputProcessorSubmitterWrapper(submitter),
 		},
 	}
 	err = inputProcessor.Run(ctx)
 	fatalOnError(err, "inputProcessor.Run failed")
+
+	if !currentOptions.NoCollector {
+		flushSubmitQueue(ctx, sess.SubmitQueue())
+	}
+}
+
+// flushSubmitQueue submits the measurements that we previously
+// failed to submit and logs how many of them are still pending.
+func flushSubmitQueue(ctx context.Context, queue *submitqueue.Queue) {
+	submitted, err := queue.Flush(ctx)
+	warnOnError(err, "cannot flush the submission queue")
+	if submitted > 0 {
+		log.Infof("submitted %d previously queued measurements", submitted)
+	}
+	pending, err := queue.Pending()
+	warnOnError(err, "cannot read the submission queue")
+	if pending > 0 {
+		log.Infof("%d measurements are queued for later submission", pending)
+	}
 }
 
 type experimentWrapper struct {
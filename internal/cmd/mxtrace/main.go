@@ -0,0 +1,37 @@
+// Command mxtrace converts the JSONL events file written by measurex
+// (e.g., using `miniooni -O EventsFile=FILE websteps`) into a Chrome
+// trace you can load into chrome://tracing or Perfetto.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+)
+
+func fatalOnError(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	input := flag.String("input", "", "JSONL events file to read")
+	output := flag.String("output", "trace.json", "Chrome trace file to write")
+	flag.Parse()
+	if *input == "" {
+		log.Fatal("You MUST specify `-input FILE`")
+	}
+	filep, err := os.Open(*input)
+	fatalOnError(err)
+	defer filep.Close()
+	m, err := measurex.ReadJSONLMeasurement(filep)
+	fatalOnError(err)
+	outfp, err := os.Create(*output)
+	fatalOnError(err)
+	_, err = measurex.NewChromeTrace(m).WriteTo(outfp)
+	fatalOnError(err)
+	fatalOnError(outfp.Close())
+}
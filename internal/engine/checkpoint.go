@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// Checkpoint contains the progress of a run, which allows us
+// to resume the run if it has been interrupted.
+type Checkpoint struct {
+	// Completed contains the indexes of the completed inputs.
+	Completed []int `json:"completed"`
+
+	// Inputs contains the inputs of the run. We need to store them
+	// because the check-in API may return different inputs each time.
+	Inputs []model.OOAPIURLInfo `json:"inputs"`
+
+	// ReportID is the ID of the report where we submitted the
+	// measurements, or empty if we did not submit any.
+	ReportID string `json:"report_id"`
+}
+
+// ErrNoCheckpoint indicates that there is no checkpoint to resume.
+var ErrNoCheckpoint = errors.New("checkpoint: no checkpoint to resume")
+
+// CheckpointerConfig contains settings for NewCheckpointer.
+type CheckpointerConfig struct {
+	// ExperimentName is the MANDATORY name of the experiment. We
+	// keep a distinct checkpoint for each experiment.
+	ExperimentName string
+
+	// KVStore is the MANDATORY key-value store.
+	KVStore model.KeyValueStore
+}
+
+// Checkpointer stores the Checkpoint of a run into a key-value store.
+type Checkpointer struct {
+	config CheckpointerConfig
+}
+
+// NewCheckpointer creates a new Checkpointer instance.
+func NewCheckpointer(config CheckpointerConfig) *Checkpointer {
+	return &Checkpointer{config: config}
+}
+
+// key returns the key where we store the checkpoint.
+func (c *Checkpointer) key() string {
+	return fmt.Sprintf("checkpoint.%s.state", c.config.ExperimentName)
+}
+
+// LoadCheckpoint loads the checkpoint saved by a previous run. This
+// function returns ErrNoCheckpoint if there is no such checkpoint.
+func (c *Checkpointer) LoadCheckpoint() (*Checkpoint, error) {
+	data, err := c.config.KVStore.Get(c.key())
+	if errors.Is(err, kvstore.ErrNoSuchKey) {
+		return nil, ErrNoCheckpoint
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp *Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	if cp == nil {
+		return nil, ErrNoCheckpoint // cleared by ClearCheckpoint
+	}
+	return cp, nil
+}
+
+// SaveCheckpoint saves the checkpoint of the current run.
+func (c *Checkpointer) SaveCheckpoint(cp *Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return c.config.KVStore.Set(c.key(), data)
+}
+
+// ClearCheckpoint clears the checkpoint once the run is complete.
+func (c *Checkpointer) ClearCheckpoint() error {
+	return c.config.KVStore.Set(c.key(), []byte("null"))
+}
@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+type FakeFailingKVStore struct {
+	Err error
+}
+
+func (ffkvs *FakeFailingKVStore) Get(key string) ([]byte, error) {
+	return nil, ffkvs.Err
+}
+
+func (ffkvs *FakeFailingKVStore) Set(key string, value []byte) error {
+	return ffkvs.Err
+}
+
+func TestCheckpointer(t *testing.T) {
+	t.Run("save, load, and clear", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		checkpointer := NewCheckpointer(CheckpointerConfig{
+			ExperimentName: "web_connectivity",
+			KVStore:        kvs,
+		})
+		if _, err := checkpointer.LoadCheckpoint(); !errors.Is(err, ErrNoCheckpoint) {
+			t.Fatal("not the error we expected", err)
+		}
+		expected := &Checkpoint{
+			Completed: []int{0, 2},
+			Inputs: []model.OOAPIURLInfo{{
+				CategoryCode: "NEWS",
+				CountryCode:  "IT",
+				URL:          "https://www.example.com/",
+			}},
+			ReportID: "xx",
+		}
+		if err := checkpointer.SaveCheckpoint(expected); err != nil {
+			t.Fatal(err)
+		}
+		// we keep a distinct checkpoint for each experiment
+		other := NewCheckpointer(CheckpointerConfig{ExperimentName: "example", KVStore: kvs})
+		if _, err := other.LoadCheckpoint(); !errors.Is(err, ErrNoCheckpoint) {
+			t.Fatal("not the error we expected", err)
+		}
+		cp, err := checkpointer.LoadCheckpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expected, cp); diff != "" {
+			t.Fatal(diff)
+		}
+		if err := checkpointer.ClearCheckpoint(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := checkpointer.LoadCheckpoint(); !errors.Is(err, ErrNoCheckpoint) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+
+	t.Run("with a failing key-value store", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		checkpointer := NewCheckpointer(CheckpointerConfig{
+			ExperimentName: "example",
+			KVStore:        &FakeFailingKVStore{Err: expected},
+		})
+		if _, err := checkpointer.LoadCheckpoint(); !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+		if err := checkpointer.SaveCheckpoint(&Checkpoint{}); !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+
+	t.Run("with a corrupt checkpoint", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		checkpointer := NewCheckpointer(CheckpointerConfig{ExperimentName: "example", KVStore: kvs})
+		if err := kvs.Set("checkpoint.example.state", []byte("{")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := checkpointer.LoadCheckpoint(); err == nil {
+			t.Fatal("expected an error here")
+		}
+	})
+}
@@ -282,6 +282,44 @@ func (e *Experiment) OpenReportContext(ctx context.Context) error {
 	if e.report != nil {
 		return nil // already open
 	}
+	client, err := e.newProbeServicesClient(ctx)
+	if err != nil {
+		return err
+	}
+	template := e.newReportTemplate()
+	e.report, err = client.OpenReport(ctx, template)
+	if err != nil {
+		e.session.logger.Debugf("experiment: probe services error: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// ResumeReportContext is like OpenReportContext except that it
+// tries to reuse the report with the given reportID, which a previous
+// run has opened (see Checkpoint). This function fails if such
+// a report is not open anymore, and then you should fallback to
+// calling OpenReportContext to open a new report.
+func (e *Experiment) ResumeReportContext(ctx context.Context, reportID string) error {
+	if e.report != nil {
+		return nil // already open
+	}
+	client, err := e.newProbeServicesClient(ctx)
+	if err != nil {
+		return err
+	}
+	template := e.newReportTemplate()
+	e.report, err = client.ResumeReport(ctx, reportID, template)
+	if err != nil {
+		e.session.logger.Debugf("experiment: probe services error: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// newProbeServicesClient creates a new probe services client
+// that accounts for the bytes sent and received.
+func (e *Experiment) newProbeServicesClient(ctx context.Context) (*probeservices.Client, error) {
 	// use custom client to have proper byte accounting
 	httpClient := &http.Client{
 		Transport: &httptransport.ByteCountingTransport{
@@ -292,16 +330,10 @@ func (e *Experiment) OpenReportContext(ctx context.Context) error {
 	client, err := e.session.NewProbeServicesClient(ctx)
 	if err != nil {
 		e.session.logger.Debugf("%+v", err)
-		return err
+		return nil, err
 	}
 	client.HTTPClient = httpClient // patch HTTP client to use
-	template := e.newReportTemplate()
-	e.report, err = client.OpenReport(ctx, template)
-	if err != nil {
-		e.session.logger.Debugf("experiment: probe services error: %s", err.Error())
-		return err
-	}
-	return nil
+	return client, nil
 }
 
 func (e *Experiment) newReportTemplate() probeservices.ReportTemplate {
@@ -13,6 +13,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/atomicx"
 	"github.com/ooni/probe-cli/v3/internal/engine/experiment/urlgetter"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx"
@@ -24,7 +25,7 @@ import (
 
 const (
 	testName      = "dnscheck"
-	testVersion   = "0.9.0"
+	testVersion   = "0.9.4"
 	defaultDomain = "example.org"
 )
 
@@ -74,9 +75,11 @@ func (e *Endpoints) maybeRegister(resolverURL string) {
 // Config contains the experiment's configuration.
 type Config struct {
 	DefaultAddrs  string `json:"default_addrs" ooni:"default addresses for domain"`
+	DNSSEC        bool   `json:"dnssec" ooni:"validate the replies using DNSSEC"`
 	Domain        string `json:"domain" ooni:"domain to resolve using the specified resolver"`
 	HTTP3Enabled  bool   `json:"http3_enabled" ooni:"use http3 instead of http/1.1 or http2"`
 	HTTPHost      string `json:"http_host" ooni:"force using specific HTTP Host header"`
+	QueryType     string `json:"query_type" ooni:"DNS query type to use (e.g. 'CNAME'); default: A and AAAA"`
 	TLSServerName string `json:"tls_server_name" ooni:"force TLS to using a specific SNI in Client Hello"`
 	TLSVersion    string `json:"tls_version" ooni:"Force specific TLS version (e.g. 'TLSv1.3')"`
 }
@@ -84,9 +87,11 @@ type Config struct {
 // TestKeys contains the results of the dnscheck experiment.
 type TestKeys struct {
 	DefaultAddrs     string                        `json:"x_default_addrs"`
+	DNSSEC           bool                          `json:"x_dnssec,omitempty"`
 	Domain           string                        `json:"domain"`
 	HTTP3Enabled     bool                          `json:"x_http3_enabled,omitempty"`
 	HTTPHost         string                        `json:"x_http_host,omitempty"`
+	QueryType        string                        `json:"x_query_type,omitempty"`
 	TLSServerName    string                        `json:"x_tls_server_name,omitempty"`
 	TLSVersion       string                        `json:"x_tls_version,omitempty"`
 	Bootstrap        *urlgetter.TestKeys           `json:"bootstrap"`
@@ -117,6 +122,7 @@ var (
 	ErrInputRequired        = errors.New("this experiment needs input")
 	ErrInvalidURL           = errors.New("the input URL is invalid")
 	ErrUnsupportedURLScheme = errors.New("unsupported URL scheme")
+	ErrUnsupportedQueryType = errors.New("unsupported DNS query type")
 )
 
 // Run implements model.ExperimentSession.Run
@@ -137,9 +143,11 @@ func (m *Measurer) Run(
 		domain = defaultDomain
 	}
 	tk.DefaultAddrs = m.Config.DefaultAddrs
+	tk.DNSSEC = m.Config.DNSSEC
 	tk.Domain = domain
 	tk.HTTP3Enabled = m.Config.HTTP3Enabled
 	tk.HTTPHost = m.Config.HTTPHost
+	tk.QueryType = m.Config.QueryType
 	tk.TLSServerName = m.Config.TLSServerName
 	tk.TLSVersion = m.Config.TLSVersion
 
@@ -153,11 +161,16 @@ func (m *Measurer) Run(
 		return fmt.Errorf("%w: %s", ErrInvalidURL, err.Error())
 	}
 	switch URL.Scheme {
-	case "https", "dot", "udp", "tcp":
+	case "https", "h3", "dot", "udp", "tcp", "quic":
 		// all good
 	default:
 		return ErrUnsupportedURLScheme
 	}
+	if m.Config.QueryType != "" {
+		if _, found := dns.StringToType[strings.ToUpper(m.Config.QueryType)]; !found {
+			return ErrUnsupportedQueryType
+		}
+	}
 
 	// Implementation note: we must not return an error from now now. Returning an
 	// error means that we don't have a measurement to submit.
@@ -207,6 +220,8 @@ func (m *Measurer) Run(
 		inputs = append(inputs, urlgetter.MultiInput{
 			Config: urlgetter.Config{
 				DNSHTTPHost:      m.httpHost(URL.Host),
+				DNSQueryType:     m.Config.QueryType,
+				DNSSEC:           m.Config.DNSSEC,
 				DNSTLSServerName: m.tlsServerName(URL.Hostname()),
 				DNSTLSVersion:    m.Config.TLSVersion,
 				HTTP3Enabled:     m.Config.HTTP3Enabled,
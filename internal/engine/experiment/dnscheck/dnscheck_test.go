@@ -49,7 +49,7 @@ func TestExperimentNameAndVersion(t *testing.T) {
 	if measurer.ExperimentName() != "dnscheck" {
 		t.Error("unexpected experiment name")
 	}
-	if measurer.ExperimentVersion() != "0.9.0" {
+	if measurer.ExperimentVersion() != "0.9.4" {
 		t.Error("unexpected experiment version")
 	}
 }
@@ -93,6 +93,19 @@ func TestDNSCheckFailsWithUnsupportedProtocol(t *testing.T) {
 	}
 }
 
+func TestDNSCheckFailsWithUnsupportedQueryType(t *testing.T) {
+	measurer := NewExperimentMeasurer(Config{QueryType: "ANTANI"})
+	err := measurer.Run(
+		context.Background(),
+		newsession(),
+		&model.Measurement{Input: "dot://one.one.one.one"},
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if !errors.Is(err, ErrUnsupportedQueryType) {
+		t.Fatal("expected unsupported query type error")
+	}
+}
+
 func TestWithCancelledContext(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // immediately cancel the context
@@ -118,6 +131,141 @@ func TestWithCancelledContext(t *testing.T) {
 	}
 }
 
+func TestWithCancelledContextAndQUIC(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // immediately cancel the context
+	measurer := NewExperimentMeasurer(Config{
+		DefaultAddrs: "1.1.1.1 1.0.0.1",
+	})
+	measurement := &model.Measurement{Input: "quic://dns.adguard.com"}
+	err := measurer.Run(
+		ctx,
+		newsession(),
+		measurement,
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := measurement.TestKeys.(*TestKeys)
+	for _, URL := range []string{"quic://1.1.1.1", "quic://1.0.0.1"} {
+		lookup, found := tk.Lookups[URL]
+		if !found {
+			t.Fatal("missing lookup for", URL)
+		}
+		if len(lookup.Queries) <= 0 {
+			t.Fatal("expected some queries for", URL)
+		}
+		for _, query := range lookup.Queries {
+			// The "doq" engine means we've been using DNSOverQUIC
+			if query.Engine != "doq" {
+				t.Fatal("unexpected engine", query.Engine)
+			}
+		}
+	}
+}
+
+func TestWithCancelledContextAndH3(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // immediately cancel the context
+	measurer := NewExperimentMeasurer(Config{
+		DefaultAddrs: "1.1.1.1 1.0.0.1",
+	})
+	measurement := &model.Measurement{Input: "h3://cloudflare-dns.com/dns-query"}
+	err := measurer.Run(
+		ctx,
+		newsession(),
+		measurement,
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := measurement.TestKeys.(*TestKeys)
+	for _, URL := range []string{"h3://1.1.1.1/dns-query", "h3://1.0.0.1/dns-query"} {
+		lookup, found := tk.Lookups[URL]
+		if !found {
+			t.Fatal("missing lookup for", URL)
+		}
+		if len(lookup.Queries) <= 0 {
+			t.Fatal("expected some queries for", URL)
+		}
+		for _, query := range lookup.Queries {
+			// The "doh3" engine means we've been using DNSOverHTTP3
+			if query.Engine != "doh3" {
+				t.Fatal("unexpected engine", query.Engine)
+			}
+		}
+	}
+}
+
+func TestWithCancelledContextAndQueryType(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // immediately cancel the context
+	measurer := NewExperimentMeasurer(Config{
+		DefaultAddrs: "1.1.1.1 1.0.0.1",
+		QueryType:    "CNAME",
+	})
+	measurement := &model.Measurement{Input: "dot://one.one.one.one"}
+	err := measurer.Run(
+		ctx,
+		newsession(),
+		measurement,
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := measurement.TestKeys.(*TestKeys)
+	if tk.QueryType != "CNAME" {
+		t.Fatal("unexpected query type")
+	}
+	for _, URL := range []string{"dot://1.1.1.1", "dot://1.0.0.1"} {
+		lookup, found := tk.Lookups[URL]
+		if !found {
+			t.Fatal("missing lookup for", URL)
+		}
+		if len(lookup.Queries) != 1 {
+			t.Fatal("expected a single query for", URL)
+		}
+		if lookup.Queries[0].QueryType != "CNAME" {
+			t.Fatal("unexpected query type", lookup.Queries[0].QueryType)
+		}
+	}
+}
+
+func TestWithCancelledContextAndDNSSEC(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // immediately cancel the context
+	measurer := NewExperimentMeasurer(Config{
+		DefaultAddrs: "1.1.1.1 1.0.0.1",
+		DNSSEC:       true,
+	})
+	measurement := &model.Measurement{Input: "dot://one.one.one.one"}
+	err := measurer.Run(
+		ctx,
+		newsession(),
+		measurement,
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := measurement.TestKeys.(*TestKeys)
+	if !tk.DNSSEC {
+		t.Fatal("unexpected DNSSEC value")
+	}
+	for _, URL := range []string{"dot://1.1.1.1", "dot://1.0.0.1"} {
+		lookup, found := tk.Lookups[URL]
+		if !found {
+			t.Fatal("missing lookup for", URL)
+		}
+		if lookup.Failure == nil {
+			t.Fatal("expected a failure for", URL)
+		}
+	}
+}
+
 func TestMakeResolverURL(t *testing.T) {
 	// test address substitution
 	addr := "255.255.255.0"
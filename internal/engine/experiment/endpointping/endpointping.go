@@ -0,0 +1,191 @@
+// Package endpointping contains the endpointping experiment.
+//
+// This experiment measures an endpoint repeatedly, like ping, to
+// detect censors that block probabilistically or only after N
+// connections. The input is an URL such as tcp://8.8.8.8:443 (TCP
+// connect), tls://8.8.8.8:443 (TCP connect and TLS handshake),
+// or quic://8.8.8.8:443 (QUIC handshake).
+//
+// This experiment does not follow any existing spec.
+package endpointping
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+const (
+	testName    = "endpointping"
+	testVersion = "0.1.0"
+)
+
+// Config contains the experiment config.
+type Config struct {
+	ALPN        string `ooni:"Comma separated list of ALPNs for tls:// and quic://"`
+	Repetitions int64  `ooni:"Number of times we measure the endpoint"`
+	Delay       int64  `ooni:"Milliseconds to wait between repetitions"`
+	SNI         string `ooni:"SNI to use for tls:// and quic://"`
+}
+
+// DefaultRepetitions is the default number of repetitions.
+const DefaultRepetitions = 10
+
+// DefaultDelay is the default delay between repetitions.
+const DefaultDelay = time.Second
+
+func (c Config) repetitions() int {
+	if c.Repetitions > 0 {
+		return int(c.Repetitions)
+	}
+	return DefaultRepetitions
+}
+
+func (c Config) delay() time.Duration {
+	if c.Delay > 0 {
+		return time.Duration(c.Delay) * time.Millisecond
+	}
+	return DefaultDelay
+}
+
+func (c Config) alpn(network measurex.EndpointNetwork) []string {
+	if c.ALPN != "" {
+		return strings.Split(c.ALPN, ",")
+	}
+	if network == measurex.NetworkQUIC {
+		return []string{"h3"}
+	}
+	return []string{"h2", "http/1.1"}
+}
+
+// TestKeys contains the experiment's test keys.
+type TestKeys struct {
+	*measurex.ArchivalRepeatedEndpointMeasurement
+}
+
+// Measurer performs the measurement.
+type Measurer struct {
+	Config Config
+}
+
+// NewExperimentMeasurer creates a new ExperimentMeasurer.
+func NewExperimentMeasurer(config Config) model.ExperimentMeasurer {
+	return &Measurer{Config: config}
+}
+
+// ExperimentName implements ExperimentMeasurer.ExperimentName.
+func (m *Measurer) ExperimentName() string {
+	return testName
+}
+
+// ExperimentVersion implements ExperimentMeasurer.ExperimentVersion.
+func (m *Measurer) ExperimentVersion() string {
+	return testVersion
+}
+
+var (
+	// errMissingInput means that the user did not provide any input.
+	errMissingInput = errors.New("endpointping: missing input")
+
+	// errUnsupportedURLScheme means we don't support the URL scheme.
+	errUnsupportedURLScheme = errors.New("endpointping: unsupported URL scheme")
+
+	// errInvalidEndpoint means the URL does not contain an IP:port endpoint.
+	errInvalidEndpoint = errors.New("endpointping: URL host is not IP:port")
+)
+
+// parseInput converts the input into a RepeatedEndpoint.
+func (m *Measurer) parseInput(input string) (*measurex.RepeatedEndpoint, error) {
+	if input == "" {
+		return nil, errMissingInput
+	}
+	URL, err := url.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	addr, port, err := net.SplitHostPort(URL.Host)
+	if err != nil || port == "" || net.ParseIP(addr) == nil {
+		return nil, errInvalidEndpoint
+	}
+	epnt := &measurex.RepeatedEndpoint{Address: URL.Host}
+	switch URL.Scheme {
+	case "tcp":
+		epnt.Network = measurex.NetworkTCP
+		return epnt, nil
+	case "tls":
+		epnt.Network = measurex.NetworkTCP
+	case "quic":
+		epnt.Network = measurex.NetworkQUIC
+	default:
+		return nil, errUnsupportedURLScheme
+	}
+	epnt.TLSConfig = &tls.Config{
+		ServerName:         m.Config.SNI,
+		NextProtos:         m.Config.alpn(epnt.Network),
+		RootCAs:            netxlite.NewDefaultCertPool(),
+		InsecureSkipVerify: m.Config.SNI == "",
+	}
+	return epnt, nil
+}
+
+// Run implements ExperimentMeasurer.Run.
+func (m *Measurer) Run(
+	ctx context.Context, sess model.ExperimentSession,
+	measurement *model.Measurement, callbacks model.ExperimentCallbacks,
+) error {
+	archival.ExtNetevents.AddTo(measurement)
+	archival.ExtTCPConnect.AddTo(measurement)
+	archival.ExtTLSHandshake.AddTo(measurement)
+	epnt, err := m.parseInput(string(measurement.Input))
+	if err != nil {
+		return err
+	}
+	mx := measurex.NewMeasurerWithDefaultSettings()
+	mx.Logger = sess.Logger()
+	mx.HTTPClient = sess.DefaultHTTPClient()
+	mx.TLSHandshaker = netxlite.NewTLSHandshakerStdlib(sess.Logger())
+	callbacks.OnProgress(0, fmt.Sprintf("endpointping: measuring: %s...", epnt.Address))
+	rm, err := mx.RepeatEndpoint(ctx, epnt, m.Config.repetitions(), m.Config.delay())
+	if err != nil {
+		return err
+	}
+	callbacks.OnProgress(1, fmt.Sprintf(
+		"endpointping: success rate: %.2f", rm.Stats.SuccessRate))
+	measurement.TestKeys = &TestKeys{
+		ArchivalRepeatedEndpointMeasurement: measurex.NewArchivalRepeatedEndpointMeasurement(rm),
+	}
+	return nil
+}
+
+// SummaryKeys contains summary keys for this experiment.
+//
+// Note that this structure is part of the ABI contract with probe-cli
+// therefore we should be careful when changing it.
+type SummaryKeys struct {
+	SuccessRate float64 `json:"success_rate"`
+	IsAnomaly   bool    `json:"-"`
+}
+
+// GetSummaryKeys implements model.ExperimentMeasurer.GetSummaryKeys.
+func (m *Measurer) GetSummaryKeys(measurement *model.Measurement) (interface{}, error) {
+	sk := SummaryKeys{IsAnomaly: false}
+	tk, ok := measurement.TestKeys.(*TestKeys)
+	if !ok {
+		return sk, errors.New("invalid test keys type")
+	}
+	if tk.ArchivalRepeatedEndpointMeasurement != nil && tk.Stats != nil {
+		sk.SuccessRate = tk.Stats.SuccessRate
+		sk.IsAnomaly = tk.Stats.Successes < tk.Stats.Attempts
+	}
+	return sk, nil
+}
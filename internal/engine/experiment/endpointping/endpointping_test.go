@@ -0,0 +1,123 @@
+package endpointping
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-cli/v3/internal/engine/mockable"
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestMeasurerExperimentNameVersion(t *testing.T) {
+	measurer := NewExperimentMeasurer(Config{})
+	if measurer.ExperimentName() != "endpointping" {
+		t.Fatal("unexpected ExperimentName")
+	}
+	if measurer.ExperimentVersion() != "0.1.0" {
+		t.Fatal("unexpected ExperimentVersion")
+	}
+}
+
+// run runs the experiment with the given config and input.
+func run(config Config, input string) (*model.Measurement, error) {
+	measurer := NewExperimentMeasurer(config)
+	measurement := &model.Measurement{Input: model.MeasurementTarget(input)}
+	err := measurer.Run(
+		context.Background(),
+		&mockable.Session{MockableLogger: log.Log},
+		measurement,
+		model.NewPrinterCallbacks(log.Log),
+	)
+	return measurement, err
+}
+
+func TestRunWithInvalidInput(t *testing.T) {
+	inputs := map[string]error{
+		"":                     errMissingInput,
+		"https://8.8.8.8:443":  errUnsupportedURLScheme,
+		"tcp://8.8.8.8":        errInvalidEndpoint,
+		"tcp://dns.google:443": errInvalidEndpoint,
+		"quic://8.8.8.8:":      errInvalidEndpoint,
+	}
+	for input, expected := range inputs {
+		_, err := run(Config{}, input)
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected err", input, err)
+		}
+	}
+	if _, err := run(Config{}, "\t"); err == nil || !strings.HasSuffix(
+		err.Error(), "invalid control character in URL") {
+		t.Fatal("unexpected err", err)
+	}
+}
+
+func TestRunWithTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close() // now connecting fails
+
+	measurement, err := run(Config{Repetitions: 3, Delay: 1}, "tcp://"+address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := measurement.TestKeys.(*TestKeys)
+	if len(tk.Attempts) != 3 || tk.Stats.Attempts != 3 || tk.Stats.Successes != 0 {
+		t.Fatal("unexpected stats", tk.Stats)
+	}
+	if tk.Stats.Failures[string(measurex.OddityTCPConnectRefused)] != 3 {
+		t.Fatal("unexpected failures", tk.Stats.Failures)
+	}
+	sk, err := NewExperimentMeasurer(Config{}).GetSummaryKeys(measurement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sk.(SummaryKeys).IsAnomaly || sk.(SummaryKeys).SuccessRate != 0 {
+		t.Fatal("unexpected summary keys", sk)
+	}
+}
+
+func TestRunWithTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	address := strings.TrimPrefix(srv.URL, "https://")
+	measurement, err := run(Config{Repetitions: 2, Delay: 1}, "tls://"+address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := measurement.TestKeys.(*TestKeys)
+	if tk.Stats.SuccessRate != 1 || len(tk.Stats.Failures) != 0 {
+		t.Fatal("unexpected stats", tk.Stats)
+	}
+	if tk.Stats.RTTMin <= 0 || tk.Stats.RTTMin > tk.Stats.RTTP50 || tk.Stats.RTTP90 > tk.Stats.RTTMax {
+		t.Fatal("unexpected RTT stats", tk.Stats)
+	}
+	if len(tk.Attempts[0].TLSHandshakes) != 1 {
+		t.Fatal("expected a TLS handshake")
+	}
+	sk, err := NewExperimentMeasurer(Config{}).GetSummaryKeys(measurement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sk.(SummaryKeys).IsAnomaly {
+		t.Fatal("unexpected anomaly")
+	}
+}
+
+func TestSummaryKeysInvalidType(t *testing.T) {
+	measurement := new(model.Measurement)
+	m := &Measurer{}
+	_, err := m.GetSummaryKeys(measurement)
+	if err.Error() != "invalid test keys type" {
+		t.Fatal("not the error we expected")
+	}
+}
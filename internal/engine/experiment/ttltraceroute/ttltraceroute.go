@@ -0,0 +1,522 @@
+// Package ttltraceroute contains the ttltraceroute experiment.
+//
+// This experiment sends TCP SYN, TLS ClientHello, and DNS query probes
+// with increasing IP TTL, like traceroute, to locate the hop at which
+// a censor injects RSTs or DNS replies. The input is an URL such as
+// https://www.example.com/. We probe the endpoint serving the URL's
+// domain and a DNS resolver. A reply to a TLS ClientHello arriving at
+// a lower TTL than the reply to a TCP SYN sent to the same endpoint
+// comes from a middlebox, and so does a reply to a DNS query arriving
+// at a lower TTL than the reply to a TCP SYN sent to the resolver.
+//
+// This experiment does not follow any existing spec.
+package ttltraceroute
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+const (
+	testName    = "ttltraceroute"
+	testVersion = "0.1.0"
+)
+
+// Config contains the experiment config.
+type Config struct {
+	Address  string `ooni:"IP:port to probe (by default we resolve the input's domain)"`
+	MaxTTL   int64  `ooni:"Maximum TTL of the probes we send"`
+	Resolver string `ooni:"IP:port of the DNS resolver to probe"`
+	Timeout  int64  `ooni:"Milliseconds to wait for the reply to each probe"`
+}
+
+// DefaultMaxTTL is the default maximum TTL.
+const DefaultMaxTTL = 30
+
+// DefaultResolver is the default DNS resolver to probe.
+const DefaultResolver = "8.8.8.8:53"
+
+// DefaultTimeout is the default time we wait for the reply to a probe.
+const DefaultTimeout = 2 * time.Second
+
+func (c Config) maxTTL() int {
+	if c.MaxTTL > 0 {
+		return int(c.MaxTTL)
+	}
+	return DefaultMaxTTL
+}
+
+func (c Config) resolver() string {
+	if c.Resolver != "" {
+		return c.Resolver
+	}
+	return DefaultResolver
+}
+
+func (c Config) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return time.Duration(c.Timeout) * time.Millisecond
+	}
+	return DefaultTimeout
+}
+
+// These are the probes we send.
+const (
+	// ProbeTCP is a TCP SYN sent to the endpoint.
+	ProbeTCP = "tcp"
+
+	// ProbeTLS is a TLS ClientHello sent to the endpoint.
+	ProbeTLS = "tls"
+
+	// ProbeResolverTCP is a TCP SYN sent to the resolver.
+	ProbeResolverTCP = "resolver_tcp"
+
+	// ProbeDNS is a DNS query sent to the resolver.
+	ProbeDNS = "dns"
+)
+
+// These are the replies we could receive.
+const (
+	// ReplyNone means that we did not receive any reply.
+	ReplyNone = "none"
+
+	// ReplyICMP means we received an ICMP error (e.g., time exceeded).
+	ReplyICMP = "icmp"
+
+	// ReplyRST means we received a RST segment.
+	ReplyRST = "rst"
+
+	// ReplyEOF means we received a FIN segment.
+	ReplyEOF = "eof"
+
+	// ReplyData means we received a SYN-ACK segment, TLS records, or
+	// a DNS response, depending on the probe.
+	ReplyData = "data"
+
+	// ReplyError means we could not send the probe.
+	ReplyError = "error"
+)
+
+// Hop contains the results of sending a probe with a given TTL.
+type Hop struct {
+	TTL     int64    `json:"ttl"`
+	Reply   string   `json:"reply"`
+	Failure *string  `json:"failure"`
+	Rcode   string   `json:"rcode,omitempty"`
+	Answers []string `json:"answers,omitempty"`
+	T       float64  `json:"t"`
+}
+
+// isReply returns whether the hop contains a reply coming from a
+// middlebox or from the server rather than from a router.
+func (h *Hop) isReply() bool {
+	return h.Reply == ReplyRST || h.Reply == ReplyEOF || h.Reply == ReplyData
+}
+
+// Trace contains the results of sending a probe with increasing TTL.
+type Trace struct {
+	Probe         string `json:"probe"`
+	Address       string `json:"address"`
+	Hops          []*Hop `json:"hops"`
+	FirstReplyHop *int64 `json:"first_reply_hop"`
+}
+
+// TestKeys contains the experiment's test keys.
+type TestKeys struct {
+	Domain       string   `json:"domain"`
+	Address      string   `json:"address"`
+	Resolver     string   `json:"resolver"`
+	Traces       []*Trace `json:"traces"`
+	CensorHop    *int64   `json:"censor_hop"`
+	CensorSignal string   `json:"censor_signal,omitempty"`
+	Failure      *string  `json:"failure"`
+}
+
+// Measurer performs the measurement.
+type Measurer struct {
+	Config Config
+
+	// Network is the OPTIONAL network library we use to send
+	// TTL-limited probes. If nil, we use netxlite.TProxy.
+	Network model.UnderlyingTTLNetworkLibrary
+}
+
+// NewExperimentMeasurer creates a new ExperimentMeasurer.
+func NewExperimentMeasurer(config Config) model.ExperimentMeasurer {
+	return &Measurer{Config: config}
+}
+
+// ExperimentName implements ExperimentMeasurer.ExperimentName.
+func (m *Measurer) ExperimentName() string {
+	return testName
+}
+
+// ExperimentVersion implements ExperimentMeasurer.ExperimentVersion.
+func (m *Measurer) ExperimentVersion() string {
+	return testVersion
+}
+
+var (
+	// errMissingInput means that the user did not provide any input.
+	errMissingInput = errors.New("ttltraceroute: missing input")
+
+	// errInvalidInput means the input is not an URL containing a domain.
+	errInvalidInput = errors.New("ttltraceroute: input is not an URL with a domain")
+
+	// errInvalidEndpoint means an endpoint in the config is not IP:port.
+	errInvalidEndpoint = errors.New("ttltraceroute: endpoint is not IP:port")
+
+	// errNoTTLSupport means the network library cannot set the TTL.
+	errNoTTLSupport = errors.New("ttltraceroute: the network library cannot set the TTL")
+)
+
+// parseInput returns the domain and the port to probe.
+func (m *Measurer) parseInput(input string) (string, string, error) {
+	if input == "" {
+		return "", "", errMissingInput
+	}
+	if !strings.Contains(input, "://") {
+		input = "https://" + input
+	}
+	URL, err := url.Parse(input)
+	if err != nil {
+		return "", "", err
+	}
+	domain := URL.Hostname()
+	if domain == "" || net.ParseIP(domain) != nil {
+		return "", "", errInvalidInput
+	}
+	port := URL.Port()
+	switch {
+	case port != "":
+	case URL.Scheme == "http":
+		port = "80"
+	default:
+		port = "443"
+	}
+	return domain, port, nil
+}
+
+// validateEndpoint returns an error if address is not IP:port.
+func validateEndpoint(address string) error {
+	addr, port, err := net.SplitHostPort(address)
+	if err != nil || port == "" || net.ParseIP(addr) == nil {
+		return fmt.Errorf("%w: %s", errInvalidEndpoint, address)
+	}
+	return nil
+}
+
+// network returns the network library to use.
+func (m *Measurer) network() (model.UnderlyingTTLNetworkLibrary, error) {
+	if m.Network != nil {
+		return m.Network, nil
+	}
+	lib, ok := netxlite.TProxy.(model.UnderlyingTTLNetworkLibrary)
+	if !ok {
+		return nil, errNoTTLSupport
+	}
+	return lib, nil
+}
+
+// Run implements ExperimentMeasurer.Run.
+func (m *Measurer) Run(
+	ctx context.Context, sess model.ExperimentSession,
+	measurement *model.Measurement, callbacks model.ExperimentCallbacks,
+) error {
+	domain, port, err := m.parseInput(string(measurement.Input))
+	if err != nil {
+		return err
+	}
+	resolver := m.Config.resolver()
+	if err := validateEndpoint(resolver); err != nil {
+		return err
+	}
+	if m.Config.Address != "" {
+		if err := validateEndpoint(m.Config.Address); err != nil {
+			return err
+		}
+	}
+	lib, err := m.network()
+	if err != nil {
+		return err
+	}
+	tk := &TestKeys{Domain: domain, Resolver: resolver}
+	measurement.TestKeys = tk
+	tk.Address = m.Config.Address
+	if tk.Address == "" {
+		reso := netxlite.NewResolverStdlib(sess.Logger())
+		addrs, err := reso.LookupHost(ctx, domain)
+		if err != nil {
+			failure := err.Error()
+			tk.Failure = &failure
+			return nil // a measurement failure is not a fundamental error
+		}
+		tk.Address = net.JoinHostPort(addrs[0], port)
+	}
+	tr := &tracer{
+		begin:   time.Now(),
+		domain:  domain,
+		lib:     lib,
+		logger:  sess.Logger(),
+		maxTTL:  m.Config.maxTTL(),
+		timeout: m.Config.timeout(),
+	}
+	probes := []struct {
+		probe, address string
+	}{
+		{ProbeTCP, tk.Address},
+		{ProbeTLS, tk.Address},
+		{ProbeResolverTCP, resolver},
+		{ProbeDNS, resolver},
+	}
+	for idx, p := range probes {
+		callbacks.OnProgress(float64(idx)/float64(len(probes)), fmt.Sprintf(
+			"ttltraceroute: sending %s probes to %s...", p.probe, p.address))
+		tk.Traces = append(tk.Traces, tr.trace(ctx, p.probe, p.address))
+	}
+	tk.CensorHop, tk.CensorSignal = analyze(tk.Traces)
+	if tk.CensorHop != nil {
+		callbacks.OnProgress(1, fmt.Sprintf("ttltraceroute: censor at hop %d (%s)",
+			*tk.CensorHop, tk.CensorSignal))
+		return nil
+	}
+	callbacks.OnProgress(1, "ttltraceroute: no censor found")
+	return nil
+}
+
+// analyze returns the hop at which we located the censor and the
+// signal that allowed us to locate it, if any. The signal consists of
+// the probe and the reply's kind (e.g., "tls_rst", "dns_data").
+func analyze(traces []*Trace) (hop *int64, signal string) {
+	byProbe := make(map[string]*Trace)
+	for _, trace := range traces {
+		byProbe[trace.Probe] = trace
+	}
+	check := func(probe, reference string) {
+		p, r := byProbe[probe], byProbe[reference]
+		if p == nil || r == nil || p.FirstReplyHop == nil || r.FirstReplyHop == nil {
+			return
+		}
+		if *p.FirstReplyHop >= *r.FirstReplyHop {
+			return // the reply comes from the server
+		}
+		if hop == nil || *p.FirstReplyHop < *hop {
+			value := *p.FirstReplyHop
+			hop = &value
+			signal = fmt.Sprintf("%s_%s", probe, p.Hops[len(p.Hops)-1].Reply)
+		}
+	}
+	check(ProbeTLS, ProbeTCP)
+	check(ProbeDNS, ProbeResolverTCP)
+	return
+}
+
+// tracer sends TTL-limited probes.
+type tracer struct {
+	begin   time.Time
+	domain  string
+	lib     model.UnderlyingTTLNetworkLibrary
+	logger  model.Logger
+	maxTTL  int
+	timeout time.Duration
+}
+
+// trace sends the given probe to the given address with increasing
+// TTL until we receive a reply or we reach the maximum TTL.
+func (tr *tracer) trace(ctx context.Context, probe, address string) *Trace {
+	out := &Trace{Probe: probe, Address: address}
+	for ttl := 1; ttl <= tr.maxTTL && ctx.Err() == nil; ttl++ {
+		hop := tr.hop(ctx, probe, address, ttl)
+		tr.logger.Infof("ttltraceroute: %s %s ttl=%d => %s", probe, address, ttl, hop.Reply)
+		out.Hops = append(out.Hops, hop)
+		if hop.isReply() {
+			out.FirstReplyHop = &hop.TTL
+			break
+		}
+	}
+	return out
+}
+
+// hop sends the given probe to the given address using the given TTL.
+func (tr *tracer) hop(ctx context.Context, probe, address string, ttl int) *Hop {
+	ctx, cancel := context.WithTimeout(ctx, tr.timeout)
+	defer cancel()
+	hop := &Hop{TTL: int64(ttl)}
+	var err error
+	switch probe {
+	case ProbeTCP, ProbeResolverTCP:
+		err = tr.sendSYN(ctx, address, ttl)
+	case ProbeTLS:
+		err = tr.sendClientHello(ctx, address, ttl)
+	case ProbeDNS:
+		err = tr.sendQuery(ctx, hop, address, ttl)
+	}
+	hop.T = time.Since(tr.begin).Seconds()
+	hop.Failure, hop.Reply = classify(probe, err)
+	return hop
+}
+
+// sendError means we could not send a probe.
+type sendError struct {
+	err error
+}
+
+// Error implements error.Error.
+func (e *sendError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap allows to access the underlying error.
+func (e *sendError) Unwrap() error {
+	return e.err
+}
+
+// classify maps the result of sending a probe to the probe's
+// failure (if any) and to the kind of reply we received.
+func classify(probe string, err error) (*string, string) {
+	if err == nil {
+		return nil, ReplyData
+	}
+	failure := netxlite.NewTopLevelGenericErrWrapper(err).Failure
+	var serr *sendError
+	if errors.As(err, &serr) {
+		return &failure, ReplyError
+	}
+	switch failure {
+	case netxlite.FailureConnectionRefused:
+		if probe == ProbeDNS {
+			return &failure, ReplyICMP // port unreachable
+		}
+		return &failure, ReplyRST
+	case netxlite.FailureConnectionReset:
+		return &failure, ReplyRST
+	case netxlite.FailureEOFError:
+		return &failure, ReplyEOF
+	case netxlite.FailureGenericTimeoutError:
+		return &failure, ReplyNone
+	case netxlite.FailureHostUnreachable, netxlite.FailureNetworkUnreachable:
+		return &failure, ReplyICMP
+	}
+	if probe == ProbeTLS && strings.Contains(err.Error(), "remote error: tls:") {
+		return &failure, ReplyData // we received an alert
+	}
+	return &failure, ReplyError
+}
+
+// sendSYN sends a TCP SYN with the given TTL.
+func (tr *tracer) sendSYN(ctx context.Context, address string, ttl int) error {
+	dialer := tr.lib.NewSimpleDialerWithTTL(tr.timeout, ttl)
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+// sendClientHello connects using the default TTL and then sends
+// a TLS ClientHello with the given TTL.
+func (tr *tracer) sendClientHello(ctx context.Context, address string, ttl int) error {
+	dialer := tr.lib.NewSimpleDialerWithTTL(tr.timeout, 0)
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return &sendError{err}
+	}
+	defer conn.Close()
+	tconn, ok := conn.(model.TTLConn)
+	if !ok {
+		return &sendError{netxlite.ErrNoTTLSupport}
+	}
+	if err := tconn.SetTTL(ttl); err != nil {
+		return &sendError{err}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return tls.Client(conn, &tls.Config{
+		ServerName:         tr.domain,
+		NextProtos:         []string{"h2", "http/1.1"},
+		InsecureSkipVerify: true, // we only care about receiving a reply
+	}).Handshake()
+}
+
+// sendQuery sends a DNS query with the given TTL and saves
+// the rcode and the answers of the reply into the hop.
+func (tr *tracer) sendQuery(ctx context.Context, hop *Hop, address string, ttl int) error {
+	network := "udp4"
+	if host, _, _ := net.SplitHostPort(address); net.ParseIP(host).To4() == nil {
+		network = "udp6"
+	}
+	raddr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return &sendError{err}
+	}
+	pconn, err := tr.lib.ListenUDPWithTTL(network, nil, ttl)
+	if err != nil {
+		return &sendError{err}
+	}
+	defer pconn.Close()
+	query := &dns.Msg{}
+	query.SetQuestion(dns.Fqdn(tr.domain), dns.TypeA)
+	data, err := query.Pack()
+	if err != nil {
+		return &sendError{err}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		pconn.SetDeadline(deadline)
+	}
+	if _, err := pconn.WriteTo(data, raddr); err != nil {
+		return err
+	}
+	buffer := make([]byte, 1<<12)
+	for {
+		count, _, err := pconn.ReadFrom(buffer)
+		if err != nil {
+			return err
+		}
+		reply := &dns.Msg{}
+		if err := reply.Unpack(buffer[:count]); err != nil || !reply.Response || reply.Id != query.Id {
+			continue // not the reply we're waiting for
+		}
+		hop.Rcode = dns.RcodeToString[reply.Rcode]
+		for _, answer := range reply.Answer {
+			if a, ok := answer.(*dns.A); ok {
+				hop.Answers = append(hop.Answers, a.A.String())
+			}
+		}
+		return nil
+	}
+}
+
+// SummaryKeys contains summary keys for this experiment.
+//
+// Note that this structure is part of the ABI contract with probe-cli
+// therefore we should be careful when changing it.
+type SummaryKeys struct {
+	CensorHop int64 `json:"censor_hop"`
+	IsAnomaly bool  `json:"-"`
+}
+
+// GetSummaryKeys implements model.ExperimentMeasurer.GetSummaryKeys.
+func (m *Measurer) GetSummaryKeys(measurement *model.Measurement) (interface{}, error) {
+	sk := SummaryKeys{IsAnomaly: false}
+	tk, ok := measurement.TestKeys.(*TestKeys)
+	if !ok {
+		return sk, errors.New("invalid test keys type")
+	}
+	if tk.CensorHop != nil {
+		sk.CensorHop = *tk.CensorHop
+		sk.IsAnomaly = true
+	}
+	return sk, nil
+}
@@ -0,0 +1,281 @@
+package ttltraceroute
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/engine/mockable"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+	"github.com/ooni/probe-cli/v3/internal/netxlite/filtering"
+)
+
+func TestMeasurerExperimentNameVersion(t *testing.T) {
+	measurer := NewExperimentMeasurer(Config{})
+	if measurer.ExperimentName() != "ttltraceroute" {
+		t.Fatal("unexpected ExperimentName")
+	}
+	if measurer.ExperimentVersion() != "0.1.0" {
+		t.Fatal("unexpected ExperimentVersion")
+	}
+}
+
+// run runs the experiment with the given measurer and input.
+func run(ctx context.Context, measurer *Measurer, input string) (*model.Measurement, error) {
+	measurement := &model.Measurement{Input: model.MeasurementTarget(input)}
+	err := measurer.Run(
+		ctx,
+		&mockable.Session{MockableLogger: log.Log},
+		measurement,
+		model.NewPrinterCallbacks(log.Log),
+	)
+	return measurement, err
+}
+
+func TestRunWithInvalidInput(t *testing.T) {
+	inputs := map[string]error{
+		"":                 errMissingInput,
+		"https://8.8.8.8/": errInvalidInput,
+		"https:///":        errInvalidInput,
+	}
+	for input, expected := range inputs {
+		_, err := run(context.Background(), &Measurer{}, input)
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected err", input, err)
+		}
+	}
+	if _, err := run(context.Background(), &Measurer{}, "\t"); err == nil || !strings.HasSuffix(
+		err.Error(), "invalid control character in URL") {
+		t.Fatal("unexpected err", err)
+	}
+	configs := []Config{{Address: "example.com:443"}, {Resolver: "8.8.8.8"}}
+	for _, config := range configs {
+		_, err := run(context.Background(), &Measurer{Config: config}, "example.com")
+		if !errors.Is(err, errInvalidEndpoint) {
+			t.Fatal("unexpected err", config, err)
+		}
+	}
+}
+
+func TestParseInput(t *testing.T) {
+	inputs := map[string]string{
+		"www.example.com":              "www.example.com:443",
+		"https://www.example.com/":     "www.example.com:443",
+		"http://www.example.com/":      "www.example.com:80",
+		"https://www.example.com:8443": "www.example.com:8443",
+	}
+	for input, expected := range inputs {
+		domain, port, err := (&Measurer{}).parseInput(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if net.JoinHostPort(domain, port) != expected {
+			t.Fatal("unexpected result", input, domain, port)
+		}
+	}
+}
+
+func TestRunWithResolverFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // so resolving fails immediately
+	measurement, err := run(ctx, &Measurer{}, "https://www.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := measurement.TestKeys.(*TestKeys)
+	if tk.Failure == nil || len(tk.Traces) != 0 {
+		t.Fatal("unexpected test keys", tk)
+	}
+}
+
+// newEnv creates a TLS server and a DNS resolver and returns their
+// endpoints along with a cleanup function.
+func newEnv(t *testing.T) (string, string, func()) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	resolver, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buffer := make([]byte, 1<<12)
+		for {
+			count, addr, err := resolver.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			query := &dns.Msg{}
+			if err := query.Unpack(buffer[:count]); err != nil {
+				continue
+			}
+			reply := &dns.Msg{}
+			reply.SetReply(query)
+			reply.Answer = append(reply.Answer, &dns.A{
+				Hdr: dns.RR_Header{
+					Name:   query.Question[0].Name,
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: net.IPv4(127, 0, 0, 1),
+			})
+			data, _ := reply.Pack()
+			resolver.WriteTo(data, addr)
+		}
+	}()
+	cleanup := func() {
+		srv.Close()
+		resolver.Close()
+	}
+	return strings.TrimPrefix(srv.URL, "https://"), resolver.LocalAddr().String(), cleanup
+}
+
+func TestRunWithTProxy(t *testing.T) {
+	address, resolver, cleanup := newEnv(t)
+	defer cleanup()
+
+	measure := func(t *testing.T, config *filtering.TProxyConfig) *TestKeys {
+		proxy, err := filtering.NewTProxy(config, log.Log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		measurer := &Measurer{
+			Config: Config{
+				Address:  address,
+				MaxTTL:   10,
+				Resolver: resolver,
+				Timeout:  200,
+			},
+			Network: proxy,
+		}
+		measurement, err := run(context.Background(), measurer, "https://www.example.com/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tk := measurement.TestKeys.(*TestKeys)
+		if tk.Failure != nil || len(tk.Traces) != 4 {
+			t.Fatal("unexpected test keys", tk)
+		}
+		return tk
+	}
+
+	firstReplies := func(tk *TestKeys) map[string]int64 {
+		out := make(map[string]int64)
+		for _, trace := range tk.Traces {
+			if trace.FirstReplyHop != nil {
+				out[trace.Probe] = *trace.FirstReplyHop
+			}
+		}
+		return out
+	}
+
+	t.Run("without a censor", func(t *testing.T) {
+		tk := measure(t, &filtering.TProxyConfig{Hops: 6})
+		replies := firstReplies(tk)
+		for _, probe := range []string{ProbeTCP, ProbeTLS, ProbeResolverTCP, ProbeDNS} {
+			if replies[probe] != 6 {
+				t.Fatal("unexpected first reply hop", probe, replies[probe])
+			}
+		}
+		dnsHops := tk.Traces[3].Hops
+		if last := dnsHops[len(dnsHops)-1]; last.Rcode != "NOERROR" || len(last.Answers) != 1 {
+			t.Fatal("unexpected DNS reply", last)
+		}
+		if tk.CensorHop != nil || tk.CensorSignal != "" {
+			t.Fatal("unexpected censor", tk.CensorHop, tk.CensorSignal)
+		}
+		sk, err := (&Measurer{}).GetSummaryKeys(&model.Measurement{TestKeys: tk})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sk.(SummaryKeys).IsAnomaly {
+			t.Fatal("unexpected anomaly")
+		}
+	})
+
+	t.Run("with a censor", func(t *testing.T) {
+		tk := measure(t, &filtering.TProxyConfig{
+			Domains:   map[string]filtering.DNSAction{"www.example.com.": filtering.DNSActionNXDOMAIN},
+			SNIs:      map[string]filtering.TLSAction{"www.example.com": filtering.TLSActionReset},
+			Hops:      6,
+			CensorHop: 3,
+		})
+		replies := firstReplies(tk)
+		expect := map[string]int64{ProbeTCP: 6, ProbeTLS: 3, ProbeResolverTCP: 6, ProbeDNS: 3}
+		for probe, hop := range expect {
+			if replies[probe] != hop {
+				t.Fatal("unexpected first reply hop", probe, replies[probe])
+			}
+		}
+		tlsHops := tk.Traces[1].Hops
+		if tlsHops[0].Reply != ReplyNone || tlsHops[2].Reply != ReplyRST {
+			t.Fatal("unexpected TLS hops", tlsHops[0].Reply, tlsHops[2].Reply)
+		}
+		if last := tk.Traces[3].Hops[2]; last.Rcode != "NXDOMAIN" {
+			t.Fatal("unexpected DNS reply", last)
+		}
+		if tk.CensorHop == nil || *tk.CensorHop != 3 || tk.CensorSignal != "tls_rst" {
+			t.Fatal("unexpected censor", tk.CensorHop, tk.CensorSignal)
+		}
+		sk, err := (&Measurer{}).GetSummaryKeys(&model.Measurement{TestKeys: tk})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sk.(SummaryKeys).IsAnomaly || sk.(SummaryKeys).CensorHop != 3 {
+			t.Fatal("unexpected summary keys", sk)
+		}
+	})
+
+	t.Run("with a censor injecting DNS replies", func(t *testing.T) {
+		tk := measure(t, &filtering.TProxyConfig{
+			Domains:   map[string]filtering.DNSAction{"www.example.com.": filtering.DNSActionLocalHost},
+			Hops:      6,
+			CensorHop: 4,
+		})
+		if tk.CensorHop == nil || *tk.CensorHop != 4 || tk.CensorSignal != "dns_data" {
+			t.Fatal("unexpected censor", tk.CensorHop, tk.CensorSignal)
+		}
+	})
+}
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		probe  string
+		err    error
+		expect string
+	}{
+		{ProbeTCP, nil, ReplyData},
+		{ProbeTCP, &sendError{errors.New("mocked error")}, ReplyError},
+		{ProbeTCP, netxlite.ECONNREFUSED, ReplyRST},
+		{ProbeDNS, netxlite.ECONNREFUSED, ReplyICMP},
+		{ProbeTLS, netxlite.ECONNRESET, ReplyRST},
+		{ProbeTLS, io.EOF, ReplyEOF},
+		{ProbeTLS, errors.New("i/o timeout"), ReplyNone},
+		{ProbeTCP, netxlite.EHOSTUNREACH, ReplyICMP},
+		{ProbeTLS, errors.New("remote error: tls: unrecognized name"), ReplyData},
+		{ProbeTCP, errors.New("remote error: tls: unrecognized name"), ReplyError},
+		{ProbeTCP, errors.New("mocked error"), ReplyError},
+	}
+	for _, tc := range cases {
+		_, reply := classify(tc.probe, tc.err)
+		if reply != tc.expect {
+			t.Fatal("unexpected reply", tc.probe, tc.err, reply)
+		}
+	}
+}
+
+func TestSummaryKeysInvalidType(t *testing.T) {
+	measurement := new(model.Measurement)
+	m := &Measurer{}
+	_, err := m.GetSummaryKeys(measurement)
+	if err.Error() != "invalid test keys type" {
+		t.Fatal("not the error we expected")
+	}
+}
@@ -0,0 +1,48 @@
+package urlgetter
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/ooni/probe-cli/v3/internal/blockpage"
+)
+
+// MatchBlockpage returns the rule in db matching the page we fetched
+// or nil if there is no such rule. We consider the body and the headers
+// of the last response, the redirect locations of all the responses,
+// and the addresses that we resolved or connected to.
+func (tk *TestKeys) MatchBlockpage(db *blockpage.DB) *blockpage.Rule {
+	if len(tk.Requests) <= 0 {
+		return nil
+	}
+	response := tk.Requests[0].Response // the last response comes first
+	if response.Code <= 0 {
+		return nil
+	}
+	page := &blockpage.Page{
+		Body:    response.Body.Value,
+		Headers: http.Header{},
+	}
+	for _, entry := range response.HeadersList {
+		page.Headers.Add(entry.Key, entry.Value.Value)
+	}
+	for _, req := range tk.Requests {
+		page.Locations = append(page.Locations, req.Response.Locations...)
+	}
+	for _, query := range tk.Queries {
+		for _, answer := range query.Answers {
+			switch {
+			case answer.IPv4 != "":
+				page.Addrs = append(page.Addrs, answer.IPv4)
+			case answer.IPv6 != "":
+				page.Addrs = append(page.Addrs, answer.IPv6)
+			}
+		}
+	}
+	for _, entry := range tk.TCPConnect {
+		if ip := net.ParseIP(entry.IP); ip != nil {
+			page.Addrs = append(page.Addrs, ip.String())
+		}
+	}
+	return db.Match(page)
+}
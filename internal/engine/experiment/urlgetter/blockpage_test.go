@@ -0,0 +1,120 @@
+package urlgetter_test
+
+import (
+	"testing"
+
+	"github.com/ooni/probe-cli/v3/internal/blockpage"
+	"github.com/ooni/probe-cli/v3/internal/engine/experiment/urlgetter"
+	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+func TestMatchBlockpage(t *testing.T) {
+	db, err := blockpage.NewDB(&blockpage.Rule{
+		ID:   "xx_01",
+		Body: "blocked by xx",
+	}, &blockpage.Rule{
+		ID:      "xx_02",
+		Headers: map[string]string{"Server": "^blocker$"},
+	}, &blockpage.Rule{
+		ID:       "xx_03",
+		Location: `^http://blocked\.example\.com/`,
+	}, &blockpage.Rule{
+		ID:    "xx_04",
+		Addrs: []string{"10.10.34.34"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newResponse := func(code int64, body string, headers ...string) archival.RequestEntry {
+		entry := archival.RequestEntry{}
+		entry.Response.Code = code
+		entry.Response.Body.Value = body
+		for i := 0; i+1 < len(headers); i += 2 {
+			entry.Response.HeadersList = append(entry.Response.HeadersList,
+				model.ArchivalHTTPHeader{
+					Key:   headers[i],
+					Value: model.ArchivalMaybeBinaryData{Value: headers[i+1]},
+				})
+			if headers[i] == "Location" {
+				entry.Response.Locations = append(entry.Response.Locations, headers[i+1])
+			}
+		}
+		return entry
+	}
+
+	cases := []struct {
+		name   string
+		tk     urlgetter.TestKeys
+		expect string
+	}{{
+		name:   "without requests",
+		tk:     urlgetter.TestKeys{},
+		expect: "",
+	}, {
+		name: "without a response",
+		tk: urlgetter.TestKeys{Requests: []archival.RequestEntry{
+			newResponse(0, ""),
+		}},
+		expect: "",
+	}, {
+		name: "with a matching body",
+		tk: urlgetter.TestKeys{Requests: []archival.RequestEntry{
+			newResponse(200, "<html>blocked by xx</html>"),
+		}},
+		expect: "xx_01",
+	}, {
+		name: "with a matching header",
+		tk: urlgetter.TestKeys{Requests: []archival.RequestEntry{
+			newResponse(403, "", "Server", "blocker"),
+		}},
+		expect: "xx_02",
+	}, {
+		name: "with a matching redirect in the chain",
+		tk: urlgetter.TestKeys{Requests: []archival.RequestEntry{
+			newResponse(200, "<html>ok</html>"),
+			newResponse(302, "", "Location", "http://blocked.example.com/"),
+		}},
+		expect: "xx_03",
+	}, {
+		name: "with a matching resolved address",
+		tk: urlgetter.TestKeys{
+			Queries: []archival.DNSQueryEntry{{
+				Answers: []archival.DNSAnswerEntry{{IPv4: "10.10.34.34"}},
+			}},
+			Requests: []archival.RequestEntry{newResponse(200, "<html>ok</html>")},
+		},
+		expect: "xx_04",
+	}, {
+		name: "with a matching connected address",
+		tk: urlgetter.TestKeys{
+			Requests:   []archival.RequestEntry{newResponse(200, "<html>ok</html>")},
+			TCPConnect: []archival.TCPConnectEntry{{IP: "10.10.34.34", Port: 80}},
+		},
+		expect: "xx_04",
+	}, {
+		name: "with a normal page",
+		tk: urlgetter.TestKeys{
+			Queries: []archival.DNSQueryEntry{{
+				Answers: []archival.DNSAnswerEntry{{IPv6: "2606:2800:220:1::248"}},
+			}},
+			Requests: []archival.RequestEntry{
+				newResponse(200, "<html>ok</html>", "Server", "nginx"),
+			},
+		},
+		expect: "",
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule := tc.tk.MatchBlockpage(db)
+			switch {
+			case tc.expect == "" && rule != nil:
+				t.Fatal("unexpected match", rule.ID)
+			case tc.expect != "" && rule == nil:
+				t.Fatal("expected a match")
+			case tc.expect != "" && rule.ID != tc.expect:
+				t.Fatal("unexpected match", rule.ID)
+			}
+		})
+	}
+}
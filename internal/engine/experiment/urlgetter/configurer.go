@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/ooni/probe-cli/v3/internal/engine/netx"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
@@ -43,6 +44,7 @@ func (c Configurer) NewConfiguration() (Configuration, error) {
 			CacheResolutions:    true,
 			CertPool:            c.Config.CertPool,
 			ContextByteCounting: true,
+			DNSSEC:              c.Config.DNSSEC,
 			DialSaver:           c.Saver,
 			HTTP3Enabled:        c.Config.HTTP3Enabled,
 			HTTPSaver:           c.Saver,
@@ -97,6 +99,17 @@ func (c Configurer) NewConfiguration() (Configuration, error) {
 		return configuration, err
 	}
 	configuration.HTTPConfig.NoTLSVerify = c.Config.NoTLSVerify
+	// configure TLS fragmentation
+	strategies, err := netxlite.ParseTLSFragmentationStrategies(c.Config.TLSFragmentation)
+	if err != nil {
+		return configuration, err
+	}
+	if len(strategies) > 0 {
+		configuration.HTTPConfig.TLSFragmentation = &netxlite.TLSFragmentationConfig{
+			Strategies: strategies,
+			Delay:      time.Duration(c.Config.TLSFragmentationDelay) * time.Millisecond,
+		}
+	}
 	// configure proxy
 	configuration.HTTPConfig.ProxyURL = c.ProxyURL
 	return configuration, nil
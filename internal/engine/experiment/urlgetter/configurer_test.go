@@ -6,9 +6,11 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/ooni/probe-cli/v3/internal/engine/experiment/urlgetter"
+	"github.com/ooni/probe-cli/v3/internal/engine/netx"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/resolver"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
@@ -376,6 +378,82 @@ func TestConfigurerNewConfigurationResolverUDP(t *testing.T) {
 	}
 }
 
+func TestConfigurerNewConfigurationResolverUDPWithDNSSEC(t *testing.T) {
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			DNSSEC:      true,
+			ResolverURL: "udp://8.8.8.8:53",
+		},
+		Logger: log.Log,
+	}
+	configuration, err := configurer.NewConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer configuration.CloseIdleConnections()
+	if configuration.HTTPConfig.DNSSEC != true {
+		t.Fatal("not the DNSSEC we expected")
+	}
+	sr, ok := configuration.HTTPConfig.BaseResolver.(*netxlite.DNSSECResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	if _, ok := sr.Txp.(*netxlite.DNSOverUDP); !ok {
+		t.Fatal("not the DNS transport we expected")
+	}
+}
+
+func TestConfigurerNewConfigurationDNSSECWithSystemResolver(t *testing.T) {
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			DNSSEC: true,
+		},
+		Logger: log.Log,
+	}
+	_, err := configurer.NewConfiguration()
+	if !errors.Is(err, netx.ErrDNSSECRequiresTransport) {
+		t.Fatal("not the error we expected", err)
+	}
+}
+
+func TestConfigurerNewConfigurationTLSFragmentation(t *testing.T) {
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			TLSFragmentation:      "tls-record,sni-split",
+			TLSFragmentationDelay: 10,
+		},
+		Logger: log.Log,
+	}
+	configuration, err := configurer.NewConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer configuration.CloseIdleConnections()
+	config := configuration.HTTPConfig.TLSFragmentation
+	if config == nil {
+		t.Fatal("expected a TLS fragmentation config")
+	}
+	if len(config.Strategies) != 2 || config.Strategies[1] != netxlite.TLSFragmentationSNISplit {
+		t.Fatal("not the strategies we expected", config.Strategies)
+	}
+	if config.Delay != 10*time.Millisecond {
+		t.Fatal("not the delay we expected", config.Delay)
+	}
+}
+
+func TestConfigurerNewConfigurationTLSFragmentationInvalid(t *testing.T) {
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			TLSFragmentation: "antani",
+		},
+		Logger: log.Log,
+	}
+	_, err := configurer.NewConfiguration()
+	if !errors.Is(err, netxlite.ErrUnknownTLSFragmentationStrategy) {
+		t.Fatal("not the error we expected", err)
+	}
+}
+
 func TestConfigurerNewConfigurationDNSCacheInvalidString(t *testing.T) {
 	saver := new(trace.Saver)
 	configurer := urlgetter.Configurer{
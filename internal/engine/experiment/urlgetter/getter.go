@@ -92,8 +92,9 @@ func (g Getter) ioutilTempDir(dir, pattern string) (string, error) {
 
 func (g Getter) get(ctx context.Context, saver *trace.Saver) (TestKeys, error) {
 	tk := TestKeys{
-		Agent:  "redirect",
-		Tunnel: g.Config.Tunnel,
+		Agent:            "redirect",
+		TLSFragmentation: g.Config.TLSFragmentation,
+		Tunnel:           g.Config.Tunnel,
 	}
 	if g.Config.DNSCache != "" {
 		tk.DNSCache = []string{g.Config.DNSCache}
@@ -515,6 +515,42 @@ func TestGetterIntegrationHTTPS(t *testing.T) {
 	}
 }
 
+func TestGetterIntegrationDNSLookupWithQueryType(t *testing.T) {
+	ctx := context.Background()
+	g := urlgetter.Getter{
+		Config: urlgetter.Config{
+			DNSQueryType: "CNAME",
+			ResolverURL:  "udp://8.8.8.8:53",
+		},
+		Session: &mockable.Session{},
+		Target:  "dnslookup://www.github.com",
+	}
+	tk, err := g.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tk.Failure != nil {
+		t.Fatal("not the Failure we expected")
+	}
+	if len(tk.Queries) != 1 {
+		t.Fatal("not the Queries we expected")
+	}
+	query := tk.Queries[0]
+	if query.QueryType != "CNAME" || query.Engine != "udp" {
+		t.Fatal("not the query we expected", query.QueryType, query.Engine)
+	}
+	if query.Hostname != "www.github.com" || query.ResolverAddress != "8.8.8.8:53" {
+		t.Fatal("not the query we expected", query.Hostname, query.ResolverAddress)
+	}
+	if len(query.Answers) != 1 {
+		t.Fatal("not the Answers we expected")
+	}
+	answer := query.Answers[0]
+	if answer.AnswerType != "CNAME" || answer.Hostname != "github.com." || answer.TTL == nil {
+		t.Fatal("not the answer we expected", answer)
+	}
+}
+
 func TestGetterIntegrationRedirect(t *testing.T) {
 	ctx := context.Background()
 	g := urlgetter.Getter{
@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"strings"
 
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/engine/httpheader"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
@@ -105,10 +107,23 @@ func (r Runner) httpGet(ctx context.Context, url string) error {
 
 func (r Runner) dnsLookup(ctx context.Context, hostname string) error {
 	resolver := netx.NewResolver(r.HTTPConfig)
-	_, err := resolver.LookupHost(ctx, hostname)
+	if r.Config.DNSQueryType == "" {
+		_, err := resolver.LookupHost(ctx, hostname)
+		return err
+	}
+	qtype, found := dns.StringToType[strings.ToUpper(r.Config.DNSQueryType)]
+	if !found {
+		return ErrUnknownDNSQueryType
+	}
+	// Note: this fails with ErrNoDNSTransport when we're using the
+	// system resolver, which cannot send arbitrary queries.
+	_, err := netxlite.LookupRaw(ctx, resolver, hostname, qtype)
 	return err
 }
 
+// ErrUnknownDNSQueryType indicates that Config.DNSQueryType is not valid.
+var ErrUnknownDNSQueryType = errors.New("urlgetter: unknown DNS query type")
+
 func (r Runner) tlsHandshake(ctx context.Context, address string) error {
 	tlsDialer := netx.NewTLSDialer(r.HTTPConfig)
 	conn, err := tlsDialer.DialTLSContext(ctx, "tcp", address)
@@ -8,9 +8,12 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/apex/log"
 	"github.com/ooni/probe-cli/v3/internal/atomicx"
 	"github.com/ooni/probe-cli/v3/internal/engine/experiment/urlgetter"
 	"github.com/ooni/probe-cli/v3/internal/engine/httpheader"
+	"github.com/ooni/probe-cli/v3/internal/engine/netx"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
 func TestRunnerWithInvalidURLScheme(t *testing.T) {
@@ -41,6 +44,45 @@ func TestRunnerDNSLookupWithContextCanceled(t *testing.T) {
 	}
 }
 
+func TestRunnerDNSLookupWithUnknownQueryType(t *testing.T) {
+	r := urlgetter.Runner{
+		Config: urlgetter.Config{DNSQueryType: "ANTANI"},
+		Target: "dnslookup://www.google.com",
+	}
+	err := r.Run(context.Background())
+	if !errors.Is(err, urlgetter.ErrUnknownDNSQueryType) {
+		t.Fatal("not the error we expected", err)
+	}
+}
+
+func TestRunnerDNSLookupWithQueryTypeAndSystemResolver(t *testing.T) {
+	r := urlgetter.Runner{
+		Config: urlgetter.Config{DNSQueryType: "cname"},
+		Target: "dnslookup://www.google.com",
+	}
+	err := r.Run(context.Background())
+	if !errors.Is(err, netxlite.ErrNoDNSTransport) {
+		t.Fatal("not the error we expected", err)
+	}
+}
+
+func TestRunnerDNSLookupWithQueryTypeAndContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := urlgetter.Runner{
+		Config: urlgetter.Config{DNSQueryType: "NS"},
+		HTTPConfig: netx.Config{
+			BaseResolver: netxlite.NewSerialResolver(
+				netxlite.NewDNSOverUDP(netxlite.NewDialerWithoutResolver(log.Log), "8.8.8.8:53")),
+		},
+		Target: "dnslookup://www.google.com",
+	}
+	err := r.Run(ctx)
+	if err == nil || err.Error() != "interrupted" {
+		t.Fatal("not the error we expected", err)
+	}
+}
+
 func TestRunnerTLSHandshakeWithContextCanceled(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
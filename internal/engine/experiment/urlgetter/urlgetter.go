@@ -8,13 +8,14 @@ import (
 	"crypto/x509"
 	"time"
 
+	"github.com/ooni/probe-cli/v3/internal/blockpage"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
 	"github.com/ooni/probe-cli/v3/internal/model"
 )
 
 const (
 	testName    = "urlgetter"
-	testVersion = "0.2.0"
+	testVersion = "0.2.2"
 )
 
 // Config contains the experiment's configuration.
@@ -24,39 +25,45 @@ type Config struct {
 	Timeout  time.Duration
 
 	// settable from command line
-	DNSCache          string `ooni:"Add 'DOMAIN IP...' to cache"`
-	DNSHTTPHost       string `ooni:"Force using specific HTTP Host header for DNS requests"`
-	DNSTLSServerName  string `ooni:"Force TLS to using a specific SNI for encrypted DNS requests"`
-	DNSTLSVersion     string `ooni:"Force specific TLS version used for DoT/DoH (e.g. 'TLSv1.3')"`
-	FailOnHTTPError   bool   `ooni:"Fail HTTP request if status code is 400 or above"`
-	HTTP3Enabled      bool   `ooni:"use http3 instead of http/1.1 or http2"`
-	HTTPHost          string `ooni:"Force using specific HTTP Host header"`
-	Method            string `ooni:"Force HTTP method different than GET"`
-	NoFollowRedirects bool   `ooni:"Disable following redirects"`
-	NoTLSVerify       bool   `ooni:"Disable TLS verification"`
-	RejectDNSBogons   bool   `ooni:"Fail DNS lookup if response contains bogons"`
-	ResolverURL       string `ooni:"URL describing the resolver to use"`
-	TLSServerName     string `ooni:"Force TLS to using a specific SNI in Client Hello"`
-	TLSVersion        string `ooni:"Force specific TLS version (e.g. 'TLSv1.3')"`
-	Tunnel            string `ooni:"Run experiment over a tunnel, e.g. psiphon"`
-	UserAgent         string `ooni:"Use the specified User-Agent"`
+	DNSCache              string `ooni:"Add 'DOMAIN IP...' to cache"`
+	DNSHTTPHost           string `ooni:"Force using specific HTTP Host header for DNS requests"`
+	DNSQueryType          string `ooni:"Query type for dnslookup:// targets (e.g. 'CNAME')"`
+	DNSSEC                bool   `ooni:"Validate DNS replies using DNSSEC (requires ResolverURL)"`
+	DNSTLSServerName      string `ooni:"Force TLS to using a specific SNI for encrypted DNS requests"`
+	DNSTLSVersion         string `ooni:"Force specific TLS version used for DoT/DoH (e.g. 'TLSv1.3')"`
+	FailOnHTTPError       bool   `ooni:"Fail HTTP request if status code is 400 or above"`
+	HTTP3Enabled          bool   `ooni:"use http3 instead of http/1.1 or http2"`
+	HTTPHost              string `ooni:"Force using specific HTTP Host header"`
+	Method                string `ooni:"Force HTTP method different than GET"`
+	NoFollowRedirects     bool   `ooni:"Disable following redirects"`
+	NoTLSVerify           bool   `ooni:"Disable TLS verification"`
+	RejectDNSBogons       bool   `ooni:"Fail DNS lookup if response contains bogons"`
+	ResolverURL           string `ooni:"URL describing the resolver to use"`
+	TLSFragmentation      string `ooni:"Fragment the Client Hello (comma-separated list of 'padding', 'tls-record', 'tcp-segments', 'sni-split')"`
+	TLSFragmentationDelay int64  `ooni:"Milliseconds to wait between Client Hello TCP segments"`
+	TLSServerName         string `ooni:"Force TLS to using a specific SNI in Client Hello"`
+	TLSVersion            string `ooni:"Force specific TLS version (e.g. 'TLSv1.3')"`
+	Tunnel                string `ooni:"Run experiment over a tunnel, e.g. psiphon"`
+	UserAgent             string `ooni:"Use the specified User-Agent"`
 }
 
 // TestKeys contains the experiment's result.
 type TestKeys struct {
 	// The following fields are part of the typical JSON emitted by OONI.
-	Agent           string                     `json:"agent"`
-	BootstrapTime   float64                    `json:"bootstrap_time,omitempty"`
-	DNSCache        []string                   `json:"dns_cache,omitempty"`
-	FailedOperation *string                    `json:"failed_operation"`
-	Failure         *string                    `json:"failure"`
-	NetworkEvents   []archival.NetworkEvent    `json:"network_events"`
-	Queries         []archival.DNSQueryEntry   `json:"queries"`
-	Requests        []archival.RequestEntry    `json:"requests"`
-	SOCKSProxy      string                     `json:"socksproxy,omitempty"`
-	TCPConnect      []archival.TCPConnectEntry `json:"tcp_connect"`
-	TLSHandshakes   []archival.TLSHandshake    `json:"tls_handshakes"`
-	Tunnel          string                     `json:"tunnel,omitempty"`
+	Agent            string                     `json:"agent"`
+	BlockingType     string                     `json:"blocking_type,omitempty"`
+	BootstrapTime    float64                    `json:"bootstrap_time,omitempty"`
+	DNSCache         []string                   `json:"dns_cache,omitempty"`
+	FailedOperation  *string                    `json:"failed_operation"`
+	Failure          *string                    `json:"failure"`
+	NetworkEvents    []archival.NetworkEvent    `json:"network_events"`
+	Queries          []archival.DNSQueryEntry   `json:"queries"`
+	Requests         []archival.RequestEntry    `json:"requests"`
+	SOCKSProxy       string                     `json:"socksproxy,omitempty"`
+	TCPConnect       []archival.TCPConnectEntry `json:"tcp_connect"`
+	TLSFragmentation string                     `json:"tls_fragmentation,omitempty"`
+	TLSHandshakes    []archival.TLSHandshake    `json:"tls_handshakes"`
+	Tunnel           string                     `json:"tunnel,omitempty"`
 
 	// The following fields are not serialised but are useful to simplify
 	// analysing the measurements in telegram, whatsapp, etc.
@@ -110,6 +117,10 @@ func (m Measurer) Run(
 		Target:  string(measurement.Input),
 	}
 	tk, _ := g.Get(ctx) // ignore error since we have the testkeys and we wanna submit them
+	db := blockpage.LoadOrDefault(sess.Logger(), sess.KeyValueStore())
+	if rule := tk.MatchBlockpage(db); rule != nil {
+		tk.BlockingType = blockpage.BlockingType(rule)
+	}
 	measurement.TestKeys = &tk
 	return nil
 }
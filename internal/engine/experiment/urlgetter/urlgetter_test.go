@@ -18,7 +18,7 @@ func TestMeasurer(t *testing.T) {
 	if m.ExperimentName() != "urlgetter" {
 		t.Fatal("invalid experiment name")
 	}
-	if m.ExperimentVersion() != "0.2.0" {
+	if m.ExperimentVersion() != "0.2.2" {
 		t.Fatal("invalid experiment version")
 	}
 	measurement := new(model.Measurement)
@@ -55,7 +55,7 @@ func TestMeasurerDNSCache(t *testing.T) {
 	if m.ExperimentName() != "urlgetter" {
 		t.Fatal("invalid experiment name")
 	}
-	if m.ExperimentVersion() != "0.2.0" {
+	if m.ExperimentVersion() != "0.2.2" {
 		t.Fatal("invalid experiment version")
 	}
 	measurement := new(model.Measurement)
@@ -5,9 +5,11 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/ooni/probe-cli/v3/internal/blockpage"
 	"github.com/ooni/probe-cli/v3/internal/engine/experiment/urlgetter"
 	"github.com/ooni/probe-cli/v3/internal/engine/experiment/webconnectivity/internal"
 	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/pagefingerprint"
 )
 
 // HTTPAnalysisResult contains the results of the analysis performed on the
@@ -18,6 +20,12 @@ type HTTPAnalysisResult struct {
 	StatusCodeMatch *bool   `json:"status_code_match"`
 	HeadersMatch    *bool   `json:"headers_match"`
 	TitleMatch      *bool   `json:"title_match"`
+
+	// Names not part of the spec.
+	PageFingerprint *pagefingerprint.Fingerprint `json:"x_page_fingerprint"`
+
+	// BlockingType is "blockpage:<id>" when we got a known blockpage.
+	BlockingType *string `json:"blocking_type"`
 }
 
 // Log logs the results of the analysis
@@ -27,15 +35,41 @@ func (har HTTPAnalysisResult) Log(logger model.Logger) {
 	logger.Infof("StatusCodeMatch: %+v", internal.BoolPointerToString(har.StatusCodeMatch))
 	logger.Infof("HeadersMatch: %+v", internal.BoolPointerToString(har.HeadersMatch))
 	logger.Infof("TitleMatch: %+v", internal.BoolPointerToString(har.TitleMatch))
+	if har.BlockingType != nil {
+		logger.Infof("BlockingType: %s", *har.BlockingType)
+	}
 }
 
 // HTTPAnalysis performs follow-up analysis on the webconnectivity measurement by
-// comparing the measurement test keys and the control.
-func HTTPAnalysis(tk urlgetter.TestKeys, ctrl ControlResponse) (out HTTPAnalysisResult) {
+// comparing the measurement test keys and the control. The blockpages
+// argument is the OPTIONAL database of known blockpages.
+func HTTPAnalysis(tk urlgetter.TestKeys, ctrl ControlResponse,
+	blockpages *blockpage.DB) (out HTTPAnalysisResult) {
 	out.BodyLengthMatch, out.BodyProportion = HTTPBodyLengthChecks(tk, ctrl)
 	out.StatusCodeMatch = HTTPStatusCodeMatch(tk, ctrl)
 	out.HeadersMatch = HTTPHeadersMatch(tk, ctrl)
 	out.TitleMatch = HTTPTitleMatch(tk, ctrl)
+	out.PageFingerprint, out.BlockingType = HTTPBlockpageCheck(tk, blockpages)
+	return
+}
+
+// HTTPBlockpageCheck computes the fingerprint of the measured body and
+// returns it along with the blocking type of the rule in blockpages
+// matching the response, if any. The fingerprint is nil when there is
+// no body and the blocking type is nil when no rule matches.
+func HTTPBlockpageCheck(tk urlgetter.TestKeys,
+	blockpages *blockpage.DB) (fp *pagefingerprint.Fingerprint, blockingType *string) {
+	if len(tk.Requests) <= 0 {
+		return
+	}
+	response := tk.Requests[0].Response
+	if response.Code > 0 && response.Body.Value != "" {
+		fp = pagefingerprint.Compute([]byte(response.Body.Value))
+	}
+	if rule := tk.MatchBlockpage(blockpages); rule != nil {
+		v := blockpage.BlockingType(rule)
+		blockingType = &v
+	}
 	return
 }
 
@@ -4,9 +4,11 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/blockpage"
 	"github.com/ooni/probe-cli/v3/internal/engine/experiment/urlgetter"
 	"github.com/ooni/probe-cli/v3/internal/engine/experiment/webconnectivity"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
+	"github.com/ooni/probe-cli/v3/internal/pagefingerprint"
 	"github.com/ooni/probe-cli/v3/internal/randx"
 )
 
@@ -832,3 +834,87 @@ func TestTitleMatch(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTPBlockpageCheck(t *testing.T) {
+	blockpageBody := `<html><head><title>Blocked</title></head><body>
+<p>Access to this website has been restricted in accordance with
+the decision of the competent authority.</p></body></html>`
+	normal := `<html><head><title>Example</title></head><body>
+<p>This domain is for use in illustrative examples in documents.</p>
+</body></html>`
+	sig := pagefingerprint.NewSignature("xx_01", []byte(blockpageBody))
+	db, err := blockpage.NewDB(&blockpage.Rule{
+		ID:      sig.ID,
+		SimHash: sig.SimHash,
+		DOMHash: sig.DOMHash,
+	}, &blockpage.Rule{
+		ID:       "xx_02",
+		Location: `^http://blocked\.example\.com/`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTestKeys := func(code int64, body string, locations ...string) urlgetter.TestKeys {
+		return urlgetter.TestKeys{
+			Requests: []archival.RequestEntry{{
+				Response: archival.HTTPResponse{
+					Code:      code,
+					Body:      archival.MaybeBinaryValue{Value: body},
+					Locations: locations,
+				},
+			}},
+		}
+	}
+
+	t.Run("with no requests", func(t *testing.T) {
+		fp, bt := webconnectivity.HTTPBlockpageCheck(urlgetter.TestKeys{}, db)
+		if fp != nil || bt != nil {
+			t.Fatal("expected nil, nil")
+		}
+	})
+
+	t.Run("with no response", func(t *testing.T) {
+		fp, bt := webconnectivity.HTTPBlockpageCheck(newTestKeys(0, ""), db)
+		if fp != nil || bt != nil {
+			t.Fatal("expected nil, nil")
+		}
+	})
+
+	t.Run("with a blockpage", func(t *testing.T) {
+		fp, bt := webconnectivity.HTTPBlockpageCheck(newTestKeys(200, blockpageBody), db)
+		if fp == nil || fp.Title != "Blocked" {
+			t.Fatal("unexpected fingerprint", fp)
+		}
+		if bt == nil || *bt != "blockpage:xx_01" {
+			t.Fatal("expected to identify the blockpage")
+		}
+	})
+
+	t.Run("with a redirect to a blockpage", func(t *testing.T) {
+		tk := newTestKeys(302, "", "http://blocked.example.com/")
+		fp, bt := webconnectivity.HTTPBlockpageCheck(tk, db)
+		if fp != nil {
+			t.Fatal("unexpected fingerprint", fp)
+		}
+		if bt == nil || *bt != "blockpage:xx_02" {
+			t.Fatal("expected to identify the blockpage")
+		}
+	})
+
+	t.Run("with a normal page", func(t *testing.T) {
+		fp, bt := webconnectivity.HTTPBlockpageCheck(newTestKeys(200, normal), db)
+		if fp == nil || fp.Title != "Example" {
+			t.Fatal("unexpected fingerprint", fp)
+		}
+		if bt != nil {
+			t.Fatal("unexpected blocking type", *bt)
+		}
+	})
+
+	t.Run("without a blockpages database", func(t *testing.T) {
+		fp, bt := webconnectivity.HTTPBlockpageCheck(newTestKeys(200, blockpageBody), nil)
+		if fp == nil || bt != nil {
+			t.Fatal("expected only the fingerprint")
+		}
+	})
+}
@@ -244,8 +244,9 @@ func Summarize(tk *TestKeys) (out Summary) {
 	// So the HTTP request did not fail in the measurement and did not
 	// fail in the control as well, didn't it? Then, let us try to guess
 	// whether we've got the expected webpage after all. This set of
-	// conditions is adapted from MK v0.10.11.
-	if tk.StatusCodeMatch != nil && *tk.StatusCodeMatch {
+	// conditions is adapted from MK v0.10.11. If we have identified a
+	// known blockpage, though, there is no need to guess.
+	if tk.BlockingType == nil && tk.StatusCodeMatch != nil && *tk.StatusCodeMatch {
 		if tk.BodyLengthMatch != nil && *tk.BodyLengthMatch {
 			out.Accessible = &accessible
 			out.Status |= StatusSuccessCleartext
@@ -16,6 +16,7 @@ func TestSummarize(t *testing.T) {
 		dns                    = "dns"
 		falseValue             = false
 		httpDiff               = "http-diff"
+		blockingType           = "blockpage:xx_01"
 		httpFailure            = "http-failure"
 		nilstring              *string
 		probeConnectionRefused = netxlite.FailureConnectionRefused
@@ -447,6 +448,27 @@ func TestSummarize(t *testing.T) {
 			Accessible:     &falseValue,
 			Status:         webconnectivity.StatusAnomalyHTTPDiff,
 		},
+	}, {
+		name: "with a known blockpage and matching status code and body length",
+		args: args{
+			tk: &webconnectivity.TestKeys{
+				HTTPAnalysisResult: webconnectivity.HTTPAnalysisResult{
+					StatusCodeMatch: &trueValue,
+					BodyLengthMatch: &trueValue,
+					BlockingType:    &blockingType,
+				},
+				Requests: []archival.RequestEntry{{}},
+				DNSAnalysisResult: webconnectivity.DNSAnalysisResult{
+					DNSConsistency: &webconnectivity.DNSConsistent,
+				},
+			},
+		},
+		wantOut: webconnectivity.Summary{
+			BlockingReason: &httpDiff,
+			Blocking:       &httpDiff,
+			Accessible:     &falseValue,
+			Status:         webconnectivity.StatusAnomalyHTTPDiff,
+		},
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
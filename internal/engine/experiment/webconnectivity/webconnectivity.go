@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/ooni/probe-cli/v3/internal/blockpage"
 	"github.com/ooni/probe-cli/v3/internal/engine/experiment/webconnectivity/internal"
 	"github.com/ooni/probe-cli/v3/internal/engine/httpheader"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
@@ -16,7 +17,7 @@ import (
 
 const (
 	testName    = "web_connectivity"
-	testVersion = "0.4.1"
+	testVersion = "0.4.2"
 )
 
 // Config contains the experiment config.
@@ -77,6 +78,10 @@ type TestKeys struct {
 // Measurer performs the measurement.
 type Measurer struct {
 	Config Config
+
+	// Blockpages is the OPTIONAL database of known blockpages. When
+	// not set, we load it using the session's key-value store.
+	Blockpages *blockpage.DB
 }
 
 // NewExperimentMeasurer creates a new ExperimentMeasurer.
@@ -232,7 +237,11 @@ func (m Measurer) Run(
 	tk.HTTPExperimentFailure = httpResult.Failure
 	tk.Requests = append(tk.Requests, httpResult.TestKeys.Requests...)
 	// 7. compare HTTP measurement to control
-	tk.HTTPAnalysisResult = HTTPAnalysis(httpResult.TestKeys, tk.Control)
+	blockpages := m.Blockpages
+	if blockpages == nil {
+		blockpages = blockpage.LoadOrDefault(sess.Logger(), sess.KeyValueStore())
+	}
+	tk.HTTPAnalysisResult = HTTPAnalysis(httpResult.TestKeys, tk.Control, blockpages)
 	tk.HTTPAnalysisResult.Log(sess.Logger())
 	tk.Summary = Summarize(tk)
 	tk.Summary.Log(sess.Logger())
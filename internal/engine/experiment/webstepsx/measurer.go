@@ -11,30 +11,53 @@ import (
 	"errors"
 	"net/http"
 	"net/url"
+	"os"
 	"time"
 
+	"github.com/ooni/probe-cli/v3/internal/blockpage"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
 	"github.com/ooni/probe-cli/v3/internal/measurex"
+	"github.com/ooni/probe-cli/v3/internal/measurex/analysis"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
 const (
 	testName    = "websteps"
-	testVersion = "0.0.3"
+	testVersion = "0.0.5"
 )
 
 // Config contains the experiment config.
-type Config struct{}
+type Config struct {
+	// EventsFile is the OPTIONAL JSONL file to which we append
+	// every measurement event as soon as it happens.
+	EventsFile string `json:"events_file" ooni:"append all measurement events to this JSONL file"`
+
+	// MeasureALPNSeparately OPTIONALLY measures h2 and http/1.1
+	// separately for each HTTPS endpoint using TCP.
+	MeasureALPNSeparately bool `json:"measure_alpn_separately" ooni:"measure h2 and http/1.1 separately"`
+
+	// MaxTestHelpers OPTIONALLY limits the number of test helpers
+	// we query concurrently. If zero, we query all of them.
+	MaxTestHelpers int64 `json:"max_test_helpers" ooni:"maximum number of test helpers to query"`
+}
 
 // TestKeys contains the experiment's test keys.
 type TestKeys struct {
 	*measurex.ArchivalURLMeasurement
+
+	// Analysis contains the verdicts obtained by comparing
+	// the probe's results with the test helper's ones.
+	Analysis *analysis.URLVerdict `json:"analysis"`
 }
 
 // Measurer performs the measurement.
 type Measurer struct {
 	Config Config
+
+	// Blockpages is the OPTIONAL database of known blockpages. When
+	// not set, we load it using the session's key-value store.
+	Blockpages *blockpage.DB
 }
 
 var (
@@ -83,24 +106,46 @@ func (mx *Measurer) RunAsync(
 	if URL.Scheme != "http" && URL.Scheme != "https" {
 		return nil, ErrUnsupportedInput
 	}
-	// 2. Find the testhelper
+	// 2. Find the testhelpers
 	testhelpers, _ := sess.GetTestHelpersByName("web-connectivity")
-	var testhelper *model.OOAPIService
-	for _, th := range testhelpers {
-		if th.Type == "https" {
-			testhelper = &th
-			break
-		}
-	}
-	if testhelper == nil {
+	thURLs := mx.thURLs(testhelpers)
+	if len(thURLs) <= 0 {
 		return nil, ErrNoAvailableTestHelpers
 	}
-	testhelper.Address = "https://1.th.ooni.org/api/v1/websteps" // TODO(bassosimone): remove!
 	out := make(chan *model.ExperimentAsyncTestKeys)
-	go mx.runAsync(ctx, sess, input, testhelper, out)
+	go mx.runAsync(ctx, sess, input, thURLs, out)
 	return out, nil
 }
 
+// thPath is the path of the websteps TH API.
+const thPath = "/api/v1/websteps"
+
+// thURLs returns the websteps URLs of the given https test helpers
+// (e.g., https://1.th.ooni.org/api/v1/websteps for the test helper
+// https://1.th.ooni.org) without duplicates.
+func (mx *Measurer) thURLs(testhelpers []model.OOAPIService) (out []string) {
+	dups := map[string]bool{}
+	for _, th := range testhelpers {
+		if th.Type != "https" {
+			continue
+		}
+		URL, err := url.Parse(th.Address)
+		if err != nil || URL.Scheme != "https" || URL.Host == "" {
+			continue
+		}
+		thURL := (&url.URL{Scheme: URL.Scheme, Host: URL.Host, Path: thPath}).String()
+		if dups[thURL] {
+			continue
+		}
+		dups[thURL] = true
+		out = append(out, thURL)
+		if mx.Config.MaxTestHelpers > 0 && int64(len(out)) >= mx.Config.MaxTestHelpers {
+			break
+		}
+	}
+	return
+}
+
 var measurerResolvers = []*measurex.ResolverInfo{{
 	Network: "system",
 	Address: "",
@@ -110,21 +155,38 @@ var measurerResolvers = []*measurex.ResolverInfo{{
 }}
 
 func (mx *Measurer) runAsync(ctx context.Context, sess model.ExperimentSession,
-	URL string, th *model.OOAPIService, out chan<- *model.ExperimentAsyncTestKeys) {
+	URL string, thURLs []string, out chan<- *model.ExperimentAsyncTestKeys) {
 	defer close(out)
-	helper := &measurerMeasureURLHelper{
-		Clnt:      sess.DefaultHTTPClient(),
-		Logger:    sess.Logger(),
-		THURL:     th.Address,
-		UserAgent: sess.UserAgent(),
+	var helpers []measurex.MeasureURLHelper
+	for _, thURL := range thURLs {
+		helpers = append(helpers, &measurerMeasureURLHelper{
+			Clnt:      sess.DefaultHTTPClient(),
+			Logger:    sess.Logger(),
+			THURL:     thURL,
+			UserAgent: sess.UserAgent(),
+		})
 	}
 	mmx := &measurex.Measurer{
-		Begin:            time.Now(),
-		HTTPClient:       sess.DefaultHTTPClient(),
-		MeasureURLHelper: helper,
-		Logger:           sess.Logger(),
-		Resolvers:        measurerResolvers,
-		TLSHandshaker:    netxlite.NewTLSHandshakerStdlib(sess.Logger()),
+		Begin:                 time.Now(),
+		HTTPClient:            sess.DefaultHTTPClient(),
+		MeasureALPNSeparately: mx.Config.MeasureALPNSeparately,
+		MeasureURLHelpers:     helpers,
+		Logger:                sess.Logger(),
+		Resolvers:             measurerResolvers,
+		TLSHandshaker:         netxlite.NewTLSHandshakerStdlib(sess.Logger()),
+	}
+	if mx.Config.EventsFile != "" {
+		filep, err := os.OpenFile(mx.Config.EventsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			sess.Logger().Warnf("webstepsx: cannot open events file: %s", err.Error())
+		} else {
+			defer filep.Close()
+			mmx.EventsDB = measurex.NewJSONLWriterDB(filep)
+		}
+	}
+	blockpages := mx.Blockpages
+	if blockpages == nil {
+		blockpages = blockpage.LoadOrDefault(sess.Logger(), sess.KeyValueStore())
 	}
 	cookies := measurex.NewCookieJar()
 	const parallelism = 3
@@ -143,6 +205,7 @@ func (mx *Measurer) runAsync(ctx context.Context, sess model.ExperimentSession,
 			MeasurementRuntime: m.TotalRuntime.Seconds(),
 			TestKeys: &TestKeys{
 				ArchivalURLMeasurement: measurex.NewArchivalURLMeasurement(m),
+				Analysis:               analysis.AnalyzeURLMeasurementWithBlockpages(m, blockpages),
 			},
 		}
 	}
@@ -218,6 +281,15 @@ type SummaryKeys struct {
 
 // GetSummaryKeys implements model.ExperimentMeasurer.GetSummaryKeys.
 func (mx *Measurer) GetSummaryKeys(measurement *model.Measurement) (interface{}, error) {
-	sk := SummaryKeys{}
+	sk := SummaryKeys{IsAnomaly: false}
+	tk, ok := measurement.TestKeys.(*TestKeys)
+	if !ok {
+		return sk, errors.New("invalid test keys type")
+	}
+	if tk.Analysis != nil {
+		sk.Accessible = tk.Analysis.Accessible
+		sk.Blocking = string(tk.Analysis.Blocking)
+		sk.IsAnomaly = tk.Analysis.Blocking != analysis.BlockingNone
+	}
 	return sk, nil
 }
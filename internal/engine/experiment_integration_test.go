@@ -437,6 +437,33 @@ func TestOpenReportIdempotent(t *testing.T) {
 	}
 }
 
+func TestResumeReport(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip test in short mode")
+	}
+	sess := newSessionForTesting(t)
+	defer sess.Close()
+	builder, err := sess.NewExperimentBuilder("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := builder.NewExperiment()
+	if err := exp.OpenReport(); err != nil {
+		t.Fatal(err)
+	}
+	rid := exp.ReportID()
+	exp = builder.NewExperiment()
+	if err := exp.ResumeReportContext(context.Background(), "antani"); err == nil {
+		t.Fatal("we should not be able to resume a nonexistent report")
+	}
+	if err := exp.ResumeReportContext(context.Background(), rid); err != nil {
+		t.Fatal(err)
+	}
+	if exp.ReportID() != rid {
+		t.Fatal("we did not resume the report")
+	}
+}
+
 func TestOpenReportFailure(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skip test in short mode")
@@ -186,6 +186,32 @@ func (b *ExperimentBuilder) NewExperiment() *Experiment {
 	return experiment
 }
 
+// NewExperimentWithOptions is like NewExperiment except that the
+// experiment also uses the given options, which take precedence over
+// the ones set using the SetOption family of methods. This method
+// does not modify the builder's config, hence you can safely call
+// it from several goroutines, provided that you do not call any of
+// the SetOption methods concurrently.
+func (b *ExperimentBuilder) NewExperimentWithOptions(opts map[string]string) (*Experiment, error) {
+	config := reflect.ValueOf(b.config)
+	if config.Kind() != reflect.Ptr {
+		return nil, errors.New("config is not a pointer")
+	}
+	clone := reflect.New(config.Elem().Type())
+	clone.Elem().Set(config.Elem())
+	builder := &ExperimentBuilder{
+		build:         b.build,
+		callbacks:     b.callbacks,
+		config:        clone.Interface(),
+		inputPolicy:   b.inputPolicy,
+		interruptible: b.interruptible,
+	}
+	if err := builder.SetOptionsGuessType(opts); err != nil {
+		return nil, err
+	}
+	return builder.NewExperiment(), nil
+}
+
 // canonicalizeExperimentName allows code to provide experiment names
 // in a more flexible way, where we have aliases.
 //
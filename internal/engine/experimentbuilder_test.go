@@ -188,3 +188,46 @@ func TestExperimentBuilderSetOptionGuessType(t *testing.T) {
 		}
 	})
 }
+
+func TestExperimentBuilderNewExperimentWithOptions(t *testing.T) {
+	var configs []example.Config
+	b := &ExperimentBuilder{
+		build: func(config interface{}) *Experiment {
+			configs = append(configs, *config.(*example.Config))
+			return &Experiment{}
+		},
+		config: &example.Config{Message: "antani", SleepTime: 10},
+	}
+	t.Run("we use the options", func(t *testing.T) {
+		exp, err := b.NewExperimentWithOptions(map[string]string{"Message": "mascetti"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp == nil {
+			t.Fatal("expected non-nil experiment here")
+		}
+		expect := example.Config{Message: "mascetti", SleepTime: 10}
+		if len(configs) != 1 || configs[0] != expect {
+			t.Fatal("unexpected configs", configs)
+		}
+		// the builder's config must not change
+		if *b.config.(*example.Config) != (example.Config{Message: "antani", SleepTime: 10}) {
+			t.Fatal("the builder's config changed", b.config)
+		}
+	})
+	t.Run("with an invalid option", func(t *testing.T) {
+		exp, err := b.NewExperimentWithOptions(map[string]string{"Antani": "true"})
+		if err == nil || err.Error() != "no such field" {
+			t.Fatal("not the error we expected", err)
+		}
+		if exp != nil {
+			t.Fatal("expected nil experiment here")
+		}
+	})
+	t.Run("when config is not a pointer", func(t *testing.T) {
+		b := &ExperimentBuilder{config: 17}
+		if _, err := b.NewExperimentWithOptions(nil); err == nil {
+			t.Fatal("expected an error here")
+		}
+	})
+}
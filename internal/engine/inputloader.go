@@ -3,15 +3,22 @@ package engine
 import (
 	"bufio"
 	"context"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"net"
 	"net/url"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/apex/log"
 	"github.com/ooni/probe-cli/v3/internal/fsx"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/stuninput"
+	"golang.org/x/net/idna"
 )
 
 // These errors are returned by the InputLoader.
@@ -21,6 +28,8 @@ var (
 	ErrInputRequired     = errors.New("no input provided")
 	ErrNoInputExpected   = errors.New("we did not expect any input")
 	ErrNoStaticInput     = errors.New("no static input for this experiment")
+	ErrInvalidInputFile  = errors.New("invalid input file")
+	ErrNoValidInput      = errors.New("no valid input")
 )
 
 // InputLoaderSession is the session according to an InputLoader. We
@@ -71,6 +80,16 @@ type InputLoaderLogger interface {
 //
 // We gather input from StaticInput and SourceFiles. If there is
 // input, we return it. Otherwise, we return an error.
+//
+// Input normalization
+//
+// Regardless of the policy, we canonicalize URL inputs by lowercasing
+// their scheme and host, converting the host to IDNA, and removing the
+// default HTTP and HTTPS ports. We then remove duplicate inputs as well
+// as inputs the experiment cannot measure (e.g., a web_connectivity
+// input that is not an HTTP or HTTPS URL). We emit a warning for each
+// input we remove and we fail with ErrNoValidInput if we remove all of
+// them, so that a typo in an input file does not go unnoticed.
 type InputLoader struct {
 	// CheckInConfig contains options for the CheckIn API. If
 	// not set, then we'll create a default config. If set but
@@ -78,8 +97,9 @@ type InputLoader struct {
 	// will set them to a default value.
 	CheckInConfig *model.OOAPICheckInConfig
 
-	// ExperimentName is the name of the experiment. This field
-	// is only used together with the InputOrStaticDefault policy.
+	// ExperimentName is the name of the experiment. We use this
+	// field to select the static input with the InputOrStaticDefault
+	// policy and to know which URL schemes the experiment supports.
 	ExperimentName string
 
 	// InputPolicy specifies the input policy for the
@@ -105,12 +125,31 @@ type InputLoader struct {
 	// from. Each file should contain a single input string
 	// per line. We will fail if any file is unreadable
 	// as well as if any file is empty.
+	//
+	// Files ending in ".jsonl" instead contain a JSON object
+	// per line with the same structure of model.OOAPIURLInfo,
+	// i.e., `url`, `category_code`, `country_code`, and an
+	// `options` object mapping option names to values.
+	//
+	// Files ending in ".csv" instead are CSV files whose header
+	// contains at least the `url` column and optionally the
+	// `category_code`, `country_code`, and `options` columns, where
+	// options use the `KEY=VALUE;KEY=VALUE` format.
 	SourceFiles []string
 }
 
 // Load attempts to load input using the specified input loader. We will
 // return a list of URLs because this is the only input we support.
 func (il *InputLoader) Load(ctx context.Context) ([]model.OOAPIURLInfo, error) {
+	inputs, err := il.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return il.normalize(inputs)
+}
+
+// load loads input according to the input policy.
+func (il *InputLoader) load(ctx context.Context) ([]model.OOAPIURLInfo, error) {
 	switch il.InputPolicy {
 	case InputOptional:
 		return il.loadOptional()
@@ -241,16 +280,28 @@ type inputLoaderOpenFn func(filepath string) (fs.File, error)
 // readfile reads inputs from the specified file. The open argument should be
 // compatible with stdlib's fs.Open and helps us with unit testing.
 func (il *InputLoader) readfile(filepath string, open inputLoaderOpenFn) ([]model.OOAPIURLInfo, error) {
-	inputs := []model.OOAPIURLInfo{}
 	filep, err := open(filepath)
 	if err != nil {
 		return nil, err
 	}
 	defer filep.Close()
+	switch ext := strings.ToLower(filepath); {
+	case strings.HasSuffix(ext, ".csv"):
+		return il.readcsv(filepath, filep)
+	case strings.HasSuffix(ext, ".jsonl"):
+		return il.readjsonl(filepath, filep)
+	default:
+		return il.readlines(filep)
+	}
+}
+
+// readlines reads a file containing an input string per line.
+func (il *InputLoader) readlines(reader io.Reader) ([]model.OOAPIURLInfo, error) {
+	inputs := []model.OOAPIURLInfo{}
 	// Implementation note: when you save file with vim, you have newline at
 	// end of file and you don't want to consider that an input line. While there
 	// ignore any other empty line that may occur inside the file.
-	scanner := bufio.NewScanner(filep)
+	scanner := bufio.NewScanner(reader)
 	for scanner.Scan() {
 		line := scanner.Text()
 		if line != "" {
@@ -263,6 +314,126 @@ func (il *InputLoader) readfile(filepath string, open inputLoaderOpenFn) ([]mode
 	return inputs, nil
 }
 
+// readjsonl reads a file containing a JSON object per line.
+func (il *InputLoader) readjsonl(filepath string, reader io.Reader) ([]model.OOAPIURLInfo, error) {
+	inputs := []model.OOAPIURLInfo{}
+	scanner := bufio.NewScanner(reader)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue // same as readlines
+		}
+		var input model.OOAPIURLInfo
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.DisallowUnknownFields() // catch typos
+		if err := decoder.Decode(&input); err != nil {
+			return nil, newInputFileError(filepath, lineno, err)
+		}
+		if input.URL == "" {
+			return nil, newInputFileError(filepath, lineno, errors.New("missing url"))
+		}
+		inputs = append(inputs, input)
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+	return inputs, nil
+}
+
+// readcsv reads a CSV file with a header row.
+func (il *InputLoader) readcsv(filepath string, reader io.Reader) ([]model.OOAPIURLInfo, error) {
+	inputs := []model.OOAPIURLInfo{}
+	csvReader := csv.NewReader(reader)
+	header, err := csvReader.Read()
+	if errors.Is(err, io.EOF) {
+		return inputs, nil // the caller deals with empty files
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrInvalidInputFile, filepath, err.Error())
+	}
+	columns := make(map[string]int)
+	for idx, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "url", "category_code", "country_code", "options":
+			columns[name] = idx
+		default:
+			return nil, newInputFileError(filepath, 1, fmt.Errorf("unknown column: %s", name))
+		}
+	}
+	if _, found := columns["url"]; !found {
+		return nil, newInputFileError(filepath, 1, errors.New("missing url column"))
+	}
+	column := func(record []string, name string) string {
+		if idx, found := columns[name]; found {
+			return strings.TrimSpace(record[idx])
+		}
+		return ""
+	}
+	for row := 2; ; row++ {
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrInvalidInputFile, filepath, err.Error())
+		}
+		input := model.OOAPIURLInfo{
+			CategoryCode: column(record, "category_code"),
+			CountryCode:  column(record, "country_code"),
+			URL:          column(record, "url"),
+		}
+		if input.URL == "" {
+			return nil, newInputFileError(filepath, row, errors.New("missing url"))
+		}
+		input.Options, err = parseInputOptions(column(record, "options"))
+		if err != nil {
+			return nil, newInputFileError(filepath, row, err)
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, nil
+}
+
+// parseInputOptions parses options using the KEY=VALUE;KEY=VALUE format.
+func parseInputOptions(value string) (map[string]string, error) {
+	var options map[string]string
+	for _, option := range strings.Split(value, ";") {
+		if option = strings.TrimSpace(option); option == "" {
+			continue
+		}
+		v := strings.SplitN(option, "=", 2)
+		if len(v) != 2 || v[0] == "" {
+			return nil, fmt.Errorf("invalid option: %s", option)
+		}
+		if options == nil {
+			options = make(map[string]string)
+		}
+		options[v[0]] = v[1]
+	}
+	return options, nil
+}
+
+// newInputFileError returns an error wrapping ErrInvalidInputFile
+// that describes an error at the given line of the given file.
+func newInputFileError(filepath string, lineno int, err error) error {
+	return fmt.Errorf("%w: %s:%d: %s", ErrInvalidInputFile, filepath, lineno, err.Error())
+}
+
+// InputAnnotations returns the annotations describing the given input,
+// i.e., its category code and country code, if known. We add these
+// annotations to the measurements of the given input.
+func InputAnnotations(input model.OOAPIURLInfo) map[string]string {
+	annotations := make(map[string]string)
+	if input.CategoryCode != "" {
+		annotations["input_category_code"] = input.CategoryCode
+	}
+	if input.CountryCode != "" {
+		annotations["input_country_code"] = input.CountryCode
+	}
+	return annotations
+}
+
 // loadRemote loads inputs from a remote source.
 func (il *InputLoader) loadRemote(ctx context.Context) ([]model.OOAPIURLInfo, error) {
 	config := il.CheckInConfig
@@ -325,6 +496,148 @@ func (il *InputLoader) preventMistakes(input []model.OOAPIURLInfo, categories []
 	return
 }
 
+// inputURLSchemes contains the URL schemes supported by the experiments
+// whose input MUST be a URL. We do not validate the input of experiments
+// not listed here, because it may not be a URL (e.g., a domain name).
+var inputURLSchemes = map[string][]string{
+	"dnscheck":         {"https", "h3", "dot", "udp", "tcp", "quic"},
+	"stunreachability": {"stun"},
+	"web_connectivity": {"http", "https"},
+	"websteps":         {"http", "https"},
+}
+
+// inputRejection is an input removed by normalizeInputs.
+type inputRejection struct {
+	// Input is the removed input.
+	Input model.OOAPIURLInfo
+
+	// Reason explains why we removed the input.
+	Reason string
+}
+
+// normalize normalizes the inputs using normalizeInputs and logs the
+// inputs we have removed. We fail if we removed all the inputs.
+func (il *InputLoader) normalize(inputs []model.OOAPIURLInfo) ([]model.OOAPIURLInfo, error) {
+	output, rejected := normalizeInputs(il.ExperimentName, inputs)
+	for _, entry := range rejected {
+		il.logger().Warnf("inputloader: skipping %s: %s", entry.Input.URL, entry.Reason)
+	}
+	if len(rejected) > 0 && len(output) <= 0 {
+		return nil, fmt.Errorf("%w: skipped all %d inputs", ErrNoValidInput, len(rejected))
+	}
+	if len(rejected) > 0 {
+		il.logger().Warnf("inputloader: skipped %d out of %d inputs", len(rejected), len(inputs))
+	}
+	return output, nil
+}
+
+// normalizeInputs canonicalizes the inputs of the given experiment and
+// returns the inputs to measure as well as the ones we removed because
+// they are invalid or duplicate. We keep the empty input, which we use
+// to run experiments taking no input, and the first of several inputs
+// with the same URL and options.
+func normalizeInputs(experimentName string, inputs []model.OOAPIURLInfo) (
+	output []model.OOAPIURLInfo, rejected []inputRejection) {
+	schemes := inputURLSchemes[canonicalizeExperimentName(experimentName)]
+	seen := make(map[string]bool)
+	for _, input := range inputs {
+		if input.URL != "" {
+			URL, err := canonicalizeInputURL(input.URL, schemes)
+			if err != nil {
+				rejected = append(rejected, inputRejection{Input: input, Reason: err.Error()})
+				continue
+			}
+			input.URL = URL
+		}
+		key := strings.Join(append([]string{input.URL}, formatInputOptions(input.Options)...), "\n")
+		if seen[key] {
+			rejected = append(rejected, inputRejection{Input: input, Reason: "duplicate input"})
+			continue
+		}
+		seen[key] = true
+		output = append(output, input)
+	}
+	return
+}
+
+// canonicalizeInputURL canonicalizes the given input URL. When schemes is
+// not empty, we require the input to be a URL using one of such schemes and
+// having a host. Otherwise, we return any input that is not a URL with a
+// scheme and a host as is. To avoid changing the URLs from the test lists,
+// we only reformat the URL if we need to modify its scheme or host.
+func canonicalizeInputURL(input string, schemes []string) (string, error) {
+	input = strings.TrimSpace(input)
+	URL, err := url.Parse(input)
+	if err != nil {
+		if len(schemes) <= 0 {
+			return input, nil
+		}
+		return "", err
+	}
+	if len(schemes) > 0 {
+		if err := checkInputURLScheme(URL.Scheme, schemes); err != nil {
+			return "", err
+		}
+		if URL.Host == "" {
+			return "", errors.New("missing host")
+		}
+	}
+	if URL.Scheme == "" || URL.Host == "" {
+		return input, nil
+	}
+	host, err := canonicalizeInputHost(URL.Hostname())
+	if err != nil {
+		return "", err
+	}
+	switch port, scheme := URL.Port(), URL.Scheme; {
+	case port == "" || (scheme == "http" && port == "80") || (scheme == "https" && port == "443"):
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6 address
+		}
+	default:
+		host = net.JoinHostPort(host, port)
+	}
+	// Note that url.Parse already lowercases the scheme.
+	if strings.HasPrefix(input, URL.Scheme+":") && host == URL.Host {
+		return input, nil
+	}
+	URL.Host = host
+	return URL.String(), nil
+}
+
+// checkInputURLScheme checks whether the scheme is one of the given schemes.
+func checkInputURLScheme(scheme string, schemes []string) error {
+	if scheme == "" {
+		return errors.New("missing URL scheme")
+	}
+	for _, s := range schemes {
+		if scheme == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported URL scheme: %s", scheme)
+}
+
+// inputIDNAProfile is the IDNA profile we use to canonicalize hosts. Unlike
+// idna.ToASCII, which netxlite's resolverIDNA uses, this profile rejects invalid
+// labels. Unlike idna.Lookup, it accepts underscores, which occur in the wild.
+var inputIDNAProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false))
+
+// canonicalizeInputHost lowercases the host and converts it to IDNA.
+func canonicalizeInputHost(host string) (string, error) {
+	if net.ParseIP(host) != nil {
+		return strings.ToLower(host), nil
+	}
+	if !utf8.ValidString(host) {
+		return "", errors.New("invalid host: invalid UTF-8")
+	}
+	host, err := inputIDNAProfile.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid host: %w", err)
+	}
+	return host, nil
+}
+
 // logger returns the configured logger or apex/log's default.
 func (il *InputLoader) logger() InputLoaderLogger {
 	if il.Logger != nil {
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"syscall"
 	"testing"
+	"testing/fstest"
 
 	"github.com/apex/log"
 	"github.com/google/go-cmp/cmp"
@@ -441,6 +442,227 @@ func TestInputLoaderReadfileScannerFailure(t *testing.T) {
 	}
 }
 
+func TestInputLoaderStructuredFiles(t *testing.T) {
+	il := &InputLoader{
+		InputPolicy: InputStrictlyRequired,
+		SourceFiles: []string{
+			"testdata/inputloader4.jsonl",
+			"testdata/inputloader5.csv",
+		},
+	}
+	out, err := il.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []model.OOAPIURLInfo{{
+		CategoryCode: "NEWS",
+		CountryCode:  "IT",
+		URL:          "https://www.example.com/",
+	}, {
+		CategoryCode: "MISC",
+		URL:          "dot://8.8.8.8:853/",
+		Options:      map[string]string{"TLSServerName": "dns.google"},
+	}, {
+		CategoryCode: "HUMR",
+		CountryCode:  "DE",
+		URL:          "https://www.example.org/",
+	}, {
+		CategoryCode: "MISC",
+		URL:          "https://1.1.1.1/dns-query",
+		Options: map[string]string{
+			"TLSServerName": "cloudflare-dns.com",
+			"TLSVersion":    "TLSv1.3",
+		},
+	}}
+	if diff := cmp.Diff(expect, out); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestInputLoaderStructuredFilesErrors(t *testing.T) {
+	files := fstest.MapFS{
+		"empty.csv":          {Data: []byte("")},
+		"header-only.CSV":    {Data: []byte("url,category_code\n")},
+		"unknown-column.csv": {Data: []byte("url,antani\nhttps://x.org/,1\n")},
+		"missing-url.csv":    {Data: []byte("category_code\nNEWS\n")},
+		"empty-url.csv":      {Data: []byte("url,category_code\n,NEWS\n")},
+		"bad-option.csv":     {Data: []byte("url,options\nhttps://x.org/,antani\n")},
+		"bad-row.csv":        {Data: []byte("url,options\nhttps://x.org/\n")},
+		"bad-json.jsonl":     {Data: []byte("{\"url\": \"https://x.org/\"}\n{\n")},
+		"unknown-key.jsonl":  {Data: []byte("{\"url\": \"https://x.org/\", \"antani\": 1}\n")},
+		"empty-url.jsonl":    {Data: []byte("{\"category_code\": \"NEWS\"}\n")},
+	}
+	expect := map[string]string{
+		"unknown-column.csv": "invalid input file: unknown-column.csv:1: unknown column: antani",
+		"missing-url.csv":    "invalid input file: missing-url.csv:1: missing url column",
+		"empty-url.csv":      "invalid input file: empty-url.csv:2: missing url",
+		"bad-option.csv":     "invalid input file: bad-option.csv:2: invalid option: antani",
+		"bad-row.csv":        "invalid input file: bad-row.csv: record on line 2: wrong number of fields",
+		"bad-json.jsonl":     "invalid input file: bad-json.jsonl:2: unexpected EOF",
+		"unknown-key.jsonl":  "invalid input file: unknown-key.jsonl:1: json: unknown field \"antani\"",
+		"empty-url.jsonl":    "invalid input file: empty-url.jsonl:1: missing url",
+	}
+	il := &InputLoader{}
+	for name, message := range expect {
+		out, err := il.readfile(name, files.Open)
+		if !errors.Is(err, ErrInvalidInputFile) || err.Error() != message {
+			t.Fatal("not the error we expected", name, err)
+		}
+		if out != nil {
+			t.Fatal("not the output we expected", name)
+		}
+	}
+	for _, name := range []string{"empty.csv", "header-only.CSV"} {
+		out, err := il.readfile(name, files.Open)
+		if err != nil || len(out) != 0 {
+			t.Fatal("unexpected result", name, out, err)
+		}
+	}
+}
+
+func TestInputAnnotations(t *testing.T) {
+	annotations := InputAnnotations(model.OOAPIURLInfo{
+		CategoryCode: "NEWS",
+		CountryCode:  "IT",
+		URL:          "https://www.example.com/",
+	})
+	expect := map[string]string{
+		"input_category_code": "NEWS",
+		"input_country_code":  "IT",
+	}
+	if diff := cmp.Diff(expect, annotations); diff != "" {
+		t.Fatal(diff)
+	}
+	if annotations := InputAnnotations(model.OOAPIURLInfo{URL: "https://x.org/"}); len(annotations) != 0 {
+		t.Fatal("unexpected annotations", annotations)
+	}
+}
+
+func TestNormalizeInputs(t *testing.T) {
+	t.Run("with an experiment taking URLs", func(t *testing.T) {
+		inputs := []model.OOAPIURLInfo{
+			{URL: "  HTTPS://WWW.Example.COM:443/Path?q=A  ", CategoryCode: "NEWS"},
+			{URL: "https://www.example.com/Path?q=A"},
+			{URL: "https://www.example.com/Path?q=A", Options: map[string]string{"A": "b"}},
+			{URL: "http://bücher.example:8080/"},
+			{URL: "http://[2001:DB8::1]:80/"},
+			{URL: "www.example.com"},
+			{URL: "ftp://www.example.com/"},
+			{URL: "https:///path"},
+			{URL: "https://a b.com/"},
+			{URL: "https://xn--a.com/"},
+			{URL: "https://a%ffb.com/"},
+			{URL: "http://_dmarc.example.com/"},
+		}
+		output, rejected := normalizeInputs("WebConnectivity", inputs)
+		expectOutput := []model.OOAPIURLInfo{
+			{URL: "https://www.example.com/Path?q=A", CategoryCode: "NEWS"},
+			{URL: "https://www.example.com/Path?q=A", Options: map[string]string{"A": "b"}},
+			{URL: "http://xn--bcher-kva.example:8080/"},
+			{URL: "http://[2001:db8::1]/"},
+			{URL: "http://_dmarc.example.com/"},
+		}
+		if diff := cmp.Diff(expectOutput, output); diff != "" {
+			t.Fatal(diff)
+		}
+		var reasons []string
+		for _, entry := range rejected {
+			reasons = append(reasons, entry.Reason)
+		}
+		expectReasons := []string{
+			"duplicate input",
+			"missing URL scheme",
+			"unsupported URL scheme: ftp",
+			"missing host",
+			"parse \"https://a b.com/\": invalid character \" \" in host name",
+			"invalid host: idna: invalid label \"\\u0080\"",
+			"invalid host: invalid UTF-8",
+		}
+		if diff := cmp.Diff(expectReasons, reasons); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with an experiment taking other inputs", func(t *testing.T) {
+		inputs := []model.OOAPIURLInfo{
+			{URL: "www.example.com"},
+			{URL: "www.example.com:443"},
+			{URL: "www.example.com"},
+			{URL: "dnslookup://WWW.EXAMPLE.COM"},
+			{},
+		}
+		output, rejected := normalizeInputs("urlgetter", inputs)
+		expectOutput := []model.OOAPIURLInfo{
+			{URL: "www.example.com"},
+			{URL: "www.example.com:443"},
+			{URL: "dnslookup://www.example.com"},
+			{},
+		}
+		if diff := cmp.Diff(expectOutput, output); diff != "" {
+			t.Fatal(diff)
+		}
+		if len(rejected) != 1 || rejected[0].Reason != "duplicate input" {
+			t.Fatal("unexpected rejected inputs", rejected)
+		}
+	})
+}
+
+func TestInputLoaderNormalizesInputs(t *testing.T) {
+	t.Run("when some inputs are valid", func(t *testing.T) {
+		il := &InputLoader{
+			ExperimentName: "web_connectivity",
+			InputPolicy:    InputStrictlyRequired,
+			StaticInputs:   []string{"https://www.example.com/", "www.example.com", "HTTPS://www.example.com/"},
+		}
+		out, err := il.Load(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]model.OOAPIURLInfo{{URL: "https://www.example.com/"}}, out); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("when all inputs are invalid", func(t *testing.T) {
+		il := &InputLoader{
+			ExperimentName: "stunreachability",
+			InputPolicy:    InputOrStaticDefault,
+			StaticInputs:   []string{"https://www.example.com/"},
+		}
+		out, err := il.Load(context.Background())
+		if !errors.Is(err, ErrNoValidInput) {
+			t.Fatal("not the error we expected", err)
+		}
+		if out != nil {
+			t.Fatal("not the output we expected")
+		}
+	})
+
+	t.Run("with inputs from the backend", func(t *testing.T) {
+		il := &InputLoader{
+			ExperimentName: "web_connectivity",
+			InputPolicy:    InputOrQueryBackend,
+			Session: &InputLoaderMockableSession{
+				Output: &model.OOAPICheckInInfo{
+					WebConnectivity: &model.OOAPICheckInInfoWebConnectivity{
+						URLs: []model.OOAPIURLInfo{
+							{URL: "https://www.example.com/"},
+							{URL: "https://www.example.com:443/"},
+						},
+					},
+				},
+			},
+		}
+		out, err := il.Load(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]model.OOAPIURLInfo{{URL: "https://www.example.com/"}}, out); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
 // InputLoaderMockableSession is a mockable session
 // used by InputLoader tests.
 type InputLoaderMockableSession struct {
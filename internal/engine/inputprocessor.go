@@ -2,6 +2,10 @@ package engine
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/ooni/probe-cli/v3/internal/model"
@@ -45,12 +49,31 @@ type InputProcessor struct {
 	// Annotations contains the measurement annotations
 	Annotations map[string]string
 
+	// Checkpointer is the OPTIONAL code that saves the progress
+	// of Run after each input, so that we can later resume an
+	// interrupted run (see Checkpoint). We clear the checkpoint
+	// once we have measured all the inputs.
+	Checkpointer InputProcessorCheckpointer
+
+	// Completed OPTIONALLY contains the indexes of the inputs
+	// that a previous run we're resuming has already measured
+	// (see Checkpoint). We skip these inputs.
+	Completed []int
+
 	// Experiment is the code that will run the experiment.
 	Experiment InputProcessorExperimentWrapper
 
 	// Inputs is the list of inputs to measure.
 	Inputs []model.OOAPIURLInfo
 
+	// NewExperimentWithOptions is the OPTIONAL function creating the
+	// experiment for measuring an input with per-input options (see
+	// model.OOAPIURLInfo.Options), e.g., by calling the ExperimentBuilder's
+	// NewExperimentWithOptions method. If this function is nil, we
+	// fail when we encounter an input with per-input options.
+	NewExperimentWithOptions func(
+		options map[string]string) (InputProcessorExperimentWrapper, error)
+
 	// MaxRuntime is the optional maximum runtime
 	// when looping over a list of inputs (e.g. when
 	// running Web Connectivity). Zero means that
@@ -60,6 +83,11 @@ type InputProcessor struct {
 	// Options contains command line options for this experiment.
 	Options []string
 
+	// Parallelism is the OPTIONAL number of inputs that we
+	// measure concurrently. Zero or one means that we measure
+	// the inputs sequentially, one after the other.
+	Parallelism int
+
 	// Saver is the code that will save measurement results
 	// on persistent storage (e.g. the file system).
 	Saver InputProcessorSaverWrapper
@@ -67,8 +95,24 @@ type InputProcessor struct {
 	// Submitter is the code that will submit measurements
 	// to the OONI collector.
 	Submitter InputProcessorSubmitterWrapper
+
+	// Unordered OPTIONALLY indicates that, when Parallelism is
+	// greater than one, we should submit and save measurements as
+	// soon as they are available. By default, we submit and save
+	// them following the order of the inputs. In both cases, we
+	// pass the input index to the Submitter and the Saver.
+	Unordered bool
+}
+
+// InputProcessorCheckpointer is InputProcessor's
+// view of a Checkpointer.
+type InputProcessorCheckpointer interface {
+	SaveCheckpoint(cp *Checkpoint) error
+	ClearCheckpoint() error
 }
 
+var _ InputProcessorCheckpointer = &Checkpointer{}
+
 // InputProcessorSaverWrapper is InputProcessor's
 // wrapper for a Saver implementation.
 type InputProcessorSaverWrapper interface {
@@ -136,36 +180,229 @@ const (
 // run is like Run but, in addition to returning an error, it
 // also returns the reason why we stopped.
 func (ip *InputProcessor) run(ctx context.Context) (int, error) {
+	cp := &Checkpoint{
+		Completed: append([]int{}, ip.Completed...),
+		Inputs:    ip.Inputs,
+	}
+	var (
+		reason int
+		err    error
+	)
+	if ip.Parallelism > 1 {
+		reason, err = ip.runParallel(ctx, cp)
+	} else {
+		reason, err = ip.runSerial(ctx, cp)
+	}
+	// Note: when the context is done we may have skipped some inputs
+	// or produced failed measurements, so we keep the checkpoint.
+	if err == nil && reason == stopNormal && ctx.Err() == nil && ip.Checkpointer != nil {
+		err = ip.Checkpointer.ClearCheckpoint()
+	}
+	return reason, err
+}
+
+// runSerial is like run but measures the inputs sequentially.
+func (ip *InputProcessor) runSerial(ctx context.Context, cp *Checkpoint) (int, error) {
 	start := time.Now()
-	for idx, url := range ip.Inputs {
+	for _, idx := range ip.todo() {
 		if ip.MaxRuntime > 0 && time.Since(start) > ip.MaxRuntime {
 			return stopMaxRuntime, nil
 		}
-		input := url.URL
-		var measurements []*model.Measurement
-		source, err := ip.Experiment.MeasureAsync(ctx, input, idx)
-		if err != nil {
+		result := ip.measure(ctx, idx)
+		if result.err != nil {
+			return 0, result.err
+		}
+		if err := ip.submitAndSave(ctx, cp, result); err != nil {
 			return 0, err
 		}
-		// NOTE: we don't want to intermix measuring with submitting
-		// therefore we collect all measurements first
-		for meas := range source {
-			measurements = append(measurements, meas)
-		}
-		for _, meas := range measurements {
-			meas.AddAnnotations(ip.Annotations)
-			meas.Options = ip.Options
-			err = ip.Submitter.Submit(ctx, idx, meas)
-			if err != nil {
-				return 0, err
+	}
+	return stopNormal, nil
+}
+
+// todo returns the indexes of the inputs we need to measure, i.e.,
+// all the inputs except the ones in ip.Completed.
+func (ip *InputProcessor) todo() []int {
+	completed := make(map[int]bool)
+	for _, idx := range ip.Completed {
+		completed[idx] = true
+	}
+	var out []int
+	for idx := range ip.Inputs {
+		if !completed[idx] {
+			out = append(out, idx)
+		}
+	}
+	return out
+}
+
+// inputProcessorResult is the result of measuring an input.
+type inputProcessorResult struct {
+	// idx is the index of the input.
+	idx int
+
+	// measurements contains the measurements.
+	measurements []*model.Measurement
+
+	// err is the error that prevented us from measuring.
+	err error
+}
+
+// errInputOptionsNotSupported indicates that an input has per-input
+// options but the InputProcessor cannot create an experiment using them.
+var errInputOptionsNotSupported = errors.New("inputprocessor: per-input options are not supported")
+
+// measure measures the input with the given index.
+func (ip *InputProcessor) measure(ctx context.Context, idx int) *inputProcessorResult {
+	result := &inputProcessorResult{idx: idx}
+	experiment := ip.Experiment
+	if options := ip.Inputs[idx].Options; len(options) > 0 {
+		if ip.NewExperimentWithOptions == nil {
+			result.err = errInputOptionsNotSupported
+			return result
+		}
+		var err error
+		experiment, err = ip.NewExperimentWithOptions(options)
+		if err != nil {
+			result.err = fmt.Errorf("cannot use options of %s: %w", ip.Inputs[idx].URL, err)
+			return result
+		}
+	}
+	source, err := experiment.MeasureAsync(ctx, ip.Inputs[idx].URL, idx)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	// NOTE: we don't want to intermix measuring with submitting
+	// therefore we collect all measurements first
+	for meas := range source {
+		result.measurements = append(result.measurements, meas)
+	}
+	return result
+}
+
+// submitAndSave submits and saves the measurements in result and
+// then updates and saves the checkpoint.
+func (ip *InputProcessor) submitAndSave(
+	ctx context.Context, cp *Checkpoint, result *inputProcessorResult) error {
+	input := ip.Inputs[result.idx]
+	for _, meas := range result.measurements {
+		meas.AddAnnotations(InputAnnotations(input))
+		meas.AddAnnotations(ip.Annotations) // the user's annotations take precedence
+		meas.Options = ip.Options
+		if len(input.Options) > 0 {
+			meas.Options = append(append([]string{}, ip.Options...), formatInputOptions(input.Options)...)
+		}
+		err := ip.Submitter.Submit(ctx, result.idx, meas)
+		if err != nil {
+			return err
+		}
+		// Note: must be after submission because submission modifies
+		// the measurement to include the report ID.
+		err = ip.Saver.SaveMeasurement(result.idx, meas)
+		if err != nil {
+			return err
+		}
+		if meas.ReportID != "" {
+			cp.ReportID = meas.ReportID
+		}
+	}
+	cp.Completed = append(cp.Completed, result.idx)
+	if ip.Checkpointer != nil {
+		return ip.Checkpointer.SaveCheckpoint(cp)
+	}
+	return nil
+}
+
+// formatInputOptions formats per-input options using the
+// KEY=VALUE format and sorting them by key.
+func formatInputOptions(options map[string]string) (out []string) {
+	for key, value := range options {
+		out = append(out, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(out)
+	return
+}
+
+// runParallel is like run but measures up to ip.Parallelism inputs
+// concurrently. We only submit and save from the calling goroutine,
+// so the Submitter and the Saver need not be goroutine safe, while
+// the Experiment must be. We stop starting new measurements when
+// the context is done, when we exceed ip.MaxRuntime, or when there
+// is an error. In all cases, we wait for the pending measurements
+// to complete before returning. On error, we also cancel them.
+func (ip *InputProcessor) runParallel(ctx context.Context, cp *Checkpoint) (int, error) {
+	start := time.Now()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		reason  = stopNormal
+		results = make(chan *inputProcessorResult)
+		sema    = make(chan bool, ip.Parallelism)
+		todo    = ip.todo()
+		wg      = &sync.WaitGroup{}
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, idx := range todo {
+			select {
+			case sema <- true:
+			case <-ctx.Done():
+				return
 			}
-			// Note: must be after submission because submission modifies
-			// the measurement to include the report ID.
-			err = ip.Saver.SaveMeasurement(idx, meas)
-			if err != nil {
-				return 0, err
+			// Note: we check the runtime after acquiring the semaphore
+			// because we may have been waiting for a while.
+			if ip.MaxRuntime > 0 && time.Since(start) > ip.MaxRuntime {
+				reason = stopMaxRuntime
+				return
 			}
+			wg.Add(1)
+			go func(idx int) {
+				defer wg.Done()
+				result := ip.measure(ctx, idx)
+				<-sema
+				results <- result
+			}(idx)
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	var (
+		err     error
+		next    int
+		pending = make(map[int]*inputProcessorResult)
+	)
+	for result := range results {
+		if err != nil {
+			continue // just drain
+		}
+		if result.err != nil {
+			err = result.err
+			cancel()
+			continue
+		}
+		if ip.Unordered {
+			if err = ip.submitAndSave(ctx, cp, result); err != nil {
+				cancel()
+			}
+			continue
+		}
+		pending[result.idx] = result
+		for err == nil && next < len(todo) && pending[todo[next]] != nil {
+			err = ip.submitAndSave(ctx, cp, pending[todo[next]])
+			delete(pending, todo[next])
+			next++
+		}
+		if err != nil {
+			cancel()
 		}
 	}
-	return stopNormal, nil
+	// Note: reading reason is safe here because we've drained the
+	// results channel, which closes after the goroutine above returns.
+	if err != nil {
+		return 0, err
+	}
+	return reason, nil
 }
@@ -3,9 +3,14 @@ package engine
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
 	"github.com/ooni/probe-cli/v3/internal/model"
 )
 
@@ -206,3 +211,466 @@ func TestInputProcessorMaxRuntime(t *testing.T) {
 		t.Fatal("not terminated by max runtime")
 	}
 }
+
+type FakeParallelInputProcessorExperiment struct {
+	Err        error
+	FailingIdx int
+	SleepTime  func(idx int) time.Duration
+	active     int
+	maxActive  int
+	measured   int
+	mu         sync.Mutex
+}
+
+func (fpipe *FakeParallelInputProcessorExperiment) MeasureAsync(
+	ctx context.Context, input string, idx int) (<-chan *model.Measurement, error) {
+	if fpipe.Err != nil && idx == fpipe.FailingIdx {
+		return nil, fpipe.Err
+	}
+	fpipe.mu.Lock()
+	fpipe.active++
+	if fpipe.active > fpipe.maxActive {
+		fpipe.maxActive = fpipe.active
+	}
+	fpipe.mu.Unlock()
+	out := make(chan *model.Measurement)
+	go func() {
+		defer close(out)
+		select {
+		case <-time.After(fpipe.SleepTime(idx)):
+		case <-ctx.Done():
+		}
+		fpipe.mu.Lock()
+		fpipe.active--
+		fpipe.measured++
+		fpipe.mu.Unlock()
+		out <- &model.Measurement{Input: model.MeasurementTarget(input)}
+	}()
+	return out, nil
+}
+
+type FakeIndexedInputProcessorSaver struct {
+	Idx []int
+	M   []*model.Measurement
+}
+
+func (fiips *FakeIndexedInputProcessorSaver) SaveMeasurement(idx int, m *model.Measurement) error {
+	fiips.Idx = append(fiips.Idx, idx)
+	fiips.M = append(fiips.M, m)
+	return nil
+}
+
+func newFakeInputs(count int) (out []model.OOAPIURLInfo) {
+	for idx := 0; idx < count; idx++ {
+		out = append(out, model.OOAPIURLInfo{URL: fmt.Sprintf("https://www.example.com/%d", idx)})
+	}
+	return
+}
+
+func TestInputProcessorParallel(t *testing.T) {
+	// make later inputs complete earlier to shuffle the results
+	sleepTime := func(idx int) time.Duration {
+		return time.Duration(10-idx) * 5 * time.Millisecond
+	}
+
+	t.Run("with ordered saving", func(t *testing.T) {
+		fpipe := &FakeParallelInputProcessorExperiment{SleepTime: sleepTime}
+		saver := &FakeIndexedInputProcessorSaver{}
+		submitter := &FakeInputProcessorSubmitter{}
+		ip := &InputProcessor{
+			Experiment:  fpipe,
+			Inputs:      newFakeInputs(10),
+			Options:     []string{"fake=true"},
+			Parallelism: 4,
+			Saver:       saver,
+			Submitter:   NewInputProcessorSubmitterWrapper(submitter),
+		}
+		reason, err := ip.run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason != stopNormal {
+			t.Fatal("unexpected reason", reason)
+		}
+		if fpipe.maxActive <= 1 || fpipe.maxActive > 4 {
+			t.Fatal("unexpected parallelism", fpipe.maxActive)
+		}
+		if len(saver.M) != 10 || len(submitter.M) != 10 {
+			t.Fatal("not all measurements saved")
+		}
+		for idx, m := range saver.M {
+			if saver.Idx[idx] != idx || string(m.Input) != ip.Inputs[idx].URL {
+				t.Fatal("unexpected order", idx, saver.Idx[idx], m.Input)
+			}
+			if submitter.M[idx] != m || len(m.Options) != 1 {
+				t.Fatal("unexpected submitted measurement", idx)
+			}
+		}
+	})
+
+	t.Run("with unordered saving", func(t *testing.T) {
+		fpipe := &FakeParallelInputProcessorExperiment{SleepTime: sleepTime}
+		saver := &FakeIndexedInputProcessorSaver{}
+		ip := &InputProcessor{
+			Experiment:  fpipe,
+			Inputs:      newFakeInputs(10),
+			Parallelism: 4,
+			Saver:       saver,
+			Submitter:   NewInputProcessorSubmitterWrapper(&FakeInputProcessorSubmitter{}),
+			Unordered:   true,
+		}
+		if err := ip.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(saver.M) != 10 {
+			t.Fatal("not all measurements saved")
+		}
+		ordered := true
+		for idx, m := range saver.M {
+			if string(m.Input) != ip.Inputs[saver.Idx[idx]].URL {
+				t.Fatal("unexpected index", idx, saver.Idx[idx], m.Input)
+			}
+			ordered = ordered && saver.Idx[idx] == idx
+		}
+		if ordered {
+			t.Fatal("expected unordered results")
+		}
+	})
+
+	t.Run("with max runtime", func(t *testing.T) {
+		fpipe := &FakeParallelInputProcessorExperiment{
+			SleepTime: func(idx int) time.Duration { return 50 * time.Millisecond },
+		}
+		saver := &FakeIndexedInputProcessorSaver{}
+		ip := &InputProcessor{
+			Experiment:  fpipe,
+			Inputs:      newFakeInputs(10),
+			MaxRuntime:  75 * time.Millisecond,
+			Parallelism: 2,
+			Saver:       saver,
+			Submitter:   NewInputProcessorSubmitterWrapper(&FakeInputProcessorSubmitter{}),
+		}
+		reason, err := ip.run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason != stopMaxRuntime {
+			t.Fatal("not terminated by max runtime")
+		}
+		// we start two measurements at t=0 and two at t=50ms, and we
+		// must wait for all of them to complete before returning
+		if fpipe.measured != 4 || len(saver.M) != 4 {
+			t.Fatal("unexpected number of measurements", fpipe.measured, len(saver.M))
+		}
+	})
+
+	t.Run("with measurement failure", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		fpipe := &FakeParallelInputProcessorExperiment{
+			Err:        expected,
+			FailingIdx: 3,
+			SleepTime:  func(idx int) time.Duration { return 10 * time.Second },
+		}
+		ip := &InputProcessor{
+			Experiment:  fpipe,
+			Inputs:      newFakeInputs(10),
+			Parallelism: 4,
+			Saver:       &FakeIndexedInputProcessorSaver{},
+			Submitter:   NewInputProcessorSubmitterWrapper(&FakeInputProcessorSubmitter{}),
+		}
+		// the pending measurements would take 10s but we cancel them
+		if err := ip.Run(context.Background()); !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+		if fpipe.active != 0 {
+			t.Fatal("there are still active measurements")
+		}
+	})
+
+	t.Run("with submission failure", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		fpipe := &FakeParallelInputProcessorExperiment{SleepTime: sleepTime}
+		submitter := &FakeInputProcessorSubmitter{Err: expected}
+		ip := &InputProcessor{
+			Experiment:  fpipe,
+			Inputs:      newFakeInputs(10),
+			Parallelism: 4,
+			Saver:       &FakeIndexedInputProcessorSaver{},
+			Submitter:   NewInputProcessorSubmitterWrapper(submitter),
+		}
+		if err := ip.Run(context.Background()); !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+		if len(submitter.M) != 1 {
+			t.Fatal("unexpected number of submissions", len(submitter.M))
+		}
+	})
+
+	t.Run("with cancelled context", func(t *testing.T) {
+		fpipe := &FakeParallelInputProcessorExperiment{
+			SleepTime: func(idx int) time.Duration { return 10 * time.Second },
+		}
+		saver := &FakeIndexedInputProcessorSaver{}
+		ip := &InputProcessor{
+			Experiment:  fpipe,
+			Inputs:      newFakeInputs(10),
+			Parallelism: 4,
+			Saver:       saver,
+			Submitter:   NewInputProcessorSubmitterWrapper(&FakeInputProcessorSubmitter{}),
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		reason, err := ip.run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason != stopNormal {
+			t.Fatal("unexpected reason", reason)
+		}
+		// we save the interrupted measurements, like when running sequentially
+		if fpipe.measured != 4 || len(saver.M) != 4 {
+			t.Fatal("unexpected number of measurements", fpipe.measured, len(saver.M))
+		}
+	})
+}
+
+type FakeReportIDInputProcessorSubmitter struct {
+	Err         error
+	FailingIdx  int
+	ReportID    string
+	SubmittedAt []int
+}
+
+func (friips *FakeReportIDInputProcessorSubmitter) Submit(
+	ctx context.Context, idx int, m *model.Measurement) error {
+	if friips.Err != nil && idx == friips.FailingIdx {
+		return friips.Err
+	}
+	friips.SubmittedAt = append(friips.SubmittedAt, idx)
+	m.ReportID = friips.ReportID
+	return nil
+}
+
+type FakeInputProcessorCheckpointer struct {
+	Err error
+}
+
+func (fipc *FakeInputProcessorCheckpointer) SaveCheckpoint(cp *Checkpoint) error {
+	return fipc.Err
+}
+
+func (fipc *FakeInputProcessorCheckpointer) ClearCheckpoint() error {
+	return fipc.Err
+}
+
+func TestInputProcessorCheckpoint(t *testing.T) {
+	sleepTime := func(idx int) time.Duration {
+		return time.Duration(10-idx) * time.Millisecond
+	}
+
+	t.Run("interrupting and resuming a run", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		checkpointer := NewCheckpointer(CheckpointerConfig{
+			ExperimentName: "example",
+			KVStore:        &kvstore.Memory{},
+		})
+		submitter := &FakeReportIDInputProcessorSubmitter{
+			Err:        expected,
+			FailingIdx: 3,
+			ReportID:   "xx",
+		}
+		ip := &InputProcessor{
+			Checkpointer: checkpointer,
+			Experiment:   &FakeParallelInputProcessorExperiment{SleepTime: sleepTime},
+			Inputs:       newFakeInputs(6),
+			Saver:        &FakeIndexedInputProcessorSaver{},
+			Submitter:    submitter,
+		}
+		if err := ip.Run(context.Background()); !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+		cp, err := checkpointer.LoadCheckpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]int{0, 1, 2}, cp.Completed); diff != "" {
+			t.Fatal(diff)
+		}
+		if cp.ReportID != "xx" || len(cp.Inputs) != 6 {
+			t.Fatal("unexpected checkpoint", cp)
+		}
+		saver := &FakeIndexedInputProcessorSaver{}
+		submitter.Err = nil
+		ip = &InputProcessor{
+			Checkpointer: checkpointer,
+			Completed:    cp.Completed,
+			Experiment:   &FakeParallelInputProcessorExperiment{SleepTime: sleepTime},
+			Inputs:       cp.Inputs,
+			Saver:        saver,
+			Submitter:    submitter,
+		}
+		if err := ip.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]int{3, 4, 5}, saver.Idx); diff != "" {
+			t.Fatal(diff)
+		}
+		if _, err := checkpointer.LoadCheckpoint(); !errors.Is(err, ErrNoCheckpoint) {
+			t.Fatal("the checkpoint should have been cleared", err)
+		}
+	})
+
+	t.Run("resuming a parallel run", func(t *testing.T) {
+		for _, unordered := range []bool{false, true} {
+			saver := &FakeIndexedInputProcessorSaver{}
+			ip := &InputProcessor{
+				Completed:   []int{0, 2, 5},
+				Experiment:  &FakeParallelInputProcessorExperiment{SleepTime: sleepTime},
+				Inputs:      newFakeInputs(8),
+				Parallelism: 3,
+				Saver:       saver,
+				Submitter:   &FakeReportIDInputProcessorSubmitter{},
+				Unordered:   unordered,
+			}
+			if err := ip.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if unordered {
+				sort.Ints(saver.Idx)
+			}
+			if diff := cmp.Diff([]int{1, 3, 4, 6, 7}, saver.Idx); diff != "" {
+				t.Fatal(unordered, diff)
+			}
+		}
+	})
+
+	t.Run("with a cancelled context we keep the checkpoint", func(t *testing.T) {
+		checkpointer := NewCheckpointer(CheckpointerConfig{
+			ExperimentName: "example",
+			KVStore:        &kvstore.Memory{},
+		})
+		ip := &InputProcessor{
+			Checkpointer: checkpointer,
+			Experiment:   &FakeParallelInputProcessorExperiment{SleepTime: sleepTime},
+			Inputs:       newFakeInputs(2),
+			Saver:        &FakeIndexedInputProcessorSaver{},
+			Submitter:    &FakeReportIDInputProcessorSubmitter{},
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := ip.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := checkpointer.LoadCheckpoint(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("when we cannot save the checkpoint", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		saver := &FakeIndexedInputProcessorSaver{}
+		ip := &InputProcessor{
+			Checkpointer: &FakeInputProcessorCheckpointer{Err: expected},
+			Experiment:   &FakeParallelInputProcessorExperiment{SleepTime: sleepTime},
+			Inputs:       newFakeInputs(4),
+			Parallelism:  2,
+			Saver:        saver,
+			Submitter:    &FakeReportIDInputProcessorSubmitter{},
+		}
+		if err := ip.Run(context.Background()); !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+		if len(saver.M) != 1 {
+			t.Fatal("we should have stopped after the first input")
+		}
+	})
+}
+
+func TestInputProcessorInputOptionsAndAnnotations(t *testing.T) {
+	inputs := []model.OOAPIURLInfo{{
+		CategoryCode: "NEWS",
+		CountryCode:  "IT",
+		URL:          "https://www.example.com/",
+	}, {
+		URL:     "https://www.example.org/",
+		Options: map[string]string{"Message": "antani", "SleepTime": "10"},
+	}}
+
+	t.Run("we use per-input options and annotations", func(t *testing.T) {
+		fipe := &FakeInputProcessorExperiment{}
+		withOptions := &FakeInputProcessorExperiment{}
+		var seenOptions []map[string]string
+		saver := &FakeInputProcessorSaver{}
+		ip := &InputProcessor{
+			Annotations: map[string]string{"input_country_code": "ZZ"},
+			Experiment:  NewInputProcessorExperimentWrapper(fipe),
+			Inputs:      inputs,
+			NewExperimentWithOptions: func(
+				options map[string]string) (InputProcessorExperimentWrapper, error) {
+				seenOptions = append(seenOptions, options)
+				return NewInputProcessorExperimentWrapper(withOptions), nil
+			},
+			Options:   []string{"fake=true"},
+			Saver:     NewInputProcessorSaverWrapper(saver),
+			Submitter: NewInputProcessorSubmitterWrapper(&FakeInputProcessorSubmitter{}),
+		}
+		if err := ip.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(fipe.M) != 1 || len(withOptions.M) != 1 || len(seenOptions) != 1 {
+			t.Fatal("we did not use the experiment with options")
+		}
+		if diff := cmp.Diff(inputs[1].Options, seenOptions[0]); diff != "" {
+			t.Fatal(diff)
+		}
+		if len(saver.M) != 2 {
+			t.Fatal("not all measurements saved")
+		}
+		first, second := saver.M[0], saver.M[1]
+		if first.Annotations["input_category_code"] != "NEWS" {
+			t.Fatal("missing category code annotation")
+		}
+		if first.Annotations["input_country_code"] != "ZZ" {
+			t.Fatal("the user's annotations should take precedence")
+		}
+		if diff := cmp.Diff([]string{"fake=true"}, first.Options); diff != "" {
+			t.Fatal(diff)
+		}
+		expect := []string{"fake=true", "Message=antani", "SleepTime=10"}
+		if diff := cmp.Diff(expect, second.Options); diff != "" {
+			t.Fatal(diff)
+		}
+		if len(ip.Options) != 1 {
+			t.Fatal("we should not modify ip.Options")
+		}
+	})
+
+	t.Run("without NewExperimentWithOptions", func(t *testing.T) {
+		ip := &InputProcessor{
+			Experiment: NewInputProcessorExperimentWrapper(&FakeInputProcessorExperiment{}),
+			Inputs:     inputs,
+			Saver:      NewInputProcessorSaverWrapper(&FakeInputProcessorSaver{}),
+			Submitter:  NewInputProcessorSubmitterWrapper(&FakeInputProcessorSubmitter{}),
+		}
+		if err := ip.Run(context.Background()); !errors.Is(err, errInputOptionsNotSupported) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+
+	t.Run("when we cannot create the experiment", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		ip := &InputProcessor{
+			Experiment: NewInputProcessorExperimentWrapper(&FakeInputProcessorExperiment{}),
+			Inputs:     inputs,
+			NewExperimentWithOptions: func(
+				options map[string]string) (InputProcessorExperimentWrapper, error) {
+				return nil, expected
+			},
+			Saver:     NewInputProcessorSaverWrapper(&FakeInputProcessorSaver{}),
+			Submitter: NewInputProcessorSubmitterWrapper(&FakeInputProcessorSubmitter{}),
+		}
+		if err := ip.Run(context.Background()); !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+}
@@ -22,7 +22,7 @@ const systemResolverURL = "system:///"
 
 // allmakers contains all the makers in a list. We use the http3
 // prefix to indicate we wanna use http3. The code will translate
-// this to https and set the proper netx options.
+// this to the h3 scheme, which netx maps to DNS-over-HTTP/3.
 var allmakers = []*resolvermaker{{
 	url: "https://cloudflare-dns.com/dns-query",
 }, {
@@ -78,11 +78,12 @@ func (r *Resolver) logger() model.Logger {
 }
 
 // newresolver creates a new resolver with the given config and URL. This is
-// where we expand http3 to https and set the h3 options.
+// where we map http3 to the h3 scheme used by netx for DoH3 and set the h3
+// options, so that the archival data says we're using "doh3".
 func (r *Resolver) newresolver(URL string) (childResolver, error) {
 	h3 := strings.HasPrefix(URL, "http3://")
 	if h3 {
-		URL = strings.Replace(URL, "http3://", "https://", 1)
+		URL = strings.Replace(URL, "http3://", "h3://", 1)
 	}
 	return r.clientmaker().Make(netx.Config{
 		BogonIsError: true,
@@ -91,7 +91,7 @@ func TestGetResolverHTTP3(t *testing.T) {
 	if re.Closed != true {
 		t.Fatal("was not closed")
 	}
-	if cmk.savedURL != strings.Replace(URL, "http3://", "https://", 1) {
+	if cmk.savedURL != strings.Replace(URL, "http3://", "h3://", 1) {
 		t.Fatal("not the URL we expected")
 	}
 	if cmk.savedConfig.ByteCounter != bc {
@@ -13,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	archivalx "github.com/ooni/probe-cli/v3/internal/archival"
 	"github.com/ooni/probe-cli/v3/internal/engine/geolocate"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
 	"github.com/ooni/probe-cli/v3/internal/model"
@@ -179,10 +180,17 @@ func newRequestList(begin time.Time, events []trace.Event) []RequestEntry {
 type dnsQueryType string
 
 // NewDNSQueriesList returns a list of DNS queries.
+//
+// We build A and AAAA entries from "resolve_done" events. We also build
+// entries containing all the answer, authority, and additional RRs (e.g.,
+// CNAME chains) from the "resolve_raw_done" events emitted by LookupRaw.
 func NewDNSQueriesList(begin time.Time, events []trace.Event) []DNSQueryEntry {
-	// TODO(bassosimone): add support for CNAME lookups.
 	var out []DNSQueryEntry
 	for _, ev := range events {
+		if ev.Name == "resolve_raw_done" {
+			out = append(out, newDNSRawQueryEntry(begin, ev))
+			continue
+		}
 		if ev.Name != "resolve_done" {
 			continue
 		}
@@ -210,6 +218,25 @@ func NewDNSQueriesList(begin time.Time, events []trace.Event) []DNSQueryEntry {
 	return out
 }
 
+// newDNSRawQueryEntry creates a DNSQueryEntry from a "resolve_raw_done"
+// event. The reply may be available also on failure (e.g., NXDOMAIN).
+func newDNSRawQueryEntry(begin time.Time, ev trace.Event) DNSQueryEntry {
+	entry := DNSQueryEntry{
+		Engine:          ev.Proto,
+		Failure:         NewFailure(ev.Err),
+		Hostname:        ev.Hostname,
+		QueryType:       ev.DNSQueryType,
+		ResolverAddress: ev.Address,
+		T:               ev.Time.Sub(begin).Seconds(),
+	}
+	if ev.DNSRawReply != nil {
+		entry.Answers = archivalx.NewArchivalDNSAnswerList(ev.DNSRawReply.Answer)
+		entry.Authority = archivalx.NewArchivalDNSAnswerList(ev.DNSRawReply.Authority)
+		entry.Additional = archivalx.NewArchivalDNSAnswerList(ev.DNSRawReply.Additional)
+	}
+	return entry
+}
+
 func (qtype dnsQueryType) ipoftype(addr string) bool {
 	switch qtype {
 	case "A":
@@ -14,6 +14,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/archival"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
+	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
@@ -391,6 +392,76 @@ func TestNewDNSQueriesList(t *testing.T) {
 			QueryType: "AAAA",
 			T:         0.2,
 		}},
+	}, {
+		name: "run with raw lookups",
+		args: args{
+			begin: begin,
+			events: []trace.Event{{
+				// We should not archive round trips, which may belong
+				// to LookupHost or LookupHTTPS, as raw lookups.
+				Address:  "8.8.8.8:53",
+				DNSQuery: []byte{0x01},
+				Name:     "dns_round_trip_done",
+				Proto:    "udp",
+				Time:     begin.Add(100 * time.Millisecond),
+			}, {
+				Address:      "8.8.8.8:53",
+				DNSQueryType: "CNAME",
+				DNSRawReply: &model.DNSReply{
+					Answer: []*model.DNSRecord{{
+						Name: "www.example.com.",
+						Type: "CNAME",
+						TTL:  300,
+						Data: "example.com.",
+					}},
+				},
+				Hostname: "www.example.com",
+				Name:     "resolve_raw_done",
+				Proto:    "udp",
+				Time:     begin.Add(200 * time.Millisecond),
+			}, {
+				Address:      "8.8.8.8:53",
+				DNSQueryType: "NS",
+				DNSRawReply: &model.DNSReply{
+					Authority: []*model.DNSRecord{{
+						Name: "example.com.",
+						Type: "SOA",
+						TTL:  60,
+						Data: "ns.example.com. root.example.com. 1 2 3 4 5",
+					}},
+				},
+				Err:      &netxlite.ErrWrapper{Failure: netxlite.FailureDNSNXDOMAINError},
+				Hostname: "www.example.com",
+				Name:     "resolve_raw_done",
+				Proto:    "udp",
+				Time:     begin.Add(300 * time.Millisecond),
+			}},
+		},
+		want: []archival.DNSQueryEntry{{
+			Answers: []archival.DNSAnswerEntry{{
+				AnswerType: "CNAME",
+				Hostname:   "example.com.",
+				TTL:        dnsTTL(300),
+			}},
+			Engine:          "udp",
+			Hostname:        "www.example.com",
+			QueryType:       "CNAME",
+			ResolverAddress: "8.8.8.8:53",
+			T:               0.2,
+		}, {
+			Authority: []archival.DNSAnswerEntry{{
+				AnswerType: "SOA",
+				Data:       "ns.example.com. root.example.com. 1 2 3 4 5",
+				TTL:        dnsTTL(60),
+			}},
+			Engine: "udp",
+			Failure: archival.NewFailure(
+				&netxlite.ErrWrapper{Failure: netxlite.FailureDNSNXDOMAINError}),
+			Hostname:        "www.example.com",
+			QueryType:       "NS",
+			ResolverAddress: "8.8.8.8:53",
+			T:               0.3,
+		}},
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -402,6 +473,11 @@ func TestNewDNSQueriesList(t *testing.T) {
 	}
 }
 
+// dnsTTL returns a pointer to the given TTL.
+func dnsTTL(ttl uint32) *uint32 {
+	return &ttl
+}
+
 func TestNewNetworkEventsList(t *testing.T) {
 	begin := time.Now()
 	type args struct {
@@ -11,10 +11,10 @@
 // By default, this library uses the system resolver. In addition, it
 // is possible to configure alternative DNS transports and remote
 // servers. We support DNS over UDP, DNS over TCP, DNS over TLS (DoT),
-// and DNS over HTTPS (DoH). When using an alternative transport, we
-// are also able to intercept and save DNS messages, as well as any
-// other interaction with the remote server (e.g., the result of the
-// TLS handshake for DoT and DoH).
+// DNS over HTTPS (DoH), and DNS over QUIC (DoQ). When using an
+// alternative transport, we are also able to intercept and save DNS
+// messages, as well as any other interaction with the remote server
+// (e.g., the result of the TLS handshake for DoT and DoH).
 //
 // We described the design and implementation of the most recent version of
 // this package at <https://github.com/ooni/probe-engine/issues/359>. Such
@@ -47,27 +47,29 @@ import (
 // We use different savers for different kind of events such that the
 // user of this library can choose what to save.
 type Config struct {
-	BaseResolver        model.Resolver       // default: system resolver
-	BogonIsError        bool                 // default: bogon is not error
-	ByteCounter         *bytecounter.Counter // default: no explicit byte counting
-	CacheResolutions    bool                 // default: no caching
-	CertPool            *x509.CertPool       // default: use vendored gocertifi
-	ContextByteCounting bool                 // default: no implicit byte counting
-	DNSCache            map[string][]string  // default: cache is empty
-	DialSaver           *trace.Saver         // default: not saving dials
-	Dialer              model.Dialer         // default: dialer.DNSDialer
-	FullResolver        model.Resolver       // default: base resolver + goodies
-	QUICDialer          model.QUICDialer     // default: quicdialer.DNSDialer
-	HTTP3Enabled        bool                 // default: disabled
-	HTTPSaver           *trace.Saver         // default: not saving HTTP
-	Logger              model.DebugLogger    // default: no logging
-	NoTLSVerify         bool                 // default: perform TLS verify
-	ProxyURL            *url.URL             // default: no proxy
-	ReadWriteSaver      *trace.Saver         // default: not saving read/write
-	ResolveSaver        *trace.Saver         // default: not saving resolves
-	TLSConfig           *tls.Config          // default: attempt using h2
-	TLSDialer           model.TLSDialer      // default: dialer.TLSDialer
-	TLSSaver            *trace.Saver         // default: not saving TLS
+	BaseResolver        model.Resolver                   // default: system resolver
+	BogonIsError        bool                             // default: bogon is not error
+	ByteCounter         *bytecounter.Counter             // default: no explicit byte counting
+	CacheResolutions    bool                             // default: no caching
+	CertPool            *x509.CertPool                   // default: use vendored gocertifi
+	ContextByteCounting bool                             // default: no implicit byte counting
+	DNSCache            map[string][]string              // default: cache is empty
+	DNSSEC              bool                             // default: no DNSSEC validation
+	DialSaver           *trace.Saver                     // default: not saving dials
+	Dialer              model.Dialer                     // default: dialer.DNSDialer
+	FullResolver        model.Resolver                   // default: base resolver + goodies
+	QUICDialer          model.QUICDialer                 // default: quicdialer.DNSDialer
+	HTTP3Enabled        bool                             // default: disabled
+	HTTPSaver           *trace.Saver                     // default: not saving HTTP
+	Logger              model.DebugLogger                // default: no logging
+	NoTLSVerify         bool                             // default: perform TLS verify
+	ProxyURL            *url.URL                         // default: no proxy
+	ReadWriteSaver      *trace.Saver                     // default: not saving read/write
+	ResolveSaver        *trace.Saver                     // default: not saving resolves
+	TLSConfig           *tls.Config                      // default: attempt using h2
+	TLSDialer           model.TLSDialer                  // default: dialer.TLSDialer
+	TLSFragmentation    *netxlite.TLSFragmentationConfig // default: no fragmentation
+	TLSSaver            *trace.Saver                     // default: not saving TLS
 }
 
 type tlsHandshaker interface {
@@ -161,6 +163,9 @@ func NewTLSDialer(config Config) model.TLSDialer {
 		config.Dialer = NewDialer(config)
 	}
 	var h tlsHandshaker = &netxlite.TLSHandshakerConfigurable{}
+	if config.TLSFragmentation != nil {
+		h = netxlite.NewTLSHandshakerFragmenting(model.DiscardLogger, config.TLSFragmentation)
+	}
 	h = &netxlite.ErrorWrapperTLSHandshaker{TLSHandshaker: h}
 	if config.Logger != nil {
 		h = &netxlite.TLSHandshakerLogger{DebugLogger: config.Logger, TLSHandshaker: h}
@@ -245,17 +250,26 @@ var allTransportsInfo = map[bool]httpTransportInfo{
 // - if the URL is `doh://powerdns`, `doh://google` or `doh://cloudflare` or the URL
 // starts with `https://`, then we create a DoH client.
 //
+// - if the URL starts with `h3://`, then we create a DoH client
+// using HTTP/3 (i.e., DoH3) with the equivalent `https://` URL.
+//
 // - if the URL is `` or `system:///`, then we create a system client,
 // i.e. a client using the system resolver.
 //
 // - if the URL starts with `udp://`, then we create a client using
 // a resolver that uses the specified UDP endpoint.
 //
+// - if the URL starts with `quic://`, then we create a client using
+// DNS-over-QUIC (RFC9250) with the specified endpoint.
+//
 // We return error if the URL does not parse or the URL scheme does not
 // fall into one of the cases described above.
 //
 // If config.ResolveSaver is not nil and we're creating an underlying
 // resolver where this is possible, we will also save events.
+//
+// If config.DNSSEC is true, the client validates replies using DNSSEC,
+// and we return ErrDNSSECRequiresTransport for the system resolver.
 func NewDNSClient(config Config, URL string) (model.Resolver, error) {
 	return NewDNSClientWithOverrides(config, URL, "", "", "")
 }
@@ -284,19 +298,46 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride,
 	}
 	switch resolverURL.Scheme {
 	case "system":
+		if config.DNSSEC {
+			return nil, ErrDNSSECRequiresTransport
+		}
 		return &netxlite.ResolverSystem{}, nil
 	case "https":
 		config.TLSConfig.NextProtos = []string{"h2", "http/1.1"}
 		httpClient := &http.Client{Transport: NewHTTPTransport(config)}
-		var txp model.DNSTransport = netxlite.NewDNSOverHTTPSWithHostOverride(
-			httpClient, URL, hostOverride)
+		dohTxp := netxlite.NewDNSOverHTTPSWithHostOverride(httpClient, URL, hostOverride)
+		dohTxp.HTTP3 = config.HTTP3Enabled // archive as "doh3" when using HTTP/3
+		var txp model.DNSTransport = dohTxp
+		if config.ResolveSaver != nil {
+			txp = resolver.SaverDNSTransport{
+				DNSTransport: txp,
+				Saver:        config.ResolveSaver,
+			}
+		}
+		return newDNSClientResolver(config, txp), nil
+	case "h3":
+		resolverURL.Scheme = "https"
+		logger := config.Logger
+		if logger == nil {
+			logger = model.DiscardLogger
+		}
+		dohTxp := netxlite.NewDNSOverHTTP3(
+			logger, NewQUICDialer(config), config.TLSConfig,
+			resolverURL.String(), hostOverride)
+		if config.ByteCounter != nil {
+			dohTxp.Client = &http.Client{Transport: httptransport.ByteCountingTransport{
+				Counter:       config.ByteCounter,
+				HTTPTransport: &http3ClientTransport{dohTxp.Client},
+			}}
+		}
+		var txp model.DNSTransport = dohTxp
 		if config.ResolveSaver != nil {
 			txp = resolver.SaverDNSTransport{
 				DNSTransport: txp,
 				Saver:        config.ResolveSaver,
 			}
 		}
-		return netxlite.NewSerialResolver(txp), nil
+		return newDNSClientResolver(config, txp), nil
 	case "udp":
 		dialer := NewDialer(config)
 		endpoint, err := makeValidEndpoint(resolverURL)
@@ -311,7 +352,7 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride,
 				Saver:        config.ResolveSaver,
 			}
 		}
-		return netxlite.NewSerialResolver(txp), nil
+		return newDNSClientResolver(config, txp), nil
 	case "dot":
 		config.TLSConfig.NextProtos = []string{"dot"}
 		tlsDialer := NewTLSDialer(config)
@@ -327,7 +368,7 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride,
 				Saver:        config.ResolveSaver,
 			}
 		}
-		return netxlite.NewSerialResolver(txp), nil
+		return newDNSClientResolver(config, txp), nil
 	case "tcp":
 		dialer := NewDialer(config)
 		endpoint, err := makeValidEndpoint(resolverURL)
@@ -342,17 +383,64 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride,
 				Saver:        config.ResolveSaver,
 			}
 		}
-		return netxlite.NewSerialResolver(txp), nil
+		return newDNSClientResolver(config, txp), nil
+	case "quic":
+		config.TLSConfig.NextProtos = []string{"doq"}
+		quicDialer := NewQUICDialer(config)
+		endpoint, err := makeValidEndpoint(resolverURL)
+		if err != nil {
+			return nil, err
+		}
+		var txp model.DNSTransport = netxlite.NewDNSOverQUIC(
+			quicDialer, endpoint, config.TLSConfig)
+		if config.ResolveSaver != nil {
+			txp = resolver.SaverDNSTransport{
+				DNSTransport: txp,
+				Saver:        config.ResolveSaver,
+			}
+		}
+		return newDNSClientResolver(config, txp), nil
 	default:
 		return nil, errors.New("unsupported resolver scheme")
 	}
 }
 
-// makeValidEndpoint makes a valid endpoint for DoT and Do53 given the
-// input URL representing such endpoint. Specifically, we are
+// ErrDNSSECRequiresTransport indicates that we cannot perform DNSSEC
+// validation because we're using the system resolver.
+var ErrDNSSECRequiresTransport = errors.New("netx: DNSSEC validation requires a DNS transport")
+
+// newDNSClientResolver creates the resolver using the given DNS transport
+// that NewDNSClientWithOverrides returns. When config.DNSSEC is true, this
+// resolver validates replies using DNSSEC.
+func newDNSClientResolver(config Config, txp model.DNSTransport) model.Resolver {
+	if config.DNSSEC {
+		return netxlite.NewDNSSECResolver(txp)
+	}
+	return netxlite.NewSerialResolver(txp)
+}
+
+// makeValidEndpoint makes a valid endpoint for DoT, DoQ, and Do53 given
+// the input URL representing such endpoint. Specifically, we are
 // concerned with the case where the port is missing. In such a
 // case, we ensure that we are using the default port 853 for DoT
-// and default port 53 for TCP and UDP.
+// and DoQ and default port 53 for TCP and UDP.
+// http3ClientTransport adapts the HTTP/3 client created by
+// netxlite.NewDNSOverHTTP3 to be a model.HTTPTransport, such that
+// we can count the bytes it sends and receives.
+type http3ClientTransport struct {
+	model.HTTPClient
+}
+
+// Network implements model.HTTPTransport.Network.
+func (txp *http3ClientTransport) Network() string {
+	return "quic"
+}
+
+// RoundTrip implements model.HTTPTransport.RoundTrip.
+func (txp *http3ClientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return txp.HTTPClient.Do(req)
+}
+
 func makeValidEndpoint(URL *url.URL) (string, error) {
 	// Implementation note: when we're using a quoted IPv6
 	// address, URL.Host contains the quotes but instead the
@@ -386,7 +474,7 @@ func makeValidEndpoint(URL *url.URL) (string, error) {
 	// For this reason we check again whether we can split it using
 	// net.SplitHostPort. If we cannot, we were in case four.
 	host := URL.Host
-	if URL.Scheme == "dot" {
+	if URL.Scheme == "dot" || URL.Scheme == "quic" {
 		host += ":853"
 	} else {
 		host += ":53"
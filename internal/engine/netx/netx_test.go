@@ -10,12 +10,14 @@ import (
 	"testing"
 
 	"github.com/apex/log"
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/bytecounter"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/httptransport"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/resolver"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/tlsdialer"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
+	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/model/mocks"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
@@ -212,6 +214,61 @@ func TestNewResolverWithPrefilledReadonlyCache(t *testing.T) {
 	}
 }
 
+func TestNewResolverLookupRaw(t *testing.T) {
+	expected := &model.DNSReply{}
+	saver := &trace.Saver{}
+	r := netx.NewResolver(netx.Config{
+		BaseResolver: &mocks.Resolver{
+			MockLookupRaw: func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+				if domain != "xn--d1acpjx3f.xn--p1ai" {
+					return nil, errors.New("passed invalid domain")
+				}
+				return expected, nil
+			},
+			MockNetwork: func() string {
+				return "udp"
+			},
+			MockAddress: func() string {
+				return "8.8.8.8:53"
+			},
+		},
+		BogonIsError:     true,
+		CacheResolutions: true,
+		Logger:           log.Log,
+		ResolveSaver:     saver,
+	})
+	rr, ok := r.(model.RawResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	reply, err := rr.LookupRaw(context.Background(), "яндекс.рф", dns.TypeNS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != expected {
+		t.Fatal("not the reply we expected")
+	}
+	ev := saver.Read()
+	if len(ev) != 2 || ev[1].Name != "resolve_raw_done" || ev[1].DNSQueryType != "NS" {
+		t.Fatal("not the events we expected")
+	}
+}
+
+func TestNewResolverLookupRawWithSystemResolver(t *testing.T) {
+	r := netx.NewResolver(netx.Config{})
+	rr, ok := r.(model.RawResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	reply, err := rr.LookupRaw(context.Background(), "dns.google", dns.TypeNS)
+	if !errors.Is(err, netxlite.ErrNoDNSTransport) {
+		t.Fatal("not the error we expected", err)
+	}
+	if reply != nil {
+		t.Fatal("expected nil reply")
+	}
+}
+
 func TestNewTLSDialerVanilla(t *testing.T) {
 	td := netx.NewTLSDialer(netx.Config{})
 	rtd, ok := td.(*netxlite.TLSDialerLegacy)
@@ -242,6 +299,25 @@ func TestNewTLSDialerVanilla(t *testing.T) {
 	}
 }
 
+func TestNewTLSDialerWithTLSFragmentation(t *testing.T) {
+	td := netx.NewTLSDialer(netx.Config{
+		TLSFragmentation: &netxlite.TLSFragmentationConfig{
+			Strategies: []string{netxlite.TLSFragmentationSNISplit},
+		},
+	})
+	rtd, ok := td.(*netxlite.TLSDialerLegacy)
+	if !ok {
+		t.Fatal("not the TLSDialer we expected")
+	}
+	ewth, ok := rtd.TLSHandshaker.(*netxlite.ErrorWrapperTLSHandshaker)
+	if !ok {
+		t.Fatal("not the TLSHandshaker we expected")
+	}
+	if _, ok := ewth.TLSHandshaker.(*netxlite.TLSHandshakerConfigurable); ok {
+		t.Fatal("expected a fragmenting TLSHandshaker")
+	}
+}
+
 func TestNewTLSDialerWithConfig(t *testing.T) {
 	td := netx.NewTLSDialer(netx.Config{
 		TLSConfig: new(tls.Config),
@@ -571,6 +647,17 @@ func TestNewDNSClientSystemResolver(t *testing.T) {
 	dnsclient.CloseIdleConnections()
 }
 
+func TestNewDNSClientSystemResolverWithDNSSEC(t *testing.T) {
+	dnsclient, err := netx.NewDNSClient(
+		netx.Config{DNSSEC: true}, "system:///")
+	if !errors.Is(err, netx.ErrDNSSECRequiresTransport) {
+		t.Fatal("not the error we expected", err)
+	}
+	if dnsclient != nil {
+		t.Fatal("expected nil resolver here")
+	}
+}
+
 func TestNewDNSClientEmpty(t *testing.T) {
 	dnsclient, err := netx.NewDNSClient(
 		netx.Config{}, "")
@@ -668,6 +755,22 @@ func TestNewDNSClientUDP(t *testing.T) {
 	dnsclient.CloseIdleConnections()
 }
 
+func TestNewDNSClientUDPWithDNSSEC(t *testing.T) {
+	dnsclient, err := netx.NewDNSClient(
+		netx.Config{DNSSEC: true}, "udp://8.8.8.8:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.(*netxlite.DNSSECResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	if _, ok := r.Transport().(*netxlite.DNSOverUDP); !ok {
+		t.Fatal("not the transport we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
 func TestNewDNSClientUDPDNSSaver(t *testing.T) {
 	saver := new(trace.Saver)
 	dnsclient, err := netx.NewDNSClient(
@@ -812,6 +915,166 @@ func TestNewDNSCLientUDPWithoutPort(t *testing.T) {
 	}
 }
 
+func TestNewDNSClientDoQ(t *testing.T) {
+	dnsclient, err := netx.NewDNSClient(
+		netx.Config{}, "quic://94.140.14.14:853")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.(*netxlite.SerialResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(*netxlite.DNSOverQUIC)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if txp.Network() != "doq" {
+		t.Fatal("not the Network we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSClientDoQDNSSaver(t *testing.T) {
+	saver := new(trace.Saver)
+	dnsclient, err := netx.NewDNSClient(
+		netx.Config{ResolveSaver: saver}, "quic://94.140.14.14:853")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.(*netxlite.SerialResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(resolver.SaverDNSTransport)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	doq, ok := txp.DNSTransport.(*netxlite.DNSOverQUIC)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if doq.Network() != "doq" {
+		t.Fatal("not the Network we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSCLientDoQWithoutPort(t *testing.T) {
+	c, err := netx.NewDNSClientWithOverrides(
+		netx.Config{}, "quic://94.140.14.14", "", "dns.adguard.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Address() != "94.140.14.14:853" {
+		t.Fatal("expected default port to be added")
+	}
+}
+
+func TestNewDNSClientBadDoQEndpoint(t *testing.T) {
+	_, err := netx.NewDNSClient(
+		netx.Config{}, "quic://bad:endpoint:853")
+	if err == nil || !strings.Contains(err.Error(), "too many colons in address") {
+		t.Fatal("expected error with bad endpoint")
+	}
+}
+
+func TestNewDNSClientDoH3(t *testing.T) {
+	dnsclient, err := netx.NewDNSClient(
+		netx.Config{}, "h3://cloudflare-dns.com/dns-query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.(*netxlite.SerialResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(*netxlite.DNSOverHTTPS)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if txp.Network() != "doh3" {
+		t.Fatal("not the Network we expected")
+	}
+	if txp.URL != "https://cloudflare-dns.com/dns-query" {
+		t.Fatal("not the URL we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSClientDoH3WithUppercaseScheme(t *testing.T) {
+	dnsclient, err := netx.NewDNSClientWithOverrides(netx.Config{},
+		"H3://cloudflare-dns.com/dns-query", "1dot1dot1dot1.cloudflare-dns.com", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.(*netxlite.SerialResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(*netxlite.DNSOverHTTPS)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if txp.URL != "https://cloudflare-dns.com/dns-query" {
+		t.Fatal("not the URL we expected", txp.URL)
+	}
+	if txp.HostOverride != "1dot1dot1dot1.cloudflare-dns.com" {
+		t.Fatal("not the host override we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSClientDoH3WithByteCounter(t *testing.T) {
+	dnsclient, err := netx.NewDNSClient(netx.Config{
+		ByteCounter: bytecounter.New(),
+	}, "h3://cloudflare-dns.com/dns-query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.(*netxlite.SerialResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(*netxlite.DNSOverHTTPS)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	client, ok := txp.Client.(*http.Client)
+	if !ok {
+		t.Fatal("not the client we expected")
+	}
+	if _, ok := client.Transport.(httptransport.ByteCountingTransport); !ok {
+		t.Fatal("not the transport we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSClientDoH3DNSSaver(t *testing.T) {
+	saver := new(trace.Saver)
+	dnsclient, err := netx.NewDNSClient(
+		netx.Config{ResolveSaver: saver}, "h3://cloudflare-dns.com/dns-query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.(*netxlite.SerialResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(resolver.SaverDNSTransport)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	doh3, ok := txp.DNSTransport.(*netxlite.DNSOverHTTPS)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if doh3.Network() != "doh3" {
+		t.Fatal("not the Network we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
 func TestNewDNSClientBadDoTEndpoint(t *testing.T) {
 	_, err := netx.NewDNSClient(
 		netx.Config{}, "dot://bad:endpoint:53")
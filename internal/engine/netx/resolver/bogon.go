@@ -29,4 +29,19 @@ func (r BogonResolver) LookupHost(ctx context.Context, hostname string) ([]strin
 	return addrs, err
 }
 
-var _ model.Resolver = BogonResolver{}
+// LookupRaw implements RawResolver.LookupRaw. We return the reply along
+// with ErrDNSBogon if any A or AAAA answer contains a bogon.
+func (r BogonResolver) LookupRaw(
+	ctx context.Context, hostname string, qtype uint16) (*model.DNSReply, error) {
+	reply, err := netxlite.LookupRaw(ctx, r.Resolver, hostname, qtype)
+	if reply != nil {
+		for _, record := range reply.Answer {
+			if (record.Type == "A" || record.Type == "AAAA") && netxlite.IsBogon(record.Data) {
+				return reply, netxlite.ErrDNSBogon
+			}
+		}
+	}
+	return reply, err
+}
+
+var _ model.RawResolver = BogonResolver{}
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/resolver"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
@@ -35,3 +38,58 @@ func TestBogonAwareResolverWithoutBogon(t *testing.T) {
 		t.Fatal("not the error we expected")
 	}
 }
+
+func TestBogonAwareResolverLookupRawWithBogon(t *testing.T) {
+	expected := &model.DNSReply{
+		Answer: []*model.DNSRecord{{
+			Name: "dns.google.com.",
+			Type: "CNAME",
+			TTL:  300,
+			Data: "dns.google.",
+		}, {
+			Name: "dns.google.",
+			Type: "A",
+			TTL:  300,
+			Data: "127.0.0.1",
+		}},
+	}
+	r := resolver.BogonResolver{
+		Resolver: &mocks.Resolver{
+			MockLookupRaw: func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+				return expected, nil
+			},
+		},
+	}
+	reply, err := r.LookupRaw(context.Background(), "dns.google.com", dns.TypeCNAME)
+	if !errors.Is(err, netxlite.ErrDNSBogon) {
+		t.Fatal("not the error we expected")
+	}
+	if reply != expected {
+		t.Fatal("not the reply we expected")
+	}
+}
+
+func TestBogonAwareResolverLookupRawWithoutBogon(t *testing.T) {
+	expected := &model.DNSReply{
+		Answer: []*model.DNSRecord{{
+			Name: "dns.google.",
+			Type: "A",
+			TTL:  300,
+			Data: "8.8.8.8",
+		}},
+	}
+	r := resolver.BogonResolver{
+		Resolver: &mocks.Resolver{
+			MockLookupRaw: func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+				return expected, nil
+			},
+		},
+	}
+	reply, err := r.LookupRaw(context.Background(), "dns.google", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != expected {
+		t.Fatal("not the reply we expected")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
 // CacheResolver is a resolver that caches successful replies.
@@ -31,6 +32,13 @@ func (r *CacheResolver) LookupHost(
 	return entry, nil
 }
 
+// LookupRaw implements RawResolver.LookupRaw. We do not cache the
+// results of raw lookups, so we always forward the query.
+func (r *CacheResolver) LookupRaw(
+	ctx context.Context, hostname string, qtype uint16) (*model.DNSReply, error) {
+	return netxlite.LookupRaw(ctx, r.Resolver, hostname, qtype)
+}
+
 // Get gets the currently configured entry for domain, or nil
 func (r *CacheResolver) Get(domain string) []string {
 	r.mu.Lock()
@@ -5,8 +5,10 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/resolver"
 	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
 )
 
 func TestCacheFailure(t *testing.T) {
@@ -75,3 +77,26 @@ func TestCacheReadonlySuccess(t *testing.T) {
 		t.Fatal("expected empty cache here")
 	}
 }
+
+func TestCacheLookupRawIsNotCached(t *testing.T) {
+	var count int
+	expected := &model.DNSReply{}
+	cache := &resolver.CacheResolver{Resolver: &mocks.Resolver{
+		MockLookupRaw: func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+			count++
+			return expected, nil
+		},
+	}}
+	for idx := 0; idx < 2; idx++ {
+		reply, err := cache.LookupRaw(context.Background(), "dns.google.com", dns.TypeNS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply != expected {
+			t.Fatal("not the reply we expected")
+		}
+	}
+	if count != 2 {
+		t.Fatal("expected to forward all the queries")
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
 	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
 // SaverResolver is a resolver that saves events
@@ -39,6 +41,34 @@ func (r SaverResolver) LookupHost(ctx context.Context, hostname string) ([]strin
 	return addrs, err
 }
 
+// LookupRaw implements RawResolver.LookupRaw
+func (r SaverResolver) LookupRaw(
+	ctx context.Context, hostname string, qtype uint16) (*model.DNSReply, error) {
+	start := time.Now()
+	r.Saver.Write(trace.Event{
+		Address:      r.Resolver.Address(),
+		DNSQueryType: dns.TypeToString[qtype],
+		Hostname:     hostname,
+		Name:         "resolve_raw_start",
+		Proto:        r.Resolver.Network(),
+		Time:         start,
+	})
+	reply, err := netxlite.LookupRaw(ctx, r.Resolver, hostname, qtype)
+	stop := time.Now()
+	r.Saver.Write(trace.Event{
+		Address:      r.Resolver.Address(),
+		DNSQueryType: dns.TypeToString[qtype],
+		DNSRawReply:  reply,
+		Duration:     stop.Sub(start),
+		Err:          err,
+		Hostname:     hostname,
+		Name:         "resolve_raw_done",
+		Proto:        r.Resolver.Network(),
+		Time:         stop,
+	})
+	return reply, err
+}
+
 // SaverDNSTransport is a DNS transport that saves events
 type SaverDNSTransport struct {
 	model.DNSTransport
@@ -70,5 +100,5 @@ func (txp SaverDNSTransport) RoundTrip(ctx context.Context, query []byte) ([]byt
 	return reply, err
 }
 
-var _ model.Resolver = SaverResolver{}
+var _ model.RawResolver = SaverResolver{}
 var _ model.DNSTransport = SaverDNSTransport{}
@@ -8,8 +8,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/resolver"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx/trace"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
 )
 
 func TestSaverResolverFailure(t *testing.T) {
@@ -110,6 +113,70 @@ func TestSaverResolverSuccess(t *testing.T) {
 	}
 }
 
+func TestSaverResolverLookupRaw(t *testing.T) {
+	expected := &model.DNSReply{
+		Answer: []*model.DNSRecord{{
+			Name: "www.google.com.",
+			Type: "CNAME",
+			TTL:  300,
+			Data: "www.l.google.com.",
+		}},
+	}
+	saver := &trace.Saver{}
+	reso := resolver.SaverResolver{
+		Resolver: &mocks.Resolver{
+			MockLookupRaw: func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+				time.Sleep(time.Microsecond)
+				return expected, nil
+			},
+			MockNetwork: func() string {
+				return "udp"
+			},
+			MockAddress: func() string {
+				return "8.8.8.8:53"
+			},
+		},
+		Saver: saver,
+	}
+	reply, err := reso.LookupRaw(context.Background(), "www.google.com", dns.TypeCNAME)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != expected {
+		t.Fatal("not the result we expected")
+	}
+	ev := saver.Read()
+	if len(ev) != 2 {
+		t.Fatal("expected number of events")
+	}
+	if ev[0].Name != "resolve_raw_start" || ev[1].Name != "resolve_raw_done" {
+		t.Fatal("unexpected name")
+	}
+	for _, e := range ev {
+		if e.Hostname != "www.google.com" {
+			t.Fatal("unexpected Hostname")
+		}
+		if e.DNSQueryType != "CNAME" {
+			t.Fatal("unexpected DNSQueryType")
+		}
+		if e.Proto != "udp" || e.Address != "8.8.8.8:53" {
+			t.Fatal("unexpected Proto or Address")
+		}
+	}
+	if ev[1].DNSRawReply != expected {
+		t.Fatal("unexpected DNSRawReply")
+	}
+	if ev[1].Duration <= 0 {
+		t.Fatal("unexpected Duration")
+	}
+	if ev[1].Err != nil {
+		t.Fatal("unexpected Err")
+	}
+	if !ev[1].Time.After(ev[0].Time) {
+		t.Fatal("the saved time is wrong")
+	}
+}
+
 func TestSaverDNSTransportFailure(t *testing.T) {
 	expected := errors.New("no such host")
 	saver := &trace.Saver{}
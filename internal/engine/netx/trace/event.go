@@ -6,6 +6,8 @@ import (
 	"errors"
 	"net/http"
 	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
 )
 
 // Event is one of the events within a trace
@@ -13,6 +15,8 @@ type Event struct {
 	Addresses          []string            `json:",omitempty"`
 	Address            string              `json:",omitempty"`
 	DNSQuery           []byte              `json:",omitempty"`
+	DNSQueryType       string              `json:",omitempty"`
+	DNSRawReply        *model.DNSReply     `json:",omitempty"`
 	DNSReply           []byte              `json:",omitempty"`
 	DataIsTruncated    bool                `json:",omitempty"`
 	Data               []byte              `json:",omitempty"`
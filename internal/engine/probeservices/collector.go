@@ -31,6 +31,10 @@ var (
 	// ErrJSONFormatNotSupported indicates that the collector we're using
 	// does not support the JSON report format.
 	ErrJSONFormatNotSupported = errors.New("JSON format not supported")
+
+	// ErrReportNotFound indicates that the report we wanted
+	// to resume does not exist or is not open anymore.
+	ErrReportNotFound = errors.New("Report not found")
 )
 
 // ReportTemplate is the template for opening a report
@@ -116,6 +120,28 @@ func (c Client) OpenReport(ctx context.Context, rt ReportTemplate) (ReportChanne
 	return nil, ErrJSONFormatNotSupported
 }
 
+// ResumeReport returns a channel for submitting measurements into
+// a report that we opened in the past using the given reportID. We
+// use the collector to check whether the report still exists and
+// we return ErrReportNotFound if that is not the case.
+func (c Client) ResumeReport(
+	ctx context.Context, reportID string, rt ReportTemplate) (ReportChannel, error) {
+	if rt.DataFormatVersion != DefaultDataFormatVersion {
+		return nil, ErrUnsupportedDataFormatVersion
+	}
+	if rt.Format != DefaultFormat {
+		return nil, ErrUnsupportedFormat
+	}
+	found, err := c.CheckReportID(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrReportNotFound
+	}
+	return &reportChan{ID: reportID, client: c, tmpl: rt}, nil
+}
+
 type collectorUpdateRequest struct {
 	// Format is the data format
 	Format string `json:"format"`
@@ -180,16 +206,25 @@ type ReportOpener interface {
 
 var _ ReportOpener = Client{}
 
+// ReportResumer is any struct that is able to resume an existing
+// ReportChannel. The Client struct belongs to this interface.
+type ReportResumer interface {
+	ResumeReport(ctx context.Context, reportID string, rt ReportTemplate) (ReportChannel, error)
+}
+
+var _ ReportResumer = Client{}
+
 // Submitter is an abstraction allowing you to submit arbitrary measurements
 // to a given OONI backend. This implementation will take care of opening
 // reports when needed as well as of closing reports when needed. Nonetheless
 // you need to remember to call its Close method when done, because there is
 // likely an open report that has not been closed yet.
 type Submitter struct {
-	channel ReportChannel
-	logger  model.Logger
-	mu      sync.Mutex
-	opener  ReportOpener
+	channel  ReportChannel
+	logger   model.Logger
+	mu       sync.Mutex
+	opener   ReportOpener
+	resumeID string
 }
 
 // NewSubmitter creates a new Submitter instance.
@@ -204,11 +239,42 @@ func (sub *Submitter) Submit(ctx context.Context, m *model.Measurement) error {
 	sub.mu.Lock()
 	defer sub.mu.Unlock()
 	if sub.channel == nil || !sub.channel.CanSubmit(m) {
-		sub.channel, err = sub.opener.OpenReport(ctx, NewReportTemplate(m))
+		sub.channel, err = sub.openReport(ctx, NewReportTemplate(m))
 		if err != nil {
 			return err
 		}
-		sub.logger.Infof("New reportID: %s", sub.channel.ReportID())
 	}
 	return sub.channel.SubmitMeasurement(ctx, m)
 }
+
+// ResumeReport tells the Submitter to try reusing the report with the
+// given reportID (e.g., a report opened by a previous run that has been
+// interrupted) the next time it needs to open a report. If the opener
+// is not a ReportResumer or the report does not exist anymore, we
+// open a new report as usual.
+func (sub *Submitter) ResumeReport(reportID string) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.resumeID = reportID
+}
+
+// openReport opens a new report or resumes the report the user asked
+// us to resume. This function assumes the caller holds the mutex.
+func (sub *Submitter) openReport(ctx context.Context, rt ReportTemplate) (ReportChannel, error) {
+	resumer, ok := sub.opener.(ReportResumer)
+	if reportID := sub.resumeID; ok && reportID != "" {
+		sub.resumeID = "" // we only try once
+		channel, err := resumer.ResumeReport(ctx, reportID, rt)
+		if err == nil {
+			sub.logger.Infof("Resumed reportID: %s", reportID)
+			return channel, nil
+		}
+		sub.logger.Warnf("Cannot resume reportID %s: %s", reportID, err.Error())
+	}
+	channel, err := sub.opener.OpenReport(ctx, rt)
+	if err != nil {
+		return nil, err
+	}
+	sub.logger.Infof("New reportID: %s", channel.ReportID())
+	return channel, nil
+}
@@ -458,3 +458,145 @@ func TestSubmitterCannotOpenNewChannel(t *testing.T) {
 		t.Fatal("unexpected number of channels")
 	}
 }
+
+func TestResumeReport(t *testing.T) {
+	template := probeservices.ReportTemplate{
+		DataFormatVersion: probeservices.DefaultDataFormatVersion,
+		Format:            probeservices.DefaultFormat,
+		ProbeASN:          "AS0",
+		ProbeCC:           "ZZ",
+		SoftwareName:      "ooniprobe-engine",
+		SoftwareVersion:   "0.1.0",
+		TestName:          "dummy",
+		TestStartTime:     "2019-10-28 12:51:06",
+		TestVersion:       "0.1.0",
+	}
+	reportID := "20201209T052225Z_dummy_ZZ_0_n1_E1VUhMz08SEkgYFU"
+	newclientWithFound := func(found string) *probeservices.Client {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/_/check_report_id" || r.URL.Query().Get("report_id") != reportID {
+				w.WriteHeader(404)
+				return
+			}
+			w.Write([]byte(`{"found": ` + found + `}`))
+		}))
+		t.Cleanup(server.Close)
+		client := newclient()
+		client.BaseURL = server.URL
+		return client
+	}
+
+	t.Run("when the report exists", func(t *testing.T) {
+		report, err := newclientWithFound("true").ResumeReport(context.Background(), reportID, template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.ReportID() != reportID {
+			t.Fatal("unexpected report ID", report.ReportID())
+		}
+		measurement := makeMeasurement(template, reportID)
+		if !report.CanSubmit(&measurement) {
+			t.Fatal("report should be able to submit this measurement")
+		}
+	})
+
+	t.Run("when the report does not exist", func(t *testing.T) {
+		report, err := newclientWithFound("false").ResumeReport(context.Background(), reportID, template)
+		if !errors.Is(err, probeservices.ErrReportNotFound) {
+			t.Fatal("not the error we expected", err)
+		}
+		if report != nil {
+			t.Fatal("expected a nil report here")
+		}
+	})
+
+	t.Run("with an invalid template", func(t *testing.T) {
+		invalid := template
+		invalid.Format = "yaml"
+		report, err := newclientWithFound("true").ResumeReport(context.Background(), reportID, invalid)
+		if !errors.Is(err, probeservices.ErrUnsupportedFormat) {
+			t.Fatal("not the error we expected", err)
+		}
+		if report != nil {
+			t.Fatal("expected a nil report here")
+		}
+	})
+
+	t.Run("with a cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel() // fail immediately
+		report, err := newclientWithFound("true").ResumeReport(ctx, reportID, template)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatal("not the error we expected", err)
+		}
+		if report != nil {
+			t.Fatal("expected a nil report here")
+		}
+	})
+}
+
+type RecordingReportResumer struct {
+	RecordingReportOpener
+	err       error
+	reportIDs []string
+}
+
+func (rrr *RecordingReportResumer) ResumeReport(
+	ctx context.Context, reportID string, rt probeservices.ReportTemplate,
+) (probeservices.ReportChannel, error) {
+	rrr.reportIDs = append(rrr.reportIDs, reportID)
+	if rrr.err != nil {
+		return nil, rrr.err
+	}
+	return &RecordingReportChannel{tmpl: rt}, nil
+}
+
+func TestSubmitterResumeReport(t *testing.T) {
+	t.Run("when we can resume the report", func(t *testing.T) {
+		rrr := &RecordingReportResumer{}
+		submitter := probeservices.NewSubmitter(rrr, log.Log)
+		submitter.ResumeReport("xx")
+		ctx := context.Background()
+		m1 := makeMeasurementWithoutTemplate("antani", "example")
+		if err := submitter.Submit(ctx, m1); err != nil {
+			t.Fatal(err)
+		}
+		// we only resume the first report we open
+		m2 := makeMeasurementWithoutTemplate("antani", "example_extended")
+		if err := submitter.Submit(ctx, m2); err != nil {
+			t.Fatal(err)
+		}
+		if len(rrr.reportIDs) != 1 || rrr.reportIDs[0] != "xx" {
+			t.Fatal("unexpected resumed reports", rrr.reportIDs)
+		}
+		if len(rrr.channels) != 1 {
+			t.Fatal("unexpected number of opened channels")
+		}
+	})
+
+	t.Run("when we cannot resume the report", func(t *testing.T) {
+		rrr := &RecordingReportResumer{err: probeservices.ErrReportNotFound}
+		submitter := probeservices.NewSubmitter(rrr, log.Log)
+		submitter.ResumeReport("xx")
+		m1 := makeMeasurementWithoutTemplate("antani", "example")
+		if err := submitter.Submit(context.Background(), m1); err != nil {
+			t.Fatal(err)
+		}
+		if len(rrr.reportIDs) != 1 || len(rrr.channels) != 1 {
+			t.Fatal("we should have opened a new report")
+		}
+	})
+
+	t.Run("when the opener cannot resume reports", func(t *testing.T) {
+		rro := &RecordingReportOpener{}
+		submitter := probeservices.NewSubmitter(rro, log.Log)
+		submitter.ResumeReport("xx")
+		m1 := makeMeasurementWithoutTemplate("antani", "example")
+		if err := submitter.Submit(context.Background(), m1); err != nil {
+			t.Fatal(err)
+		}
+		if len(rro.channels) != 1 {
+			t.Fatal("we should have opened a new report")
+		}
+	})
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/ooni/probe-cli/v3/internal/engine/internal/sessionresolver"
 	"github.com/ooni/probe-cli/v3/internal/engine/netx"
 	"github.com/ooni/probe-cli/v3/internal/engine/probeservices"
+	"github.com/ooni/probe-cli/v3/internal/engine/submitqueue"
 	"github.com/ooni/probe-cli/v3/internal/kvstore"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/platform"
@@ -62,6 +63,7 @@ type Session struct {
 	selectedProbeService     *model.OOAPIService
 	softwareName             string
 	softwareVersion          string
+	submitQueue              *submitqueue.Queue
 	tempDir                  string
 
 	// closeOnce allows us to call Close just once.
@@ -168,6 +170,13 @@ func NewSession(ctx context.Context, config SessionConfig) (*Session, error) {
 		torBinary:               config.TorBinary,
 		tunnelDir:               config.TunnelDir,
 	}
+	sess.submitQueue = submitqueue.New(submitqueue.Config{
+		KVStore: sess.kvStore,
+		Logger:  sess.logger,
+		NewSubmitter: func(ctx context.Context) (submitqueue.Submitter, error) {
+			return sess.NewSubmitter(ctx)
+		},
+	})
 	proxyURL := config.ProxyURL
 	if proxyURL != nil {
 		switch proxyURL.Scheme {
@@ -369,6 +378,12 @@ func (s *Session) KeyValueStore() model.KeyValueStore {
 	return s.kvStore
 }
 
+// SubmitQueue returns the persistent queue of the measurements that
+// we could not submit, which we store in the session's KVStore.
+func (s *Session) SubmitQueue() *submitqueue.Queue {
+	return s.submitQueue
+}
+
 // Logger returns the logger used by the session.
 func (s *Session) Logger() model.Logger {
 	return s.logger
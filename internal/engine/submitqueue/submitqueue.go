@@ -0,0 +1,296 @@
+// Package submitqueue implements a persistent queue of measurements
+// that we could not submit to the OONI collector.
+//
+// We store the queue into a model.KeyValueStore, so the measurements
+// survive across runs. When we Flush the queue, we retry submitting
+// each measurement using exponential backoff and we drop the ones
+// that have been in the queue for longer than a given max age.
+package submitqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// StoreKey is the key we use to store the queue.
+const StoreKey = "submitqueue.state"
+
+// DefaultMaxAge is the default maximum time a measurement
+// may spend in the queue before we drop it.
+const DefaultMaxAge = 7 * 24 * time.Hour
+
+// DefaultInitialBackoff is the default time we wait before
+// retrying to submit a measurement for the first time.
+const DefaultInitialBackoff = time.Minute
+
+// DefaultMaxBackoff is the default maximum time we wait
+// between two attempts at submitting a measurement.
+const DefaultMaxBackoff = 6 * time.Hour
+
+// Submitter submits measurements.
+type Submitter interface {
+	// Submit submits the measurement and updates its
+	// report ID field in case of success.
+	Submit(ctx context.Context, m *model.Measurement) error
+}
+
+// Config contains the Queue config.
+type Config struct {
+	// KVStore is the MANDATORY key-value store.
+	KVStore model.KeyValueStore
+
+	// Logger is the MANDATORY logger.
+	Logger model.Logger
+
+	// NewSubmitter is the MANDATORY function creating the
+	// Submitter. We only call this function when flushing
+	// a non-empty queue, because it may use the network.
+	NewSubmitter func(ctx context.Context) (Submitter, error)
+
+	// MaxAge is the OPTIONAL maximum time a measurement may
+	// spend in the queue. If zero, we use DefaultMaxAge.
+	MaxAge time.Duration
+
+	// InitialBackoff is the OPTIONAL time we wait before the
+	// first retry. If zero, we use DefaultInitialBackoff.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the OPTIONAL maximum time between retries.
+	// If zero, we use DefaultMaxBackoff.
+	MaxBackoff time.Duration
+
+	// TimeNow is the OPTIONAL function returning the current
+	// time. If nil, we use time.Now.
+	TimeNow func() time.Time
+}
+
+// Queue is a persistent queue of measurements to submit. The
+// zero value is invalid; please, use New to construct. This
+// struct is safe for concurrent use by multiple goroutines.
+type Queue struct {
+	config Config
+	mu     sync.Mutex
+}
+
+// New creates a new Queue.
+func New(config Config) *Queue {
+	return &Queue{config: config}
+}
+
+// entry is an entry in the queue.
+type entry struct {
+	// ID identifies the measurement.
+	ID string `json:"id"`
+
+	// Measurement is the serialized measurement.
+	Measurement json.RawMessage `json:"measurement"`
+
+	// Added is when we added the measurement to the queue.
+	Added time.Time `json:"added"`
+
+	// Attempts is the number of failed submission attempts.
+	Attempts int64 `json:"attempts"`
+
+	// NextAttempt is when we should try again.
+	NextAttempt time.Time `json:"next_attempt"`
+
+	// Failure is the last submission failure.
+	Failure string `json:"failure"`
+}
+
+// entryID returns the ID of the entry for m. We dedupe entries using
+// the report ID and, to distinguish among the measurements in the same
+// report and the ones without a report ID, the test name, the input, and
+// the measurement start time.
+func entryID(m *model.Measurement) string {
+	return fmt.Sprintf("%s|%s|%s|%s", m.ReportID, m.TestName, m.Input, m.MeasurementStartTime)
+}
+
+// Add adds to the queue a measurement we could not submit because of
+// the given error, which may be nil. If the queue already contains the
+// same measurement, we replace it and we count a failed attempt.
+func (q *Queue) Add(m *model.Measurement, failure error) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	defer q.mu.Unlock()
+	q.mu.Lock()
+	entries, err := q.read()
+	if err != nil {
+		return err
+	}
+	now := q.timeNow()
+	e := &entry{ID: entryID(m), Added: now}
+	for idx, cur := range entries {
+		if cur.ID == e.ID {
+			e = cur
+			entries = append(entries[:idx], entries[idx+1:]...)
+			break
+		}
+	}
+	e.Measurement = data
+	q.failed(e, failure, now)
+	q.config.Logger.Infof("submitqueue: queued measurement for later submission: %s", e.ID)
+	return q.write(append(entries, e))
+}
+
+// Pending returns the number of measurements in the queue.
+func (q *Queue) Pending() (int, error) {
+	defer q.mu.Unlock()
+	q.mu.Lock()
+	entries, err := q.read()
+	return len(entries), err
+}
+
+// Flush submits the measurements in the queue whose next attempt
+// is due, drops the measurements older than the max age, and
+// returns the number of measurements it submitted. We stop
+// submitting when the context is done, leaving the remaining
+// measurements in the queue. We only return an error when we
+// cannot access the queue or create a submitter.
+func (q *Queue) Flush(ctx context.Context) (int, error) {
+	defer q.mu.Unlock()
+	q.mu.Lock()
+	entries, err := q.read()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		keep      []*entry
+		submitted int
+		submitter Submitter
+	)
+	for _, e := range entries {
+		now := q.timeNow()
+		if now.Sub(e.Added) > q.maxAge() {
+			q.config.Logger.Warnf("submitqueue: dropping too old measurement: %s", e.ID)
+			continue
+		}
+		if ctx.Err() != nil || now.Before(e.NextAttempt) {
+			keep = append(keep, e)
+			continue
+		}
+		if submitter == nil {
+			submitter, err = q.config.NewSubmitter(ctx)
+			if err != nil {
+				return 0, err // the queue is unchanged
+			}
+		}
+		if err := q.submit(ctx, submitter, e); err != nil {
+			q.config.Logger.Warnf("submitqueue: cannot submit %s: %s", e.ID, err.Error())
+			q.failed(e, err, q.timeNow())
+			keep = append(keep, e)
+			continue
+		}
+		submitted++
+	}
+	if submitted > 0 || len(keep) != len(entries) || submitter != nil {
+		if err := q.write(keep); err != nil {
+			return submitted, err
+		}
+	}
+	return submitted, nil
+}
+
+// submit submits the measurement in the given entry.
+func (q *Queue) submit(ctx context.Context, submitter Submitter, e *entry) error {
+	var m model.Measurement
+	if err := json.Unmarshal(e.Measurement, &m); err != nil {
+		return err
+	}
+	return submitter.Submit(ctx, &m)
+}
+
+// failed updates the entry after a failed submission attempt.
+func (q *Queue) failed(e *entry, failure error, now time.Time) {
+	e.Failure = ""
+	if failure != nil {
+		e.Failure = failure.Error()
+	}
+	e.NextAttempt = now.Add(q.backoff(e.Attempts))
+	e.Attempts++
+}
+
+// backoff returns the time to wait after the given number of
+// previous failed attempts. We double the time at each attempt.
+func (q *Queue) backoff(attempts int64) time.Duration {
+	backoff, max := q.initialBackoff(), q.maxBackoff()
+	for ; attempts > 0 && backoff < max; attempts-- {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// errNilKVStore indicates that the KVStore is nil.
+var errNilKVStore = errors.New("submitqueue: kvstore is nil")
+
+// read reads the entries from the key-value store. A missing
+// key is not an error and just means the queue is empty.
+func (q *Queue) read() ([]*entry, error) {
+	if q.config.KVStore == nil {
+		return nil, errNilKVStore
+	}
+	data, err := q.config.KVStore.Get(StoreKey)
+	if errors.Is(err, kvstore.ErrNoSuchKey) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// write writes the entries into the key-value store.
+func (q *Queue) write(entries []*entry) error {
+	if entries == nil {
+		entries = []*entry{} // serialize as [] rather than null
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return q.config.KVStore.Set(StoreKey, data)
+}
+
+func (q *Queue) timeNow() time.Time {
+	if q.config.TimeNow != nil {
+		return q.config.TimeNow()
+	}
+	return time.Now()
+}
+
+func (q *Queue) maxAge() time.Duration {
+	if q.config.MaxAge > 0 {
+		return q.config.MaxAge
+	}
+	return DefaultMaxAge
+}
+
+func (q *Queue) initialBackoff() time.Duration {
+	if q.config.InitialBackoff > 0 {
+		return q.config.InitialBackoff
+	}
+	return DefaultInitialBackoff
+}
+
+func (q *Queue) maxBackoff() time.Duration {
+	if q.config.MaxBackoff > 0 {
+		return q.config.MaxBackoff
+	}
+	return DefaultMaxBackoff
+}
@@ -0,0 +1,220 @@
+package submitqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+type fakeSubmitter struct {
+	err error
+	m   []*model.Measurement
+}
+
+func (fs *fakeSubmitter) Submit(ctx context.Context, m *model.Measurement) error {
+	fs.m = append(fs.m, m)
+	if fs.err == nil {
+		m.ReportID = "20220101T000000Z_webconnectivity_IT_30722_n1_abc"
+	}
+	return fs.err
+}
+
+// fakeClock is a clock we can move forward.
+type fakeClock struct {
+	now time.Time
+}
+
+func (fc *fakeClock) Now() time.Time {
+	return fc.now
+}
+
+func newQueue(kvs model.KeyValueStore, clock *fakeClock, submitter *fakeSubmitter) *Queue {
+	return New(Config{
+		KVStore: kvs,
+		Logger:  log.Log,
+		NewSubmitter: func(ctx context.Context) (Submitter, error) {
+			return submitter, nil
+		},
+		TimeNow: clock.Now,
+	})
+}
+
+func newMeasurement(input string) *model.Measurement {
+	return &model.Measurement{
+		Input:                model.MeasurementTarget(input),
+		MeasurementStartTime: "2022-01-01 00:00:00",
+		TestName:             "web_connectivity",
+		TestKeys:             map[string]interface{}{"accessible": true},
+	}
+}
+
+func TestQueue(t *testing.T) {
+	mocked := errors.New("mocked error")
+
+	t.Run("Add dedupes measurements", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		clock := &fakeClock{now: time.Now()}
+		q := newQueue(kvs, clock, &fakeSubmitter{})
+		for _, input := range []string{"https://a.com/", "https://b.com/", "https://a.com/"} {
+			if err := q.Add(newMeasurement(input), mocked); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if pending, err := q.Pending(); err != nil || pending != 2 {
+			t.Fatal("unexpected pending", pending, err)
+		}
+		entries, err := q.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entries[1].Attempts != 2 || entries[1].Failure != "mocked error" {
+			t.Fatal("unexpected entry", entries[1])
+		}
+		// the queue survives creating a new Queue using the same store
+		if pending, err := newQueue(kvs, clock, nil).Pending(); err != nil || pending != 2 {
+			t.Fatal("unexpected pending", pending, err)
+		}
+	})
+
+	t.Run("Flush with an empty queue does not create a submitter", func(t *testing.T) {
+		q := New(Config{
+			KVStore: &kvstore.Memory{},
+			Logger:  log.Log,
+			NewSubmitter: func(ctx context.Context) (Submitter, error) {
+				return nil, mocked
+			},
+		})
+		if submitted, err := q.Flush(context.Background()); err != nil || submitted != 0 {
+			t.Fatal("unexpected result", submitted, err)
+		}
+	})
+
+	t.Run("Flush uses exponential backoff", func(t *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		submitter := &fakeSubmitter{err: mocked}
+		q := newQueue(&kvstore.Memory{}, clock, submitter)
+		if err := q.Add(newMeasurement("https://a.com/"), mocked); err != nil {
+			t.Fatal(err)
+		}
+		flush := func(after time.Duration, expectAttempts int) {
+			clock.now = clock.now.Add(after)
+			if _, err := q.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if len(submitter.m) != expectAttempts {
+				t.Fatal("unexpected number of attempts", len(submitter.m), expectAttempts)
+			}
+		}
+		flush(30*time.Second, 0) // too early
+		flush(30*time.Second, 1) // first retry after one minute
+		flush(90*time.Second, 1) // second retry after two minutes
+		flush(30*time.Second, 2)
+		flush(4*time.Minute, 3) // third retry after four minutes
+		submitter.err = nil
+		flush(8*time.Minute, 4) // fourth retry after eight minutes
+		if pending, err := q.Pending(); err != nil || pending != 0 {
+			t.Fatal("unexpected pending", pending, err)
+		}
+		if submitter.m[3].Input != "https://a.com/" {
+			t.Fatal("unexpected measurement", submitter.m[3].Input)
+		}
+	})
+
+	t.Run("backoff is bounded", func(t *testing.T) {
+		q := New(Config{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second})
+		expect := []time.Duration{1, 2, 4, 8, 10, 10}
+		for attempts, value := range expect {
+			if backoff := q.backoff(int64(attempts)); backoff != value*time.Second {
+				t.Fatal("unexpected backoff", attempts, backoff)
+			}
+		}
+	})
+
+	t.Run("Flush drops too old measurements", func(t *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		submitter := &fakeSubmitter{}
+		q := newQueue(&kvstore.Memory{}, clock, submitter)
+		if err := q.Add(newMeasurement("https://a.com/"), mocked); err != nil {
+			t.Fatal(err)
+		}
+		clock.now = clock.now.Add(DefaultMaxAge + time.Second)
+		if submitted, err := q.Flush(context.Background()); err != nil || submitted != 0 {
+			t.Fatal("unexpected result", submitted, err)
+		}
+		if pending, err := q.Pending(); err != nil || pending != 0 {
+			t.Fatal("unexpected pending", pending, err)
+		}
+		if len(submitter.m) != 0 {
+			t.Fatal("we should not have submitted")
+		}
+	})
+
+	t.Run("Flush with a cancelled context", func(t *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		submitter := &fakeSubmitter{}
+		q := newQueue(&kvstore.Memory{}, clock, submitter)
+		if err := q.Add(newMeasurement("https://a.com/"), nil); err != nil {
+			t.Fatal(err)
+		}
+		clock.now = clock.now.Add(time.Hour)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if submitted, err := q.Flush(ctx); err != nil || submitted != 0 {
+			t.Fatal("unexpected result", submitted, err)
+		}
+		if pending, err := q.Pending(); err != nil || pending != 1 {
+			t.Fatal("unexpected pending", pending, err)
+		}
+	})
+
+	t.Run("Flush when we cannot create a submitter", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		q := New(Config{
+			KVStore: kvs,
+			Logger:  log.Log,
+			NewSubmitter: func(ctx context.Context) (Submitter, error) {
+				return nil, mocked
+			},
+			TimeNow: (&fakeClock{now: time.Now().Add(time.Hour)}).Now,
+		})
+		if err := newQueue(kvs, &fakeClock{now: time.Now()}, nil).Add(
+			newMeasurement("https://a.com/"), nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := q.Flush(context.Background()); !errors.Is(err, mocked) {
+			t.Fatal("unexpected err", err)
+		}
+		if pending, err := q.Pending(); err != nil || pending != 1 {
+			t.Fatal("unexpected pending", pending, err)
+		}
+	})
+
+	t.Run("with a corrupt store", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		if err := kvs.Set(StoreKey, []byte("{")); err != nil {
+			t.Fatal(err)
+		}
+		q := newQueue(kvs, &fakeClock{now: time.Now()}, nil)
+		if _, err := q.Pending(); err == nil {
+			t.Fatal("expected an error")
+		}
+		if err := q.Add(newMeasurement("https://a.com/"), nil); err == nil {
+			t.Fatal("expected an error")
+		}
+		if _, err := q.Flush(context.Background()); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("with a nil store", func(t *testing.T) {
+		q := New(Config{Logger: log.Log})
+		if _, err := q.Pending(); !errors.Is(err, errNilKVStore) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+}
@@ -3,12 +3,10 @@ package engine
 import (
 	"context"
 
+	"github.com/ooni/probe-cli/v3/internal/engine/submitqueue"
 	"github.com/ooni/probe-cli/v3/internal/model"
 )
 
-// TODO(bassosimone): maybe keep track of which measurements
-// could not be submitted by a specific submitter?
-
 // Submitter submits a measurement to the OONI collector.
 type Submitter interface {
 	// Submit submits the measurement and updates its
@@ -32,6 +30,23 @@ type SubmitterConfig struct {
 
 	// Logger is the logger to be used.
 	Logger model.Logger
+
+	// Queue is the OPTIONAL queue where we store the measurements
+	// we could not submit (see Session.SubmitQueue). When set, we
+	// also tolerate failing to create a submitter, because we can
+	// queue all the measurements and submit them later.
+	Queue *submitqueue.Queue
+
+	// ReportID is the OPTIONAL ID of a report opened by a previous
+	// run that we should try to reuse (see Checkpoint). If the report
+	// is not open anymore, we will open a new report.
+	ReportID string
+}
+
+// submitterReportResumer is a Submitter that can resume
+// a report (e.g., a probeservices.Submitter).
+type submitterReportResumer interface {
+	ResumeReport(reportID string)
 }
 
 // NewSubmitter creates a new submitter instance. Depending on
@@ -42,10 +57,17 @@ func NewSubmitter(ctx context.Context, config SubmitterConfig) (Submitter, error
 		return stubSubmitter{}, nil
 	}
 	subm, err := config.Session.NewSubmitter(ctx)
-	if err != nil {
+	if err != nil && config.Queue == nil {
 		return nil, err
 	}
-	return realSubmitter{subm: subm, logger: config.Logger}, nil
+	if err != nil {
+		config.Logger.Warnf("cannot create submitter: %s", err.Error())
+		subm = failingSubmitter{err: err}
+	}
+	if resumer, ok := subm.(submitterReportResumer); ok && config.ReportID != "" {
+		resumer.ResumeReport(config.ReportID)
+	}
+	return realSubmitter{subm: subm, logger: config.Logger, queue: config.Queue}, nil
 }
 
 type stubSubmitter struct{}
@@ -59,9 +81,27 @@ var _ Submitter = stubSubmitter{}
 type realSubmitter struct {
 	subm   Submitter
 	logger model.Logger
+	queue  *submitqueue.Queue
 }
 
 func (rs realSubmitter) Submit(ctx context.Context, m *model.Measurement) error {
 	rs.logger.Info("submitting measurement to OONI collector; please be patient...")
-	return rs.subm.Submit(ctx, m)
+	err := rs.subm.Submit(ctx, m)
+	if err != nil && rs.queue != nil {
+		if qerr := rs.queue.Add(m, err); qerr != nil {
+			rs.logger.Warnf("cannot queue measurement: %s", qerr.Error())
+		}
+	}
+	return err
+}
+
+// failingSubmitter is a Submitter that always fails.
+type failingSubmitter struct {
+	err error
 }
+
+func (fs failingSubmitter) Submit(ctx context.Context, m *model.Measurement) error {
+	return fs.err
+}
+
+var _ Submitter = failingSubmitter{}
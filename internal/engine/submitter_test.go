@@ -7,6 +7,8 @@ import (
 
 	"github.com/apex/log"
 	"github.com/ooni/probe-cli/v3/internal/atomicx"
+	"github.com/ooni/probe-cli/v3/internal/engine/submitqueue"
+	"github.com/ooni/probe-cli/v3/internal/kvstore"
 	"github.com/ooni/probe-cli/v3/internal/model"
 )
 
@@ -91,3 +93,95 @@ func TestNewSubmitterWithFailedSubmission(t *testing.T) {
 		t.Fatal("unexpected number of calls")
 	}
 }
+
+func TestNewSubmitterWithQueue(t *testing.T) {
+	expected := errors.New("mocked error")
+	newQueue := func() *submitqueue.Queue {
+		return submitqueue.New(submitqueue.Config{
+			KVStore: &kvstore.Memory{},
+			Logger:  log.Log,
+		})
+	}
+
+	t.Run("we queue failed submissions", func(t *testing.T) {
+		queue := newQueue()
+		submitter, err := NewSubmitter(context.Background(), SubmitterConfig{
+			Enabled: true,
+			Logger:  log.Log,
+			Queue:   queue,
+			Session: FakeSubmitterSession{Submitter: &FakeSubmitter{Error: expected}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := submitter.Submit(context.Background(), new(model.Measurement)); !errors.Is(err, expected) {
+			t.Fatalf("not the error we expected: %+v", err)
+		}
+		if pending, err := queue.Pending(); err != nil || pending != 1 {
+			t.Fatal("unexpected pending", pending, err)
+		}
+	})
+
+	t.Run("we do not queue successful submissions", func(t *testing.T) {
+		queue := newQueue()
+		submitter, err := NewSubmitter(context.Background(), SubmitterConfig{
+			Enabled: true,
+			Logger:  log.Log,
+			Queue:   queue,
+			Session: FakeSubmitterSession{Submitter: &FakeSubmitter{}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := submitter.Submit(context.Background(), new(model.Measurement)); err != nil {
+			t.Fatal(err)
+		}
+		if pending, err := queue.Pending(); err != nil || pending != 0 {
+			t.Fatal("unexpected pending", pending, err)
+		}
+	})
+
+	t.Run("we queue when we cannot create a submitter", func(t *testing.T) {
+		queue := newQueue()
+		submitter, err := NewSubmitter(context.Background(), SubmitterConfig{
+			Enabled: true,
+			Logger:  log.Log,
+			Queue:   queue,
+			Session: FakeSubmitterSession{Error: expected},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := submitter.Submit(context.Background(), new(model.Measurement)); !errors.Is(err, expected) {
+			t.Fatalf("not the error we expected: %+v", err)
+		}
+		if pending, err := queue.Pending(); err != nil || pending != 1 {
+			t.Fatal("unexpected pending", pending, err)
+		}
+	})
+}
+
+type FakeResumingSubmitter struct {
+	FakeSubmitter
+	ReportID string
+}
+
+func (frs *FakeResumingSubmitter) ResumeReport(reportID string) {
+	frs.ReportID = reportID
+}
+
+func TestNewSubmitterWithReportID(t *testing.T) {
+	fakeSubmitter := &FakeResumingSubmitter{}
+	_, err := NewSubmitter(context.Background(), SubmitterConfig{
+		Enabled:  true,
+		Logger:   log.Log,
+		ReportID: "xx",
+		Session:  FakeSubmitterSession{Submitter: fakeSubmitter},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fakeSubmitter.ReportID != "xx" {
+		t.Fatal("we did not ask the submitter to resume the report")
+	}
+}
@@ -0,0 +1,96 @@
+package measurex
+
+//
+// ALPN
+//
+// Code to measure h2 and http/1.1 separately on the same
+// endpoint. Some middleboxes break h2 but let http/1.1 pass, so
+// we may want to force each ALPN protocol in turn.
+//
+
+// negotiatedProtocol returns the protocol negotiated via ALPN
+// by the first TLS or QUIC handshake inside the measurement.
+func negotiatedProtocol(m *Measurement) string {
+	for _, ev := range m.TLSHandshake {
+		return ev.NegotiatedProto
+	}
+	for _, ev := range m.QUICHandshake {
+		return ev.NegotiatedProto
+	}
+	return ""
+}
+
+// splitALPN returns a copy of the given endpoints where we replace
+// each HTTPS endpoint using TCP and offering both h2 and http/1.1
+// with two endpoints, one offering just h2 and the other offering
+// just http/1.1. We do not modify the original endpoints.
+func splitALPN(epnts ...*HTTPEndpoint) (out []*HTTPEndpoint) {
+	for _, epnt := range epnts {
+		if epnt.Network != NetworkTCP || epnt.URL.Scheme != "https" || len(epnt.ALPN) < 2 {
+			out = append(out, epnt)
+			continue
+		}
+		for _, alpn := range epnt.ALPN {
+			out = append(out, &HTTPEndpoint{
+				Domain:  epnt.Domain,
+				Network: epnt.Network,
+				Address: epnt.Address,
+				SNI:     epnt.SNI,
+				ALPN:    []string{alpn},
+				URL:     epnt.URL,
+				Header:  epnt.Header,
+			})
+		}
+	}
+	return
+}
+
+// httpEndpointSucceeded returns whether the given measurement
+// contains a successful HTTP round trip.
+func httpEndpointSucceeded(m *HTTPEndpointMeasurement) bool {
+	for _, ev := range m.HTTPRoundTrip {
+		if ev.Failure == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// FindH2FailingEndpoints returns the addresses of the TCP endpoints
+// where forcing h2 using ALPN failed while forcing http/1.1 succeeded,
+// which hints at middleboxes interfering with h2. This function is only
+// useful when using Measurer.MeasureALPNSeparately.
+func FindH2FailingEndpoints(epnts ...*HTTPEndpointMeasurement) (out []string) {
+	type result struct {
+		h2, http11 *bool
+	}
+	var (
+		results = map[string]*result{}
+		order   []string
+	)
+	for _, epnt := range epnts {
+		if epnt.Network != NetworkTCP || len(epnt.ALPN) != 1 {
+			continue
+		}
+		r, found := results[epnt.Address]
+		if !found {
+			r = &result{}
+			results[epnt.Address] = r
+			order = append(order, epnt.Address)
+		}
+		success := httpEndpointSucceeded(epnt)
+		switch epnt.ALPN[0] {
+		case "h2":
+			r.h2 = &success
+		case "http/1.1":
+			r.http11 = &success
+		}
+	}
+	for _, address := range order {
+		r := results[address]
+		if r.h2 != nil && r.http11 != nil && !*r.h2 && *r.http11 {
+			out = append(out, address)
+		}
+	}
+	return
+}
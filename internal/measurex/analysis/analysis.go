@@ -0,0 +1,546 @@
+// Package analysis promotes measurex oddities to anomalies.
+//
+// An oddity (see measurex.Oddity) is an unexpected result on the probe
+// side (e.g., a TLS handshake timeout). We promote an oddity to an
+// anomaly when the test helper (TH) sees a different result for the same
+// operation (e.g., the TH completes the same TLS handshake). We then
+// produce a structured verdict for each endpoint and for the whole URL.
+//
+// Each verdict has a confidence score between 0 and 1. We are most
+// confident when the TH contradicts the probe for an operation that is
+// rarely flaky (e.g., a TLS handshake reset), less confident for
+// operations that may legitimately differ (e.g., HTTP bodies), and
+// least confident when we cannot compare with the TH at all.
+//
+// When the measurement contains several THs (see measurex.URLMeasurement's
+// ExtraTHs), we compare with all of them. A probe address is fine if any
+// TH resolved it and an endpoint works if it works for any TH, since THs
+// in different places may legitimately see different CDN answers.
+//
+// When the probe and the TH both have a body snapshot, we compare the
+// pages using pagefingerprint rather than using their lengths. Also, when
+// a response matches a known blockpage rule (see the blockpage package and
+// AnalyzeURLMeasurementWithBlockpages), the verdict includes the rule ID.
+package analysis
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/ooni/probe-cli/v3/internal/blockpage"
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+	"github.com/ooni/probe-cli/v3/internal/pagefingerprint"
+)
+
+// Blocking is the kind of blocking we detected.
+type Blocking string
+
+// This enumeration lists all the kinds of blocking.
+var (
+	// BlockingNone indicates that there is no blocking.
+	BlockingNone = Blocking("")
+
+	// BlockingDNS indicates DNS-based blocking.
+	BlockingDNS = Blocking("dns")
+
+	// BlockingTCP indicates TCP/IP-based blocking.
+	BlockingTCP = Blocking("tcp_ip")
+
+	// BlockingTLS indicates interference with the TLS handshake.
+	BlockingTLS = Blocking("tls")
+
+	// BlockingHTTPDiff indicates that the probe's HTTP results
+	// differ from the ones of the test helper.
+	BlockingHTTPDiff = Blocking("http-diff")
+
+	// BlockingQUIC indicates QUIC-based blocking.
+	BlockingQUIC = Blocking("quic")
+)
+
+// Confidence scores used by the analysis.
+const (
+	// ConfidenceHigh is the confidence when the TH contradicts
+	// the probe for an operation that is rarely flaky.
+	ConfidenceHigh = 0.9
+
+	// ConfidenceMedium is the confidence when the TH contradicts the
+	// probe for an operation that may fail for other reasons.
+	ConfidenceMedium = 0.7
+
+	// ConfidenceLow is the confidence when the probe and the
+	// TH results may legitimately differ.
+	ConfidenceLow = 0.5
+
+	// ConfidenceNoTH is the confidence when we cannot compare
+	// with the TH and we only have the probe oddity.
+	ConfidenceNoTH = 0.25
+)
+
+// Verdict is the result of comparing the probe and the TH.
+type Verdict struct {
+	// Accessible indicates whether the probe could access the resource.
+	Accessible bool `json:"accessible"`
+
+	// Blocking is the kind of blocking (BlockingNone if none).
+	Blocking Blocking `json:"blocking"`
+
+	// Confidence is the confidence in this verdict (between 0 and 1).
+	Confidence float64 `json:"confidence"`
+
+	// Failure is the probe failure that led to this verdict, if any.
+	Failure *string `json:"failure"`
+
+	// Oddity is the probe oddity that led to this verdict, if any.
+	Oddity measurex.Oddity `json:"oddity"`
+
+	// Blockpage is the ID of the known blockpage we received, if any.
+	Blockpage string `json:"blockpage,omitempty"`
+}
+
+// EndpointVerdict is the verdict for an HTTP endpoint.
+type EndpointVerdict struct {
+	// URL is the URL we fetched using this endpoint.
+	URL string `json:"url"`
+
+	// Network is the endpoint's network.
+	Network measurex.EndpointNetwork `json:"network"`
+
+	// Address is the endpoint's address.
+	Address string `json:"address"`
+
+	// An EndpointVerdict is a Verdict.
+	Verdict
+}
+
+// URLVerdict is the verdict for an URL.
+type URLVerdict struct {
+	// URL is the URL we measured.
+	URL string `json:"url"`
+
+	// DNS is the verdict for the DNS lookups.
+	DNS *Verdict `json:"dns"`
+
+	// Endpoints contains the verdict for each endpoint.
+	Endpoints []*EndpointVerdict `json:"endpoints"`
+
+	// An URLVerdict is a Verdict.
+	Verdict
+}
+
+// AnalyzeURLMeasurement compares the probe and the TH results contained
+// in the given measurement and returns the corresponding verdicts.
+func AnalyzeURLMeasurement(m *measurex.URLMeasurement) *URLVerdict {
+	return AnalyzeURLMeasurementWithBlockpages(m, nil)
+}
+
+// AnalyzeURLMeasurementWithBlockpages is like AnalyzeURLMeasurement but
+// also checks the responses received by the probe against the given database
+// of known blockpages, so we can say which blockpage we received.
+func AnalyzeURLMeasurementWithBlockpages(
+	m *measurex.URLMeasurement, blockpages *blockpage.DB) *URLVerdict {
+	out := &URLVerdict{URL: m.URL}
+	ths := m.AllTHs()
+	for _, epnt := range m.Endpoints {
+		out.Endpoints = append(out.Endpoints, analyzeEndpoint(
+			epnt, findTHEndpoint(ths, epnt), blockpages))
+	}
+	out.DNS = analyzeDNS(m, out.Endpoints)
+	out.Verdict = summarize(out.DNS, out.Endpoints)
+	return out
+}
+
+// summarize computes the URL verdict from the DNS and endpoints verdicts.
+func summarize(dns *Verdict, endpoints []*EndpointVerdict) Verdict {
+	if dns.Blocking != BlockingNone {
+		return *dns
+	}
+	var best *Verdict
+	for _, epnt := range endpoints {
+		if epnt.Accessible {
+			return Verdict{Accessible: true, Confidence: epnt.Confidence}
+		}
+		if epnt.Blocking != BlockingNone && (best == nil || epnt.Confidence > best.Confidence) {
+			best = &epnt.Verdict
+		}
+	}
+	if best != nil {
+		return *best
+	}
+	if len(endpoints) > 0 {
+		// All endpoints failed consistently on the probe and the TH
+		// side, so it seems the website is down for everyone.
+		return endpoints[0].Verdict
+	}
+	return *dns // we have not measured any endpoint
+}
+
+// findTHEndpoint returns the TH measurement for the same endpoint
+// measured by the probe or nil if there is no such measurement. With
+// several THs, we prefer a measurement where the HTTP round trip worked.
+func findTHEndpoint(ths []*measurex.THMeasurement,
+	epnt *measurex.HTTPEndpointMeasurement) (out *measurex.HTTPEndpointMeasurement) {
+	for _, th := range ths {
+		for _, e := range th.Endpoints {
+			if e.Network != epnt.Network || e.Address != epnt.Address {
+				continue
+			}
+			if thRoundTripSucceeded(e) {
+				return e
+			}
+			if out == nil {
+				out = e
+			}
+		}
+	}
+	return
+}
+
+// thRoundTripSucceeded returns whether the TH performed a successful
+// HTTP round trip with the given endpoint.
+func thRoundTripSucceeded(epnt *measurex.HTTPEndpointMeasurement) bool {
+	if epnt.Measurement == nil {
+		return false
+	}
+	for _, ev := range epnt.HTTPRoundTrip {
+		if ev.Failure == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Steps of an endpoint measurement.
+const (
+	stepConnect = "connect"
+	stepTLS     = "tls"
+	stepQUIC    = "quic"
+	stepHTTP    = "http"
+)
+
+// outcome is the outcome of an endpoint measurement.
+type outcome struct {
+	// step is the step that failed ("" on success).
+	step string
+
+	// failure is the failure (nil on success).
+	failure *string
+
+	// oddity is the oddity (empty if there's no oddity).
+	oddity measurex.Oddity
+
+	// statusCode is the HTTP status code.
+	statusCode int64
+
+	// bodyLength is the HTTP body length.
+	bodyLength int64
+
+	// fingerprint is the fingerprint of the body snapshot (nil
+	// if the body snapshot is empty).
+	fingerprint *pagefingerprint.Fingerprint
+}
+
+// newOutcome computes the outcome of an endpoint measurement. We
+// return nil if the measurement is nil or does not contain data.
+func newOutcome(m *measurex.HTTPEndpointMeasurement) *outcome {
+	if m == nil || m.Measurement == nil {
+		return nil
+	}
+	for _, ev := range m.Connect {
+		if ev.Failure != nil {
+			return &outcome{step: stepConnect, failure: ev.Failure, oddity: ev.Oddity}
+		}
+	}
+	for _, ev := range m.TLSHandshake {
+		if ev.Failure != nil {
+			return &outcome{step: stepTLS, failure: ev.Failure, oddity: ev.Oddity}
+		}
+	}
+	for _, ev := range m.QUICHandshake {
+		if ev.Failure != nil {
+			return &outcome{step: stepQUIC, failure: ev.Failure, oddity: ev.Oddity}
+		}
+	}
+	if len(m.HTTPRoundTrip) <= 0 {
+		return &outcome{}
+	}
+	ev := m.HTTPRoundTrip[0]
+	if ev.Failure != nil {
+		return &outcome{step: stepHTTP, failure: ev.Failure, oddity: ev.Oddity}
+	}
+	out := &outcome{
+		oddity:     ev.Oddity,
+		statusCode: ev.StatusCode,
+		bodyLength: ev.ResponseBodyLength,
+	}
+	if len(ev.ResponseBody) > 0 {
+		out.fingerprint = pagefingerprint.Compute(ev.ResponseBody)
+	}
+	return out
+}
+
+// matchBlockpage returns the rule in blockpages matching the response
+// the probe received from the given endpoint or nil.
+func matchBlockpage(m *measurex.HTTPEndpointMeasurement, blockpages *blockpage.DB) *blockpage.Rule {
+	if len(m.HTTPRoundTrip) <= 0 {
+		return nil
+	}
+	ev := m.HTTPRoundTrip[0]
+	page := &blockpage.Page{
+		Body:      string(ev.ResponseBody),
+		Headers:   ev.ResponseHeaders,
+		Locations: ev.ResponseHeaders.Values("Location"),
+	}
+	if addr, _, err := net.SplitHostPort(m.Address); err == nil {
+		page.Addrs = append(page.Addrs, addr)
+	}
+	return blockpages.Match(page)
+}
+
+// analyzeEndpoint compares the probe and the TH measurements of
+// an endpoint. The th argument is nil when the TH did not measure
+// the same endpoint (or when we could not contact the TH). The
+// blockpages argument is the OPTIONAL database of known blockpages.
+func analyzeEndpoint(probe, th *measurex.HTTPEndpointMeasurement,
+	blockpages *blockpage.DB) *EndpointVerdict {
+	out := &EndpointVerdict{
+		URL:     probe.URL,
+		Network: probe.Network,
+		Address: probe.Address,
+	}
+	po, to := newOutcome(probe), newOutcome(th)
+	if po == nil {
+		return out // nothing to analyze
+	}
+	out.Failure, out.Oddity = po.failure, po.oddity
+	if po.step == "" {
+		if rule := matchBlockpage(probe, blockpages); rule != nil {
+			// We know this blockpage, so we don't need the TH.
+			out.Blocking, out.Confidence = BlockingHTTPDiff, ConfidenceHigh
+			out.Blockpage = rule.ID
+			return out
+		}
+	}
+	switch {
+	case po.step != "" && to == nil:
+		out.Blocking = blockingForStep(probe.Network, po.step)
+		out.Confidence = ConfidenceNoTH
+	case po.step != "" && to.step == po.step:
+		// Both failed in the same way: this oddity is not an anomaly.
+		out.Confidence = ConfidenceMedium
+	case po.step != "" && (to.step == "" || stepIndex(to.step) > stepIndex(po.step)):
+		out.Blocking = blockingForStep(probe.Network, po.step)
+		out.Confidence = confidenceForOddity(po.oddity)
+	case po.step != "":
+		// The TH failed earlier than the probe, so we cannot say much.
+		out.Confidence = ConfidenceNoTH
+	case to == nil:
+		out.Accessible = true
+		out.Confidence = ConfidenceLow
+	case to.step != "":
+		// The probe succeeded while the TH failed.
+		out.Accessible = true
+		out.Confidence = ConfidenceMedium
+	default:
+		out.Accessible, out.Blocking, out.Confidence = compareHTTP(po, to)
+	}
+	return out
+}
+
+// stepIndex returns the index of a step, such that later
+// steps of a measurement have a larger index.
+func stepIndex(step string) int {
+	switch step {
+	case stepConnect:
+		return 0
+	case stepTLS, stepQUIC:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// blockingForStep maps a failed step to the kind of blocking.
+func blockingForStep(network measurex.EndpointNetwork, step string) Blocking {
+	switch {
+	case network == measurex.NetworkQUIC:
+		return BlockingQUIC
+	case step == stepConnect:
+		return BlockingTCP
+	case step == stepTLS:
+		return BlockingTLS
+	default:
+		return BlockingHTTPDiff
+	}
+}
+
+// confidenceForOddity returns the confidence we have that an oddity
+// contradicted by the TH is an anomaly. Timeouts are less conclusive than
+// resets and certificate errors, because they could be caused by
+// packet loss, and we are even less confident for QUIC, which uses UDP.
+func confidenceForOddity(oddity measurex.Oddity) float64 {
+	switch oddity {
+	case measurex.OddityTLSHandshakeReset,
+		measurex.OddityTLSHandshakeUnexpectedEOF,
+		measurex.OddityTLSHandshakeInvalidHostname,
+		measurex.OddityTLSHandshakeUnknownAuthority,
+		measurex.OddityTCPConnectRefused:
+		return ConfidenceHigh
+	case measurex.OddityTCPConnectTimeout,
+		measurex.OddityTLSHandshakeTimeout,
+		measurex.OddityQUICHandshakeTimeout:
+		return ConfidenceMedium
+	default:
+		return ConfidenceLow
+	}
+}
+
+// compareHTTP compares two successful HTTP round trips. We consider the round
+// trips different if the status codes differ or if the probe's body is much
+// smaller than the TH's body (this heuristic comes from Web Connectivity).
+func compareHTTP(probe, th *outcome) (bool, Blocking, float64) {
+	if probe.statusCode != th.statusCode {
+		if probe.oddity != "" && th.oddity == "" {
+			return false, BlockingHTTPDiff, ConfidenceMedium
+		}
+		return false, BlockingHTTPDiff, ConfidenceLow
+	}
+	if probe.fingerprint != nil && th.fingerprint != nil &&
+		probe.fingerprint.SimHash != 0 && th.fingerprint.SimHash != 0 {
+		// Comparing the visible text is more robust than comparing
+		// the body lengths, so we prefer it when possible.
+		if pagefingerprint.Similarity(probe.fingerprint, th.fingerprint) <
+			pagefingerprint.SimilarityThreshold {
+			return false, BlockingHTTPDiff, ConfidenceMedium
+		}
+		return true, BlockingNone, ConfidenceHigh
+	}
+	if th.bodyLength > 0 && float64(probe.bodyLength)/float64(th.bodyLength) < 0.7 {
+		return false, BlockingHTTPDiff, ConfidenceLow
+	}
+	return true, BlockingNone, ConfidenceHigh
+}
+
+// analyzeDNS compares the probe and the TH lookups. We also take into
+// account the endpoints verdicts, because the probe and the TH may
+// legitimately resolve different addresses (e.g., because of CDNs) but
+// the probe only addresses should then work as well as the TH ones.
+func analyzeDNS(m *measurex.URLMeasurement, endpoints []*EndpointVerdict) *Verdict {
+	domain := m.URL
+	if parsed, err := url.Parse(m.URL); err == nil {
+		domain = parsed.Hostname()
+	}
+	probe := lookupsForDomain(domain, m.DNS)
+	var th []*measurex.DNSLookupEvent
+	ths := m.AllTHs()
+	for _, thm := range ths {
+		th = append(th, lookupsForDomain(domain, thm.DNS)...)
+	}
+	thAddrs := validAddrs(th)
+	var (
+		failed []*measurex.DNSLookupEvent
+		addrs  = map[string]bool{}
+	)
+	for _, ev := range probe {
+		if ev.Failure != nil || ev.Oddity == measurex.OddityDNSLookupBogon {
+			failed = append(failed, ev)
+			continue
+		}
+		for _, addr := range ev.Addrs() {
+			addrs[addr] = true
+		}
+	}
+	switch {
+	case len(failed) > 0 && len(ths) <= 0:
+		return &Verdict{
+			Blocking:   BlockingDNS,
+			Confidence: ConfidenceNoTH,
+			Failure:    failed[0].Failure,
+			Oddity:     failed[0].Oddity,
+		}
+	case len(failed) > 0 && len(thAddrs) <= 0:
+		// Both failed: this oddity is not an anomaly.
+		return &Verdict{
+			Confidence: ConfidenceMedium,
+			Failure:    failed[0].Failure,
+			Oddity:     failed[0].Oddity,
+		}
+	case len(failed) > 0:
+		confidence := ConfidenceHigh
+		if len(failed) < len(probe) {
+			// Some resolvers worked, so this may be a broken resolver.
+			confidence = ConfidenceMedium
+		}
+		return &Verdict{
+			Blocking:   BlockingDNS,
+			Confidence: confidence,
+			Failure:    failed[0].Failure,
+			Oddity:     failed[0].Oddity,
+		}
+	case len(probe) <= 0:
+		return &Verdict{} // nothing to analyze (e.g., the URL contains an IP address)
+	}
+	return analyzeDNSAddrs(addrs, thAddrs, endpoints)
+}
+
+// analyzeDNSAddrs is the part of analyzeDNS that runs when all the probe
+// lookups succeeded. We flag DNS blocking if the probe and the TH resolved
+// disjoint addresses and none of the probe's addresses works.
+func analyzeDNSAddrs(addrs, thAddrs map[string]bool, endpoints []*EndpointVerdict) *Verdict {
+	if len(thAddrs) <= 0 {
+		return &Verdict{Accessible: true, Confidence: ConfidenceNoTH}
+	}
+	for addr := range addrs {
+		if thAddrs[addr] {
+			return &Verdict{Accessible: true, Confidence: ConfidenceHigh}
+		}
+	}
+	var probeOnly []*EndpointVerdict
+	for _, epnt := range endpoints {
+		if addr, _, err := net.SplitHostPort(epnt.Address); err == nil && addrs[addr] {
+			probeOnly = append(probeOnly, epnt)
+		}
+	}
+	for _, epnt := range probeOnly {
+		if epnt.Accessible {
+			return &Verdict{Accessible: true, Confidence: ConfidenceMedium}
+		}
+	}
+	if len(probeOnly) <= 0 {
+		return &Verdict{Accessible: true, Confidence: ConfidenceNoTH}
+	}
+	return &Verdict{
+		Blocking:   BlockingDNS,
+		Confidence: ConfidenceMedium,
+		Failure:    probeOnly[0].Failure,
+		Oddity:     probeOnly[0].Oddity,
+	}
+}
+
+// lookupsForDomain returns the A/AAAA lookups for the given domain.
+func lookupsForDomain(domain string, dns []*measurex.DNSMeasurement) (out []*measurex.DNSLookupEvent) {
+	for _, m := range dns {
+		if m.Measurement == nil {
+			continue
+		}
+		for _, ev := range m.LookupHost {
+			if ev.Domain == domain {
+				out = append(out, ev)
+			}
+		}
+	}
+	return
+}
+
+// validAddrs returns the non-bogon IP addresses in the given lookups.
+func validAddrs(lookups []*measurex.DNSLookupEvent) map[string]bool {
+	out := map[string]bool{}
+	for _, ev := range lookups {
+		for _, addr := range ev.Addrs() {
+			if net.ParseIP(addr) != nil && !netxlite.IsBogon(addr) {
+				out[addr] = true
+			}
+		}
+	}
+	return out
+}
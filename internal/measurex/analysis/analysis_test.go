@@ -0,0 +1,414 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/ooni/probe-cli/v3/internal/blockpage"
+	"github.com/ooni/probe-cli/v3/internal/measurex"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+	"github.com/ooni/probe-cli/v3/internal/pagefingerprint"
+)
+
+// failure returns a pointer to the given failure string.
+func failure(s string) *string {
+	return &s
+}
+
+// newDNS creates a DNS measurement for www.example.com.
+func newDNS(fail *string, oddity measurex.Oddity, addrs ...string) []*measurex.DNSMeasurement {
+	return []*measurex.DNSMeasurement{{
+		Domain: "www.example.com",
+		Measurement: &measurex.Measurement{
+			LookupHost: []*measurex.DNSLookupEvent{{
+				Domain:  "www.example.com",
+				Failure: fail,
+				Oddity:  oddity,
+				A:       addrs,
+			}},
+		},
+	}}
+}
+
+// newEndpoint creates an HTTP endpoint measurement.
+func newEndpoint(network measurex.EndpointNetwork, address string,
+	m *measurex.Measurement) *measurex.HTTPEndpointMeasurement {
+	return &measurex.HTTPEndpointMeasurement{
+		URL:         "https://www.example.com/",
+		Network:     network,
+		Address:     address,
+		Measurement: m,
+	}
+}
+
+// success is a successful HTTPS endpoint measurement.
+func success(status, length int64) *measurex.Measurement {
+	return &measurex.Measurement{
+		Connect:      []*measurex.NetworkEvent{{}},
+		TLSHandshake: []*measurex.QUICTLSHandshakeEvent{{}},
+		HTTPRoundTrip: []*measurex.HTTPRoundTripEvent{{
+			StatusCode:         status,
+			ResponseBodyLength: length,
+		}},
+	}
+}
+
+func TestAnalyzeURLMeasurement(t *testing.T) {
+	const address = "93.184.216.34:443"
+
+	type testcase struct {
+		name       string
+		m          *measurex.URLMeasurement
+		accessible bool
+		blocking   Blocking
+		confidence float64
+	}
+
+	var testcases = []testcase{{
+		name: "accessible",
+		m: &measurex.URLMeasurement{
+			URL: "https://www.example.com/",
+			DNS: newDNS(nil, "", "93.184.216.34"),
+			Endpoints: []*measurex.HTTPEndpointMeasurement{
+				newEndpoint(measurex.NetworkTCP, address, success(200, 1000)),
+			},
+			TH: &measurex.THMeasurement{
+				DNS: newDNS(nil, "", "93.184.216.34"),
+				Endpoints: []*measurex.HTTPEndpointMeasurement{
+					newEndpoint(measurex.NetworkTCP, address, success(200, 1000)),
+				},
+			},
+		},
+		accessible: true,
+		blocking:   BlockingNone,
+		confidence: ConfidenceHigh,
+	}, {
+		name: "DNS blocking",
+		m: &measurex.URLMeasurement{
+			URL: "https://www.example.com/",
+			DNS: newDNS(failure(netxlite.FailureDNSNXDOMAINError), measurex.OddityDNSLookupNXDOMAIN),
+			TH: &measurex.THMeasurement{
+				DNS: newDNS(nil, "", "93.184.216.34"),
+			},
+		},
+		blocking:   BlockingDNS,
+		confidence: ConfidenceHigh,
+	}, {
+		name: "DNS blocking without the TH",
+		m: &measurex.URLMeasurement{
+			URL: "https://www.example.com/",
+			DNS: newDNS(failure(netxlite.FailureDNSNXDOMAINError), measurex.OddityDNSLookupNXDOMAIN),
+		},
+		blocking:   BlockingDNS,
+		confidence: ConfidenceNoTH,
+	}, {
+		name: "DNS failure for everyone",
+		m: &measurex.URLMeasurement{
+			URL: "https://www.example.com/",
+			DNS: newDNS(failure(netxlite.FailureDNSNXDOMAINError), measurex.OddityDNSLookupNXDOMAIN),
+			TH: &measurex.THMeasurement{
+				DNS: newDNS(failure(netxlite.FailureDNSNXDOMAINError), measurex.OddityDNSLookupNXDOMAIN),
+			},
+		},
+		blocking:   BlockingNone,
+		confidence: ConfidenceMedium,
+	}, {
+		name: "DNS returning addresses that do not work",
+		m: &measurex.URLMeasurement{
+			URL: "https://www.example.com/",
+			DNS: newDNS(nil, "", "10.10.34.35"),
+			Endpoints: []*measurex.HTTPEndpointMeasurement{
+				newEndpoint(measurex.NetworkTCP, "10.10.34.35:443", &measurex.Measurement{
+					Connect: []*measurex.NetworkEvent{{
+						Failure: failure(netxlite.FailureGenericTimeoutError),
+						Oddity:  measurex.OddityTCPConnectTimeout,
+					}},
+				}),
+			},
+			TH: &measurex.THMeasurement{
+				DNS: newDNS(nil, "", "93.184.216.34"),
+			},
+		},
+		blocking:   BlockingDNS,
+		confidence: ConfidenceMedium,
+	}, {
+		name: "TCP blocking",
+		m: &measurex.URLMeasurement{
+			URL: "https://www.example.com/",
+			DNS: newDNS(nil, "", "93.184.216.34"),
+			Endpoints: []*measurex.HTTPEndpointMeasurement{
+				newEndpoint(measurex.NetworkTCP, address, &measurex.Measurement{
+					Connect: []*measurex.NetworkEvent{{
+						Failure: failure(netxlite.FailureGenericTimeoutError),
+						Oddity:  measurex.OddityTCPConnectTimeout,
+					}},
+				}),
+			},
+			TH: &measurex.THMeasurement{
+				DNS: newDNS(nil, "", "93.184.216.34"),
+				Endpoints: []*measurex.HTTPEndpointMeasurement{
+					newEndpoint(measurex.NetworkTCP, address, success(200, 1000)),
+				},
+			},
+		},
+		blocking:   BlockingTCP,
+		confidence: ConfidenceMedium,
+	}, {
+		name: "TLS blocking",
+		m: &measurex.URLMeasurement{
+			URL: "https://www.example.com/",
+			DNS: newDNS(nil, "", "93.184.216.34"),
+			Endpoints: []*measurex.HTTPEndpointMeasurement{
+				newEndpoint(measurex.NetworkTCP, address, &measurex.Measurement{
+					Connect: []*measurex.NetworkEvent{{}},
+					TLSHandshake: []*measurex.QUICTLSHandshakeEvent{{
+						Failure: failure(netxlite.FailureConnectionReset),
+						Oddity:  measurex.OddityTLSHandshakeReset,
+					}},
+				}),
+			},
+			TH: &measurex.THMeasurement{
+				DNS: newDNS(nil, "", "93.184.216.34"),
+				Endpoints: []*measurex.HTTPEndpointMeasurement{
+					newEndpoint(measurex.NetworkTCP, address, success(200, 1000)),
+				},
+			},
+		},
+		blocking:   BlockingTLS,
+		confidence: ConfidenceHigh,
+	}, {
+		name: "QUIC blocking with working TCP",
+		m: &measurex.URLMeasurement{
+			URL: "https://www.example.com/",
+			DNS: newDNS(nil, "", "93.184.216.34"),
+			Endpoints: []*measurex.HTTPEndpointMeasurement{
+				newEndpoint(measurex.NetworkQUIC, address, &measurex.Measurement{
+					QUICHandshake: []*measurex.QUICTLSHandshakeEvent{{
+						Failure: failure(netxlite.FailureGenericTimeoutError),
+						Oddity:  measurex.OddityQUICHandshakeTimeout,
+					}},
+				}),
+				newEndpoint(measurex.NetworkTCP, address, success(200, 1000)),
+			},
+			TH: &measurex.THMeasurement{
+				DNS: newDNS(nil, "", "93.184.216.34"),
+				Endpoints: []*measurex.HTTPEndpointMeasurement{
+					newEndpoint(measurex.NetworkQUIC, address, success(200, 1000)),
+					newEndpoint(measurex.NetworkTCP, address, success(200, 1000)),
+				},
+			},
+		},
+		accessible: true,
+		blocking:   BlockingNone,
+		confidence: ConfidenceHigh,
+	}, {
+		name: "HTTP diff",
+		m: &measurex.URLMeasurement{
+			URL: "https://www.example.com/",
+			DNS: newDNS(nil, "", "93.184.216.34"),
+			Endpoints: []*measurex.HTTPEndpointMeasurement{
+				newEndpoint(measurex.NetworkTCP, address, &measurex.Measurement{
+					HTTPRoundTrip: []*measurex.HTTPRoundTripEvent{{
+						StatusCode: 403,
+						Oddity:     measurex.OddityStatus403,
+					}},
+				}),
+			},
+			TH: &measurex.THMeasurement{
+				DNS: newDNS(nil, "", "93.184.216.34"),
+				Endpoints: []*measurex.HTTPEndpointMeasurement{
+					newEndpoint(measurex.NetworkTCP, address, success(200, 1000)),
+				},
+			},
+		},
+		blocking:   BlockingHTTPDiff,
+		confidence: ConfidenceMedium,
+	}, {
+		name: "website down for everyone",
+		m: &measurex.URLMeasurement{
+			URL: "https://www.example.com/",
+			DNS: newDNS(nil, "", "93.184.216.34"),
+			Endpoints: []*measurex.HTTPEndpointMeasurement{
+				newEndpoint(measurex.NetworkTCP, address, &measurex.Measurement{
+					Connect: []*measurex.NetworkEvent{{
+						Failure: failure(netxlite.FailureConnectionRefused),
+						Oddity:  measurex.OddityTCPConnectRefused,
+					}},
+				}),
+			},
+			TH: &measurex.THMeasurement{
+				DNS: newDNS(nil, "", "93.184.216.34"),
+				Endpoints: []*measurex.HTTPEndpointMeasurement{
+					newEndpoint(measurex.NetworkTCP, address, &measurex.Measurement{
+						Connect: []*measurex.NetworkEvent{{
+							Failure: failure(netxlite.FailureConnectionRefused),
+							Oddity:  measurex.OddityTCPConnectRefused,
+						}},
+					}),
+				},
+			},
+		},
+		blocking:   BlockingNone,
+		confidence: ConfidenceMedium,
+	}, {
+		name: "geo-dependent CDN answers with several THs",
+		m: &measurex.URLMeasurement{
+			URL: "https://www.example.com/",
+			DNS: newDNS(nil, "", "104.16.1.1"),
+			Endpoints: []*measurex.HTTPEndpointMeasurement{
+				newEndpoint(measurex.NetworkTCP, "104.16.1.1:443", &measurex.Measurement{
+					Connect: []*measurex.NetworkEvent{{}},
+					TLSHandshake: []*measurex.QUICTLSHandshakeEvent{{
+						Failure: failure(netxlite.FailureConnectionReset),
+						Oddity:  measurex.OddityTLSHandshakeReset,
+					}},
+				}),
+			},
+			TH: &measurex.THMeasurement{
+				DNS: newDNS(nil, "", "93.184.216.34"),
+				Endpoints: []*measurex.HTTPEndpointMeasurement{
+					newEndpoint(measurex.NetworkTCP, "104.16.1.1:443", &measurex.Measurement{
+						Connect: []*measurex.NetworkEvent{{
+							Failure: failure(netxlite.FailureGenericTimeoutError),
+							Oddity:  measurex.OddityTCPConnectTimeout,
+						}},
+					}),
+				},
+			},
+			ExtraTHs: []*measurex.THMeasurement{{
+				DNS: newDNS(nil, "", "104.16.1.1"),
+				Endpoints: []*measurex.HTTPEndpointMeasurement{
+					newEndpoint(measurex.NetworkTCP, "104.16.1.1:443", success(200, 1000)),
+				},
+			}},
+		},
+		blocking:   BlockingTLS,
+		confidence: ConfidenceHigh,
+	}}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := AnalyzeURLMeasurement(tc.m)
+			if v.Accessible != tc.accessible {
+				t.Fatal("unexpected accessible", v.Accessible)
+			}
+			if v.Blocking != tc.blocking {
+				t.Fatal("unexpected blocking", v.Blocking)
+			}
+			if v.Confidence != tc.confidence {
+				t.Fatal("unexpected confidence", v.Confidence)
+			}
+			if len(v.Endpoints) != len(tc.m.Endpoints) {
+				t.Fatal("unexpected number of endpoint verdicts")
+			}
+		})
+	}
+}
+
+func TestAnalyzeEndpointQUICBlocking(t *testing.T) {
+	probe := newEndpoint(measurex.NetworkQUIC, "93.184.216.34:443", &measurex.Measurement{
+		QUICHandshake: []*measurex.QUICTLSHandshakeEvent{{
+			Failure: failure(netxlite.FailureGenericTimeoutError),
+			Oddity:  measurex.OddityQUICHandshakeTimeout,
+		}},
+	})
+	th := newEndpoint(measurex.NetworkQUIC, "93.184.216.34:443", success(200, 1000))
+	v := analyzeEndpoint(probe, th, nil)
+	if v.Blocking != BlockingQUIC || v.Confidence != ConfidenceMedium {
+		t.Fatal("unexpected verdict", v.Blocking, v.Confidence)
+	}
+	if v.Oddity != measurex.OddityQUICHandshakeTimeout || *v.Failure != netxlite.FailureGenericTimeoutError {
+		t.Fatal("unexpected oddity or failure", v.Oddity, v.Failure)
+	}
+}
+
+// withBody returns a successful HTTPS endpoint measurement with the given body.
+func withBody(status int64, body string) *measurex.Measurement {
+	m := success(status, int64(len(body)))
+	m.HTTPRoundTrip[0].ResponseBody = []byte(body)
+	return m
+}
+
+const (
+	testBlockpage = `<html><head><title>Blocked</title></head><body>
+<p>Access to this website has been restricted in accordance with
+the decision of the competent authority.</p></body></html>`
+
+	testPage = `<html><head><title>Example</title></head><body>
+<p>This domain is for use in illustrative examples in documents. You may
+use this domain in literature without prior coordination.</p></body></html>`
+)
+
+func TestAnalyzeEndpointBodySimilarity(t *testing.T) {
+	const address = "93.184.216.34:443"
+	th := newEndpoint(measurex.NetworkTCP, address, withBody(200, testPage))
+
+	t.Run("with a similar but much shorter body", func(t *testing.T) {
+		// Same visible text but much less markup: comparing the lengths
+		// would flag http-diff but comparing the text does not.
+		body := "<p>This domain is for use in illustrative examples in documents. You may " +
+			"use this domain in literature without prior coordination.</p>"
+		probe := newEndpoint(measurex.NetworkTCP, address, withBody(200, body))
+		v := analyzeEndpoint(probe, th, nil)
+		if !v.Accessible || v.Blocking != BlockingNone || v.Confidence != ConfidenceHigh {
+			t.Fatal("unexpected verdict", v.Verdict)
+		}
+	})
+
+	t.Run("with a different body of similar length", func(t *testing.T) {
+		probe := newEndpoint(measurex.NetworkTCP, address, withBody(200, testBlockpage))
+		v := analyzeEndpoint(probe, th, nil)
+		if v.Accessible || v.Blocking != BlockingHTTPDiff || v.Confidence != ConfidenceMedium {
+			t.Fatal("unexpected verdict", v.Verdict)
+		}
+		if v.Blockpage != "" {
+			t.Fatal("unexpected blockpage", v.Blockpage)
+		}
+	})
+}
+
+func TestAnalyzeURLMeasurementWithBlockpages(t *testing.T) {
+	sig := pagefingerprint.NewSignature("xx_01", []byte(testBlockpage))
+	db, err := blockpage.NewDB(&blockpage.Rule{
+		ID:      sig.ID,
+		SimHash: sig.SimHash,
+		DOMHash: sig.DOMHash,
+	}, &blockpage.Rule{
+		ID:    "xx_02",
+		Addrs: []string{"10.10.34.34"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("with a known blockpage body", func(t *testing.T) {
+		const address = "93.184.216.34:443"
+		m := &measurex.URLMeasurement{
+			URL: "https://www.example.com/",
+			DNS: newDNS(nil, "", "93.184.216.34"),
+			Endpoints: []*measurex.HTTPEndpointMeasurement{
+				newEndpoint(measurex.NetworkTCP, address, withBody(200, testBlockpage)),
+			},
+		}
+		v := AnalyzeURLMeasurementWithBlockpages(m, db)
+		if v.Blocking != BlockingHTTPDiff || v.Confidence != ConfidenceHigh || v.Blockpage != "xx_01" {
+			t.Fatal("unexpected verdict", v.Verdict)
+		}
+		if v := AnalyzeURLMeasurement(m); v.Blockpage != "" || v.Blocking != BlockingNone {
+			t.Fatal("unexpected verdict without blockpages", v.Verdict)
+		}
+	})
+
+	t.Run("with a known blockpage server", func(t *testing.T) {
+		const address = "10.10.34.34:80"
+		m := &measurex.URLMeasurement{
+			URL: "http://www.example.com/",
+			Endpoints: []*measurex.HTTPEndpointMeasurement{
+				newEndpoint(measurex.NetworkTCP, address, withBody(200, testPage)),
+			},
+		}
+		v := AnalyzeURLMeasurementWithBlockpages(m, db)
+		if len(v.Endpoints) != 1 || v.Endpoints[0].Blockpage != "xx_02" {
+			t.Fatal("unexpected endpoint verdicts", v.Endpoints)
+		}
+	})
+}
@@ -6,6 +6,10 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/archival"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
 )
 
 //
@@ -96,11 +100,18 @@ type ArchivalDNSRoundTripEvent struct {
 	Finished float64             `json:"t"`
 	Failure  *string             `json:"failure"`
 	Reply    *ArchivalBinaryData `json:"raw_reply"`
+
+	// Decoded RRs from the raw reply, which allow us to see CNAME
+	// chains and NS records without parsing the raw reply. We use the
+	// same names used by model.ArchivalDNSLookupResult.
+	Answers    []model.ArchivalDNSAnswer `json:"answers,omitempty"`
+	Authority  []model.ArchivalDNSAnswer `json:"x_authority,omitempty"`
+	Additional []model.ArchivalDNSAnswer `json:"x_additional,omitempty"`
 }
 
 // NewArchivalDNSRoundTripEvent converts a DNSRoundTripEvent into is archival format.
 func NewArchivalDNSRoundTripEvent(in *DNSRoundTripEvent) *ArchivalDNSRoundTripEvent {
-	return &ArchivalDNSRoundTripEvent{
+	out := &ArchivalDNSRoundTripEvent{
 		Network:  in.Network,
 		Address:  in.Address,
 		Query:    NewArchivalBinaryData(in.Query),
@@ -109,6 +120,18 @@ func NewArchivalDNSRoundTripEvent(in *DNSRoundTripEvent) *ArchivalDNSRoundTripEv
 		Failure:  in.Failure,
 		Reply:    NewArchivalBinaryData(in.Reply),
 	}
+	if len(in.Reply) > 0 {
+		// Note: we ignore decoding errors because the raw reply is
+		// anyway available to whoever wants to investigate further. The
+		// reply is non-nil also when the RCODE indicates failure.
+		reply, _ := (&netxlite.DNSDecoderMiekg{}).DecodeReply(in.Reply)
+		if reply != nil {
+			out.Answers = archival.NewArchivalDNSAnswerList(reply.Answer)
+			out.Authority = archival.NewArchivalDNSAnswerList(reply.Authority)
+			out.Additional = archival.NewArchivalDNSAnswerList(reply.Additional)
+		}
+	}
+	return out
 }
 
 // NewArchivalDNSRoundTripEventList converts a DNSRoundTripEvent
@@ -142,8 +165,9 @@ type ArchivalHTTPResponse struct {
 	BodyIsTruncated bool                `json:"body_is_truncated"`
 
 	// Fields not part of the spec
-	BodyLength int64 `json:"x_body_length"`
-	BodyIsUTF8 bool  `json:"x_body_is_utf8"`
+	BodyLength int64  `json:"x_body_length"`
+	BodyIsUTF8 bool   `json:"x_body_is_utf8"`
+	Proto      string `json:"x_protocol"`
 }
 
 // ArchivalHTTPRoundTripEvent is the archival format of an
@@ -201,6 +225,7 @@ func NewArchivalHTTPRoundTripEvent(in *HTTPRoundTripEvent) *ArchivalHTTPRoundTri
 			BodyLength:      in.ResponseBodyLength,
 			BodyIsTruncated: in.ResponseBodyIsTruncated,
 			BodyIsUTF8:      in.ResponseBodyIsUTF8,
+			Proto:           in.Proto,
 		},
 		Finished: in.Finished,
 		Started:  in.Started,
@@ -297,7 +322,9 @@ type ArchivalDNSLookupAnswer struct {
 	IPv6 string `json:"ivp6,omitempty"`
 
 	// Names not part of the spec.
-	ALPN string `json:"alpn,omitempty"`
+	ALPN          string              `json:"alpn,omitempty"`
+	ECHConfigList *ArchivalBinaryData `json:"ech_config_list,omitempty"`
+	ECHPublicName []string            `json:"ech_public_name,omitempty"`
 }
 
 // ArchivalDNSLookupEvent is the archival data format
@@ -337,6 +364,25 @@ func NewArchivalDNSLookupAnswers(in *DNSLookupEvent) (out []ArchivalDNSLookupAns
 			ALPN: alpn,
 		})
 	}
+	if len(in.ECH) > 0 {
+		out = append(out, ArchivalDNSLookupAnswer{
+			Type:          "ECH",
+			ECHConfigList: NewArchivalBinaryData(in.ECH),
+			ECHPublicName: echPublicNames(in.ECH),
+		})
+	}
+	return
+}
+
+// echPublicNames returns the public names inside an ECHConfigList
+// or an empty list if we cannot parse the ECHConfigList.
+func echPublicNames(echConfigList []byte) (out []string) {
+	configs, _ := netxlite.ParseECHConfigList(echConfigList)
+	for _, config := range configs {
+		if config.PublicName != "" {
+			out = append(out, config.PublicName)
+		}
+	}
 	return
 }
 
@@ -437,7 +483,11 @@ type ArchivalURLMeasurement struct {
 	URL          string                             `json:"url"`
 	DNS          []*ArchivalDNSMeasurement          `json:"dns"`
 	Endpoints    []*ArchivalHTTPEndpointMeasurement `json:"endpoints"`
+	H2Failing    []string                           `json:"x_h2_failing_endpoints,omitempty"`
+	ECH          bool                               `json:"x_advertises_ech"`
 	TH           *ArchivalTHMeasurement             `json:"th"`
+	ExtraTHs     []*ArchivalTHMeasurement           `json:"x_extra_ths,omitempty"`
+	THConsensus  *ArchivalTHConsensus               `json:"x_th_consensus,omitempty"`
 	TotalRuntime time.Duration                      `json:"x_total_runtime"`
 	DNSRuntime   time.Duration                      `json:"x_dns_runtime"`
 	THRuntime    time.Duration                      `json:"x_th_runtime"`
@@ -451,7 +501,11 @@ func NewArchivalURLMeasurement(in *URLMeasurement) *ArchivalURLMeasurement {
 		URL:          in.URL,
 		DNS:          NewArchivalDNSMeasurementList(in.DNS),
 		Endpoints:    NewArchivalHTTPEndpointMeasurementList(in.Endpoints),
+		H2Failing:    in.H2FailingEndpoints,
+		ECH:          in.AdvertisesECH,
 		TH:           NewArchivalTHMeasurement(in.TH),
+		ExtraTHs:     NewArchivalTHMeasurementList(in.ExtraTHs),
+		THConsensus:  NewArchivalTHConsensus(in.THConsensus),
 		TotalRuntime: in.TotalRuntime,
 		DNSRuntime:   in.DNSRuntime,
 		THRuntime:    in.THRuntime,
@@ -485,6 +539,34 @@ func NewArchivalEndpointMeasurement(in *EndpointMeasurement) *ArchivalEndpointMe
 	}
 }
 
+//
+// RepeatedEndpointMeasurement
+//
+
+// ArchivalRepeatedEndpointMeasurement is the archival
+// representation of RepeatedEndpointMeasurement.
+type ArchivalRepeatedEndpointMeasurement struct {
+	Network  EndpointNetwork                `json:"network"`
+	Address  string                         `json:"address"`
+	Attempts []*ArchivalEndpointMeasurement `json:"attempts"`
+	Stats    *RepeatStats                   `json:"stats"`
+}
+
+// NewArchivalRepeatedEndpointMeasurement converts a RepeatedEndpointMeasurement
+// to the corresponding archival data format.
+func NewArchivalRepeatedEndpointMeasurement(
+	in *RepeatedEndpointMeasurement) *ArchivalRepeatedEndpointMeasurement {
+	out := &ArchivalRepeatedEndpointMeasurement{
+		Network: in.Network,
+		Address: in.Address,
+		Stats:   in.Stats,
+	}
+	for _, m := range in.Attempts {
+		out.Attempts = append(out.Attempts, NewArchivalEndpointMeasurement(m))
+	}
+	return out
+}
+
 //
 // THMeasurement
 //
@@ -506,6 +588,34 @@ func NewArchivalTHMeasurement(in *THMeasurement) (out *ArchivalTHMeasurement) {
 	return
 }
 
+// NewArchivalTHMeasurementList converts a list of THMeasurement
+// to a list of ArchivalTHMeasurement.
+func NewArchivalTHMeasurementList(in []*THMeasurement) (out []*ArchivalTHMeasurement) {
+	for _, m := range in {
+		out = append(out, NewArchivalTHMeasurement(m))
+	}
+	return
+}
+
+// ArchivalTHConsensus is the archival representation of THConsensus.
+type ArchivalTHConsensus struct {
+	Helpers   int      `json:"helpers"`
+	Addrs     []string `json:"addrs"`
+	Endpoints []string `json:"endpoints"`
+}
+
+// NewArchivalTHConsensus creates the archival representation of THConsensus.
+func NewArchivalTHConsensus(in *THConsensus) (out *ArchivalTHConsensus) {
+	if in != nil {
+		out = &ArchivalTHConsensus{
+			Helpers:   in.Helpers,
+			Addrs:     in.Addrs,
+			Endpoints: in.Endpoints,
+		}
+	}
+	return
+}
+
 //
 // DNSMeasurement
 //
@@ -540,9 +650,11 @@ func NewArchivalDNSMeasurementList(in []*DNSMeasurement) (out []*ArchivalDNSMeas
 // ArchivalHTTPEndpointMeasurement is the archival representation
 // of an HTTPEndpointMeasurement.
 type ArchivalHTTPEndpointMeasurement struct {
-	URL     string          `json:"url"`
-	Network EndpointNetwork `json:"network"`
-	Address string          `json:"address"`
+	URL                string          `json:"url"`
+	Network            EndpointNetwork `json:"network"`
+	Address            string          `json:"address"`
+	ALPN               []string        `json:"alpn,omitempty"`
+	NegotiatedProtocol string          `json:"negotiated_protocol,omitempty"`
 	*ArchivalMeasurement
 }
 
@@ -553,12 +665,62 @@ func NewArchivalHTTPEndpointMeasurement(in *HTTPEndpointMeasurement) *ArchivalHT
 		URL:                 in.URL,
 		Network:             in.Network,
 		Address:             in.Address,
+		ALPN:                in.ALPN,
+		NegotiatedProtocol:  in.NegotiatedProtocol,
 		ArchivalMeasurement: NewArchivalMeasurement(in.Measurement),
 	}
 }
 
 // NewArchivalHTTPEndpointMeasurementList converts a list of HTTPEndpointMeasurement
 // to a list of ArchivalHTTPEndpointMeasurement.
+//
+// DNSLateResponseEvent
+//
+
+// ArchivalDNSLateResponseEvent is the OONI data format representation
+// of a late DNS reply, which is currently not specified. We use the same
+// names used by ArchivalDNSRoundTripEvent.
+type ArchivalDNSLateResponseEvent struct {
+	Network  string              `json:"engine"`
+	Address  string              `json:"resolver_address"`
+	Query    *ArchivalBinaryData `json:"raw_query"`
+	Finished float64             `json:"t"`
+	Reply    *ArchivalBinaryData `json:"raw_reply"`
+
+	// Decoded RRs from the raw reply (see ArchivalDNSRoundTripEvent).
+	Answers    []model.ArchivalDNSAnswer `json:"answers,omitempty"`
+	Authority  []model.ArchivalDNSAnswer `json:"x_authority,omitempty"`
+	Additional []model.ArchivalDNSAnswer `json:"x_additional,omitempty"`
+}
+
+// NewArchivalDNSLateResponseEvent converts a DNSLateResponseEvent into is archival format.
+func NewArchivalDNSLateResponseEvent(in *DNSLateResponseEvent) *ArchivalDNSLateResponseEvent {
+	out := &ArchivalDNSLateResponseEvent{
+		Network:  in.Network,
+		Address:  in.Address,
+		Query:    NewArchivalBinaryData(in.Query),
+		Finished: in.Finished,
+		Reply:    NewArchivalBinaryData(in.Reply),
+	}
+	// Note: like for round trips, we ignore decoding errors.
+	reply, _ := (&netxlite.DNSDecoderMiekg{}).DecodeReply(in.Reply)
+	if reply != nil {
+		out.Answers = archival.NewArchivalDNSAnswerList(reply.Answer)
+		out.Authority = archival.NewArchivalDNSAnswerList(reply.Authority)
+		out.Additional = archival.NewArchivalDNSAnswerList(reply.Additional)
+	}
+	return out
+}
+
+// NewArchivalDNSLateResponseEventList converts a DNSLateResponseEvent
+// list to the corresponding archival format.
+func NewArchivalDNSLateResponseEventList(in []*DNSLateResponseEvent) (out []*ArchivalDNSLateResponseEvent) {
+	for _, ev := range in {
+		out = append(out, NewArchivalDNSLateResponseEvent(ev))
+	}
+	return
+}
+
 func NewArchivalHTTPEndpointMeasurementList(in []*HTTPEndpointMeasurement) (out []*ArchivalHTTPEndpointMeasurement) {
 	for _, m := range in {
 		out = append(out, NewArchivalHTTPEndpointMeasurement(m))
@@ -574,6 +736,7 @@ func NewArchivalHTTPEndpointMeasurementList(in []*HTTPEndpointMeasurement) (out
 type ArchivalMeasurement struct {
 	NetworkEvents  []*ArchivalNetworkEvent          `json:"network_events,omitempty"`
 	DNSEvents      []*ArchivalDNSRoundTripEvent     `json:"dns_events,omitempty"`
+	DNSLateEvents  []*ArchivalDNSLateResponseEvent  `json:"x_dns_late_responses,omitempty"`
 	Queries        []*ArchivalDNSLookupEvent        `json:"queries,omitempty"`
 	TCPConnect     []*ArchivalTCPConnect            `json:"tcp_connect,omitempty"`
 	TLSHandshakes  []*ArchivalQUICTLSHandshakeEvent `json:"tls_handshakes,omitempty"`
@@ -586,6 +749,7 @@ func NewArchivalMeasurement(in *Measurement) *ArchivalMeasurement {
 	out := &ArchivalMeasurement{
 		NetworkEvents:  NewArchivalNetworkEventList(in.ReadWrite),
 		DNSEvents:      NewArchivalDNSRoundTripEventList(in.DNSRoundTrip),
+		DNSLateEvents:  NewArchivalDNSLateResponseEventList(in.DNSLateResponse),
 		Queries:        nil, // done below
 		TCPConnect:     NewArchivalTCPConnectList(in.Connect),
 		TLSHandshakes:  NewArchivalQUICTLSHandshakeEventList(in.TLSHandshake),
@@ -0,0 +1,280 @@
+package measurex
+
+//
+// Chrome trace
+//
+// This file converts a Measurement into the Chrome trace event
+// format, which you can load into chrome://tracing or Perfetto
+// to visualize concurrency, stalls, and failures.
+//
+// See https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+// for the specification of the format.
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ChromeTraceEvent is an event in the Chrome trace event format.
+type ChromeTraceEvent struct {
+	// Name is the name of the event (e.g., "connect").
+	Name string `json:"name"`
+
+	// Cat is the event category (e.g., "tcp", "dns").
+	Cat string `json:"cat,omitempty"`
+
+	// Ph is the event phase ("X" for complete events, "i" for
+	// instant events, and "M" for metadata events).
+	Ph string `json:"ph"`
+
+	// Ts is the timestamp in microseconds since Measurer.Begin.
+	Ts float64 `json:"ts"`
+
+	// Dur is the duration in microseconds of complete events.
+	Dur float64 `json:"dur,omitempty"`
+
+	// Pid is the process ID (we always use a single process).
+	Pid int `json:"pid"`
+
+	// Tid is the thread ID, which we use to group events
+	// by endpoint, resolver, or URL.
+	Tid int `json:"tid"`
+
+	// S is the scope of instant events.
+	S string `json:"s,omitempty"`
+
+	// Cname is the OPTIONAL color name (we use it for failures).
+	Cname string `json:"cname,omitempty"`
+
+	// Args contains additional information about the event.
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// ChromeTrace is a trace in the Chrome trace event format.
+type ChromeTrace struct {
+	// TraceEvents contains the events.
+	TraceEvents []*ChromeTraceEvent `json:"traceEvents"`
+
+	// DisplayTimeUnit is the unit used to display times.
+	DisplayTimeUnit string `json:"displayTimeUnit"`
+}
+
+// WriteTo writes the trace as JSON into w.
+func (t *ChromeTrace) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return 0, err
+	}
+	count, err := w.Write(data)
+	return int64(count), err
+}
+
+// chromeTraceBuilder builds a ChromeTrace.
+type chromeTraceBuilder struct {
+	// events contains the complete and instant events.
+	events []*ChromeTraceEvent
+
+	// lanes maps a lane name to its thread ID.
+	lanes map[string]int
+
+	// names contains the lane names in thread ID order.
+	names []string
+}
+
+// NewChromeTrace converts one or more Measurement into a ChromeTrace. We
+// group events in lanes (i.e., "threads" in the trace viewer), using one lane
+// for each endpoint, resolver, and URL. All the measurements MUST share the
+// same Measurer.Begin because we use it as the zero of the timeline.
+func NewChromeTrace(measurements ...*Measurement) *ChromeTrace {
+	b := &chromeTraceBuilder{lanes: map[string]int{}}
+	for _, m := range measurements {
+		if m != nil {
+			b.add(m)
+		}
+	}
+	return b.finish()
+}
+
+// NewChromeTraceForURLMeasurement is like NewChromeTrace but uses all
+// the measurements collected by the probe for the given URL. We do not
+// include the TH measurements, because they use a different clock.
+func NewChromeTraceForURLMeasurement(um *URLMeasurement) *ChromeTrace {
+	var measurements []*Measurement
+	for _, m := range um.DNS {
+		measurements = append(measurements, m.Measurement)
+	}
+	for _, m := range um.Endpoints {
+		measurements = append(measurements, m.Measurement)
+	}
+	return NewChromeTrace(measurements...)
+}
+
+// add adds all the events inside a measurement.
+func (b *chromeTraceBuilder) add(m *Measurement) {
+	for _, ev := range m.Connect {
+		b.addNetworkEvent(ev)
+	}
+	for _, ev := range m.ReadWrite {
+		b.addNetworkEvent(ev)
+	}
+	for _, ev := range m.Close {
+		b.addNetworkEvent(ev)
+	}
+	for _, ev := range m.TLSHandshake {
+		b.addHandshakeEvent("tls_handshake", ev)
+	}
+	for _, ev := range m.QUICHandshake {
+		b.addHandshakeEvent("quic_handshake", ev)
+	}
+	for _, ev := range m.LookupHost {
+		b.addLookupEvent("lookup_host", ev)
+	}
+	for _, ev := range m.LookupHTTPSSvc {
+		b.addLookupEvent("lookup_httpssvc", ev)
+	}
+	for _, ev := range m.DNSRoundTrip {
+		b.addComplete(chromeTraceResolverLane(ev.Network, ev.Address), &ChromeTraceEvent{
+			Name: "dns_round_trip",
+			Cat:  "dns",
+			Args: map[string]interface{}{
+				"query_size": len(ev.Query),
+				"reply_size": len(ev.Reply),
+			},
+		}, ev.Started, ev.Finished, ev.Failure)
+	}
+	for _, ev := range m.DNSLateResponse {
+		b.addInstant(chromeTraceResolverLane(ev.Network, ev.Address), &ChromeTraceEvent{
+			Name: "dns_late_response",
+			Cat:  "dns",
+			Args: map[string]interface{}{
+				"reply_size": len(ev.Reply),
+			},
+		}, ev.Finished)
+	}
+	for _, ev := range m.HTTPRoundTrip {
+		b.addComplete("http "+ev.URL, &ChromeTraceEvent{
+			Name: fmt.Sprintf("%s %s", ev.Method, ev.URL),
+			Cat:  "http",
+			Args: map[string]interface{}{
+				"status_code":    ev.StatusCode,
+				"body_length":    ev.ResponseBodyLength,
+				"body_truncated": ev.ResponseBodyIsTruncated,
+				"oddity":         ev.Oddity,
+			},
+		}, ev.Started, ev.Finished, ev.Failure)
+	}
+}
+
+// chromeTraceResolverLane returns the lane of a resolver.
+func chromeTraceResolverLane(network, address string) string {
+	if address == "" {
+		return "dns " + network
+	}
+	return fmt.Sprintf("dns %s %s", network, address)
+}
+
+// addNetworkEvent adds a connect, read, write, or close event.
+func (b *chromeTraceBuilder) addNetworkEvent(ev *NetworkEvent) {
+	args := map[string]interface{}{}
+	if ev.Count > 0 {
+		args["num_bytes"] = ev.Count
+	}
+	if ev.Oddity != "" {
+		args["oddity"] = ev.Oddity
+	}
+	b.addComplete(ev.Network+" "+ev.RemoteAddr, &ChromeTraceEvent{
+		Name: ev.Operation,
+		Cat:  ev.Network,
+		Args: args,
+	}, ev.Started, ev.Finished, ev.Failure)
+}
+
+// addHandshakeEvent adds a TLS or QUIC handshake event.
+func (b *chromeTraceBuilder) addHandshakeEvent(name string, ev *QUICTLSHandshakeEvent) {
+	b.addComplete(ev.Network+" "+ev.RemoteAddr, &ChromeTraceEvent{
+		Name: name,
+		Cat:  ev.Network,
+		Args: map[string]interface{}{
+			"sni":              ev.SNI,
+			"alpn":             ev.ALPN,
+			"negotiated_proto": ev.NegotiatedProto,
+			"tls_version":      ev.TLSVersion,
+			"oddity":           ev.Oddity,
+		},
+	}, ev.Started, ev.Finished, ev.Failure)
+}
+
+// addLookupEvent adds a DNS lookup event.
+func (b *chromeTraceBuilder) addLookupEvent(name string, ev *DNSLookupEvent) {
+	b.addComplete(chromeTraceResolverLane(ev.Network, ev.Address), &ChromeTraceEvent{
+		Name: fmt.Sprintf("%s %s", name, ev.Domain),
+		Cat:  "dns",
+		Args: map[string]interface{}{
+			"a":      ev.A,
+			"aaaa":   ev.AAAA,
+			"alpn":   ev.ALPN,
+			"oddity": ev.Oddity,
+		},
+	}, ev.Started, ev.Finished, ev.Failure)
+}
+
+// addComplete adds a complete event spanning from started to finished,
+// which are expressed in seconds since the beginning of the measurement.
+func (b *chromeTraceBuilder) addComplete(lane string,
+	ev *ChromeTraceEvent, started, finished float64, failure *string) {
+	ev.Ph = "X"
+	ev.Ts = started * 1e06
+	ev.Dur = (finished - started) * 1e06
+	if failure != nil {
+		if ev.Args == nil {
+			ev.Args = map[string]interface{}{}
+		}
+		ev.Args["failure"] = *failure
+		ev.Cname = "terrible"
+	}
+	b.append(lane, ev)
+}
+
+// addInstant adds an instant event at the given time, which
+// is expressed in seconds since the beginning of the measurement.
+func (b *chromeTraceBuilder) addInstant(lane string, ev *ChromeTraceEvent, t float64) {
+	ev.Ph = "i"
+	ev.S = "t"
+	ev.Ts = t * 1e06
+	b.append(lane, ev)
+}
+
+// append appends an event to the given lane.
+func (b *chromeTraceBuilder) append(lane string, ev *ChromeTraceEvent) {
+	tid, found := b.lanes[lane]
+	if !found {
+		tid = len(b.names) + 1
+		b.lanes[lane] = tid
+		b.names = append(b.names, lane)
+	}
+	ev.Pid = 1
+	ev.Tid = tid
+	b.events = append(b.events, ev)
+}
+
+// finish returns the ChromeTrace.
+func (b *chromeTraceBuilder) finish() *ChromeTrace {
+	sort.SliceStable(b.events, func(i, j int) bool {
+		return b.events[i].Ts < b.events[j].Ts
+	})
+	out := &ChromeTrace{DisplayTimeUnit: "ms"}
+	for idx, name := range b.names {
+		out.TraceEvents = append(out.TraceEvents, &ChromeTraceEvent{
+			Name: "thread_name",
+			Ph:   "M",
+			Pid:  1,
+			Tid:  idx + 1,
+			Args: map[string]interface{}{"name": name},
+		})
+	}
+	out.TraceEvents = append(out.TraceEvents, b.events...)
+	return out
+}
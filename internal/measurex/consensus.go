@@ -0,0 +1,133 @@
+package measurex
+
+//
+// Consensus
+//
+// Code to query several test helpers concurrently and to compute
+// what they agree upon. Test helpers in different places may see
+// different addresses for the same domain (e.g., because of CDNs),
+// so using several of them reduces false positives.
+//
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// measureURLHelpers returns all the configured MeasureURLHelpers.
+func (mx *Measurer) measureURLHelpers() (out []MeasureURLHelper) {
+	if mx.MeasureURLHelper != nil {
+		out = append(out, mx.MeasureURLHelper)
+	}
+	for _, thh := range mx.MeasureURLHelpers {
+		if thh != nil {
+			out = append(out, thh)
+		}
+	}
+	return
+}
+
+// lookupExtraHTTPEndpointsParallel calls LookupExtraHTTPEndpoints for
+// all the given helpers in parallel. It returns all the extra endpoints
+// and the TH measurements in the same order of the helpers. We do not
+// include the TH measurements of helpers that failed.
+func lookupExtraHTTPEndpointsParallel(ctx context.Context, URL *url.URL,
+	headers http.Header, helpers []MeasureURLHelper, epnts ...*HTTPEndpoint) (
+	extra []*HTTPEndpoint, ths []*THMeasurement) {
+	type result struct {
+		epnts []*HTTPEndpoint
+		th    *THMeasurement
+	}
+	results := make([]result, len(helpers))
+	wg := &sync.WaitGroup{}
+	for idx, thh := range helpers {
+		wg.Add(1)
+		go func(idx int, thh MeasureURLHelper) {
+			defer wg.Done()
+			newEpnts, th, err := thh.LookupExtraHTTPEndpoints(ctx, URL, headers, epnts...)
+			if err == nil {
+				results[idx] = result{epnts: newEpnts, th: th}
+			}
+		}(idx, thh)
+	}
+	wg.Wait()
+	for _, r := range results {
+		extra = append(extra, r.epnts...)
+		if r.th != nil {
+			ths = append(ths, r.th)
+		}
+	}
+	return
+}
+
+// THConsensus contains what several TH measurements agree upon.
+type THConsensus struct {
+	// Helpers is the number of TH measurements we used.
+	Helpers int
+
+	// Addrs contains the valid IP addresses that at least one TH
+	// resolved for the domain. We use the union because THs in
+	// different places legitimately see different CDN addresses.
+	Addrs []string
+
+	// Endpoints contains the endpoints (e.g., "8.8.8.8:443/tcp") for
+	// which at least half of the THs that measured them managed to
+	// perform an HTTP round trip.
+	Endpoints []string
+}
+
+// NewTHConsensus computes the consensus among the given TH
+// measurements for the given domain. Returns nil if the list
+// of TH measurements is empty.
+func NewTHConsensus(domain string, ths ...*THMeasurement) *THConsensus {
+	if len(ths) <= 0 {
+		return nil
+	}
+	var (
+		addrs     = map[string]bool{}
+		measured  = map[string]int{}
+		successes = map[string]int{}
+	)
+	for _, th := range ths {
+		for _, m := range th.DNS {
+			if m.Measurement == nil {
+				continue
+			}
+			for _, ev := range m.LookupHost {
+				if ev.Domain != domain || ev.Failure != nil {
+					continue
+				}
+				for _, addr := range ev.Addrs() {
+					if net.ParseIP(addr) != nil && !netxlite.IsBogon(addr) {
+						addrs[addr] = true
+					}
+				}
+			}
+		}
+		for _, epnt := range th.Endpoints {
+			key := (&Endpoint{Network: epnt.Network, Address: epnt.Address}).String()
+			measured[key]++
+			if httpEndpointSucceeded(epnt) {
+				successes[key]++
+			}
+		}
+	}
+	out := &THConsensus{Helpers: len(ths)}
+	for addr := range addrs {
+		out.Addrs = append(out.Addrs, addr)
+	}
+	for key, count := range measured {
+		if 2*successes[key] >= count {
+			out.Endpoints = append(out.Endpoints, key)
+		}
+	}
+	sort.Strings(out.Addrs)
+	sort.Strings(out.Endpoints)
+	return out
+}
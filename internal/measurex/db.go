@@ -11,6 +11,8 @@ package measurex
 // - MeasurementDB implements WritableDB and allows high-level
 // code to generate a Measurement from all the events.
 //
+// See also jsonl.go for a WritableDB that streams events to disk.
+//
 
 import "sync"
 
@@ -39,6 +41,9 @@ type WritableDB interface {
 	// InsertIntoDNSRoundTrip saves a DNS round trip event.
 	InsertIntoDNSRoundTrip(ev *DNSRoundTripEvent)
 
+	// InsertIntoDNSLateResponse saves a DNS late response event.
+	InsertIntoDNSLateResponse(ev *DNSLateResponseEvent)
+
 	// InsertIntoHTTPRoundTrip saves an HTTP round trip event.
 	InsertIntoHTTPRoundTrip(ev *HTTPRoundTripEvent)
 
@@ -53,16 +58,21 @@ type WritableDB interface {
 // to generate a Measurement from all the saved events.
 type MeasurementDB struct {
 	// database "tables"
-	dialTable          []*NetworkEvent
-	readWriteTable     []*NetworkEvent
-	closeTable         []*NetworkEvent
-	tlsHandshakeTable  []*QUICTLSHandshakeEvent
-	lookupHostTable    []*DNSLookupEvent
-	lookupHTTPSvcTable []*DNSLookupEvent
-	dnsRoundTripTable  []*DNSRoundTripEvent
-	httpRoundTripTable []*HTTPRoundTripEvent
-	httpRedirectTable  []*HTTPRedirectEvent
-	quicHandshakeTable []*QUICTLSHandshakeEvent
+	dialTable            []*NetworkEvent
+	readWriteTable       []*NetworkEvent
+	closeTable           []*NetworkEvent
+	tlsHandshakeTable    []*QUICTLSHandshakeEvent
+	lookupHostTable      []*DNSLookupEvent
+	lookupHTTPSvcTable   []*DNSLookupEvent
+	dnsRoundTripTable    []*DNSRoundTripEvent
+	dnsLateResponseTable []*DNSLateResponseEvent
+	httpRoundTripTable   []*HTTPRoundTripEvent
+	httpRedirectTable    []*HTTPRedirectEvent
+	quicHandshakeTable   []*QUICTLSHandshakeEvent
+
+	// Mirror is the OPTIONAL WritableDB into which we also
+	// save every event (e.g., a JSONLWriterDB).
+	Mirror WritableDB
 
 	// mu protects all the fields
 	mu sync.Mutex
@@ -80,6 +90,7 @@ func (db *MeasurementDB) DeleteAll() {
 	db.lookupHostTable = nil
 	db.lookupHTTPSvcTable = nil
 	db.dnsRoundTripTable = nil
+	db.dnsLateResponseTable = nil
 	db.httpRoundTripTable = nil
 	db.httpRedirectTable = nil
 	db.quicHandshakeTable = nil
@@ -91,6 +102,9 @@ func (db *MeasurementDB) InsertIntoDial(ev *NetworkEvent) {
 	db.mu.Lock()
 	db.dialTable = append(db.dialTable, ev)
 	db.mu.Unlock()
+	if db.Mirror != nil {
+		db.Mirror.InsertIntoDial(ev)
+	}
 }
 
 // selectAllFromDialUnlocked returns all dial events.
@@ -104,6 +118,9 @@ func (db *MeasurementDB) InsertIntoReadWrite(ev *NetworkEvent) {
 	db.mu.Lock()
 	db.readWriteTable = append(db.readWriteTable, ev)
 	db.mu.Unlock()
+	if db.Mirror != nil {
+		db.Mirror.InsertIntoReadWrite(ev)
+	}
 }
 
 // selectAllFromReadWriteUnlocked returns all I/O events.
@@ -117,6 +134,9 @@ func (db *MeasurementDB) InsertIntoClose(ev *NetworkEvent) {
 	db.mu.Lock()
 	db.closeTable = append(db.closeTable, ev)
 	db.mu.Unlock()
+	if db.Mirror != nil {
+		db.Mirror.InsertIntoClose(ev)
+	}
 }
 
 // selectAllFromCloseUnlocked returns all close events.
@@ -130,6 +150,9 @@ func (db *MeasurementDB) InsertIntoTLSHandshake(ev *QUICTLSHandshakeEvent) {
 	db.mu.Lock()
 	db.tlsHandshakeTable = append(db.tlsHandshakeTable, ev)
 	db.mu.Unlock()
+	if db.Mirror != nil {
+		db.Mirror.InsertIntoTLSHandshake(ev)
+	}
 }
 
 // selectAllFromTLSHandshakeUnlocked returns all TLS handshake events.
@@ -143,6 +166,9 @@ func (db *MeasurementDB) InsertIntoLookupHost(ev *DNSLookupEvent) {
 	db.mu.Lock()
 	db.lookupHostTable = append(db.lookupHostTable, ev)
 	db.mu.Unlock()
+	if db.Mirror != nil {
+		db.Mirror.InsertIntoLookupHost(ev)
+	}
 }
 
 // selectAllFromLookupHostUnlocked returns all the lookup host events.
@@ -156,6 +182,9 @@ func (db *MeasurementDB) InsertIntoLookupHTTPSSvc(ev *DNSLookupEvent) {
 	db.mu.Lock()
 	db.lookupHTTPSvcTable = append(db.lookupHTTPSvcTable, ev)
 	db.mu.Unlock()
+	if db.Mirror != nil {
+		db.Mirror.InsertIntoLookupHTTPSSvc(ev)
+	}
 }
 
 // selectAllFromLookupHTTPSSvcUnlocked returns all HTTPSSvc lookup events.
@@ -169,6 +198,9 @@ func (db *MeasurementDB) InsertIntoDNSRoundTrip(ev *DNSRoundTripEvent) {
 	db.mu.Lock()
 	db.dnsRoundTripTable = append(db.dnsRoundTripTable, ev)
 	db.mu.Unlock()
+	if db.Mirror != nil {
+		db.Mirror.InsertIntoDNSRoundTrip(ev)
+	}
 }
 
 // selectAllFromDNSRoundTripUnlocked returns all DNS round trip events.
@@ -177,11 +209,30 @@ func (db *MeasurementDB) selectAllFromDNSRoundTripUnlocked() (out []*DNSRoundTri
 	return
 }
 
+// InsertIntoDNSLateResponse implements EventDB.InsertIntoDNSLateResponse.
+func (db *MeasurementDB) InsertIntoDNSLateResponse(ev *DNSLateResponseEvent) {
+	db.mu.Lock()
+	db.dnsLateResponseTable = append(db.dnsLateResponseTable, ev)
+	db.mu.Unlock()
+	if db.Mirror != nil {
+		db.Mirror.InsertIntoDNSLateResponse(ev)
+	}
+}
+
+// selectAllFromDNSLateResponseUnlocked returns all DNS late response events.
+func (db *MeasurementDB) selectAllFromDNSLateResponseUnlocked() (out []*DNSLateResponseEvent) {
+	out = append(out, db.dnsLateResponseTable...)
+	return
+}
+
 // InsertIntoHTTPRoundTrip implements EventDB.InsertIntoHTTPRoundTrip.
 func (db *MeasurementDB) InsertIntoHTTPRoundTrip(ev *HTTPRoundTripEvent) {
 	db.mu.Lock()
 	db.httpRoundTripTable = append(db.httpRoundTripTable, ev)
 	db.mu.Unlock()
+	if db.Mirror != nil {
+		db.Mirror.InsertIntoHTTPRoundTrip(ev)
+	}
 }
 
 // selectAllFromHTTPRoundTripUnlocked returns all HTTP round trip events.
@@ -195,6 +246,9 @@ func (db *MeasurementDB) InsertIntoHTTPRedirect(ev *HTTPRedirectEvent) {
 	db.mu.Lock()
 	db.httpRedirectTable = append(db.httpRedirectTable, ev)
 	db.mu.Unlock()
+	if db.Mirror != nil {
+		db.Mirror.InsertIntoHTTPRedirect(ev)
+	}
 }
 
 // selectAllFromHTTPRedirectUnlocked returns all HTTP redirections.
@@ -208,6 +262,9 @@ func (db *MeasurementDB) InsertIntoQUICHandshake(ev *QUICTLSHandshakeEvent) {
 	db.mu.Lock()
 	db.quicHandshakeTable = append(db.quicHandshakeTable, ev)
 	db.mu.Unlock()
+	if db.Mirror != nil {
+		db.Mirror.InsertIntoQUICHandshake(ev)
+	}
 }
 
 // selectAllFromQUICHandshakeUnlocked returns all QUIC handshake events.
@@ -223,16 +280,17 @@ func (db *MeasurementDB) selectAllFromQUICHandshakeUnlocked() (out []*QUICTLSHan
 func (db *MeasurementDB) AsMeasurement() *Measurement {
 	db.mu.Lock()
 	meas := &Measurement{
-		Connect:        db.selectAllFromDialUnlocked(),
-		ReadWrite:      db.selectAllFromReadWriteUnlocked(),
-		Close:          db.selectAllFromCloseUnlocked(),
-		TLSHandshake:   db.selectAllFromTLSHandshakeUnlocked(),
-		QUICHandshake:  db.selectAllFromQUICHandshakeUnlocked(),
-		LookupHost:     db.selectAllFromLookupHostUnlocked(),
-		LookupHTTPSSvc: db.selectAllFromLookupHTTPSSvcUnlocked(),
-		DNSRoundTrip:   db.selectAllFromDNSRoundTripUnlocked(),
-		HTTPRoundTrip:  db.selectAllFromHTTPRoundTripUnlocked(),
-		HTTPRedirect:   db.selectAllFromHTTPRedirectUnlocked(),
+		Connect:         db.selectAllFromDialUnlocked(),
+		ReadWrite:       db.selectAllFromReadWriteUnlocked(),
+		Close:           db.selectAllFromCloseUnlocked(),
+		TLSHandshake:    db.selectAllFromTLSHandshakeUnlocked(),
+		QUICHandshake:   db.selectAllFromQUICHandshakeUnlocked(),
+		LookupHost:      db.selectAllFromLookupHostUnlocked(),
+		LookupHTTPSSvc:  db.selectAllFromLookupHTTPSSvcUnlocked(),
+		DNSRoundTrip:    db.selectAllFromDNSRoundTripUnlocked(),
+		DNSLateResponse: db.selectAllFromDNSLateResponseUnlocked(),
+		HTTPRoundTrip:   db.selectAllFromHTTPRoundTripUnlocked(),
+		HTTPRedirect:    db.selectAllFromHTTPRedirectUnlocked(),
 	}
 	db.mu.Unlock()
 	return meas
@@ -36,6 +36,17 @@ type DNSRoundTripEvent struct {
 	Reply    []byte
 }
 
+// DNSLateResponseEvent is a DNS-over-UDP reply received after the
+// first one, which is typical of on-path injection. See the documentation
+// of netxlite.DNSOverUDP for more information.
+type DNSLateResponseEvent struct {
+	Network  string
+	Address  string
+	Query    []byte
+	Finished float64
+	Reply    []byte
+}
+
 func (txp *dnsxRoundTripperDB) RoundTrip(ctx context.Context, query []byte) ([]byte, error) {
 	started := time.Since(txp.begin).Seconds()
 	reply, err := txp.DNSTransport.RoundTrip(ctx, query)
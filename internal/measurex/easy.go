@@ -37,7 +37,7 @@ func (mx *Measurer) EasyHTTPRoundTripGET(ctx context.Context, timeout time.Durat
 	URL string) (meas *ArchivalMeasurement, failure *string) {
 	ctx, cancel := context.WithTimeout(ctx, timeout) // honour the timeout
 	defer cancel()
-	db := &MeasurementDB{}
+	db := mx.newDB()
 	req, err := NewHTTPRequestWithContext(ctx, "GET", URL, nil)
 	if err != nil {
 		failure := err.Error()
@@ -85,6 +85,13 @@ func (easy *EasyTLSConfig) InsecureSkipVerify(v bool) *EasyTLSConfig {
 	return easy
 }
 
+// NextProtos sets the ALPN protocols (e.g., "h2"). Use this method to
+// force a specific protocol and see whether it fails.
+func (easy *EasyTLSConfig) NextProtos(v ...string) *EasyTLSConfig {
+	easy.config.NextProtos = v
+	return easy
+}
+
 // RootCAs allows the set the CA pool.
 func (easy *EasyTLSConfig) RootCAs(v *x509.CertPool) *EasyTLSConfig {
 	easy.config.RootCAs = v
@@ -125,7 +132,7 @@ func (easy *EasyTLSConfig) asTLSConfig() *tls.Config {
 func (mx *Measurer) EasyTLSConnectAndHandshake(ctx context.Context, endpoint string,
 	tlsConfig *EasyTLSConfig) (meas *ArchivalMeasurement, failure *string) {
 	// Note: TLSConnectAndHandshakeWithDB uses the timeout configured inside mx.
-	db := &MeasurementDB{}
+	db := mx.newDB()
 	conn, err := mx.TLSConnectAndHandshakeWithDB(ctx, db, endpoint, tlsConfig.asTLSConfig())
 	if err != nil {
 		failure := err.Error()
@@ -158,7 +165,7 @@ func (mx *Measurer) EasyTLSConnectAndHandshake(ctx context.Context, endpoint str
 func (mx *Measurer) EasyTCPConnect(ctx context.Context,
 	endpoint string) (meas *ArchivalMeasurement, failure *string) {
 	// Note: TCPConnectWithDB uses the timeout configured inside mx.
-	db := &MeasurementDB{}
+	db := mx.newDB()
 	conn, err := mx.TCPConnectWithDB(ctx, db, endpoint)
 	if err != nil {
 		failure := err.Error()
@@ -242,7 +249,7 @@ func (mx *Measurer) EasyOBFS4ConnectAndHandshake(ctx context.Context,
 	rawParams map[string][]string) (meas *ArchivalMeasurement, failure *string) {
 	ctx, cancel := context.WithTimeout(ctx, timeout) // honour the timeout
 	defer cancel()
-	db := &MeasurementDB{}
+	db := mx.newDB()
 	params, err := newEasyOBFS4Params(dataDir, rawParams)
 	if err != nil {
 		failure := err.Error()
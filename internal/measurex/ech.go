@@ -0,0 +1,70 @@
+package measurex
+
+//
+// ECH
+//
+// Code to check whether a domain advertises Encrypted ClientHello
+// in its HTTPS records and to perform ECH handshakes.
+//
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// ECHConfigListForDomain returns the first ECHConfigList advertised
+// by the HTTPS records for domain in the given DNS measurements or
+// nil if no HTTPS record for domain contains an ECHConfigList.
+func ECHConfigListForDomain(domain string, meas ...*DNSMeasurement) []byte {
+	for _, m := range meas {
+		for _, ev := range m.LookupHTTPSSvc {
+			if ev.Domain == domain && ev.SupportsECH() {
+				return ev.ECH
+			}
+		}
+	}
+	return nil
+}
+
+// ErrNoECHHandshaker indicates that Measurer.ECHHandshaker is nil.
+var ErrNoECHHandshaker = errors.New("measurex: no configured ECH handshaker")
+
+// TLSConnectAndHandshakeECH is like TLSConnectAndHandshake except
+// that it uses mx.ECHHandshaker with the given ECHConfigList (which
+// you typically obtain using ECHConfigListForDomain). The config's
+// ServerName is the SNI of the inner (encrypted) ClientHello.
+//
+// Returns an EndpointMeasurement and ErrNoECHHandshaker if the
+// mx.ECHHandshaker field is nil.
+func (mx *Measurer) TLSConnectAndHandshakeECH(ctx context.Context,
+	address string, config *tls.Config, echConfigList []byte) (*EndpointMeasurement, error) {
+	if mx.ECHHandshaker == nil {
+		return nil, ErrNoECHHandshaker
+	}
+	db := mx.newDB()
+	conn, err := mx.TCPConnectWithDB(ctx, db, address)
+	if err == nil {
+		ol := NewOperationLogger(mx.Logger,
+			"TLSHandshakeECH %s with sni=%s", address, config.ServerName)
+		ctx, cancel := context.WithTimeout(ctx, mx.tlsHandshakeTimeout())
+		th := mx.WrapTLSHandshaker(db, netxlite.NewTLSHandshakerECH(
+			mx.Logger, mx.ECHHandshaker, echConfigList))
+		var tlsConn Conn
+		tlsConn, _, err = th.Handshake(ctx, conn, config)
+		cancel()
+		ol.Stop(err)
+		if err == nil {
+			tlsConn.Close()
+		} else {
+			conn.Close()
+		}
+	}
+	return &EndpointMeasurement{
+		Network:     NetworkTCP,
+		Address:     address,
+		Measurement: db.AsMeasurement(),
+	}, nil
+}
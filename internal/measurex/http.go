@@ -138,8 +138,9 @@ type HTTPResponse struct {
 	BodyIsTruncated bool                `json:"body_is_truncated"`
 
 	// Fields not part of the spec
-	BodyLength int64 `json:"x_body_length"`
-	BodyIsUTF8 bool  `json:"x_body_is_utf8"`
+	BodyLength int64  `json:"x_body_length"`
+	BodyIsUTF8 bool   `json:"x_body_is_utf8"`
+	Proto      string `json:"x_protocol"`
 }
 
 // HTTPRoundTripEvent contains information about an HTTP round trip.
@@ -149,6 +150,7 @@ type HTTPRoundTripEvent struct {
 	URL                     string
 	RequestHeaders          http.Header
 	StatusCode              int64
+	Proto                   string
 	ResponseHeaders         http.Header
 	ResponseBody            []byte
 	ResponseBodyLength      int64
@@ -185,6 +187,7 @@ func (txp *HTTPTransportDB) RoundTrip(req *http.Request) (*http.Response, error)
 		rt.Oddity = OddityStatusOther
 	}
 	rt.StatusCode = int64(resp.StatusCode)
+	rt.Proto = resp.Proto
 	rt.ResponseHeaders = resp.Header
 	r := io.LimitReader(resp.Body, txp.MaxBodySnapshotSize)
 	body, err := netxlite.ReadAllContext(req.Context(), r)
@@ -0,0 +1,322 @@
+package measurex
+
+//
+// JSONL
+//
+// This file defines JSONLWriterDB, a WritableDB that appends
+// each event to a JSONL stream as soon as it happens, and
+// ReadJSONLMeasurement, which rebuilds a Measurement from
+// such a stream (e.g., after a crash).
+//
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// These are the tables used by the JSONL stream.
+const (
+	JSONLTableDial            = "dial"
+	JSONLTableReadWrite       = "read_write"
+	JSONLTableClose           = "close"
+	JSONLTableTLSHandshake    = "tls_handshake"
+	JSONLTableLookupHost      = "lookup_host"
+	JSONLTableLookupHTTPSSvc  = "lookup_https_svc"
+	JSONLTableDNSRoundTrip    = "dns_round_trip"
+	JSONLTableDNSLateResponse = "dns_late_response"
+	JSONLTableHTTPRoundTrip   = "http_round_trip"
+	JSONLTableHTTPRedirect    = "http_redirect"
+	JSONLTableQUICHandshake   = "quic_handshake"
+)
+
+// JSONLEntry is a line of a JSONL events stream.
+type JSONLEntry struct {
+	// Table is the table in which we inserted the event.
+	Table string `json:"table"`
+
+	// Event is the serialized event.
+	Event json.RawMessage `json:"event"`
+}
+
+// JSONLWriterDB is a WritableDB that writes each event as a
+// JSONLEntry line into the underlying io.Writer. We issue a single
+// Write per event, hence you can tail the file while measuring.
+//
+// You typically use it as Measurer.EventsDB, so that the events
+// are also saved in memory to produce the Measurement.
+type JSONLWriterDB struct {
+	// err is the first error that occurred.
+	err error
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// w is the underlying writer.
+	w io.Writer
+}
+
+// NewJSONLWriterDB creates a new JSONLWriterDB writing into w.
+func NewJSONLWriterDB(w io.Writer) *JSONLWriterDB {
+	return &JSONLWriterDB{w: w}
+}
+
+var _ WritableDB = &JSONLWriterDB{}
+
+// Err returns the first error that occurred while serializing
+// or writing events. Once an error occurs, we stop writing.
+func (db *JSONLWriterDB) Err() error {
+	defer db.mu.Unlock()
+	db.mu.Lock()
+	return db.err
+}
+
+// insert serializes and writes ev into the given table.
+func (db *JSONLWriterDB) insert(table string, ev interface{}) {
+	defer db.mu.Unlock()
+	db.mu.Lock()
+	if db.err != nil {
+		return
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		db.err = err
+		return
+	}
+	line, err := json.Marshal(&JSONLEntry{Table: table, Event: data})
+	if err != nil {
+		db.err = err
+		return
+	}
+	_, db.err = db.w.Write(append(line, '\n'))
+}
+
+// InsertIntoDial implements EventDB.InsertIntoDial.
+func (db *JSONLWriterDB) InsertIntoDial(ev *NetworkEvent) {
+	db.insert(JSONLTableDial, ev)
+}
+
+// InsertIntoReadWrite implements EventDB.InsertIntoReadWrite.
+func (db *JSONLWriterDB) InsertIntoReadWrite(ev *NetworkEvent) {
+	db.insert(JSONLTableReadWrite, ev)
+}
+
+// InsertIntoClose implements EventDB.InsertIntoClose.
+func (db *JSONLWriterDB) InsertIntoClose(ev *NetworkEvent) {
+	db.insert(JSONLTableClose, ev)
+}
+
+// InsertIntoTLSHandshake implements EventDB.InsertIntoTLSHandshake.
+func (db *JSONLWriterDB) InsertIntoTLSHandshake(ev *QUICTLSHandshakeEvent) {
+	db.insert(JSONLTableTLSHandshake, ev)
+}
+
+// InsertIntoLookupHost implements EventDB.InsertIntoLookupHost.
+func (db *JSONLWriterDB) InsertIntoLookupHost(ev *DNSLookupEvent) {
+	db.insert(JSONLTableLookupHost, ev)
+}
+
+// InsertIntoLookupHTTPSSvc implements EventDB.InsertIntoLookupHTTPSSvc.
+func (db *JSONLWriterDB) InsertIntoLookupHTTPSSvc(ev *DNSLookupEvent) {
+	db.insert(JSONLTableLookupHTTPSSvc, ev)
+}
+
+// InsertIntoDNSRoundTrip implements EventDB.InsertIntoDNSRoundTrip.
+func (db *JSONLWriterDB) InsertIntoDNSRoundTrip(ev *DNSRoundTripEvent) {
+	db.insert(JSONLTableDNSRoundTrip, ev)
+}
+
+// InsertIntoDNSLateResponse implements EventDB.InsertIntoDNSLateResponse.
+func (db *JSONLWriterDB) InsertIntoDNSLateResponse(ev *DNSLateResponseEvent) {
+	db.insert(JSONLTableDNSLateResponse, ev)
+}
+
+// InsertIntoHTTPRoundTrip implements EventDB.InsertIntoHTTPRoundTrip.
+func (db *JSONLWriterDB) InsertIntoHTTPRoundTrip(ev *HTTPRoundTripEvent) {
+	db.insert(JSONLTableHTTPRoundTrip, ev)
+}
+
+// InsertIntoHTTPRedirect implements EventDB.InsertIntoHTTPRedirect.
+func (db *JSONLWriterDB) InsertIntoHTTPRedirect(ev *HTTPRedirectEvent) {
+	db.insert(JSONLTableHTTPRedirect, newJSONLHTTPRedirectEvent(ev))
+}
+
+// InsertIntoQUICHandshake implements EventDB.InsertIntoQUICHandshake.
+func (db *JSONLWriterDB) InsertIntoQUICHandshake(ev *QUICTLSHandshakeEvent) {
+	db.insert(JSONLTableQUICHandshake, ev)
+}
+
+// jsonlHTTPRedirectEvent is the JSON serializable HTTPRedirectEvent.
+type jsonlHTTPRedirectEvent struct {
+	URL      string
+	Location string
+	Cookies  []string
+	Error    string
+}
+
+// newJSONLHTTPRedirectEvent converts an HTTPRedirectEvent.
+func newJSONLHTTPRedirectEvent(ev *HTTPRedirectEvent) *jsonlHTTPRedirectEvent {
+	out := &jsonlHTTPRedirectEvent{}
+	if ev.URL != nil {
+		out.URL = ev.URL.String()
+	}
+	if ev.Location != nil {
+		out.Location = ev.Location.String()
+	}
+	for _, cookie := range ev.Cookies {
+		out.Cookies = append(out.Cookies, cookie.String())
+	}
+	if ev.Error != nil {
+		out.Error = ev.Error.Error()
+	}
+	return out
+}
+
+// toHTTPRedirectEvent converts back to an HTTPRedirectEvent.
+func (ev *jsonlHTTPRedirectEvent) toHTTPRedirectEvent() (*HTTPRedirectEvent, error) {
+	out := &HTTPRedirectEvent{}
+	if ev.URL != "" {
+		URL, err := url.Parse(ev.URL)
+		if err != nil {
+			return nil, err
+		}
+		out.URL = URL
+	}
+	if ev.Location != "" {
+		location, err := url.Parse(ev.Location)
+		if err != nil {
+			return nil, err
+		}
+		out.Location = location
+	}
+	if len(ev.Cookies) > 0 {
+		resp := &http.Response{Header: http.Header{"Set-Cookie": ev.Cookies}}
+		out.Cookies = resp.Cookies()
+	}
+	switch ev.Error {
+	case "":
+	case ErrHTTPTooManyRedirects.Error():
+		out.Error = ErrHTTPTooManyRedirects
+	case http.ErrUseLastResponse.Error():
+		out.Error = http.ErrUseLastResponse
+	default:
+		out.Error = errors.New(ev.Error)
+	}
+	return out, nil
+}
+
+// ErrJSONLUnknownTable indicates that a JSONL stream
+// contains an entry for an unknown table.
+var ErrJSONLUnknownTable = errors.New("measurex: unknown JSONL table")
+
+// ReadJSONLMeasurement reads all the events saved by a JSONLWriterDB
+// and rebuilds the corresponding Measurement. Because the writer may
+// have crashed while writing, we ignore a truncated last line.
+func ReadJSONLMeasurement(r io.Reader) (*Measurement, error) {
+	db := &MeasurementDB{}
+	if err := ReadJSONLInto(r, db); err != nil {
+		return nil, err
+	}
+	return db.AsMeasurement(), nil
+}
+
+// maxJSONLLineSize is the maximum size of a JSONL line.
+const maxJSONLLineSize = 1 << 26
+
+// ReadJSONLInto is like ReadJSONLMeasurement but inserts the
+// events into the given WritableDB, in the order in which we
+// originally saved them.
+func ReadJSONLInto(r io.Reader, db WritableDB) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxJSONLLineSize)
+	var truncated error
+	for lineno := 1; scanner.Scan(); lineno++ {
+		if truncated != nil {
+			return truncated // the broken line was not the last one
+		}
+		var entry JSONLEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			truncated = fmt.Errorf("measurex: JSONL line %d: %w", lineno, err)
+			continue
+		}
+		if err := insertJSONLEntry(db, &entry); err != nil {
+			return fmt.Errorf("measurex: JSONL line %d: %w", lineno, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// insertJSONLEntry inserts the given entry into the given db.
+func insertJSONLEntry(db WritableDB, entry *JSONLEntry) error {
+	switch entry.Table {
+	case JSONLTableDial, JSONLTableReadWrite, JSONLTableClose:
+		var ev NetworkEvent
+		if err := json.Unmarshal(entry.Event, &ev); err != nil {
+			return err
+		}
+		switch entry.Table {
+		case JSONLTableDial:
+			db.InsertIntoDial(&ev)
+		case JSONLTableReadWrite:
+			db.InsertIntoReadWrite(&ev)
+		default:
+			db.InsertIntoClose(&ev)
+		}
+	case JSONLTableTLSHandshake, JSONLTableQUICHandshake:
+		var ev QUICTLSHandshakeEvent
+		if err := json.Unmarshal(entry.Event, &ev); err != nil {
+			return err
+		}
+		if entry.Table == JSONLTableTLSHandshake {
+			db.InsertIntoTLSHandshake(&ev)
+		} else {
+			db.InsertIntoQUICHandshake(&ev)
+		}
+	case JSONLTableLookupHost, JSONLTableLookupHTTPSSvc:
+		var ev DNSLookupEvent
+		if err := json.Unmarshal(entry.Event, &ev); err != nil {
+			return err
+		}
+		if entry.Table == JSONLTableLookupHost {
+			db.InsertIntoLookupHost(&ev)
+		} else {
+			db.InsertIntoLookupHTTPSSvc(&ev)
+		}
+	case JSONLTableDNSRoundTrip:
+		var ev DNSRoundTripEvent
+		if err := json.Unmarshal(entry.Event, &ev); err != nil {
+			return err
+		}
+		db.InsertIntoDNSRoundTrip(&ev)
+	case JSONLTableDNSLateResponse:
+		var ev DNSLateResponseEvent
+		if err := json.Unmarshal(entry.Event, &ev); err != nil {
+			return err
+		}
+		db.InsertIntoDNSLateResponse(&ev)
+	case JSONLTableHTTPRoundTrip:
+		var ev HTTPRoundTripEvent
+		if err := json.Unmarshal(entry.Event, &ev); err != nil {
+			return err
+		}
+		db.InsertIntoHTTPRoundTrip(&ev)
+	case JSONLTableHTTPRedirect:
+		var jev jsonlHTTPRedirectEvent
+		if err := json.Unmarshal(entry.Event, &jev); err != nil {
+			return err
+		}
+		ev, err := jev.toHTTPRedirectEvent()
+		if err != nil {
+			return err
+		}
+		db.InsertIntoHTTPRedirect(ev)
+	default:
+		return fmt.Errorf("%w: %s", ErrJSONLUnknownTable, entry.Table)
+	}
+	return nil
+}
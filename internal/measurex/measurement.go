@@ -31,10 +31,28 @@ type URLMeasurement struct {
 	// if we choose to follow redirections.
 	RedirectURLs []string
 
+	// H2FailingEndpoints contains the addresses of the endpoints where
+	// h2 failed and http/1.1 succeeded (see FindH2FailingEndpoints).
+	H2FailingEndpoints []string
+
+	// AdvertisesECH indicates whether any HTTPS record for the
+	// URL's domain contained an ECHConfigList.
+	AdvertisesECH bool
+
 	// TH is the measurement collected by the TH. This field
-	// will be nil if we cannot contact the TH.
+	// will be nil if we cannot contact the TH. When we're using
+	// several THs, this is the measurement of the first TH that
+	// replied successfully.
 	TH *THMeasurement
 
+	// ExtraTHs contains the measurements collected by the other
+	// THs that replied successfully, if any.
+	ExtraTHs []*THMeasurement
+
+	// THConsensus is what TH and ExtraTHs agree upon. This field
+	// will be nil if we cannot contact any TH.
+	THConsensus *THConsensus
+
 	// TotalRuntime is the total time to measure this URL.
 	TotalRuntime time.Duration
 
@@ -48,6 +66,15 @@ type URLMeasurement struct {
 	EpntsRuntime time.Duration
 }
 
+// AllTHs returns TH and ExtraTHs as a single list.
+func (m *URLMeasurement) AllTHs() (out []*THMeasurement) {
+	if m.TH != nil {
+		out = append(out, m.TH)
+	}
+	out = append(out, m.ExtraTHs...)
+	return
+}
+
 // fillRedirects takes in input a complete URLMeasurement and fills
 // the field named Redirects with all redirections.
 func (m *URLMeasurement) fillRedirects() {
@@ -91,6 +118,10 @@ type Measurement struct {
 	// DNSRoundTrip contains all the DNS round trips.
 	DNSRoundTrip []*DNSRoundTripEvent
 
+	// DNSLateResponse contains the DNS-over-UDP replies
+	// received after the first reply for a given query.
+	DNSLateResponse []*DNSLateResponseEvent
+
 	// HTTPRoundTrip contains all the HTTP round trips.
 	HTTPRoundTrip []*HTTPRoundTripEvent
 
@@ -260,6 +291,13 @@ type HTTPEndpointMeasurement struct {
 	// Address is the address of this endpoint.
 	Address string
 
+	// ALPN contains the ALPN protocols we offered.
+	ALPN []string
+
+	// NegotiatedProtocol is the protocol negotiated using
+	// ALPN or empty if we did not complete a handshake.
+	NegotiatedProtocol string
+
 	// An HTTPEndpointMeasurement is a Measurement.
 	*Measurement
 }
@@ -39,6 +39,23 @@ type Measurer struct {
 	// the shorter watchdog timeout will prevail.
 	DNSLookupTimeout time.Duration
 
+	// DNSLateResponsesWindow is the OPTIONAL amount of time for which
+	// a DNS-over-UDP transport keeps reading replies after the first one
+	// to collect late (e.g., duplicate or injected) replies. If not set,
+	// we return as soon as we receive the first reply.
+	DNSLateResponsesWindow time.Duration
+
+	// ECHHandshaker is the OPTIONAL handshaker we use to perform
+	// ECH handshakes in TLSConnectAndHandshakeECH. We do not provide
+	// an implementation, so you need to plug in your own.
+	ECHHandshaker netxlite.ECHHandshaker
+
+	// EventsDB is the OPTIONAL WritableDB into which we also save
+	// every measurement event as soon as it happens (e.g., a
+	// JSONLWriterDB streaming events to disk). If not set, events
+	// only live in memory until we return a Measurement.
+	EventsDB WritableDB
+
 	// HTTPClient is the MANDATORY HTTP client for the WCTH.
 	HTTPClient model.HTTPClient
 
@@ -58,11 +75,21 @@ type Measurer struct {
 	// Logger is the MANDATORY logger to use.
 	Logger model.Logger
 
+	// MeasureALPNSeparately OPTIONALLY instructs MeasureURL to measure
+	// each HTTPS endpoint using TCP twice, forcing h2 the first time and
+	// http/1.1 the second time, rather than offering both.
+	MeasureALPNSeparately bool
+
 	// MeasureURLHelper is the OPTIONAL test helper to use when
 	// we're measuring using the MeasureURL function. If this field
 	// is not set, we'll not be using any helper.
 	MeasureURLHelper MeasureURLHelper
 
+	// MeasureURLHelpers contains OPTIONAL additional test helpers
+	// to use when we're measuring using the MeasureURL function. We
+	// query these helpers and MeasureURLHelper concurrently.
+	MeasureURLHelpers []MeasureURLHelper
+
 	// QUICHandshakeTimeout is the OPTIONAL timeout for performing
 	// a QUIC handshake. If not set, we use a default value.
 	//
@@ -100,11 +127,16 @@ func NewMeasurerWithDefaultSettings() *Measurer {
 	return &Measurer{
 		Begin:                   time.Now(),
 		DNSLookupTimeout:        0,
+		DNSLateResponsesWindow:  0,
+		ECHHandshaker:           nil,
+		EventsDB:                nil,
 		HTTPClient:              &http.Client{},
 		HTTPMaxBodySnapshotSize: 0,
 		HTTPRoundTripTimeout:    0,
 		Logger:                  log.Log,
+		MeasureALPNSeparately:   false,
 		MeasureURLHelper:        nil,
+		MeasureURLHelpers:       nil,
 		QUICHandshakeTimeout:    0,
 		Resolvers: []*ResolverInfo{{
 			Network: "system",
@@ -119,6 +151,11 @@ func NewMeasurerWithDefaultSettings() *Measurer {
 	}
 }
 
+// newDB creates a new MeasurementDB mirroring events into mx.EventsDB.
+func (mx *Measurer) newDB() *MeasurementDB {
+	return &MeasurementDB{Mirror: mx.EventsDB}
+}
+
 // DefaultDNSLookupTimeout is the default DNS lookup timeout.
 const DefaultDNSLookupTimeout = 4 * time.Second
 
@@ -136,7 +173,7 @@ func (mx *Measurer) LookupHostSystem(ctx context.Context, domain string) *DNSMea
 	ol := NewOperationLogger(mx.Logger, "LookupHost %s with getaddrinfo", domain)
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	db := &MeasurementDB{}
+	db := mx.newDB()
 	r := mx.NewResolverSystem(db, mx.Logger)
 	defer r.CloseIdleConnections()
 	_, err := r.LookupHost(ctx, domain)
@@ -154,7 +191,7 @@ func (mx *Measurer) lookupHostForeign(
 	ol := NewOperationLogger(mx.Logger, "LookupHost %s with %s", domain, r.Network())
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	db := &MeasurementDB{}
+	db := mx.newDB()
 	_, err := mx.WrapResolver(db, r).LookupHost(ctx, domain)
 	ol.Stop(err)
 	return &DNSMeasurement{
@@ -180,7 +217,7 @@ func (mx *Measurer) LookupHostUDP(
 	ol := NewOperationLogger(mx.Logger, "LookupHost %s with %s/udp", domain, address)
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	db := &MeasurementDB{}
+	db := mx.newDB()
 	r := mx.NewResolverUDP(db, mx.Logger, address)
 	defer r.CloseIdleConnections()
 	_, err := r.LookupHost(ctx, domain)
@@ -208,7 +245,7 @@ func (mx *Measurer) LookupHTTPSSvcUDP(
 	ol := NewOperationLogger(mx.Logger, "LookupHTTPSvc %s with %s/udp", domain, address)
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	db := &MeasurementDB{}
+	db := mx.newDB()
 	r := mx.NewResolverUDP(db, mx.Logger, address)
 	defer r.CloseIdleConnections()
 	_, err := r.LookupHTTPS(ctx, domain)
@@ -227,7 +264,7 @@ func (mx *Measurer) lookupHTTPSSvcUDPForeign(
 	ol := NewOperationLogger(mx.Logger, "LookupHTTPSvc %s with %s", domain, r.Address())
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	db := &MeasurementDB{}
+	db := mx.newDB()
 	_, err := mx.WrapResolver(db, r).LookupHTTPS(ctx, domain)
 	ol.Stop(err)
 	return &DNSMeasurement{
@@ -246,7 +283,7 @@ func (mx *Measurer) lookupHTTPSSvcUDPForeign(
 //
 // Returns an EndpointMeasurement.
 func (mx *Measurer) TCPConnect(ctx context.Context, address string) *EndpointMeasurement {
-	db := &MeasurementDB{}
+	db := mx.newDB()
 	conn, _ := mx.TCPConnectWithDB(ctx, db, address)
 	measurement := db.AsMeasurement()
 	if conn != nil {
@@ -316,7 +353,7 @@ func (mx *Measurer) TCPConnectWithDB(ctx context.Context, db WritableDB, address
 // Returns an EndpointMeasurement.
 func (mx *Measurer) TLSConnectAndHandshake(ctx context.Context,
 	address string, config *tls.Config) *EndpointMeasurement {
-	db := &MeasurementDB{}
+	db := mx.newDB()
 	conn, _ := mx.TLSConnectAndHandshakeWithDB(ctx, db, address, config)
 	measurement := db.AsMeasurement()
 	if conn != nil {
@@ -386,7 +423,7 @@ func (mx *Measurer) TLSConnectAndHandshakeWithDB(ctx context.Context,
 // Returns an EndpointMeasurement.
 func (mx *Measurer) QUICHandshake(ctx context.Context, address string,
 	config *tls.Config) *EndpointMeasurement {
-	db := &MeasurementDB{}
+	db := mx.newDB()
 	sess, _ := mx.QUICHandshakeWithDB(ctx, db, address, config)
 	measurement := db.AsMeasurement()
 	if sess != nil {
@@ -472,10 +509,12 @@ func (mx *Measurer) httpEndpointGet(ctx context.Context, epnt *HTTPEndpoint,
 	jar http.CookieJar) (*http.Response, *HTTPEndpointMeasurement, error) {
 	resp, m, err := mx.httpEndpointGetMeasurement(ctx, epnt, jar)
 	out := &HTTPEndpointMeasurement{
-		URL:         epnt.URL.String(),
-		Network:     epnt.Network,
-		Address:     epnt.Address,
-		Measurement: m,
+		URL:                epnt.URL.String(),
+		Network:            epnt.Network,
+		Address:            epnt.Address,
+		ALPN:               epnt.ALPN,
+		NegotiatedProtocol: negotiatedProtocol(m),
+		Measurement:        m,
 	}
 	return resp, out, err
 }
@@ -491,7 +530,7 @@ func (mx *Measurer) httpEndpointGet(ctx context.Context, epnt *HTTPEndpoint,
 // - the third element is a nil error on success and an error on failure
 func (mx *Measurer) httpEndpointGetMeasurement(ctx context.Context, epnt *HTTPEndpoint,
 	jar http.CookieJar) (resp *http.Response, m *Measurement, err error) {
-	db := &MeasurementDB{}
+	db := mx.newDB()
 	resp, err = mx.httpEndpointGetWithDB(ctx, epnt, db, jar)
 	m = db.AsMeasurement()
 	return
@@ -893,17 +932,24 @@ func (mx *Measurer) MeasureURL(
 	if err != nil {
 		return nil, err
 	}
-	if mx.MeasureURLHelper != nil {
+	if helpers := mx.measureURLHelpers(); len(helpers) > 0 {
 		thBegin := time.Now()
-		extraEpnts, thMeasurement, _ := mx.MeasureURLHelper.LookupExtraHTTPEndpoints(
-			ctx, parsed, headers, epnts...)
+		extraEpnts, ths := lookupExtraHTTPEndpointsParallel(
+			ctx, parsed, headers, helpers, epnts...)
 		m.THRuntime = time.Since(thBegin)
 		epnts = removeDuplicateHTTPEndpoints(append(epnts, extraEpnts...)...)
-		m.TH = thMeasurement
+		if len(ths) > 0 {
+			m.TH, m.ExtraTHs = ths[0], ths[1:]
+		}
+		m.THConsensus = NewTHConsensus(parsed.Hostname(), ths...)
 		mx.enforceAllowedHeadersOnly(epnts)
 	}
 	epntRuntime := time.Now()
-	for epnt := range mx.HTTPEndpointGetParallel(ctx, parallelism, cookies, epnts...) {
+	measured := epnts
+	if mx.MeasureALPNSeparately {
+		measured = splitALPN(epnts...)
+	}
+	for epnt := range mx.HTTPEndpointGetParallel(ctx, parallelism, cookies, measured...) {
 		m.Endpoints = append(m.Endpoints, epnt)
 	}
 	switch parsed.Scheme {
@@ -914,6 +960,8 @@ func (mx *Measurer) MeasureURL(
 	}
 	m.EpntsRuntime = time.Since(epntRuntime)
 	m.fillRedirects()
+	m.H2FailingEndpoints = FindH2FailingEndpoints(m.Endpoints...)
+	m.AdvertisesECH = ECHConfigListForDomain(parsed.Hostname(), m.DNS...) != nil
 	return m, nil
 }
 
@@ -9,7 +9,8 @@ package measurex
 // Oddity is an unexpected result on the probe or
 // or test helper side during a measurement. We will
 // promote the oddity to anomaly if the probe and
-// the test helper see different results.
+// the test helper see different results (see the
+// measurex/analysis package).
 type Oddity string
 
 // This enumeration lists all known oddities.
@@ -0,0 +1,210 @@
+package measurex
+
+//
+// Repeat
+//
+// Ping-like repeated probing of an endpoint. Some censors block
+// probabilistically or only after N connections, so a single
+// measurement is not enough to detect them.
+//
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// RepeatedEndpoint is an endpoint we want to measure repeatedly.
+type RepeatedEndpoint struct {
+	// Network is the MANDATORY endpoint network (NetworkTCP
+	// or NetworkQUIC).
+	Network EndpointNetwork
+
+	// Address is the MANDATORY endpoint address (e.g., "8.8.8.8:443").
+	Address string
+
+	// TLSConfig is the OPTIONAL TLS config. When it is nil, we
+	// only perform TCP connects with a NetworkTCP endpoint. This
+	// field is MANDATORY with a NetworkQUIC endpoint.
+	TLSConfig *tls.Config
+}
+
+// RepeatedEndpointMeasurement is the result of RepeatEndpoint.
+type RepeatedEndpointMeasurement struct {
+	// Network is the network of this endpoint.
+	Network EndpointNetwork
+
+	// Address is the address of this endpoint.
+	Address string
+
+	// Attempts contains the measurement of each attempt.
+	Attempts []*EndpointMeasurement
+
+	// Stats contains the aggregated stats.
+	Stats *RepeatStats
+}
+
+// RepeatStats contains aggregated stats for a RepeatedEndpointMeasurement.
+type RepeatStats struct {
+	// Attempts is the number of attempts we performed.
+	Attempts int64 `json:"attempts"`
+
+	// Successes is the number of successful attempts.
+	Successes int64 `json:"successes"`
+
+	// SuccessRate is Successes divided by Attempts.
+	SuccessRate float64 `json:"success_rate"`
+
+	// RTTMin is the minimum RTT in seconds. We define the RTT as the time
+	// to TCP connect or to complete the QUIC handshake. We only consider
+	// successful attempts when computing the RTT stats.
+	RTTMin float64 `json:"rtt_min"`
+
+	// RTTP50 is the median RTT in seconds.
+	RTTP50 float64 `json:"rtt_p50"`
+
+	// RTTP90 is the 90th percentile of the RTT in seconds.
+	RTTP90 float64 `json:"rtt_p90"`
+
+	// RTTMax is the maximum RTT in seconds.
+	RTTMax float64 `json:"rtt_max"`
+
+	// Failures maps each Oddity to the number of attempts failing
+	// with such an Oddity. When a failed attempt has no Oddity we
+	// use its failure string as the key.
+	Failures map[string]int64 `json:"failures"`
+}
+
+// ErrRepeatInvalidEndpoint indicates that the RepeatedEndpoint
+// passed to RepeatEndpoint is not valid.
+var ErrRepeatInvalidEndpoint = errors.New("measurex: invalid RepeatedEndpoint")
+
+// RepeatEndpoint measures the given endpoint count times waiting for
+// interval between the beginning of each attempt. We stop early if the
+// context is done. For each attempt, we TCP connect (and optionally
+// TLS handshake) or QUIC handshake depending on the endpoint.
+func (mx *Measurer) RepeatEndpoint(ctx context.Context, epnt *RepeatedEndpoint,
+	count int, interval time.Duration) (*RepeatedEndpointMeasurement, error) {
+	if epnt.Network != NetworkTCP && epnt.Network != NetworkQUIC {
+		return nil, ErrRepeatInvalidEndpoint
+	}
+	if epnt.Network == NetworkQUIC && epnt.TLSConfig == nil {
+		return nil, ErrRepeatInvalidEndpoint
+	}
+	out := &RepeatedEndpointMeasurement{
+		Network: epnt.Network,
+		Address: epnt.Address,
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for idx := 0; idx < count; idx++ {
+		if idx > 0 {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		out.Attempts = append(out.Attempts, mx.repeatEndpointOnce(ctx, epnt))
+	}
+	out.Stats = NewRepeatStats(out.Attempts)
+	return out, nil
+}
+
+// repeatEndpointOnce performs a single RepeatEndpoint attempt.
+func (mx *Measurer) repeatEndpointOnce(
+	ctx context.Context, epnt *RepeatedEndpoint) *EndpointMeasurement {
+	switch {
+	case epnt.Network == NetworkQUIC:
+		// Note: we need to clone the config because quic-go
+		// may modify it during the handshake.
+		return mx.QUICHandshake(ctx, epnt.Address, epnt.TLSConfig.Clone())
+	case epnt.TLSConfig != nil:
+		return mx.TLSConnectAndHandshake(ctx, epnt.Address, epnt.TLSConfig.Clone())
+	default:
+		return mx.TCPConnect(ctx, epnt.Address)
+	}
+}
+
+// NewRepeatStats computes the RepeatStats of the given attempts.
+func NewRepeatStats(attempts []*EndpointMeasurement) *RepeatStats {
+	stats := &RepeatStats{Failures: map[string]int64{}}
+	var rtts []float64
+	for _, m := range attempts {
+		stats.Attempts++
+		failure, oddity := repeatAttemptOutcome(m.Measurement)
+		if failure != nil {
+			key := string(oddity)
+			if key == "" {
+				key = *failure
+			}
+			stats.Failures[key]++
+			continue
+		}
+		stats.Successes++
+		if rtt, found := repeatAttemptRTT(m); found {
+			rtts = append(rtts, rtt)
+		}
+	}
+	if stats.Attempts > 0 {
+		stats.SuccessRate = float64(stats.Successes) / float64(stats.Attempts)
+	}
+	if len(rtts) > 0 {
+		sort.Float64s(rtts)
+		stats.RTTMin = rtts[0]
+		stats.RTTP50 = repeatPercentile(rtts, 50)
+		stats.RTTP90 = repeatPercentile(rtts, 90)
+		stats.RTTMax = rtts[len(rtts)-1]
+	}
+	return stats
+}
+
+// repeatAttemptOutcome returns the failure and oddity of the first
+// failed step of an attempt or nil if the attempt succeeded.
+func repeatAttemptOutcome(m *Measurement) (*string, Oddity) {
+	for _, ev := range m.Connect {
+		if ev.Failure != nil {
+			return ev.Failure, ev.Oddity
+		}
+	}
+	for _, ev := range m.TLSHandshake {
+		if ev.Failure != nil {
+			return ev.Failure, ev.Oddity
+		}
+	}
+	for _, ev := range m.QUICHandshake {
+		if ev.Failure != nil {
+			return ev.Failure, ev.Oddity
+		}
+	}
+	return nil, ""
+}
+
+// repeatAttemptRTT returns the RTT of a successful attempt.
+func repeatAttemptRTT(m *EndpointMeasurement) (float64, bool) {
+	if m.Network == NetworkQUIC {
+		for _, ev := range m.QUICHandshake {
+			return ev.Finished - ev.Started, true
+		}
+		return 0, false
+	}
+	for _, ev := range m.Connect {
+		return ev.Finished - ev.Started, true
+	}
+	return 0, false
+}
+
+// repeatPercentile returns the p-th percentile of the given
+// sorted values using the nearest-rank method.
+func repeatPercentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
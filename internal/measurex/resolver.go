@@ -44,13 +44,83 @@ func (mx *Measurer) NewResolverSystem(db WritableDB, logger model.Logger) model.
 func (mx *Measurer) NewResolverUDP(db WritableDB, logger model.Logger, address string) model.Resolver {
 	return mx.WrapResolver(db, netxlite.WrapResolver(
 		logger, netxlite.NewSerialResolver(
-			mx.WrapDNSXRoundTripper(db, netxlite.NewDNSOverUDP(
-				mx.NewDialerWithSystemResolver(db, logger),
-				address,
-			)))),
+			mx.WrapDNSXRoundTripper(db, mx.NewDNSOverUDP(db, logger, address)))),
 	)
 }
 
+// NewDNSOverUDP creates a DNS-over-UDP transport that saves
+// into the DB the late replies we receive during the
+// DNSLateResponsesWindow configured in the Measurer.
+//
+// Arguments:
+//
+// - db is where to save events;
+//
+// - logger is the logger;
+//
+// - address is the resolver address (e.g., "1.1.1.1:53").
+func (mx *Measurer) NewDNSOverUDP(
+	db WritableDB, logger model.Logger, address string) *netxlite.DNSOverUDP {
+	txp := netxlite.NewDNSOverUDP(mx.NewDialerWithSystemResolver(db, logger), address)
+	txp.LateResponsesWindow = mx.DNSLateResponsesWindow
+	txp.OnLateResponse = func(resp *netxlite.DNSOverUDPLateResponse) {
+		db.InsertIntoDNSLateResponse(&DNSLateResponseEvent{
+			Network:  txp.Network(),
+			Address:  resp.Address,
+			Query:    resp.Query,
+			Finished: resp.Received.Sub(mx.Begin).Seconds(),
+			Reply:    resp.Reply,
+		})
+	}
+	return txp
+}
+
+// NewResolverParallel is a convenience factory for creating a Resolver
+// that races the given transports using netxlite.ParallelResolver.
+//
+// Arguments:
+//
+// - db is where to save events;
+//
+// - logger is the logger;
+//
+// - txps contains the transports to use (e.g., UDP, DoT, DoH).
+//
+// We save a DNSLookupEvent for each transport, including the ones
+// that lost the race, so we can see disagreements between them. To
+// this end, lookups return only after all the transports are done, so
+// the losers are not canceled by the caller and all the events are
+// inside the DB by the time a lookup returns.
+func (mx *Measurer) NewResolverParallel(db WritableDB,
+	logger model.Logger, txps ...model.DNSTransport) model.Resolver {
+	var wrapped []model.DNSTransport
+	for _, txp := range txps {
+		wrapped = append(wrapped, mx.WrapDNSXRoundTripper(db, txp))
+	}
+	reso := netxlite.NewParallelResolver(wrapped...)
+	reso.WaitAll = true
+	rdb := &resolverDB{Resolver: reso, db: db, begin: mx.Begin}
+	reso.OnAnswer = rdb.saveParallelAnswer
+	return netxlite.WrapResolver(logger, reso)
+}
+
+// saveParallelAnswer saves the answer of a single transport
+// used by a netxlite.ParallelResolver.
+func (r *resolverDB) saveParallelAnswer(ans *netxlite.ParallelResolverAnswer) {
+	started := ans.Started.Sub(r.begin).Seconds()
+	finished := ans.Finished.Sub(r.begin).Seconds()
+	switch ans.Operation {
+	case "LookupHTTPS":
+		r.saveHTTPSSvcResults(ans.Network, ans.Address, ans.Domain,
+			started, finished, ans.Err, ans.HTTPS)
+	default:
+		r.saveLookupResultsWithInfo(ans.Network, ans.Address, ans.Domain,
+			started, finished, ans.Err, ans.Addrs, "A")
+		r.saveLookupResultsWithInfo(ans.Network, ans.Address, ans.Domain,
+			started, finished, ans.Err, ans.Addrs, "AAAA")
+	}
+}
+
 type resolverDB struct {
 	model.Resolver
 	begin time.Time
@@ -70,6 +140,7 @@ type DNSLookupEvent struct {
 	A         []string
 	AAAA      []string
 	ALPN      []string
+	ECH       []byte
 }
 
 // SupportsHTTP3 returns true if this query is for HTTPS and
@@ -86,6 +157,12 @@ func (ev *DNSLookupEvent) SupportsHTTP3() bool {
 	return false
 }
 
+// SupportsECH returns true if this query is for HTTPS and
+// the answer contains an ECHConfigList.
+func (ev *DNSLookupEvent) SupportsECH() bool {
+	return ev.QueryType == "HTTPS" && len(ev.ECH) > 0
+}
+
 // Addrs returns all the IPv4/IPv6 addresses
 func (ev *DNSLookupEvent) Addrs() (out []string) {
 	out = append(out, ev.A...)
@@ -104,9 +181,15 @@ func (r *resolverDB) LookupHost(ctx context.Context, domain string) ([]string, e
 
 func (r *resolverDB) saveLookupResults(domain string, started, finished float64,
 	err error, addrs []string, qtype string) {
+	r.saveLookupResultsWithInfo(r.Resolver.Network(), r.Resolver.Address(),
+		domain, started, finished, err, addrs, qtype)
+}
+
+func (r *resolverDB) saveLookupResultsWithInfo(network, address, domain string,
+	started, finished float64, err error, addrs []string, qtype string) {
 	ev := &DNSLookupEvent{
-		Network:   r.Resolver.Network(),
-		Address:   r.Resolver.Address(),
+		Network:   network,
+		Address:   address,
 		Failure:   NewFailure(err),
 		Domain:    domain,
 		QueryType: qtype,
@@ -157,9 +240,16 @@ func (r *resolverDB) LookupHTTPS(ctx context.Context, domain string) (*model.HTT
 	started := time.Since(r.begin).Seconds()
 	https, err := r.Resolver.LookupHTTPS(ctx, domain)
 	finished := time.Since(r.begin).Seconds()
+	r.saveHTTPSSvcResults(r.Resolver.Network(), r.Resolver.Address(),
+		domain, started, finished, err, https)
+	return https, err
+}
+
+func (r *resolverDB) saveHTTPSSvcResults(network, address, domain string,
+	started, finished float64, err error, https *model.HTTPSSvc) {
 	ev := &DNSLookupEvent{
-		Network:   r.Resolver.Network(),
-		Address:   r.Resolver.Address(),
+		Network:   network,
+		Address:   address,
 		Domain:    domain,
 		QueryType: "HTTPS",
 		Started:   started,
@@ -171,9 +261,9 @@ func (r *resolverDB) LookupHTTPS(ctx context.Context, domain string) (*model.HTT
 		ev.A = append(ev.A, https.IPv4...)
 		ev.AAAA = append(ev.AAAA, https.IPv6...)
 		ev.ALPN = append(ev.ALPN, https.ALPN...)
+		ev.ECH = https.ECH
 	}
 	r.db.InsertIntoLookupHTTPSSvc(ev)
-	return https, err
 }
 
 func (r *resolverDB) computeOddityHTTPSSvc(https *model.HTTPSSvc, err error) Oddity {
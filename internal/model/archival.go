@@ -111,8 +111,13 @@ func (hb *ArchivalMaybeBinaryData) UnmarshalJSON(d []byte) error {
 // ArchivalDNSLookupResult is the result of a DNS lookup.
 //
 // See https://github.com/ooni/spec/blob/master/data-formats/df-002-dnst.md.
+//
+// The Additional and Authority fields are not part of the spec and are
+// only filled when we have access to the raw DNS reply.
 type ArchivalDNSLookupResult struct {
+	Additional       []ArchivalDNSAnswer `json:"x_additional,omitempty"`
 	Answers          []ArchivalDNSAnswer `json:"answers"`
+	Authority        []ArchivalDNSAnswer `json:"x_authority,omitempty"`
 	Engine           string              `json:"engine"`
 	Failure          *string             `json:"failure"`
 	Hostname         string              `json:"hostname"`
@@ -124,10 +129,15 @@ type ArchivalDNSLookupResult struct {
 }
 
 // ArchivalDNSAnswer is a DNS answer.
+//
+// For CNAME, NS, and PTR answers, Hostname contains the target
+// name. For answer types not covered by the spec (e.g., MX, TXT,
+// SOA), Data contains the RR data in presentation format.
 type ArchivalDNSAnswer struct {
 	ASN        int64   `json:"asn,omitempty"`
 	ASOrgName  string  `json:"as_org_name,omitempty"`
 	AnswerType string  `json:"answer_type"`
+	Data       string  `json:"x_data,omitempty"`
 	Hostname   string  `json:"hostname,omitempty"`
 	IPv4       string  `json:"ipv4,omitempty"`
 	IPv6       string  `json:"ipv6,omitempty"`
@@ -17,6 +17,7 @@ type ExperimentSession interface {
 	FetchPsiphonConfig(ctx context.Context) ([]byte, error)
 	FetchTorTargets(ctx context.Context, cc string) (map[string]OOAPITorTarget, error)
 	FetchURLList(ctx context.Context, config OOAPIURLListConfig) ([]OOAPIURLInfo, error)
+	KeyValueStore() KeyValueStore
 	Logger() Logger
 	ProbeCC() string
 	ResolverIP() string
@@ -7,6 +7,8 @@ type DNSDecoder struct {
 	MockDecodeLookupHost func(qtype uint16, reply []byte) ([]string, error)
 
 	MockDecodeHTTPS func(reply []byte) (*model.HTTPSSvc, error)
+
+	MockDecodeReply func(reply []byte) (*model.DNSReply, error)
 }
 
 // DecodeLookupHost calls MockDecodeLookupHost.
@@ -18,3 +20,8 @@ func (e *DNSDecoder) DecodeLookupHost(qtype uint16, reply []byte) ([]string, err
 func (e *DNSDecoder) DecodeHTTPS(reply []byte) (*model.HTTPSSvc, error) {
 	return e.MockDecodeHTTPS(reply)
 }
+
+// DecodeReply calls MockDecodeReply.
+func (e *DNSDecoder) DecodeReply(reply []byte) (*model.DNSReply, error) {
+	return e.MockDecodeReply(reply)
+}
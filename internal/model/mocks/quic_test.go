@@ -289,6 +289,142 @@ func TestQUICEarlySession(t *testing.T) {
 	})
 }
 
+func TestQUICStream(t *testing.T) {
+	t.Run("StreamID", func(t *testing.T) {
+		stream := &QUICStream{
+			MockStreamID: func() quic.StreamID {
+				return 4
+			},
+		}
+		if stream.StreamID() != 4 {
+			t.Fatal("unexpected stream ID")
+		}
+	})
+
+	t.Run("Read", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		stream := &QUICStream{
+			MockRead: func(b []byte) (int, error) {
+				return 0, expected
+			},
+		}
+		count, err := stream.Read(make([]byte, 128))
+		if !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+		if count != 0 {
+			t.Fatal("expected zero bytes here")
+		}
+	})
+
+	t.Run("CancelRead", func(t *testing.T) {
+		var called bool
+		stream := &QUICStream{
+			MockCancelRead: func(code quic.StreamErrorCode) {
+				called = true
+			},
+		}
+		stream.CancelRead(0)
+		if !called {
+			t.Fatal("not called")
+		}
+	})
+
+	t.Run("SetReadDeadline", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		stream := &QUICStream{
+			MockSetReadDeadline: func(t time.Time) error {
+				return expected
+			},
+		}
+		err := stream.SetReadDeadline(time.Now())
+		if !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+
+	t.Run("Write", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		stream := &QUICStream{
+			MockWrite: func(b []byte) (int, error) {
+				return 0, expected
+			},
+		}
+		count, err := stream.Write(make([]byte, 128))
+		if !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+		if count != 0 {
+			t.Fatal("expected zero bytes here")
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		stream := &QUICStream{
+			MockClose: func() error {
+				return expected
+			},
+		}
+		err := stream.Close()
+		if !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+
+	t.Run("CancelWrite", func(t *testing.T) {
+		var called bool
+		stream := &QUICStream{
+			MockCancelWrite: func(code quic.StreamErrorCode) {
+				called = true
+			},
+		}
+		stream.CancelWrite(0)
+		if !called {
+			t.Fatal("not called")
+		}
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		ctx := context.Background()
+		stream := &QUICStream{
+			MockContext: func() context.Context {
+				return ctx
+			},
+		}
+		out := stream.Context()
+		if !reflect.DeepEqual(ctx, out) {
+			t.Fatal("not the context we expected")
+		}
+	})
+
+	t.Run("SetWriteDeadline", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		stream := &QUICStream{
+			MockSetWriteDeadline: func(t time.Time) error {
+				return expected
+			},
+		}
+		err := stream.SetWriteDeadline(time.Now())
+		if !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+
+	t.Run("SetDeadline", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		stream := &QUICStream{
+			MockSetDeadline: func(t time.Time) error {
+				return expected
+			},
+		}
+		err := stream.SetDeadline(time.Now())
+		if !errors.Is(err, expected) {
+			t.Fatal("not the error we expected", err)
+		}
+	})
+}
+
 func TestQUICUDPLikeConn(t *testing.T) {
 	t.Run("WriteTo", func(t *testing.T) {
 		expected := errors.New("mocked error")
@@ -13,6 +13,7 @@ type Resolver struct {
 	MockAddress              func() string
 	MockCloseIdleConnections func()
 	MockLookupHTTPS          func(ctx context.Context, domain string) (*model.HTTPSSvc, error)
+	MockLookupRaw            func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error)
 }
 
 // LookupHost calls MockLookupHost.
@@ -39,3 +40,8 @@ func (r *Resolver) CloseIdleConnections() {
 func (r *Resolver) LookupHTTPS(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
 	return r.MockLookupHTTPS(ctx, domain)
 }
+
+// LookupRaw calls MockLookupRaw.
+func (r *Resolver) LookupRaw(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+	return r.MockLookupRaw(ctx, domain, qtype)
+}
@@ -77,4 +77,21 @@ func TestResolver(t *testing.T) {
 			t.Fatal("expected nil addr")
 		}
 	})
+
+	t.Run("LookupRaw", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		r := &Resolver{
+			MockLookupRaw: func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+				return nil, expected
+			},
+		}
+		ctx := context.Background()
+		reply, err := r.LookupRaw(ctx, "dns.google", 5)
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if reply != nil {
+			t.Fatal("expected nil reply")
+		}
+	})
 }
@@ -47,6 +47,22 @@ type DNSDecoder interface {
 	// contain at least a valid ALPN entry. It will not return
 	// an error, though, when there are no IPv4/IPv6 hints in the reply.
 	DecodeHTTPS(data []byte) (*HTTPSSvc, error)
+
+	// DecodeReply decodes any reply.
+	//
+	// The argument is the reply as read by the DNSTransport.
+	//
+	// On success, this function returns a DNSReply structure containing
+	// all the answer, authority, and additional RRs and a nil error. If
+	// the reply's RCODE indicates failure (e.g., NXDOMAIN), this function
+	// returns both the decoded DNSReply, so that the caller can inspect
+	// the authority section, and the error corresponding to the RCODE.
+	// If we cannot parse the reply, the DNSReply pointer is nil and the
+	// error points to the error that occurred.
+	//
+	// Unlike DecodeLookupHost and DecodeHTTPS, this function does not
+	// return an error when the reply does not contain any answer.
+	DecodeReply(data []byte) (*DNSReply, error)
 }
 
 // The DNSEncoder encodes DNS queries to bytes
@@ -128,6 +144,39 @@ type HTTPSSvc struct {
 
 	// IPv6 contains the IPv6 hints (which may be empty).
 	IPv6 []string
+
+	// ECH contains the raw ECHConfigList (which may be empty). Use
+	// netxlite.ParseECHConfigList to parse it.
+	ECH []byte
+}
+
+// DNSReply contains all the RRs inside a DNS reply.
+type DNSReply struct {
+	// Answer contains the RRs in the answer section.
+	Answer []*DNSRecord
+
+	// Authority contains the RRs in the authority section.
+	Authority []*DNSRecord
+
+	// Additional contains the RRs in the additional section. We
+	// do not include the OPT pseudo-RR used by EDNS(0).
+	Additional []*DNSRecord
+}
+
+// DNSRecord is a generic resource record.
+type DNSRecord struct {
+	// Name is the owner name (e.g., "www.example.com.").
+	Name string
+
+	// Type is the RR type (e.g., "CNAME").
+	Type string
+
+	// TTL is the RR TTL.
+	TTL uint32
+
+	// Data contains the RR data in presentation format (e.g.,
+	// "example.com." for a CNAME or "10 mx.example.com." for a MX).
+	Data string
 }
 
 // QUICListener listens for QUIC connections.
@@ -177,6 +226,17 @@ type Resolver interface {
 		ctx context.Context, domain string) (*HTTPSSvc, error)
 }
 
+// RawResolver is a Resolver that can also send queries of any type.
+type RawResolver interface {
+	Resolver
+
+	// LookupRaw sends a query for the given qtype (e.g., dns.TypeCNAME)
+	// and returns all the RRs inside the reply. Like DNSDecoder.DecodeReply,
+	// this function returns both the reply and an error when the reply's
+	// RCODE indicates failure (e.g., NXDOMAIN).
+	LookupRaw(ctx context.Context, hostname string, qtype uint16) (*DNSReply, error)
+}
+
 // TLSDialer is a Dialer dialing TLS connections.
 type TLSDialer interface {
 	// CloseIdleConnections closes idle connections, if any.
@@ -251,3 +311,28 @@ type UnderlyingNetworkLibrary interface {
 	// NewSimpleDialer returns a new SimpleDialer.
 	NewSimpleDialer(timeout time.Duration) SimpleDialer
 }
+
+// UnderlyingTTLNetworkLibrary is an UnderlyingNetworkLibrary that also
+// allows us to choose the IP TTL (or the IPv6 hop limit) of the packets
+// we send, which is what we need to send TTL-limited probes. In all the
+// methods, a zero TTL means using the system's default.
+type UnderlyingTTLNetworkLibrary interface {
+	UnderlyingNetworkLibrary
+
+	// ListenUDPWithTTL is like ListenUDP but the datagrams we
+	// send using the returned conn have the given TTL.
+	ListenUDPWithTTL(network string, laddr *net.UDPAddr, ttl int) (UDPLikeConn, error)
+
+	// NewSimpleDialerWithTTL is like NewSimpleDialer but the conns
+	// we create send packets with the given TTL (including the TCP SYN)
+	// and implement TTLConn, so we can later change their TTL.
+	NewSimpleDialerWithTTL(timeout time.Duration, ttl int) SimpleDialer
+}
+
+// TTLConn is a net.Conn whose TTL we can change.
+type TTLConn interface {
+	net.Conn
+
+	// SetTTL sets the TTL of the packets we'll send from now on.
+	SetTTL(ttl int) error
+}
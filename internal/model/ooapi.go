@@ -74,6 +74,10 @@ type OOAPIURLInfo struct {
 	CategoryCode string `json:"category_code"`
 	CountryCode  string `json:"country_code"`
 	URL          string `json:"url"`
+
+	// Options contains optional experiment options for this URL. The
+	// OONI API does not return them: we only read them from input files.
+	Options map[string]string `json:"options,omitempty"`
 }
 
 // OOAPIURLListConfig contains configuration for fetching the URL list.
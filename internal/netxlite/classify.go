@@ -235,6 +235,10 @@ func quicIsCertificateError(alert uint8) bool {
 // filters for DNS bogons MUST use this error.
 var ErrDNSBogon = errors.New("dns: detected bogon address")
 
+// ErrDNSSECBogus indicates that DNSSEC validation failed. Code that
+// validates DNSSEC signatures MUST wrap this error.
+var ErrDNSSECBogus = errors.New("dns: dnssec validation failed")
+
 // We use these strings to string-match errors in the standard library
 // and map such errors to OONI failures.
 const (
@@ -273,6 +277,9 @@ func classifyResolverError(err error) string {
 	if errors.Is(err, ErrDNSBogon) {
 		return FailureDNSBogonError // not in MK
 	}
+	if errors.Is(err, ErrDNSSECBogus) {
+		return FailureDNSDNSSECBogus // not in MK
+	}
 	// Implementation note: we match errors that share the same
 	// string of the stdlib in the generic classifier.
 	if errors.Is(err, ErrOODNSRefused) {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"io"
 	"testing"
 
@@ -263,6 +264,13 @@ func TestClassifyResolverError(t *testing.T) {
 		}
 	})
 
+	t.Run("for ErrDNSSECBogus", func(t *testing.T) {
+		err := fmt.Errorf("%w: antani", ErrDNSSECBogus)
+		if classifyResolverError(err) != FailureDNSDNSSECBogus {
+			t.Fatal("unexpected result")
+		}
+	})
+
 	t.Run("for refused", func(t *testing.T) {
 		if classifyResolverError(ErrOODNSRefused) != FailureDNSRefusedError {
 			t.Fatal("unexpected result")
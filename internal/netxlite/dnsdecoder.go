@@ -1,6 +1,8 @@
 package netxlite
 
 import (
+	"strings"
+
 	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/model"
 )
@@ -13,17 +15,25 @@ func (d *DNSDecoderMiekg) parseReply(data []byte) (*dns.Msg, error) {
 	if err := reply.Unpack(data); err != nil {
 		return nil, err
 	}
+	if err := d.rcodeToError(reply.Rcode); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// rcodeToError maps the RCODE of a reply to an error.
+func (d *DNSDecoderMiekg) rcodeToError(rcode int) error {
 	// TODO(bassosimone): map more errors to net.DNSError names
 	// TODO(bassosimone): add support for lame referral.
-	switch reply.Rcode {
+	switch rcode {
 	case dns.RcodeSuccess:
-		return reply, nil
+		return nil
 	case dns.RcodeNameError:
-		return nil, ErrOODNSNoSuchHost
+		return ErrOODNSNoSuchHost
 	case dns.RcodeRefused:
-		return nil, ErrOODNSRefused
+		return ErrOODNSRefused
 	default:
-		return nil, ErrOODNSMisbehaving
+		return ErrOODNSMisbehaving
 	}
 }
 
@@ -48,6 +58,8 @@ func (d *DNSDecoderMiekg) DecodeHTTPS(data []byte) (*model.HTTPSSvc, error) {
 					for _, ip := range extv.Hint {
 						out.IPv6 = append(out.IPv6, ip.String())
 					}
+				case *dns.SVCBECHConfig:
+					out.ECH = extv.ECH
 				}
 			}
 		}
@@ -84,4 +96,41 @@ func (d *DNSDecoderMiekg) DecodeLookupHost(qtype uint16, data []byte) ([]string,
 	return addrs, nil
 }
 
+// DecodeReply decodes all the RRs inside the reply. We do not return an
+// error when there are no answers, since (e.g., for NS queries) the
+// interesting RRs may be inside the authority section. For the same
+// reason, we decode all the sections regardless of the RCODE, and we
+// return the error corresponding to the RCODE alongside the reply.
+func (d *DNSDecoderMiekg) DecodeReply(data []byte) (*model.DNSReply, error) {
+	reply := new(dns.Msg)
+	if err := reply.Unpack(data); err != nil {
+		return nil, err
+	}
+	out := &model.DNSReply{
+		Answer:     d.convertRecords(reply.Answer),
+		Authority:  d.convertRecords(reply.Ns),
+		Additional: d.convertRecords(reply.Extra),
+	}
+	return out, d.rcodeToError(reply.Rcode)
+}
+
+// convertRecords converts a list of miekg/dns RRs to model.DNSRecord.
+func (d *DNSDecoderMiekg) convertRecords(rrs []dns.RR) (out []*model.DNSRecord) {
+	for _, rr := range rrs {
+		if _, isOPT := rr.(*dns.OPT); isOPT {
+			continue // we don't want to include EDNS(0) pseudo-RRs
+		}
+		hdr := rr.Header()
+		out = append(out, &model.DNSRecord{
+			Name: hdr.Name,
+			Type: dns.TypeToString[hdr.Rrtype],
+			TTL:  hdr.Ttl,
+			// The presentation format is the header followed by the
+			// data, so we remove the header to just keep the data.
+			Data: strings.TrimPrefix(rr.String(), hdr.String()),
+		})
+	}
+	return
+}
+
 var _ model.DNSDecoder = &DNSDecoderMiekg{}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/model"
 )
 
 func TestDNSDecoder(t *testing.T) {
@@ -179,8 +180,212 @@ func TestDNSDecoder(t *testing.T) {
 			if diff := cmp.Diff(v6, reply.IPv6); diff != "" {
 				t.Fatal(diff)
 			}
+			if len(reply.ECH) != 0 {
+				t.Fatal("expected no ECHConfigList")
+			}
+		})
+
+		t.Run("with ECHConfigList", func(t *testing.T) {
+			ech := []byte{0x00, 0x04, 0xfa, 0xce, 0x00, 0x00}
+			data := dnsGenHTTPSReplyWithECH(t, ech)
+			d := &DNSDecoderMiekg{}
+			reply, err := d.DecodeHTTPS(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(ech, reply.ECH); diff != "" {
+				t.Fatal(diff)
+			}
 		})
 	})
+
+	t.Run("DecodeReply", func(t *testing.T) {
+		t.Run("with nil data", func(t *testing.T) {
+			d := &DNSDecoderMiekg{}
+			reply, err := d.DecodeReply(nil)
+			if err == nil || err.Error() != "dns: overflow unpacking uint16" {
+				t.Fatal("not the error we expected", err)
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply")
+			}
+		})
+
+		t.Run("with NXDOMAIN", func(t *testing.T) {
+			d := &DNSDecoderMiekg{}
+			reply, err := d.DecodeReply(
+				dnsGenReplyWithError(t, dns.TypeNS, dns.RcodeNameError))
+			if !errors.Is(err, ErrOODNSNoSuchHost) {
+				t.Fatal("not the error we expected", err)
+			}
+			if reply == nil {
+				t.Fatal("expected non-nil reply")
+			}
+		})
+
+		t.Run("with NXDOMAIN and SOA in the authority section", func(t *testing.T) {
+			data := dnsGenRawReply(t, dns.RcodeNameError, nil, []dns.RR{
+				&dns.SOA{
+					Hdr: dns.RR_Header{
+						Name:   dns.Fqdn("x.org"),
+						Rrtype: dns.TypeSOA,
+						Class:  dns.ClassINET,
+						Ttl:    900,
+					},
+					Ns:      dns.Fqdn("ns1.x.org"),
+					Mbox:    dns.Fqdn("hostmaster.x.org"),
+					Serial:  1,
+					Refresh: 7200,
+					Retry:   3600,
+					Expire:  1209600,
+					Minttl:  3600,
+				},
+			}, nil)
+			d := &DNSDecoderMiekg{}
+			reply, err := d.DecodeReply(data)
+			if !errors.Is(err, ErrOODNSNoSuchHost) {
+				t.Fatal("not the error we expected", err)
+			}
+			expected := &model.DNSReply{
+				Authority: []*model.DNSRecord{{
+					Name: "x.org.",
+					Type: "SOA",
+					TTL:  900,
+					Data: "ns1.x.org. hostmaster.x.org. 1 7200 3600 1209600 3600",
+				}},
+			}
+			if diff := cmp.Diff(expected, reply); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("with empty answer", func(t *testing.T) {
+			d := &DNSDecoderMiekg{}
+			reply, err := d.DecodeReply(dnsGenLookupHostReplySuccess(t, dns.TypeA))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(reply.Answer) != 0 || len(reply.Authority) != 0 || len(reply.Additional) != 0 {
+				t.Fatal("expected an empty reply")
+			}
+		})
+
+		t.Run("with CNAME chain, authority, and additional", func(t *testing.T) {
+			data := dnsGenRawReplySuccess(t, []dns.RR{
+				&dns.CNAME{
+					Hdr: dns.RR_Header{
+						Name:   dns.Fqdn("www.x.org"),
+						Rrtype: dns.TypeCNAME,
+						Class:  dns.ClassINET,
+						Ttl:    300,
+					},
+					Target: dns.Fqdn("x.org"),
+				},
+				&dns.A{
+					Hdr: dns.RR_Header{
+						Name:   dns.Fqdn("x.org"),
+						Rrtype: dns.TypeA,
+						Class:  dns.ClassINET,
+						Ttl:    60,
+					},
+					A: net.ParseIP("10.10.34.35"),
+				},
+			}, []dns.RR{
+				&dns.NS{
+					Hdr: dns.RR_Header{
+						Name:   dns.Fqdn("x.org"),
+						Rrtype: dns.TypeNS,
+						Class:  dns.ClassINET,
+						Ttl:    3600,
+					},
+					Ns: dns.Fqdn("ns1.x.org"),
+				},
+			}, []dns.RR{
+				&dns.MX{
+					Hdr: dns.RR_Header{
+						Name:   dns.Fqdn("x.org"),
+						Rrtype: dns.TypeMX,
+						Class:  dns.ClassINET,
+						Ttl:    3600,
+					},
+					Preference: 10,
+					Mx:         dns.Fqdn("mx.x.org"),
+				},
+				&dns.OPT{
+					Hdr: dns.RR_Header{
+						Name:   ".",
+						Rrtype: dns.TypeOPT,
+					},
+				},
+			})
+			d := &DNSDecoderMiekg{}
+			reply, err := d.DecodeReply(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := &model.DNSReply{
+				Answer: []*model.DNSRecord{{
+					Name: "www.x.org.",
+					Type: "CNAME",
+					TTL:  300,
+					Data: "x.org.",
+				}, {
+					Name: "x.org.",
+					Type: "A",
+					TTL:  60,
+					Data: "10.10.34.35",
+				}},
+				Authority: []*model.DNSRecord{{
+					Name: "x.org.",
+					Type: "NS",
+					TTL:  3600,
+					Data: "ns1.x.org.",
+				}},
+				Additional: []*model.DNSRecord{{
+					Name: "x.org.",
+					Type: "MX",
+					TTL:  3600,
+					Data: "10 mx.x.org.",
+				}},
+			}
+			if diff := cmp.Diff(expected, reply); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	})
+}
+
+// dnsGenRawReplySuccess generates a successful DNS reply for
+// www.x.org containing the given answer, ns, and extra RRs.
+func dnsGenRawReplySuccess(t *testing.T, answer, ns, extra []dns.RR) []byte {
+	return dnsGenRawReply(t, dns.RcodeSuccess, answer, ns, extra)
+}
+
+// dnsGenRawReply generates a DNS reply for www.x.org using code as
+// the Rcode and containing the given answer, ns, and extra RRs.
+func dnsGenRawReply(t *testing.T, code int, answer, ns, extra []dns.RR) []byte {
+	question := dns.Question{
+		Name:   dns.Fqdn("www.x.org"),
+		Qtype:  dns.TypeA,
+		Qclass: dns.ClassINET,
+	}
+	query := new(dns.Msg)
+	query.Id = dns.Id()
+	query.RecursionDesired = true
+	query.Question = make([]dns.Question, 1)
+	query.Question[0] = question
+	reply := new(dns.Msg)
+	reply.Compress = true
+	reply.MsgHdr.RecursionAvailable = true
+	reply.SetRcode(query, code)
+	reply.Answer = answer
+	reply.Ns = ns
+	reply.Extra = extra
+	data, err := reply.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
 }
 
 // dnsGenReplyWithError generates a DNS reply for the given
@@ -308,3 +513,32 @@ func dnsGenHTTPSReplySuccess(t *testing.T, alpns, ipv4s, ipv6s []string) []byte
 	}
 	return data
 }
+
+// dnsGenHTTPSReplyWithECH generates a successful HTTPS response
+// containing the "h3" ALPN and the given ECHConfigList.
+func dnsGenHTTPSReplyWithECH(t *testing.T, ech []byte) []byte {
+	query := new(dns.Msg)
+	query.SetQuestion(dns.Fqdn("x.org"), dns.TypeHTTPS)
+	reply := new(dns.Msg)
+	reply.SetReply(query)
+	reply.Answer = append(reply.Answer, &dns.HTTPS{
+		SVCB: dns.SVCB{
+			Hdr: dns.RR_Header{
+				Name:   dns.Fqdn("x.org"),
+				Rrtype: dns.TypeHTTPS,
+				Class:  dns.ClassINET,
+				Ttl:    100,
+			},
+			Target: dns.Fqdn("x.org"),
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBAlpn{Alpn: []string{"h3"}},
+				&dns.SVCBECHConfig{ECH: ech},
+			},
+		},
+	})
+	data, err := reply.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -6,7 +6,14 @@ import (
 )
 
 // DNSEncoderMiekg uses github.com/miekg/dns to implement the Encoder.
-type DNSEncoderMiekg struct{}
+type DNSEncoderMiekg struct {
+	// DNSSEC OPTIONALLY forces the encoder to always include an
+	// EDNS0 OPT RR with the DO bit set (even without padding) and
+	// to set the CD bit. With these bits set, the server returns
+	// RRSIG records and does not filter out replies that fail
+	// validation, so that we can validate them ourselves.
+	DNSSEC bool
+}
 
 const (
 	// dnsPaddingDesiredBlockSize is the size that the padded query should be multiple of
@@ -30,8 +37,14 @@ func (e *DNSEncoderMiekg) Encode(domain string, qtype uint16, padding bool) ([]b
 	query.RecursionDesired = true
 	query.Question = make([]dns.Question, 1)
 	query.Question[0] = question
+	if e.DNSSEC {
+		query.CheckingDisabled = true
+		query.SetEdns0(dnsEDNS0MaxResponseSize, true)
+	}
 	if padding {
-		query.SetEdns0(dnsEDNS0MaxResponseSize, dnsDNSSECEnabled)
+		if query.IsEdns0() == nil {
+			query.SetEdns0(dnsEDNS0MaxResponseSize, dnsDNSSECEnabled)
+		}
 		// Clients SHOULD pad queries to the closest multiple of
 		// 128 octets RFC8467#section-4.1. We inflate the query
 		// length by the size of the option (i.e. 4 octets). The
@@ -27,6 +27,33 @@ func TestDNSEncoder(t *testing.T) {
 		dnsValidateEncodedQueryBytes(t, data, byte(dns.TypeA))
 	})
 
+	t.Run("encode with DNSSEC", func(t *testing.T) {
+		for _, padding := range []bool{false, true} {
+			e := &DNSEncoderMiekg{DNSSEC: true}
+			data, err := e.Encode("x.org", dns.TypeA, padding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := &dns.Msg{}
+			if err := query.Unpack(data); err != nil {
+				t.Fatal(err)
+			}
+			if !query.CheckingDisabled {
+				t.Fatal("expected the CD bit to be set")
+			}
+			opt := query.IsEdns0()
+			if opt == nil {
+				t.Fatal("expected an OPT RR")
+			}
+			if !opt.Do() {
+				t.Fatal("expected the DO bit to be set")
+			}
+			if padding && (len(data)%dnsPaddingDesiredBlockSize) != 0 {
+				t.Fatal("expected the query to be padded")
+			}
+		}
+	})
+
 	t.Run("encode padding", func(t *testing.T) {
 		// The purpose of this unit test is to make sure that for a wide
 		// array of values we obtain the right query size.
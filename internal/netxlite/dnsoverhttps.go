@@ -3,6 +3,7 @@ package netxlite
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
 	"net/http"
 	"time"
@@ -22,6 +23,11 @@ type DNSOverHTTPS struct {
 	// HostOverride is OPTIONAL and allows to override the
 	// Host header sent in every request.
 	HostOverride string
+
+	// HTTP3 is OPTIONAL and indicates that Client uses HTTP/3
+	// rather than HTTP/1.1 or HTTP/2. When this field is true,
+	// Network returns "doh3" rather than "doh".
+	HTTP3 bool
 }
 
 // NewDNSOverHTTPS creates a new DNSOverHTTPS instance.
@@ -42,6 +48,37 @@ func NewDNSOverHTTPSWithHostOverride(
 	return &DNSOverHTTPS{Client: client, URL: URL, HostOverride: hostOverride}
 }
 
+// NewDNSOverHTTP3 creates a new DNSOverHTTPS instance that
+// uses HTTP/3 (i.e., DNS-over-HTTP/3 or DoH3).
+//
+// Arguments:
+//
+// - logger is the logger to use;
+//
+// - dialer is the QUICDialer used by the HTTP/3 transport;
+//
+// - tlsConfig is the OPTIONAL TLS config (e.g., to set the SNI). We
+// always use the "h3" ALPN regardless of its NextProtos field;
+//
+// - URL is the DoH resolver URL (e.g., https://1.1.1.1/dns-query);
+//
+// - hostOverride is the OPTIONAL Host header override.
+func NewDNSOverHTTP3(logger model.DebugLogger, dialer model.QUICDialer,
+	tlsConfig *tls.Config, URL, hostOverride string) *DNSOverHTTPS {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{"h3"}
+	txp := NewHTTP3Transport(logger, dialer, tlsConfig)
+	return &DNSOverHTTPS{
+		Client:       WrapHTTPClient(&http.Client{Transport: txp}),
+		URL:          URL,
+		HostOverride: hostOverride,
+		HTTP3:        true,
+	}
+}
+
 // RoundTrip sends a query and receives a reply.
 func (t *DNSOverHTTPS) RoundTrip(ctx context.Context, query []byte) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(ctx, 45*time.Second)
@@ -75,8 +112,11 @@ func (t *DNSOverHTTPS) RequiresPadding() bool {
 	return true
 }
 
-// Network returns the transport network, i.e., "doh".
+// Network returns the transport network, i.e., "doh" or "doh3".
 func (t *DNSOverHTTPS) Network() string {
+	if t.HTTP3 {
+		return "doh3"
+	}
 	return "doh"
 }
 
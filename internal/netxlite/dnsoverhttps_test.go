@@ -3,12 +3,16 @@ package netxlite
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
 	"io"
 	"net/http"
 	"strings"
 	"testing"
 
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/lucas-clemente/quic-go/http3"
 	"github.com/ooni/probe-cli/v3/internal/engine/httpheader"
 	"github.com/ooni/probe-cli/v3/internal/model/mocks"
 )
@@ -179,6 +183,20 @@ func TestDNSOverHTTPS(t *testing.T) {
 		}
 	})
 
+	t.Run("other functions behave correctly with HTTP3", func(t *testing.T) {
+		const queryURL = "https://cloudflare-dns.com/dns-query"
+		txp := &DNSOverHTTPS{Client: http.DefaultClient, URL: queryURL, HTTP3: true}
+		if txp.Network() != "doh3" {
+			t.Fatal("invalid network")
+		}
+		if txp.RequiresPadding() != true {
+			t.Fatal("should require padding")
+		}
+		if txp.Address() != queryURL {
+			t.Fatal("invalid address")
+		}
+	})
+
 	t.Run("CloseIdleConnections", func(t *testing.T) {
 		var called bool
 		doh := &DNSOverHTTPS{
@@ -194,3 +212,39 @@ func TestDNSOverHTTPS(t *testing.T) {
 		}
 	})
 }
+
+func TestNewDNSOverHTTP3(t *testing.T) {
+	const queryURL = "https://cloudflare-dns.com/dns-query"
+	dialer := &mocks.QUICDialer{}
+	tlsConfig := &tls.Config{ServerName: "dns.google"}
+	txp := NewDNSOverHTTP3(log.Log, dialer, tlsConfig, queryURL, "dns.google")
+	if !txp.HTTP3 {
+		t.Fatal("expected HTTP3 to be true")
+	}
+	if txp.Network() != "doh3" {
+		t.Fatal("invalid network")
+	}
+	if txp.Address() != queryURL {
+		t.Fatal("invalid address")
+	}
+	errWrapper := txp.Client.(*httpClientErrWrapper)
+	clnt := errWrapper.HTTPClient.(*http.Client)
+	logger := clnt.Transport.(*httpTransportLogger)
+	h3txp := logger.HTTPTransport.(*http3Transport)
+	if h3txp.dialer != dialer {
+		t.Fatal("invalid dialer")
+	}
+	if txp.HostOverride != "dns.google" {
+		t.Fatal("invalid host override")
+	}
+	h3config := h3txp.child.(*http3.RoundTripper).TLSClientConfig
+	if h3config.ServerName != "dns.google" {
+		t.Fatal("invalid server name")
+	}
+	if diff := cmp.Diff([]string{"h3"}, h3config.NextProtos); diff != "" {
+		t.Fatal(diff)
+	}
+	if len(tlsConfig.NextProtos) != 0 {
+		t.Fatal("modified the original TLS config")
+	}
+}
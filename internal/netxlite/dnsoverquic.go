@@ -0,0 +1,141 @@
+package netxlite
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"math"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// DNSOverQUIC is a DNS-over-QUIC DNSTransport (see RFC9250).
+//
+// Bug: this implementation always creates a new session for each query.
+type DNSOverQUIC struct {
+	dialer    model.QUICDialer
+	address   string
+	tlsConfig *tls.Config
+}
+
+// NewDNSOverQUIC creates a new DNSOverQUIC transport.
+//
+// Arguments:
+//
+// - dialer is any type that implements the QUICDialer interface;
+//
+// - address is the endpoint address (e.g., 94.140.14.14:853);
+//
+// - tlsConfig is the OPTIONAL TLS config (e.g., to set the SNI). If
+// its NextProtos field is empty, we will use the "doq" ALPN.
+func NewDNSOverQUIC(dialer model.QUICDialer, address string, tlsConfig *tls.Config) *DNSOverQUIC {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig = tlsConfig.Clone()
+	if len(tlsConfig.NextProtos) <= 0 {
+		tlsConfig.NextProtos = []string{"doq"}
+	}
+	return &DNSOverQUIC{dialer: dialer, address: address, tlsConfig: tlsConfig}
+}
+
+// RoundTrip sends a query and receives a reply.
+func (t *DNSOverQUIC) RoundTrip(ctx context.Context, query []byte) ([]byte, error) {
+	if len(query) > math.MaxUint16 {
+		return nil, errors.New("query too long")
+	}
+	if len(query) < 2 {
+		return nil, errors.New("query too short")
+	}
+	sess, err := t.dialer.DialContext(ctx, "udp", t.address, t.tlsConfig, &quic.Config{})
+	if err != nil {
+		return nil, err
+	}
+	// RFC9250 Sect. 4.3 says the client MAY close the session with
+	// DOQ_NO_ERROR (i.e., zero) when it has no more queries to send.
+	defer sess.CloseWithError(0, "")
+	stream, err := sess.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err = stream.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	// Make sure we unblock I/O as soon as the context is done.
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stream.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	reply, err := t.roundTrip(stream, query)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return reply, err
+}
+
+// roundTrip sends the query and reads the reply using the given stream.
+func (t *DNSOverQUIC) roundTrip(stream quic.Stream, query []byte) ([]byte, error) {
+	// Write request. RFC9250 Sect. 4.2.1 says that the message ID MUST
+	// be zero and the message MUST be prefixed with its length.
+	buf := []byte{byte(len(query) >> 8)}
+	buf = append(buf, byte(len(query)))
+	buf = append(buf, 0, 0)
+	buf = append(buf, query[2:]...)
+	if _, err := stream.Write(buf); err != nil {
+		return nil, err
+	}
+	// The client MUST send the STREAM FIN after the query.
+	if err := stream.Close(); err != nil {
+		return nil, err
+	}
+	// Read response
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(stream, header); err != nil {
+		return nil, err
+	}
+	length := int(header[0])<<8 | int(header[1])
+	reply := make([]byte, length)
+	if _, err := io.ReadFull(stream, reply); err != nil {
+		return nil, err
+	}
+	// Restore the original message ID, which we zeroed above, such
+	// that the reply matches the query for the callers.
+	if len(reply) >= 2 {
+		copy(reply[:2], query[:2])
+	}
+	return reply, nil
+}
+
+// RequiresPadding returns true for DoQ according to RFC9250.
+func (t *DNSOverQUIC) RequiresPadding() bool {
+	return true
+}
+
+// Network returns the transport network, i.e., "doq".
+func (t *DNSOverQUIC) Network() string {
+	return "doq"
+}
+
+// Address returns the upstream server endpoint (e.g., "94.140.14.14:853").
+func (t *DNSOverQUIC) Address() string {
+	return t.address
+}
+
+// CloseIdleConnections closes idle connections, if any.
+func (t *DNSOverQUIC) CloseIdleConnections() {
+	t.dialer.CloseIdleConnections()
+}
+
+var _ model.DNSTransport = &DNSOverQUIC{}
@@ -0,0 +1,366 @@
+package netxlite
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
+)
+
+// dnsOverQUICNewDialer returns a QUIC dialer returning a session
+// that always returns the given stream from OpenStreamSync.
+func dnsOverQUICNewDialer(stream quic.Stream) *mocks.QUICDialer {
+	return &mocks.QUICDialer{
+		MockDialContext: func(ctx context.Context, network, address string,
+			tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlySession, error) {
+			return &mocks.QUICEarlySession{
+				MockOpenStreamSync: func(ctx context.Context) (quic.Stream, error) {
+					return stream, nil
+				},
+				MockCloseWithError: func(code quic.ApplicationErrorCode, reason string) error {
+					return nil
+				},
+			}, nil
+		},
+	}
+}
+
+func TestDNSOverQUIC(t *testing.T) {
+	t.Run("NewDNSOverQUIC", func(t *testing.T) {
+		t.Run("with nil TLS config", func(t *testing.T) {
+			txp := NewDNSOverQUIC(&mocks.QUICDialer{}, "9.9.9.9:853", nil)
+			if diff := cmp.Diff([]string{"doq"}, txp.tlsConfig.NextProtos); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("with custom TLS config", func(t *testing.T) {
+			config := &tls.Config{ServerName: "dns.adguard.com"}
+			txp := NewDNSOverQUIC(&mocks.QUICDialer{}, "9.9.9.9:853", config)
+			if txp.tlsConfig == config {
+				t.Fatal("expected the config to be cloned")
+			}
+			if txp.tlsConfig.ServerName != "dns.adguard.com" {
+				t.Fatal("invalid server name")
+			}
+			if len(config.NextProtos) != 0 {
+				t.Fatal("modified the original config")
+			}
+		})
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		t.Run("query too large", func(t *testing.T) {
+			txp := NewDNSOverQUIC(&mocks.QUICDialer{}, "9.9.9.9:853", nil)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<18))
+			if err == nil {
+				t.Fatal("expected an error here")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+		})
+
+		t.Run("query too short", func(t *testing.T) {
+			txp := NewDNSOverQUIC(&mocks.QUICDialer{}, "9.9.9.9:853", nil)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1))
+			if err == nil {
+				t.Fatal("expected an error here")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+		})
+
+		t.Run("dial failure", func(t *testing.T) {
+			mocked := errors.New("mocked error")
+			dialer := &mocks.QUICDialer{
+				MockDialContext: func(ctx context.Context, network, address string,
+					tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlySession, error) {
+					return nil, mocked
+				},
+			}
+			txp := NewDNSOverQUIC(dialer, "9.9.9.9:853", nil)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11))
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+		})
+
+		t.Run("OpenStreamSync failure", func(t *testing.T) {
+			mocked := errors.New("mocked error")
+			var closed bool
+			dialer := &mocks.QUICDialer{
+				MockDialContext: func(ctx context.Context, network, address string,
+					tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlySession, error) {
+					return &mocks.QUICEarlySession{
+						MockOpenStreamSync: func(ctx context.Context) (quic.Stream, error) {
+							return nil, mocked
+						},
+						MockCloseWithError: func(code quic.ApplicationErrorCode, reason string) error {
+							closed = true
+							return nil
+						},
+					}, nil
+				},
+			}
+			txp := NewDNSOverQUIC(dialer, "9.9.9.9:853", nil)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11))
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+			if !closed {
+				t.Fatal("did not close the session")
+			}
+		})
+
+		t.Run("SetDeadline failure", func(t *testing.T) {
+			mocked := errors.New("mocked error")
+			stream := &mocks.QUICStream{
+				MockSetDeadline: func(t time.Time) error {
+					return mocked
+				},
+			}
+			txp := NewDNSOverQUIC(dnsOverQUICNewDialer(stream), "9.9.9.9:853", nil)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11))
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+		})
+
+		t.Run("write failure", func(t *testing.T) {
+			mocked := errors.New("mocked error")
+			stream := &mocks.QUICStream{
+				MockSetDeadline: func(t time.Time) error {
+					return nil
+				},
+				MockWrite: func(b []byte) (int, error) {
+					return 0, mocked
+				},
+			}
+			txp := NewDNSOverQUIC(dnsOverQUICNewDialer(stream), "9.9.9.9:853", nil)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11))
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+		})
+
+		t.Run("close failure", func(t *testing.T) {
+			mocked := errors.New("mocked error")
+			stream := &mocks.QUICStream{
+				MockSetDeadline: func(t time.Time) error {
+					return nil
+				},
+				MockWrite: func(b []byte) (int, error) {
+					return len(b), nil
+				},
+				MockClose: func() error {
+					return mocked
+				},
+			}
+			txp := NewDNSOverQUIC(dnsOverQUICNewDialer(stream), "9.9.9.9:853", nil)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11))
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+		})
+
+		t.Run("first read fails", func(t *testing.T) {
+			stream := &mocks.QUICStream{
+				MockSetDeadline: func(t time.Time) error {
+					return nil
+				},
+				MockWrite: func(b []byte) (int, error) {
+					return len(b), nil
+				},
+				MockClose: func() error {
+					return nil
+				},
+				MockRead: func(b []byte) (int, error) {
+					return 0, io.EOF
+				},
+			}
+			txp := NewDNSOverQUIC(dnsOverQUICNewDialer(stream), "9.9.9.9:853", nil)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11))
+			if !errors.Is(err, io.EOF) {
+				t.Fatal("not the error we expected", err)
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+		})
+
+		t.Run("second read fails", func(t *testing.T) {
+			input := io.MultiReader(
+				bytes.NewReader([]byte{byte(0), byte(2), byte(1)}),
+				&mocks.Reader{
+					MockRead: func(b []byte) (int, error) {
+						return 0, io.EOF
+					},
+				},
+			)
+			stream := &mocks.QUICStream{
+				MockSetDeadline: func(t time.Time) error {
+					return nil
+				},
+				MockWrite: func(b []byte) (int, error) {
+					return len(b), nil
+				},
+				MockClose: func() error {
+					return nil
+				},
+				MockRead: input.Read,
+			}
+			txp := NewDNSOverQUIC(dnsOverQUICNewDialer(stream), "9.9.9.9:853", nil)
+			reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11))
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatal("not the error we expected", err)
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+		})
+
+		t.Run("successful case", func(t *testing.T) {
+			input := bytes.NewReader([]byte{byte(0), byte(1), byte(1)})
+			var written []byte
+			stream := &mocks.QUICStream{
+				MockSetDeadline: func(t time.Time) error {
+					return nil
+				},
+				MockWrite: func(b []byte) (int, error) {
+					written = append(written, b...)
+					return len(b), nil
+				},
+				MockClose: func() error {
+					return nil
+				},
+				MockRead: input.Read,
+			}
+			txp := NewDNSOverQUIC(dnsOverQUICNewDialer(stream), "9.9.9.9:853", nil)
+			query := []byte{0xde, 0xad, 0xbe, 0xef}
+			reply, err := txp.RoundTrip(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(reply) != 1 || reply[0] != 1 {
+				t.Fatal("not the response we expected")
+			}
+			expected := []byte{0, 4, 0, 0, 0xbe, 0xef}
+			if diff := cmp.Diff(expected, written); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	})
+
+	t.Run("RoundTrip restores the query ID", func(t *testing.T) {
+		input := bytes.NewReader([]byte{0, 4, 0, 0, 0xca, 0xfe})
+		stream := &mocks.QUICStream{
+			MockSetDeadline: func(t time.Time) error {
+				return nil
+			},
+			MockWrite: func(b []byte) (int, error) {
+				return len(b), nil
+			},
+			MockClose: func() error {
+				return nil
+			},
+			MockRead: input.Read,
+		}
+		txp := NewDNSOverQUIC(dnsOverQUICNewDialer(stream), "9.9.9.9:853", nil)
+		query := []byte{0xde, 0xad, 0xbe, 0xef}
+		reply, err := txp.RoundTrip(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []byte{0xde, 0xad, 0xca, 0xfe}
+		if diff := cmp.Diff(expected, reply); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("RoundTrip honours the context", func(t *testing.T) {
+		unblock := make(chan bool)
+		var once sync.Once
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		var deadline time.Time
+		stream := &mocks.QUICStream{
+			MockSetDeadline: func(t time.Time) error {
+				if deadline.IsZero() {
+					deadline = t // the first call sets the deadline
+					return nil
+				}
+				once.Do(func() { close(unblock) })
+				return nil
+			},
+			MockWrite: func(b []byte) (int, error) {
+				return len(b), nil
+			},
+			MockClose: func() error {
+				return nil
+			},
+			MockRead: func(b []byte) (int, error) {
+				<-unblock
+				return 0, errors.New("i/o timeout")
+			},
+		}
+		txp := NewDNSOverQUIC(dnsOverQUICNewDialer(stream), "9.9.9.9:853", nil)
+		reply, err := txp.RoundTrip(ctx, make([]byte, 1<<11))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatal("not the error we expected", err)
+		}
+		if reply != nil {
+			t.Fatal("expected nil reply here")
+		}
+		if time.Until(deadline) > time.Second {
+			t.Fatal("the deadline does not take into account the context")
+		}
+	})
+
+	t.Run("other functions okay", func(t *testing.T) {
+		var called bool
+		dialer := &mocks.QUICDialer{
+			MockCloseIdleConnections: func() {
+				called = true
+			},
+		}
+		txp := NewDNSOverQUIC(dialer, "9.9.9.9:853", nil)
+		if txp.RequiresPadding() != true {
+			t.Fatal("invalid RequiresPadding")
+		}
+		if txp.Network() != "doq" {
+			t.Fatal("invalid Network")
+		}
+		if txp.Address() != "9.9.9.9:853" {
+			t.Fatal("invalid Address")
+		}
+		txp.CloseIdleConnections()
+		if !called {
+			t.Fatal("did not call CloseIdleConnections")
+		}
+	})
+}
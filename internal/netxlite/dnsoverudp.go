@@ -2,17 +2,50 @@ package netxlite
 
 import (
 	"context"
+	"net"
 	"time"
 
 	"github.com/ooni/probe-cli/v3/internal/model"
 )
 
 // DNSOverUDP is a DNS-over-UDP DNSTransport.
+//
+// By default, RoundTrip returns the first reply it receives and closes
+// the socket. Yet, on-path censors often inject replies that arrive
+// before the legitimate one. If you set LateResponsesWindow, we keep the
+// socket open for such an amount of time after the first reply and we
+// pass any additional reply to OnLateResponse. In this mode, RoundTrip
+// still returns the first reply, but only after the window has expired.
 type DNSOverUDP struct {
+	// LateResponsesWindow is the OPTIONAL amount of time for which we
+	// keep reading replies after the first one. If this field is zero
+	// or negative, we return as soon as we receive the first reply.
+	LateResponsesWindow time.Duration
+
+	// OnLateResponse is the OPTIONAL callback invoked for each reply
+	// received after the first one (see LateResponsesWindow). We call
+	// this callback synchronously before RoundTrip returns.
+	OnLateResponse func(resp *DNSOverUDPLateResponse)
+
 	dialer  model.Dialer
 	address string
 }
 
+// DNSOverUDPLateResponse is a reply received after the first one.
+type DNSOverUDPLateResponse struct {
+	// Address is the server address (e.g., "8.8.8.8:53").
+	Address string
+
+	// Query is the raw query we sent.
+	Query []byte
+
+	// Reply is the raw late reply.
+	Reply []byte
+
+	// Received is when we received this reply.
+	Received time.Time
+}
+
 // NewDNSOverUDP creates a DNSOverUDP instance.
 //
 // Arguments:
@@ -45,9 +78,39 @@ func (t *DNSOverUDP) RoundTrip(ctx context.Context, query []byte) ([]byte, error
 	if err != nil {
 		return nil, err
 	}
+	if t.LateResponsesWindow > 0 {
+		t.collectLateResponses(ctx, conn, query)
+	}
 	return reply[:n], nil
 }
 
+// collectLateResponses reads the replies received after the first
+// one until the LateResponsesWindow or the context expires.
+func (t *DNSOverUDP) collectLateResponses(ctx context.Context, conn net.Conn, query []byte) {
+	deadline := time.Now().Add(t.LateResponsesWindow)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return
+	}
+	for {
+		reply := make([]byte, 1<<17)
+		n, err := conn.Read(reply)
+		if err != nil {
+			return // typically, the deadline has expired
+		}
+		if t.OnLateResponse != nil {
+			t.OnLateResponse(&DNSOverUDPLateResponse{
+				Address:  t.address,
+				Query:    query,
+				Reply:    reply[:n],
+				Received: time.Now(),
+			})
+		}
+	}
+}
+
 // RequiresPadding returns false for UDP according to RFC8467.
 func (t *DNSOverUDP) RequiresPadding() bool {
 	return false
@@ -146,6 +146,136 @@ func TestDNSOverUDP(t *testing.T) {
 		})
 	})
 
+	t.Run("RoundTrip with LateResponsesWindow", func(t *testing.T) {
+		// newConn returns a conn that returns the given replies and
+		// then fails with a timeout once the deadline expires.
+		newConn := func(deadlines *[]time.Time, replies ...[]byte) *mocks.Conn {
+			return &mocks.Conn{
+				MockSetDeadline: func(t time.Time) error {
+					*deadlines = append(*deadlines, t)
+					return nil
+				},
+				MockWrite: func(b []byte) (int, error) {
+					return len(b), nil
+				},
+				MockRead: func(b []byte) (int, error) {
+					if len(replies) <= 0 {
+						return 0, &errorWithTimeout{ETIMEDOUT}
+					}
+					n := copy(b, replies[0])
+					replies = replies[1:]
+					return n, nil
+				},
+				MockClose: func() error {
+					return nil
+				},
+			}
+		}
+
+		t.Run("with late responses", func(t *testing.T) {
+			var deadlines []time.Time
+			conn := newConn(&deadlines, []byte("first"), []byte("second"), []byte("third"))
+			txp := NewDNSOverUDP(&mocks.Dialer{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return conn, nil
+				},
+			}, "9.9.9.9:53")
+			txp.LateResponsesWindow = time.Second
+			var late []*DNSOverUDPLateResponse
+			txp.OnLateResponse = func(resp *DNSOverUDPLateResponse) {
+				late = append(late, resp)
+			}
+			query := []byte("query")
+			data, err := txp.RoundTrip(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "first" {
+				t.Fatal("not the reply we expected", string(data))
+			}
+			if len(late) != 2 {
+				t.Fatal("expected two late responses")
+			}
+			for idx, expect := range []string{"second", "third"} {
+				if string(late[idx].Reply) != expect {
+					t.Fatal("unexpected late reply", string(late[idx].Reply))
+				}
+				if string(late[idx].Query) != "query" {
+					t.Fatal("unexpected query")
+				}
+				if late[idx].Address != "9.9.9.9:53" {
+					t.Fatal("unexpected address")
+				}
+				if late[idx].Received.IsZero() {
+					t.Fatal("unexpected received time")
+				}
+			}
+			if len(deadlines) != 2 {
+				t.Fatal("expected to set the deadline twice")
+			}
+		})
+
+		t.Run("with context deadline shorter than the window", func(t *testing.T) {
+			var deadlines []time.Time
+			conn := newConn(&deadlines, []byte("first"))
+			txp := NewDNSOverUDP(&mocks.Dialer{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return conn, nil
+				},
+			}, "9.9.9.9:53")
+			txp.LateResponsesWindow = time.Hour
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			expected, _ := ctx.Deadline()
+			data, err := txp.RoundTrip(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "first" {
+				t.Fatal("not the reply we expected", string(data))
+			}
+			if len(deadlines) != 2 || !deadlines[1].Equal(expected) {
+				t.Fatal("did not use the context deadline", deadlines)
+			}
+		})
+
+		t.Run("with SetDeadline failure after the first reply", func(t *testing.T) {
+			var count int
+			txp := NewDNSOverUDP(&mocks.Dialer{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return &mocks.Conn{
+						MockSetDeadline: func(t time.Time) error {
+							if count++; count > 1 {
+								return errors.New("mocked error")
+							}
+							return nil
+						},
+						MockWrite: func(b []byte) (int, error) {
+							return len(b), nil
+						},
+						MockRead: func(b []byte) (int, error) {
+							return copy(b, []byte("first")), nil
+						},
+						MockClose: func() error {
+							return nil
+						},
+					}, nil
+				},
+			}, "9.9.9.9:53")
+			txp.LateResponsesWindow = time.Second
+			txp.OnLateResponse = func(resp *DNSOverUDPLateResponse) {
+				t.Fatal("should not be called")
+			}
+			data, err := txp.RoundTrip(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "first" {
+				t.Fatal("not the reply we expected", string(data))
+			}
+		})
+	})
+
 	t.Run("other functions okay", func(t *testing.T) {
 		const address = "9.9.9.9:53"
 		txp := NewDNSOverUDP(NewDialerWithoutResolver(log.Log), address)
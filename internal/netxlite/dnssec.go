@@ -0,0 +1,576 @@
+package netxlite
+
+//
+// DNSSEC validation
+//
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/runtimex"
+)
+
+// DNSSECRootTrustAnchor contains the DS records of the root zone
+// KSKs published by IANA at https://data.iana.org/root-anchors/. We
+// use these records when DNSSECResolver.TrustAnchor is empty.
+var DNSSECRootTrustAnchor = []string{
+	". 86400 IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". 86400 IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// DNSSECResolver is a resolver that validates replies using DNSSEC.
+//
+// We send queries with the DO and CD bits set (see DNSEncoderMiekg)
+// using the given transport. Then, we verify the RRSIG records of the
+// RRsets inside the reply and we walk the chain of trust (DNSKEY and
+// DS records) up to the root zone, whose keys must match the trust
+// anchor. Because all the queries use the same transport, a middlebox
+// spoofing the replies cannot forge a valid chain of trust.
+//
+// We only accept unsigned RRsets when we can prove that they belong
+// to an insecure zone, i.e., when there is a zone cut for which the
+// parent zone proves with signed NSEC or NSEC3 records that there is
+// no DS record. Negative replies (i.e., NXDOMAIN and NODATA) must
+// include signed NSEC or NSEC3 records, unless they belong to an
+// insecure zone. Note that we verify the signatures of these records
+// but we do not check whether they actually cover the queried name.
+//
+// When validation fails, we return an error wrapping ErrDNSSECBogus.
+//
+// You should probably use NewDNSSECResolver to create a new instance.
+type DNSSECResolver struct {
+	// Decoder is the MANDATORY decoder to use.
+	Decoder model.DNSDecoder
+
+	// Encoder is the MANDATORY encoder to use. This encoder MUST
+	// set the DO bit, e.g., &DNSEncoderMiekg{DNSSEC: true}.
+	Encoder model.DNSEncoder
+
+	// TimeNow is the OPTIONAL function returning the current time, which
+	// we use to check the validity period of signatures. If this field
+	// is nil, we use time.Now.
+	TimeNow func() time.Time
+
+	// TrustAnchor contains the OPTIONAL DS records of the root zone. If
+	// this field is empty, we use DNSSECRootTrustAnchor.
+	TrustAnchor []*dns.DS
+
+	// Txp is the MANDATORY underlying DNS transport.
+	Txp model.DNSTransport
+}
+
+// NewDNSSECResolver creates a new DNSSECResolver instance.
+func NewDNSSECResolver(txp model.DNSTransport) *DNSSECResolver {
+	return &DNSSECResolver{
+		Decoder: &DNSDecoderMiekg{},
+		Encoder: &DNSEncoderMiekg{DNSSEC: true},
+		Txp:     txp,
+	}
+}
+
+var _ model.RawResolver = &DNSSECResolver{}
+
+// Transport returns the transport being used.
+func (r *DNSSECResolver) Transport() model.DNSTransport {
+	return r.Txp
+}
+
+// Network returns the "network" of the underlying transport.
+func (r *DNSSECResolver) Network() string {
+	return r.Txp.Network()
+}
+
+// Address returns the "address" of the underlying transport.
+func (r *DNSSECResolver) Address() string {
+	return r.Txp.Address()
+}
+
+// CloseIdleConnections closes idle connections, if any.
+func (r *DNSSECResolver) CloseIdleConnections() {
+	r.Txp.CloseIdleConnections()
+}
+
+// LookupHost performs validated A and AAAA lookups for hostname.
+func (r *DNSSECResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	v := r.newValidator()
+	addrsA, errA := r.lookupHost(ctx, v, hostname, dns.TypeA)
+	addrsAAAA, errAAAA := r.lookupHost(ctx, v, hostname, dns.TypeAAAA)
+	// A validation failure for either query means that someone is
+	// tampering with the replies, so we always return it.
+	for _, err := range []error{errA, errAAAA} {
+		if errors.Is(err, ErrDNSSECBogus) {
+			return nil, err
+		}
+	}
+	if errA != nil && errAAAA != nil {
+		// Like SerialResolver, we assume errA is more meaningful.
+		return nil, errA
+	}
+	var addrs []string
+	addrs = append(addrs, addrsA...)
+	addrs = append(addrs, addrsAAAA...)
+	return addrs, nil
+}
+
+func (r *DNSSECResolver) lookupHost(ctx context.Context,
+	v *dnssecValidator, hostname string, qtype uint16) ([]string, error) {
+	replydata, err := v.lookup(ctx, hostname, qtype)
+	if err != nil {
+		return nil, err
+	}
+	return r.Decoder.DecodeLookupHost(qtype, replydata)
+}
+
+// LookupHTTPS implements Resolver.LookupHTTPS.
+func (r *DNSSECResolver) LookupHTTPS(
+	ctx context.Context, hostname string) (*model.HTTPSSvc, error) {
+	replydata, err := r.newValidator().lookup(ctx, hostname, dns.TypeHTTPS)
+	if err != nil {
+		return nil, err
+	}
+	return r.Decoder.DecodeHTTPS(replydata)
+}
+
+// LookupRaw implements model.RawResolver.LookupRaw.
+func (r *DNSSECResolver) LookupRaw(
+	ctx context.Context, hostname string, qtype uint16) (*model.DNSReply, error) {
+	replydata, err := r.newValidator().lookup(ctx, hostname, qtype)
+	if err != nil {
+		return nil, err
+	}
+	return r.Decoder.DecodeReply(replydata)
+}
+
+// trustAnchor returns the trust anchor we should use.
+func (r *DNSSECResolver) trustAnchor() (out []*dns.DS) {
+	if len(r.TrustAnchor) > 0 {
+		return r.TrustAnchor
+	}
+	for _, record := range DNSSECRootTrustAnchor {
+		rr, err := dns.NewRR(record)
+		runtimex.PanicOnError(err, "dns.NewRR failed")
+		ds, good := rr.(*dns.DS)
+		runtimex.PanicIfFalse(good, "expected a DS record")
+		out = append(out, ds)
+	}
+	return
+}
+
+// newValidator creates a new dnssecValidator.
+func (r *DNSSECResolver) newValidator() *dnssecValidator {
+	now := time.Now
+	if r.TimeNow != nil {
+		now = r.TimeNow
+	}
+	return &dnssecValidator{
+		keys: map[string][]*dns.DNSKEY{},
+		now:  now(),
+		r:    r,
+	}
+}
+
+// dnssecValidator validates the replies of a single lookup operation
+// and caches the zone keys that it has already validated.
+type dnssecValidator struct {
+	// keys maps a canonical zone name to its validated DNSKEYs.
+	keys map[string][]*dns.DNSKEY
+
+	// now is the time we use to check the validity of signatures.
+	now time.Time
+
+	// r is the resolver that created this validator.
+	r *DNSSECResolver
+}
+
+// lookup sends a query for domain and qtype and returns the raw
+// reply, provided that the reply passes DNSSEC validation.
+func (v *dnssecValidator) lookup(ctx context.Context, domain string, qtype uint16) ([]byte, error) {
+	replydata, reply, err := v.exchange(ctx, domain, qtype)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.validateReply(ctx, reply); err != nil {
+		return nil, err
+	}
+	return replydata, nil
+}
+
+// exchange sends a query and returns the raw and the parsed reply.
+func (v *dnssecValidator) exchange(
+	ctx context.Context, domain string, qtype uint16) ([]byte, *dns.Msg, error) {
+	querydata, err := v.r.Encoder.Encode(domain, qtype, v.r.Txp.RequiresPadding())
+	if err != nil {
+		return nil, nil, err
+	}
+	replydata, err := v.r.Txp.RoundTrip(ctx, querydata)
+	if err != nil {
+		return nil, nil, err
+	}
+	reply := &dns.Msg{}
+	if err := reply.Unpack(replydata); err != nil {
+		return nil, nil, err
+	}
+	return replydata, reply, nil
+}
+
+// exchangeChain is like exchange but it's meant for the queries we
+// send to follow the chain of trust, hence it fails if the RCODE of
+// the reply indicates failure.
+func (v *dnssecValidator) exchangeChain(
+	ctx context.Context, domain string, qtype uint16) (*dns.Msg, error) {
+	_, reply, err := v.exchange(ctx, domain, qtype)
+	if err != nil {
+		return nil, err
+	}
+	decoder := &DNSDecoderMiekg{}
+	if err := decoder.rcodeToError(reply.Rcode); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// validateReply validates a reply to a query sent by the user.
+func (v *dnssecValidator) validateReply(ctx context.Context, reply *dns.Msg) error {
+	if reply.Rcode != dns.RcodeSuccess && reply.Rcode != dns.RcodeNameError {
+		return nil // the decoder will map the RCODE to an error
+	}
+	if len(reply.Question) != 1 {
+		return fmt.Errorf("%w: expected a single question", ErrDNSSECBogus)
+	}
+	target, qtype := reply.Question[0].Name, reply.Question[0].Qtype
+	var positive bool
+	for _, set := range dnssecGroupRRsets(reply.Answer) {
+		if err := v.verifyOrProveInsecure(ctx, set); err != nil {
+			return err
+		}
+		for _, rr := range set.rrs {
+			if cname, ok := rr.(*dns.CNAME); ok && dnssecEqualNames(cname.Hdr.Name, target) {
+				target = cname.Target
+			}
+			if rr.Header().Rrtype == qtype {
+				positive = true
+			}
+		}
+	}
+	if positive && reply.Rcode == dns.RcodeSuccess {
+		return nil
+	}
+	// This is a negative reply, so we need signed denial of existence
+	// records, unless the target belongs to an insecure zone.
+	var denial bool
+	for _, set := range dnssecGroupRRsets(reply.Ns) {
+		if len(set.sigs) <= 0 {
+			continue
+		}
+		if err := v.verifyRRset(ctx, set); err != nil {
+			return err
+		}
+		switch set.rrtype {
+		case dns.TypeNSEC, dns.TypeNSEC3:
+			denial = true
+		}
+	}
+	if denial {
+		return nil
+	}
+	return v.proveInsecure(ctx, target)
+}
+
+// verifyOrProveInsecure verifies the signatures of a signed RRset and
+// otherwise checks whether its owner belongs to an insecure zone.
+func (v *dnssecValidator) verifyOrProveInsecure(ctx context.Context, set *dnssecRRset) error {
+	if len(set.sigs) <= 0 {
+		return v.proveInsecure(ctx, set.name)
+	}
+	return v.verifyRRset(ctx, set)
+}
+
+// verifyRRset returns nil if at least one of the signatures of
+// the given RRset is valid and has been generated by a zone key
+// that we can validate up to the trust anchor.
+func (v *dnssecValidator) verifyRRset(ctx context.Context, set *dnssecRRset) error {
+	err := fmt.Errorf("%w: no signatures for %s", ErrDNSSECBogus, set)
+	for _, sig := range set.sigs {
+		if !dns.IsSubDomain(sig.SignerName, set.name) {
+			err = fmt.Errorf("%w: %s signed by %s", ErrDNSSECBogus, set, sig.SignerName)
+			continue
+		}
+		if set.rrtype == dns.TypeDS && dnssecEqualNames(sig.SignerName, set.name) {
+			// The parent zone signs the DS RRset, so a DS RRset signed by
+			// its owner zone cannot be part of the chain of trust.
+			err = fmt.Errorf("%w: %s signed by its owner", ErrDNSSECBogus, set)
+			continue
+		}
+		if !sig.ValidityPeriod(v.now) {
+			err = fmt.Errorf("%w: expired signature for %s", ErrDNSSECBogus, set)
+			continue
+		}
+		keys, kerr := v.zoneKeys(ctx, sig.SignerName)
+		if kerr != nil {
+			if !errors.Is(kerr, ErrDNSSECBogus) {
+				return kerr // e.g., a network error
+			}
+			err = kerr
+			continue
+		}
+		if dnssecVerifyWithKeys(sig, keys, set.rrs) {
+			return nil
+		}
+		err = fmt.Errorf("%w: invalid signature for %s", ErrDNSSECBogus, set)
+	}
+	return err
+}
+
+// zoneKeys returns the DNSKEYs of the given zone after we have
+// validated them using the DS records of the parent zone.
+func (v *dnssecValidator) zoneKeys(ctx context.Context, zone string) ([]*dns.DNSKEY, error) {
+	zone = dns.CanonicalName(zone)
+	if keys, found := v.keys[zone]; found {
+		return keys, nil
+	}
+	dsset, err := v.delegationSigners(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := v.exchangeChain(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+	set := dnssecFindRRset(reply.Answer, zone, dns.TypeDNSKEY)
+	var keys []*dns.DNSKEY
+	for _, rr := range set.rrs {
+		if key, ok := rr.(*dns.DNSKEY); ok && (key.Flags&dns.ZONE) != 0 {
+			keys = append(keys, key)
+		}
+	}
+	// The DNSKEY RRset must be self-signed by a key matching a DS record.
+	for _, key := range keys {
+		if !dnssecKeyMatchesDS(key, dsset) {
+			continue
+		}
+		for _, sig := range set.sigs {
+			if sig.ValidityPeriod(v.now) &&
+				dnssecVerifyWithKeys(sig, []*dns.DNSKEY{key}, set.rrs) {
+				v.keys[zone] = keys
+				return keys, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: cannot validate the DNSKEYs of %s", ErrDNSSECBogus, zone)
+}
+
+// delegationSigners returns the validated DS records of the given zone.
+func (v *dnssecValidator) delegationSigners(ctx context.Context, zone string) ([]*dns.DS, error) {
+	if zone == "." {
+		return v.r.trustAnchor(), nil
+	}
+	reply, err := v.exchangeChain(ctx, zone, dns.TypeDS)
+	if err != nil {
+		return nil, err
+	}
+	set := dnssecFindRRset(reply.Answer, zone, dns.TypeDS)
+	if len(set.rrs) <= 0 {
+		return nil, fmt.Errorf("%w: no DS records for %s", ErrDNSSECBogus, zone)
+	}
+	if err := v.verifyRRset(ctx, set); err != nil {
+		return nil, err
+	}
+	var out []*dns.DS
+	for _, rr := range set.rrs {
+		if ds, ok := rr.(*dns.DS); ok {
+			out = append(out, ds)
+		}
+	}
+	return out, nil
+}
+
+// proveInsecure returns nil if we can prove that name belongs to an insecure
+// zone. To this end, we walk down from the root and query for the DS records
+// of each ancestor of name, until we find a signed proof that one of them is
+// a delegation without DS records. If all the zones on the path to name are
+// signed, we return an error wrapping ErrDNSSECBogus.
+func (v *dnssecValidator) proveInsecure(ctx context.Context, name string) error {
+	labels := dns.SplitDomainName(name)
+	for idx := len(labels) - 1; idx >= 0; idx-- {
+		child := dns.Fqdn(strings.Join(labels[idx:], "."))
+		_, reply, err := v.exchange(ctx, child, dns.TypeDS)
+		if err != nil {
+			return err
+		}
+		if set := dnssecFindRRset(reply.Answer, child, dns.TypeDS); len(set.rrs) > 0 {
+			// The child is a signed zone, so we must be able to validate its keys.
+			if _, err := v.zoneKeys(ctx, child); err != nil {
+				return err
+			}
+			continue
+		}
+		insecure, err := v.provesInsecureDelegation(ctx, reply, child)
+		if err != nil {
+			return err
+		}
+		if insecure {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: unsigned data for %s in a signed zone", ErrDNSSECBogus, name)
+}
+
+// provesInsecureDelegation returns whether the authority section of the
+// reply contains signed NSEC or NSEC3 records proving that child is a
+// delegation without DS records (or it's covered by NSEC3 opt-out).
+func (v *dnssecValidator) provesInsecureDelegation(
+	ctx context.Context, reply *dns.Msg, child string) (bool, error) {
+	for _, set := range dnssecGroupRRsets(reply.Ns) {
+		if set.rrtype != dns.TypeNSEC && set.rrtype != dns.TypeNSEC3 {
+			continue
+		}
+		if len(set.sigs) <= 0 {
+			continue // we cannot trust unsigned denial of existence records
+		}
+		if err := v.verifyRRset(ctx, set); err != nil {
+			return false, err
+		}
+		for _, rr := range set.rrs {
+			switch rr := rr.(type) {
+			case *dns.NSEC:
+				if dnssecEqualNames(rr.Hdr.Name, child) && dnssecIsDelegationWithoutDS(rr.TypeBitMap) {
+					return true, nil
+				}
+			case *dns.NSEC3:
+				if rr.Match(child) && dnssecIsDelegationWithoutDS(rr.TypeBitMap) {
+					return true, nil
+				}
+				if rr.Cover(child) && (rr.Flags&dnssecNSEC3OptOut) != 0 {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// dnssecNSEC3OptOut is the NSEC3 opt-out flag (see RFC5155).
+const dnssecNSEC3OptOut = 1
+
+// dnssecIsDelegationWithoutDS returns whether the NSEC or NSEC3 type bitmap
+// describes a delegation point (i.e., NS but not SOA) without DS records.
+func dnssecIsDelegationWithoutDS(bitmap []uint16) bool {
+	var hasNS, hasSOA, hasDS bool
+	for _, rrtype := range bitmap {
+		switch rrtype {
+		case dns.TypeNS:
+			hasNS = true
+		case dns.TypeSOA:
+			hasSOA = true
+		case dns.TypeDS:
+			hasDS = true
+		}
+	}
+	return hasNS && !hasSOA && !hasDS
+}
+
+// dnssecKeyMatchesDS returns whether key matches any of the DS records.
+func dnssecKeyMatchesDS(key *dns.DNSKEY, dsset []*dns.DS) bool {
+	for _, ds := range dsset {
+		if ds.KeyTag != key.KeyTag() || ds.Algorithm != key.Algorithm {
+			continue
+		}
+		if expect := key.ToDS(ds.DigestType); expect != nil &&
+			strings.EqualFold(expect.Digest, ds.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// dnssecVerifyWithKeys returns whether any of the keys verifies the signature.
+func dnssecVerifyWithKeys(sig *dns.RRSIG, keys []*dns.DNSKEY, rrs []dns.RR) bool {
+	for _, key := range keys {
+		if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+			continue
+		}
+		if sig.Verify(key, rrs) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// dnssecEqualNames returns whether two domain names are equal.
+func dnssecEqualNames(a, b string) bool {
+	return dns.CanonicalName(a) == dns.CanonicalName(b)
+}
+
+// dnssecRRset is an RRset along with the RRSIGs covering it.
+type dnssecRRset struct {
+	// name is the canonical owner name.
+	name string
+
+	// rrtype is the type of the RRs.
+	rrtype uint16
+
+	// rrs contains the RRs.
+	rrs []dns.RR
+
+	// sigs contains the RRSIGs covering the RRs.
+	sigs []*dns.RRSIG
+}
+
+// String returns a string representation of the RRset suitable for errors.
+func (set *dnssecRRset) String() string {
+	return fmt.Sprintf("%s/%s", set.name, dns.TypeToString[set.rrtype])
+}
+
+// dnssecGroupRRsets groups the RRs in a section by owner name and type, and
+// associates each RRSIG to the RRset it covers. RRsets with signatures
+// but without RRs are not included in the returned list.
+func dnssecGroupRRsets(section []dns.RR) (out []*dnssecRRset) {
+	var all []*dnssecRRset
+	index := map[string]*dnssecRRset{}
+	get := func(name string, rrtype uint16) *dnssecRRset {
+		name = dns.CanonicalName(name)
+		key := fmt.Sprintf("%s/%d", name, rrtype)
+		set, found := index[key]
+		if !found {
+			set = &dnssecRRset{name: name, rrtype: rrtype}
+			index[key] = set
+			all = append(all, set)
+		}
+		return set
+	}
+	for _, rr := range section {
+		switch rr := rr.(type) {
+		case *dns.RRSIG:
+			set := get(rr.Hdr.Name, rr.TypeCovered)
+			set.sigs = append(set.sigs, rr)
+		case *dns.OPT:
+			// nothing
+		default:
+			set := get(rr.Header().Name, rr.Header().Rrtype)
+			set.rrs = append(set.rrs, rr)
+		}
+	}
+	for _, set := range all {
+		if len(set.rrs) > 0 {
+			out = append(out, set)
+		}
+	}
+	return
+}
+
+// dnssecFindRRset returns the RRset with the given name and type. If
+// there is no such RRset, we return an empty RRset.
+func dnssecFindRRset(section []dns.RR, name string, rrtype uint16) *dnssecRRset {
+	for _, set := range dnssecGroupRRsets(section) {
+		if set.rrtype == rrtype && dnssecEqualNames(set.name, name) {
+			return set
+		}
+	}
+	return &dnssecRRset{name: dns.CanonicalName(name), rrtype: rrtype}
+}
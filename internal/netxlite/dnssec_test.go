@@ -0,0 +1,521 @@
+package netxlite
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
+)
+
+// dnssecTestHierarchy is a fake signed DNS hierarchy containing the
+// root zone, the signed "example." zone and the "insecure." zone, which
+// is delegated by the root zone without DS records.
+type dnssecTestHierarchy struct {
+	// anchor is the trust anchor for the root zone.
+	anchor []*dns.DS
+
+	// answers maps "name/type" to the answer section.
+	answers map[string][]dns.RR
+
+	// authority maps "name/type" to the authority section.
+	authority map[string][]dns.RR
+
+	// keys maps a zone name to its DNSKEY.
+	keys map[string]*dns.DNSKEY
+
+	// rcodes maps "name/type" to the RCODE (if not NOERROR).
+	rcodes map[string]int
+
+	// signers maps a zone name to its private key.
+	signers map[string]crypto.Signer
+
+	// tamper OPTIONALLY modifies the reply before sending it.
+	tamper func(qname string, qtype uint16, reply *dns.Msg)
+}
+
+func newDNSSECTestHierarchy(t *testing.T) *dnssecTestHierarchy {
+	h := &dnssecTestHierarchy{
+		answers:   map[string][]dns.RR{},
+		authority: map[string][]dns.RR{},
+		keys:      map[string]*dns.DNSKEY{},
+		rcodes:    map[string]int{},
+		signers:   map[string]crypto.Signer{},
+	}
+	for _, zone := range []string{".", "example."} {
+		h.newZoneKey(t, zone)
+		h.answers[h.key(zone, dns.TypeDNSKEY)] = h.sign(t, zone, h.keys[zone])
+	}
+	h.anchor = []*dns.DS{h.keys["."].ToDS(dns.SHA256)}
+	h.answers[h.key("example.", dns.TypeDS)] = h.sign(
+		t, ".", h.keys["example."].ToDS(dns.SHA256))
+	h.authority[h.key("insecure.", dns.TypeDS)] = h.sign(
+		t, ".", h.newRR(t, "insecure. 3600 IN NSEC zzz. NS RRSIG NSEC"))
+	h.answers[h.key("www.example.", dns.TypeA)] = h.sign(
+		t, "example.", h.newRR(t, "www.example. 3600 IN A 93.184.216.34"))
+	nodata := h.sign(t, "example.", h.newRR(t, "www.example. 3600 IN NSEC example. A RRSIG NSEC"))
+	h.authority[h.key("www.example.", dns.TypeAAAA)] = nodata
+	h.authority[h.key("www.example.", dns.TypeHTTPS)] = nodata
+	h.authority[h.key("www.example.", dns.TypeDS)] = nodata
+	nxdomain := h.sign(t, "example.", h.newRR(
+		t, "example. 3600 IN NSEC www.example. NS SOA RRSIG NSEC DNSKEY"))
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeDS} {
+		h.authority[h.key("missing.example.", qtype)] = nxdomain
+		h.rcodes[h.key("missing.example.", qtype)] = dns.RcodeNameError
+	}
+	h.answers[h.key("www.insecure.", dns.TypeA)] = []dns.RR{
+		h.newRR(t, "www.insecure. 3600 IN A 130.192.91.211")}
+	h.authority[h.key("www.insecure.", dns.TypeAAAA)] = []dns.RR{
+		h.newRR(t, "insecure. 3600 IN SOA ns.insecure. root.insecure. 1 2 3 4 5")}
+	return h
+}
+
+// key returns the key used by the answers, authority, and rcodes maps.
+func (h *dnssecTestHierarchy) key(name string, qtype uint16) string {
+	return fmt.Sprintf("%s/%s", dns.CanonicalName(name), dns.TypeToString[qtype])
+}
+
+// newRR parses a RR or fails the test.
+func (h *dnssecTestHierarchy) newRR(t *testing.T, s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+// newZoneKey generates the key of the given zone.
+func (h *dnssecTestHierarchy) newZoneKey(t *testing.T, zone string) {
+	key := &dns.DNSKEY{
+		Hdr: dns.RR_Header{
+			Name:   zone,
+			Rrtype: dns.TypeDNSKEY,
+			Class:  dns.ClassINET,
+			Ttl:    3600,
+		},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.keys[zone] = key
+	h.signers[zone] = priv.(crypto.Signer)
+}
+
+// sign returns the RRset followed by its signature generated by zone.
+func (h *dnssecTestHierarchy) sign(t *testing.T, zone string, rrs ...dns.RR) []dns.RR {
+	now := time.Now()
+	sig := &dns.RRSIG{
+		Algorithm:  dns.ECDSAP256SHA256,
+		Expiration: uint32(now.Add(24 * time.Hour).Unix()),
+		Inception:  uint32(now.Add(-24 * time.Hour).Unix()),
+		KeyTag:     h.keys[zone].KeyTag(),
+		SignerName: zone,
+	}
+	if err := sig.Sign(h.signers[zone], rrs); err != nil {
+		t.Fatal(err)
+	}
+	return append(rrs, sig)
+}
+
+// transport returns a DNSTransport that answers using the hierarchy.
+func (h *dnssecTestHierarchy) transport() *mocks.DNSTransport {
+	return &mocks.DNSTransport{
+		MockRoundTrip: h.roundTrip,
+		MockRequiresPadding: func() bool {
+			return false
+		},
+		MockNetwork: func() string {
+			return "udp"
+		},
+		MockAddress: func() string {
+			return "8.8.8.8:53"
+		},
+		MockCloseIdleConnections: func() {},
+	}
+}
+
+func (h *dnssecTestHierarchy) roundTrip(ctx context.Context, rawQuery []byte) ([]byte, error) {
+	query := &dns.Msg{}
+	if err := query.Unpack(rawQuery); err != nil {
+		return nil, err
+	}
+	if opt := query.IsEdns0(); opt == nil || !opt.Do() {
+		return nil, errors.New("the DO bit is not set")
+	}
+	qname, qtype := query.Question[0].Name, query.Question[0].Qtype
+	key := h.key(qname, qtype)
+	reply := (&dns.Msg{}).SetReply(query)
+	for _, rr := range h.answers[key] {
+		reply.Answer = append(reply.Answer, dns.Copy(rr))
+	}
+	for _, rr := range h.authority[key] {
+		reply.Ns = append(reply.Ns, dns.Copy(rr))
+	}
+	reply.Rcode = h.rcodes[key]
+	if len(reply.Answer) <= 0 && len(reply.Ns) <= 0 {
+		reply.Rcode = dns.RcodeServerFailure // we don't know this name
+	}
+	if h.tamper != nil {
+		h.tamper(qname, qtype, reply)
+	}
+	return reply.Pack()
+}
+
+// newResolver creates a DNSSECResolver using the hierarchy.
+func (h *dnssecTestHierarchy) newResolver() *DNSSECResolver {
+	reso := NewDNSSECResolver(h.transport())
+	reso.TrustAnchor = h.anchor
+	return reso
+}
+
+// dnssecStripSignatures removes the RRSIGs from a section.
+func dnssecStripSignatures(section []dns.RR) (out []dns.RR) {
+	for _, rr := range section {
+		if _, ok := rr.(*dns.RRSIG); !ok {
+			out = append(out, rr)
+		}
+	}
+	return
+}
+
+func TestDNSSECResolver(t *testing.T) {
+	t.Run("NewDNSSECResolver", func(t *testing.T) {
+		txp := &mocks.DNSTransport{}
+		reso := NewDNSSECResolver(txp)
+		if reso.Transport() != txp {
+			t.Fatal("invalid transport")
+		}
+		encoder, ok := reso.Encoder.(*DNSEncoderMiekg)
+		if !ok || !encoder.DNSSEC {
+			t.Fatal("the encoder does not set the DO bit")
+		}
+		if _, ok := reso.Decoder.(*DNSDecoderMiekg); !ok {
+			t.Fatal("invalid decoder")
+		}
+	})
+
+	t.Run("Network, Address, and CloseIdleConnections", func(t *testing.T) {
+		var called bool
+		txp := &mocks.DNSTransport{
+			MockNetwork: func() string {
+				return "udp"
+			},
+			MockAddress: func() string {
+				return "8.8.8.8:53"
+			},
+			MockCloseIdleConnections: func() {
+				called = true
+			},
+		}
+		reso := NewDNSSECResolver(txp)
+		if reso.Network() != "udp" {
+			t.Fatal("invalid network")
+		}
+		if reso.Address() != "8.8.8.8:53" {
+			t.Fatal("invalid address")
+		}
+		reso.CloseIdleConnections()
+		if !called {
+			t.Fatal("not called")
+		}
+	})
+
+	t.Run("LookupHost", func(t *testing.T) {
+		t.Run("with a signed zone", func(t *testing.T) {
+			reso := newDNSSECTestHierarchy(t).newResolver()
+			addrs, err := reso.LookupHost(context.Background(), "www.example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addrs) != 1 || addrs[0] != "93.184.216.34" {
+				t.Fatal("unexpected addrs", addrs)
+			}
+		})
+
+		t.Run("with an insecure zone", func(t *testing.T) {
+			reso := newDNSSECTestHierarchy(t).newResolver()
+			addrs, err := reso.LookupHost(context.Background(), "www.insecure")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addrs) != 1 || addrs[0] != "130.192.91.211" {
+				t.Fatal("unexpected addrs", addrs)
+			}
+		})
+
+		t.Run("with a spoofed signed answer", func(t *testing.T) {
+			h := newDNSSECTestHierarchy(t)
+			h.tamper = func(qname string, qtype uint16, reply *dns.Msg) {
+				for _, rr := range reply.Answer {
+					if a, ok := rr.(*dns.A); ok {
+						a.A = []byte{10, 10, 34, 35}
+					}
+				}
+			}
+			addrs, err := h.newResolver().LookupHost(context.Background(), "www.example")
+			if !errors.Is(err, ErrDNSSECBogus) {
+				t.Fatal("unexpected err", err)
+			}
+			if addrs != nil {
+				t.Fatal("expected nil addrs")
+			}
+		})
+
+		t.Run("with a spoofed unsigned answer", func(t *testing.T) {
+			h := newDNSSECTestHierarchy(t)
+			h.tamper = func(qname string, qtype uint16, reply *dns.Msg) {
+				if qtype == dns.TypeA {
+					reply.Answer = dnssecStripSignatures(reply.Answer)
+				}
+			}
+			addrs, err := h.newResolver().LookupHost(context.Background(), "www.example")
+			if !errors.Is(err, ErrDNSSECBogus) {
+				t.Fatal("unexpected err", err)
+			}
+			if addrs != nil {
+				t.Fatal("expected nil addrs")
+			}
+		})
+
+		t.Run("with a spoofed DS denial for the signed zone", func(t *testing.T) {
+			h := newDNSSECTestHierarchy(t)
+			h.tamper = func(qname string, qtype uint16, reply *dns.Msg) {
+				if qtype == dns.TypeA {
+					reply.Answer = dnssecStripSignatures(reply.Answer)
+				}
+				if qtype == dns.TypeDS && qname == "example." {
+					reply.Answer = nil
+					reply.Ns = []dns.RR{&dns.NSEC{
+						Hdr: dns.RR_Header{
+							Name:   "example.",
+							Rrtype: dns.TypeNSEC,
+							Class:  dns.ClassINET,
+							Ttl:    3600,
+						},
+						NextDomain: "zzz.",
+						TypeBitMap: []uint16{dns.TypeNS, dns.TypeNSEC},
+					}}
+				}
+			}
+			_, err := h.newResolver().LookupHost(context.Background(), "www.example")
+			if !errors.Is(err, ErrDNSSECBogus) {
+				t.Fatal("unexpected err", err)
+			}
+		})
+
+		t.Run("with expired signatures", func(t *testing.T) {
+			reso := newDNSSECTestHierarchy(t).newResolver()
+			reso.TimeNow = func() time.Time {
+				return time.Now().Add(48 * time.Hour)
+			}
+			_, err := reso.LookupHost(context.Background(), "www.example")
+			if !errors.Is(err, ErrDNSSECBogus) {
+				t.Fatal("unexpected err", err)
+			}
+		})
+
+		t.Run("with another trust anchor", func(t *testing.T) {
+			reso := newDNSSECTestHierarchy(t).newResolver()
+			reso.TrustAnchor = newDNSSECTestHierarchy(t).anchor
+			_, err := reso.LookupHost(context.Background(), "www.example")
+			if !errors.Is(err, ErrDNSSECBogus) {
+				t.Fatal("unexpected err", err)
+			}
+		})
+
+		t.Run("with the default trust anchor", func(t *testing.T) {
+			reso := newDNSSECTestHierarchy(t).newResolver()
+			reso.TrustAnchor = nil
+			_, err := reso.LookupHost(context.Background(), "www.example")
+			if !errors.Is(err, ErrDNSSECBogus) {
+				t.Fatal("unexpected err", err)
+			}
+		})
+
+		t.Run("with signed NXDOMAIN", func(t *testing.T) {
+			reso := newDNSSECTestHierarchy(t).newResolver()
+			addrs, err := reso.LookupHost(context.Background(), "missing.example")
+			if !errors.Is(err, ErrOODNSNoSuchHost) {
+				t.Fatal("unexpected err", err)
+			}
+			if addrs != nil {
+				t.Fatal("expected nil addrs")
+			}
+		})
+
+		t.Run("with unsigned NXDOMAIN", func(t *testing.T) {
+			h := newDNSSECTestHierarchy(t)
+			h.tamper = func(qname string, qtype uint16, reply *dns.Msg) {
+				if qname == "missing.example." {
+					reply.Ns = dnssecStripSignatures(reply.Ns)
+				}
+			}
+			_, err := h.newResolver().LookupHost(context.Background(), "missing.example")
+			if !errors.Is(err, ErrDNSSECBogus) {
+				t.Fatal("unexpected err", err)
+			}
+		})
+
+		t.Run("with transport failure", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			txp := &mocks.DNSTransport{
+				MockRoundTrip: func(ctx context.Context, query []byte) ([]byte, error) {
+					return nil, expected
+				},
+				MockRequiresPadding: func() bool {
+					return false
+				},
+			}
+			addrs, err := NewDNSSECResolver(txp).LookupHost(context.Background(), "www.example")
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if addrs != nil {
+				t.Fatal("expected nil addrs")
+			}
+		})
+
+		t.Run("with transport failure while following the chain", func(t *testing.T) {
+			h := newDNSSECTestHierarchy(t)
+			expected := errors.New("mocked error")
+			txp := h.transport()
+			txp.MockRoundTrip = func(ctx context.Context, query []byte) ([]byte, error) {
+				msg := &dns.Msg{}
+				if err := msg.Unpack(query); err != nil {
+					return nil, err
+				}
+				if msg.Question[0].Qtype == dns.TypeDNSKEY {
+					return nil, expected
+				}
+				return h.roundTrip(ctx, query)
+			}
+			reso := NewDNSSECResolver(txp)
+			reso.TrustAnchor = h.anchor
+			_, err := reso.LookupHost(context.Background(), "www.example")
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+		})
+
+		t.Run("with a server failure", func(t *testing.T) {
+			reso := newDNSSECTestHierarchy(t).newResolver()
+			_, err := reso.LookupHost(context.Background(), "www.antani")
+			if !errors.Is(err, ErrOODNSMisbehaving) {
+				t.Fatal("unexpected err", err)
+			}
+		})
+
+		t.Run("is classified as dns_dnssec_bogus", func(t *testing.T) {
+			h := newDNSSECTestHierarchy(t)
+			h.tamper = func(qname string, qtype uint16, reply *dns.Msg) {
+				reply.Answer = dnssecStripSignatures(reply.Answer)
+			}
+			reso := WrapResolver(log.Log, h.newResolver())
+			_, err := reso.LookupHost(context.Background(), "www.example")
+			if err == nil || err.Error() != FailureDNSDNSSECBogus {
+				t.Fatal("unexpected err", err)
+			}
+		})
+	})
+
+	t.Run("LookupHTTPS", func(t *testing.T) {
+		t.Run("with signed NODATA", func(t *testing.T) {
+			reso := newDNSSECTestHierarchy(t).newResolver()
+			https, err := reso.LookupHTTPS(context.Background(), "www.example")
+			if !errors.Is(err, ErrOODNSNoAnswer) {
+				t.Fatal("unexpected err", err)
+			}
+			if https != nil {
+				t.Fatal("expected nil https")
+			}
+		})
+
+		t.Run("with unsigned NODATA", func(t *testing.T) {
+			h := newDNSSECTestHierarchy(t)
+			h.tamper = func(qname string, qtype uint16, reply *dns.Msg) {
+				if qtype == dns.TypeHTTPS {
+					reply.Ns = dnssecStripSignatures(reply.Ns)
+				}
+			}
+			_, err := h.newResolver().LookupHTTPS(context.Background(), "www.example")
+			if !errors.Is(err, ErrDNSSECBogus) {
+				t.Fatal("unexpected err", err)
+			}
+		})
+	})
+
+	t.Run("LookupRaw", func(t *testing.T) {
+		t.Run("with success", func(t *testing.T) {
+			reso := newDNSSECTestHierarchy(t).newResolver()
+			reply, err := reso.LookupRaw(context.Background(), "www.example", dns.TypeA)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var found bool
+			for _, rr := range reply.Answer {
+				found = found || (rr.Type == "A" && rr.Data == "93.184.216.34")
+			}
+			if !found {
+				t.Fatal("did not find the A record")
+			}
+		})
+
+		t.Run("with the DNSKEY of a signed zone", func(t *testing.T) {
+			reso := newDNSSECTestHierarchy(t).newResolver()
+			reply, err := reso.LookupRaw(context.Background(), "example", dns.TypeDNSKEY)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(reply.Answer) != 2 {
+				t.Fatal("expected the DNSKEY and its RRSIG")
+			}
+		})
+
+		t.Run("with failure", func(t *testing.T) {
+			h := newDNSSECTestHierarchy(t)
+			h.tamper = func(qname string, qtype uint16, reply *dns.Msg) {
+				reply.Answer = dnssecStripSignatures(reply.Answer)
+			}
+			reply, err := h.newResolver().LookupRaw(context.Background(), "www.example", dns.TypeA)
+			if !errors.Is(err, ErrDNSSECBogus) {
+				t.Fatal("unexpected err", err)
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply")
+			}
+		})
+	})
+}
+
+func TestDNSSECIsDelegationWithoutDS(t *testing.T) {
+	var inputs = []struct {
+		bitmap []uint16
+		expect bool
+	}{{
+		bitmap: []uint16{dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC},
+		expect: true,
+	}, {
+		bitmap: []uint16{dns.TypeNS, dns.TypeDS, dns.TypeRRSIG, dns.TypeNSEC},
+		expect: false,
+	}, {
+		bitmap: []uint16{dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeNSEC},
+		expect: false,
+	}, {
+		bitmap: []uint16{dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC},
+		expect: false,
+	}}
+	for _, input := range inputs {
+		if dnssecIsDelegationWithoutDS(input.bitmap) != input.expect {
+			t.Fatal("unexpected result for", input.bitmap)
+		}
+	}
+}
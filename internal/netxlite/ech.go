@@ -0,0 +1,182 @@
+package netxlite
+
+//
+// Encrypted ClientHello (ECH)
+//
+// We parse the ECHConfigList advertised by HTTPS records (see
+// draft-ietf-tls-esni-13) and we allow to plug in an actual ECH
+// implementation to perform ECH handshakes.
+//
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// ECHConfigVersionDraft13 is the ECHConfig version used by
+// draft-ietf-tls-esni-13 and following drafts.
+const ECHConfigVersionDraft13 = 0xfe0d
+
+// ECHCipherSuite is an HPKE symmetric cipher suite.
+type ECHCipherSuite struct {
+	// KDFID is the HPKE KDF identifier.
+	KDFID uint16
+
+	// AEADID is the HPKE AEAD identifier.
+	AEADID uint16
+}
+
+// ECHConfig is a parsed ECHConfig.
+type ECHConfig struct {
+	// Version is the ECHConfig version.
+	Version uint16
+
+	// ConfigID is the config identifier.
+	ConfigID uint8
+
+	// KEMID is the HPKE KEM identifier.
+	KEMID uint16
+
+	// PublicKey is the HPKE public key.
+	PublicKey []byte
+
+	// CipherSuites contains the HPKE cipher suites.
+	CipherSuites []ECHCipherSuite
+
+	// MaximumNameLength is the maximum length of the inner SNI.
+	MaximumNameLength uint8
+
+	// PublicName is the SNI used by the outer ClientHello.
+	PublicName string
+
+	// Raw is the raw ECHConfig, including version and length. We only
+	// fill the other fields when we know the Version.
+	Raw []byte
+}
+
+// ErrInvalidECHConfigList indicates that we cannot parse an ECHConfigList.
+var ErrInvalidECHConfigList = errors.New("netxlite: invalid ECHConfigList")
+
+// ParseECHConfigList parses the ECHConfigList contained by the
+// "ech" SvcParam of an HTTPS record. We return all the ECHConfigs
+// including the ones with an unknown version, for which we only
+// fill the Version and Raw fields.
+func ParseECHConfigList(data []byte) ([]*ECHConfig, error) {
+	if len(data) < 2 || int(binary.BigEndian.Uint16(data)) != len(data)-2 {
+		return nil, ErrInvalidECHConfigList
+	}
+	var out []*ECHConfig
+	for b := data[2:]; len(b) > 0; {
+		if len(b) < 4 {
+			return nil, ErrInvalidECHConfigList
+		}
+		length := 4 + int(binary.BigEndian.Uint16(b[2:4]))
+		if length > len(b) {
+			return nil, ErrInvalidECHConfigList
+		}
+		config := &ECHConfig{
+			Version: binary.BigEndian.Uint16(b),
+			Raw:     b[:length],
+		}
+		if config.Version == ECHConfigVersionDraft13 {
+			if err := config.parseContents(b[4:length]); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, config)
+		b = b[length:]
+	}
+	if len(out) <= 0 {
+		return nil, ErrInvalidECHConfigList
+	}
+	return out, nil
+}
+
+// parseContents parses the ECHConfigContents.
+func (c *ECHConfig) parseContents(b []byte) error {
+	if len(b) < 3 {
+		return ErrInvalidECHConfigList
+	}
+	c.ConfigID = b[0]
+	c.KEMID = binary.BigEndian.Uint16(b[1:3])
+	b = b[3:]
+	var (
+		suites []byte
+		name   []byte
+		ok     bool
+	)
+	if c.PublicKey, b, ok = echReadVector(b, 2); !ok || len(c.PublicKey) <= 0 {
+		return ErrInvalidECHConfigList
+	}
+	if suites, b, ok = echReadVector(b, 2); !ok || len(suites) <= 0 || len(suites)%4 != 0 {
+		return ErrInvalidECHConfigList
+	}
+	for ; len(suites) > 0; suites = suites[4:] {
+		c.CipherSuites = append(c.CipherSuites, ECHCipherSuite{
+			KDFID:  binary.BigEndian.Uint16(suites[0:2]),
+			AEADID: binary.BigEndian.Uint16(suites[2:4]),
+		})
+	}
+	if len(b) < 1 {
+		return ErrInvalidECHConfigList
+	}
+	c.MaximumNameLength = b[0]
+	if name, b, ok = echReadVector(b[1:], 1); !ok || len(name) <= 0 {
+		return ErrInvalidECHConfigList
+	}
+	c.PublicName = string(name)
+	if _, b, ok = echReadVector(b, 2); !ok || len(b) != 0 {
+		return ErrInvalidECHConfigList // extensions vector or trailing data
+	}
+	return nil
+}
+
+// echReadVector reads a vector with the given length size from b and
+// returns the vector, the remainder of b, and whether it succeeded.
+func echReadVector(b []byte, lengthSize int) ([]byte, []byte, bool) {
+	off, err := tlsSkipVector(b, 0, lengthSize)
+	if err != nil {
+		return nil, nil, false
+	}
+	return b[lengthSize:off], b[off:], true
+}
+
+// ECHHandshaker performs TLS handshakes using Encrypted ClientHello. We
+// do not implement ECH ourselves, so you need to plug in an implementation
+// (e.g., one based on a fork of crypto/tls) to perform ECH handshakes.
+type ECHHandshaker interface {
+	// HandshakeECH is like model.TLSHandshaker.Handshake except that it
+	// encrypts the ClientHello using one of the given ECHConfigs. The
+	// config.ServerName is the SNI of the inner ClientHello.
+	HandshakeECH(ctx context.Context, conn net.Conn, config *tls.Config,
+		echConfigList []byte) (net.Conn, tls.ConnectionState, error)
+}
+
+// NewTLSHandshakerECH creates a new TLSHandshaker using the given
+// ECHHandshaker and ECHConfigList, so that you can use an ECHHandshaker
+// wherever we expect a model.TLSHandshaker (e.g., in measurex). The
+// returned handshaker logs and wraps errors like the other handshakers.
+func NewTLSHandshakerECH(logger model.DebugLogger,
+	handshaker ECHHandshaker, echConfigList []byte) model.TLSHandshaker {
+	return newTLSHandshaker(&tlsHandshakerECH{
+		handshaker:    handshaker,
+		echConfigList: echConfigList,
+	}, logger)
+}
+
+// tlsHandshakerECH adapts an ECHHandshaker to model.TLSHandshaker.
+type tlsHandshakerECH struct {
+	handshaker    ECHHandshaker
+	echConfigList []byte
+}
+
+// Handshake implements model.TLSHandshaker.Handshake.
+func (h *tlsHandshakerECH) Handshake(ctx context.Context,
+	conn net.Conn, config *tls.Config) (net.Conn, tls.ConnectionState, error) {
+	return h.handshaker.HandshakeECH(ctx, conn, config, h.echConfigList)
+}
@@ -0,0 +1,199 @@
+package netxlite
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+)
+
+// echGenConfig generates a draft-13 ECHConfig with the given public name.
+func echGenConfig(configID uint8, publicName string) []byte {
+	contents := []byte{configID, 0x00, 0x20}            // config_id, DHKEM(X25519, HKDF-SHA256)
+	contents = append(contents, 0x00, 0x04)             // public_key length
+	contents = append(contents, 1, 2, 3, 4)             // public_key
+	contents = append(contents, 0x00, 0x08)             // cipher_suites length
+	contents = append(contents, 0x00, 0x01, 0x00, 0x01) // HKDF-SHA256, AES-128-GCM
+	contents = append(contents, 0x00, 0x01, 0x00, 0x03) // HKDF-SHA256, ChaCha20Poly1305
+	contents = append(contents, 0x00)                   // maximum_name_length
+	contents = append(contents, byte(len(publicName)))
+	contents = append(contents, publicName...)
+	contents = append(contents, 0x00, 0x00) // extensions
+	return echGenEntry(ECHConfigVersionDraft13, contents)
+}
+
+// echGenEntry generates an ECHConfig with the given version and contents.
+func echGenEntry(version uint16, contents []byte) []byte {
+	out := make([]byte, 4, 4+len(contents))
+	binary.BigEndian.PutUint16(out, version)
+	binary.BigEndian.PutUint16(out[2:], uint16(len(contents)))
+	return append(out, contents...)
+}
+
+// echGenList generates an ECHConfigList containing the given configs.
+func echGenList(configs ...[]byte) []byte {
+	out := make([]byte, 2)
+	for _, config := range configs {
+		out = append(out, config...)
+	}
+	binary.BigEndian.PutUint16(out, uint16(len(out)-2))
+	return out
+}
+
+func TestParseECHConfigList(t *testing.T) {
+	t.Run("with valid input", func(t *testing.T) {
+		first := echGenConfig(7, "cover.example.com")
+		second := echGenEntry(0xfe0a, []byte{1, 2, 3})
+		configs, err := ParseECHConfigList(echGenList(first, second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []*ECHConfig{{
+			Version:   ECHConfigVersionDraft13,
+			ConfigID:  7,
+			KEMID:     0x0020,
+			PublicKey: []byte{1, 2, 3, 4},
+			CipherSuites: []ECHCipherSuite{{
+				KDFID:  0x0001,
+				AEADID: 0x0001,
+			}, {
+				KDFID:  0x0001,
+				AEADID: 0x0003,
+			}},
+			MaximumNameLength: 0,
+			PublicName:        "cover.example.com",
+			Raw:               first,
+		}, {
+			Version: 0xfe0a,
+			Raw:     second,
+		}}
+		if diff := cmp.Diff(expected, configs); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with invalid input", func(t *testing.T) {
+		valid := echGenConfig(7, "cover.example.com")
+		contents := valid[4:]
+		inputs := map[string][]byte{
+			"nil":                  nil,
+			"empty list":           {0x00, 0x00},
+			"wrong list length":    append(echGenList(valid), 0x00),
+			"truncated header":     echGenList([]byte{0xfe, 0x0d, 0x00}),
+			"truncated config":     echGenList(valid[:len(valid)-1]),
+			"too short contents":   echGenList(echGenEntry(ECHConfigVersionDraft13, contents[:2])),
+			"empty public key":     echGenList(echGenEntry(ECHConfigVersionDraft13, []byte{7, 0x00, 0x20, 0x00, 0x00})),
+			"bad suites length":    echGenList(echGenEntry(ECHConfigVersionDraft13, append(append([]byte{}, contents[:9]...), 0x00, 0x03))),
+			"missing max name len": echGenList(echGenEntry(ECHConfigVersionDraft13, contents[:19])),
+			"empty public name":    echGenList(echGenEntry(ECHConfigVersionDraft13, append(append([]byte{}, contents[:20]...), 0x00, 0x00, 0x00))),
+			"missing extensions":   echGenList(echGenEntry(ECHConfigVersionDraft13, contents[:len(contents)-2])),
+			"trailing data":        echGenList(echGenEntry(ECHConfigVersionDraft13, append(append([]byte{}, contents...), 0x00))),
+		}
+		for name, input := range inputs {
+			configs, err := ParseECHConfigList(input)
+			if !errors.Is(err, ErrInvalidECHConfigList) {
+				t.Fatal(name, "not the error we expected", err)
+			}
+			if configs != nil {
+				t.Fatal(name, "expected nil configs")
+			}
+		}
+	})
+}
+
+// echStandInHandshaker is a stand-in ECHHandshaker. It does not
+// encrypt the ClientHello but uses the public name as the outer SNI
+// like an ECH client would do, so we can check how NewTLSHandshakerECH
+// passes its arguments to the underlying ECHHandshaker.
+type echStandInHandshaker struct {
+	echConfigList []byte
+	innerSNI      string
+}
+
+func (h *echStandInHandshaker) HandshakeECH(ctx context.Context, conn net.Conn,
+	config *tls.Config, echConfigList []byte) (net.Conn, tls.ConnectionState, error) {
+	h.echConfigList = echConfigList
+	h.innerSNI = config.ServerName
+	configs, err := ParseECHConfigList(echConfigList)
+	if err != nil {
+		return nil, tls.ConnectionState{}, err
+	}
+	config = config.Clone()
+	config.ServerName = configs[0].PublicName
+	return NewTLSHandshakerStdlib(log.Log).Handshake(ctx, conn, config)
+}
+
+func TestNewTLSHandshakerECH(t *testing.T) {
+	var outerSNI string
+	srvr := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, r *http.Request) {}))
+	srvr.TLS = &tls.Config{
+		GetConfigForClient: func(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+			outerSNI = chi.ServerName
+			return nil, nil
+		},
+	}
+	srvr.StartTLS()
+	defer srvr.Close()
+	URL, err := url.Parse(srvr.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("on success", func(t *testing.T) {
+		conn, err := net.Dial("tcp", URL.Host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ech := echGenList(echGenConfig(1, "cover.example.com"))
+		stand := &echStandInHandshaker{}
+		handshaker := NewTLSHandshakerECH(log.Log, stand, ech)
+		config := &tls.Config{
+			InsecureSkipVerify: true,
+			ServerName:         "secret.example.com",
+		}
+		tlsConn, _, err := handshaker.Handshake(context.Background(), conn, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tlsConn.Close()
+		if diff := cmp.Diff(ech, stand.echConfigList); diff != "" {
+			t.Fatal(diff)
+		}
+		if stand.innerSNI != "secret.example.com" {
+			t.Fatal("unexpected inner SNI", stand.innerSNI)
+		}
+		if outerSNI != "cover.example.com" {
+			t.Fatal("unexpected outer SNI", outerSNI)
+		}
+	})
+
+	t.Run("on failure", func(t *testing.T) {
+		conn, err := net.Dial("tcp", URL.Host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		handshaker := NewTLSHandshakerECH(log.Log, &echStandInHandshaker{}, nil)
+		config := &tls.Config{InsecureSkipVerify: true}
+		tlsConn, _, err := handshaker.Handshake(context.Background(), conn, config)
+		var errWrapper *ErrWrapper
+		if !errors.As(err, &errWrapper) || !errors.Is(err, ErrInvalidECHConfigList) {
+			t.Fatal("not the error we expected", err)
+		}
+		if errWrapper.Operation != TLSHandshakeOperation {
+			t.Fatal("unexpected operation", errWrapper.Operation)
+		}
+		if tlsConn != nil {
+			t.Fatal("expected nil conn")
+		}
+	})
+}
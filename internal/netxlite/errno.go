@@ -1,5 +1,5 @@
 // Code generated by go generate; DO NOT EDIT.
-// Generated: 2022-01-24 12:46:26.278434 +0100 CET m=+0.682175209
+// Generated: 2026-10-16 15:26:28.620234999 +0000 UTC m=+0.831075815
 
 package netxlite
 
@@ -21,6 +21,7 @@ const (
 	FailureConnectionRefused           = "connection_refused"
 	FailureConnectionReset             = "connection_reset"
 	FailureDNSBogonError               = "dns_bogon_error"
+	FailureDNSDNSSECBogus              = "dns_dnssec_bogus"
 	FailureDNSNXDOMAINError            = "dns_nxdomain_error"
 	FailureDNSNoAnswer                 = "dns_no_answer"
 	FailureDNSNonRecoverableFailure    = "dns_non_recoverable_failure"
@@ -70,6 +71,7 @@ var failuresMap = map[string]string{
 	"connection_reset":               "connection_reset",
 	"destination_address_required":   "destination_address_required",
 	"dns_bogon_error":                "dns_bogon_error",
+	"dns_dnssec_bogus":               "dns_dnssec_bogus",
 	"dns_no_answer":                  "dns_no_answer",
 	"dns_non_recoverable_failure":    "dns_non_recoverable_failure",
 	"dns_nxdomain_error":             "dns_nxdomain_error",
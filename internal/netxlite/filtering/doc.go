@@ -10,4 +10,13 @@
 // The typical usage of this package's functionality is to
 // load a censoring policy into TProxyConfig and then to create
 // and start a TProxy instance using NewTProxy.
+//
+// TProxy can also throttle the traffic of TCP/UDP endpoints or of TLS
+// and QUIC SNIs using bandwidth, latency, jitter, and loss rules (see
+// ThrottlingPolicy). For example, to check whether ndt7, dash, and
+// web_connectivity detect throttling, you can run
+//
+//	miniooni --censor internal/netxlite/filtering/testdata/throttling.json ndt7
+//
+// from the repository root, where throttling.json contains throttling rules.
 package filtering
@@ -0,0 +1,288 @@
+package filtering
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// QUICAction is a QUIC filtering action that TProxy should take.
+type QUICAction string
+
+const (
+	// QUICActionPass passes the traffic to the destination.
+	QUICActionPass = QUICAction("pass")
+
+	// QUICActionDrop silently drops all the datagrams of the flow.
+	QUICActionDrop = QUICAction("drop")
+
+	// QUICActionICMPUnreachable simulates receiving an ICMP port
+	// unreachable message, which causes the socket to fail with
+	// ECONNREFUSED when the client attempts to send data.
+	QUICActionICMPUnreachable = QUICAction("icmp-unreachable")
+
+	// QUICActionRateLimit polices the flow such that we drop all
+	// the datagrams that exceed the configured RateLimit.
+	QUICActionRateLimit = QUICAction("rate-limit")
+)
+
+// errQUICNotClientInitial indicates that a datagram does
+// not start with a QUIC client Initial packet.
+var errQUICNotClientInitial = errors.New("filtering: not a QUIC client Initial")
+
+// errQUICMalformedInitial indicates that we cannot parse
+// or decrypt a QUIC client Initial packet.
+var errQUICMalformedInitial = errors.New("filtering: malformed QUIC Initial")
+
+// errQUICNoSNI indicates that the ClientHello does not contain an SNI.
+var errQUICNoSNI = errors.New("filtering: no SNI in QUIC ClientHello")
+
+// quicInitialSalts maps the QUIC versions we know how to parse
+// to the salt used to derive the Initial secrets.
+var quicInitialSalts = map[uint32][]byte{
+	// QUIC v1 (RFC 9001, Sect. 5.2)
+	0x00000001: {
+		0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+		0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+	},
+	// draft-29 (draft-ietf-quic-tls-29, Sect. 5.2)
+	0xff00001d: {
+		0xaf, 0xbf, 0xec, 0x28, 0x99, 0x93, 0xd2, 0x4c, 0x9e, 0x97,
+		0x86, 0xf1, 0x9c, 0x61, 0x11, 0xe0, 0x43, 0x90, 0xa8, 0x99,
+	},
+}
+
+// quicParseClientInitialSNI returns the SNI contained in the ClientHello
+// carried by the QUIC client Initial packet at the beginning of the
+// given datagram. This function does not modify the datagram. We can
+// only see the SNI if the first Initial packet contains it, which is
+// the case for the ClientHello of most clients.
+func quicParseClientInitialSNI(datagram []byte) (string, error) {
+	payload, err := quicDecryptClientInitial(datagram)
+	if err != nil {
+		return "", err
+	}
+	hello, err := quicReassembleCrypto(payload)
+	if err != nil {
+		return "", err
+	}
+	return tlsParseClientHelloSNI(hello)
+}
+
+// quicDecryptClientInitial removes header protection from the client
+// Initial packet at the beginning of the datagram and returns its
+// decrypted payload (see RFC 9001, Sect. 5).
+func quicDecryptClientInitial(datagram []byte) ([]byte, error) {
+	r := &quicReader{buf: datagram}
+	first := r.byte()
+	if first&0x80 == 0 || first&0x30 != 0 { // long header, Initial type
+		return nil, errQUICNotClientInitial
+	}
+	salt, found := quicInitialSalts[binary.BigEndian.Uint32(r.bytes(4))]
+	if r.err != nil || !found {
+		return nil, errQUICNotClientInitial
+	}
+	dcid := r.bytes(int(r.byte()))
+	r.bytes(int(r.byte()))   // source connection ID
+	r.bytes(int(r.varint())) // token
+	length := int(r.varint())
+	if r.err != nil {
+		return nil, errQUICMalformedInitial
+	}
+	pnOffset := r.off
+	if length < 20 || pnOffset+length > len(datagram) {
+		return nil, errQUICMalformedInitial
+	}
+	secret := quicHKDFExpandLabel(quicHKDFExtract(salt, dcid), "client in", 32)
+	key := quicHKDFExpandLabel(secret, "quic key", 16)
+	iv := quicHKDFExpandLabel(secret, "quic iv", 12)
+	hp := quicHKDFExpandLabel(secret, "quic hp", 16)
+	hpBlock, err := aes.NewCipher(hp)
+	if err != nil {
+		return nil, err
+	}
+	mask := make([]byte, aes.BlockSize)
+	hpBlock.Encrypt(mask, datagram[pnOffset+4:pnOffset+4+aes.BlockSize])
+	header := append([]byte{}, datagram[:pnOffset+4]...)
+	header[0] ^= mask[0] & 0x0f
+	pnLen := int(header[0]&0x03) + 1
+	header = header[:pnOffset+pnLen]
+	nonce := append([]byte{}, iv...)
+	for idx := 0; idx < pnLen; idx++ {
+		header[pnOffset+idx] ^= mask[1+idx]
+		nonce[len(nonce)-pnLen+idx] ^= header[pnOffset+idx]
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := aead.Open(nil, nonce, datagram[pnOffset+pnLen:pnOffset+length], header)
+	if err != nil {
+		return nil, errQUICMalformedInitial
+	}
+	return payload, nil
+}
+
+// quicReassembleCrypto parses the frames inside a decrypted Initial
+// payload and returns the CRYPTO stream bytes starting at offset zero. Some
+// clients (e.g., Chrome) shuffle CRYPTO frames, so we sort them.
+func quicReassembleCrypto(payload []byte) ([]byte, error) {
+	type cryptoFrame struct {
+		offset int
+		data   []byte
+	}
+	var frames []cryptoFrame
+	r := &quicReader{buf: payload}
+	for r.err == nil && r.off < len(payload) {
+		switch frameType := r.varint(); frameType {
+		case 0x00, 0x01: // PADDING, PING
+		case 0x02, 0x03: // ACK
+			r.varint() // largest acknowledged
+			r.varint() // ACK delay
+			count := r.varint()
+			r.varint() // first ACK range
+			for idx := uint64(0); r.err == nil && idx < count; idx++ {
+				r.varint() // gap
+				r.varint() // ACK range length
+			}
+			if frameType == 0x03 {
+				r.varint() // ECT0
+				r.varint() // ECT1
+				r.varint() // ECN-CE
+			}
+		case 0x06: // CRYPTO
+			offset := int(r.varint())
+			data := r.bytes(int(r.varint()))
+			frames = append(frames, cryptoFrame{offset: offset, data: data})
+		case 0x1c: // CONNECTION_CLOSE
+			r.varint() // error code
+			r.varint() // frame type
+			r.bytes(int(r.varint()))
+		default:
+			return nil, errQUICMalformedInitial
+		}
+	}
+	if r.err != nil {
+		return nil, errQUICMalformedInitial
+	}
+	sort.SliceStable(frames, func(i, j int) bool {
+		return frames[i].offset < frames[j].offset
+	})
+	var stream []byte
+	for _, frame := range frames {
+		if frame.offset > len(stream) {
+			break // there's a gap in the stream
+		}
+		if end := frame.offset + len(frame.data); end > len(stream) {
+			stream = append(stream, frame.data[len(stream)-frame.offset:]...)
+		}
+	}
+	return stream, nil
+}
+
+// tlsParseClientHelloSNI returns the SNI contained in a raw ClientHello
+// handshake message. The message may be truncated, provided that the
+// truncation occurs after the server_name extension.
+func tlsParseClientHelloSNI(hello []byte) (string, error) {
+	r := &quicReader{buf: hello}
+	if r.byte() != 0x01 { // client_hello
+		return "", errQUICMalformedInitial
+	}
+	r.bytes(3)               // length
+	r.bytes(2)               // legacy_version
+	r.bytes(32)              // random
+	r.bytes(int(r.byte()))   // legacy_session_id
+	r.bytes(int(r.uint16())) // cipher_suites
+	r.bytes(int(r.byte()))   // legacy_compression_methods
+	r.uint16()               // extensions length
+	for r.err == nil {
+		extType := r.uint16()
+		ext := &quicReader{buf: r.bytes(int(r.uint16()))}
+		if r.err != nil || extType != 0x0000 { // server_name
+			continue
+		}
+		ext.uint16() // server_name_list length
+		for ext.err == nil {
+			nameType := ext.byte()
+			name := ext.bytes(int(ext.uint16()))
+			if ext.err == nil && nameType == 0x00 { // host_name
+				return string(name), nil
+			}
+		}
+		return "", errQUICMalformedInitial
+	}
+	return "", errQUICNoSNI
+}
+
+// quicReader reads QUIC and TLS wire format data. The first error
+// is sticky and causes all the subsequent reads to return zero values.
+type quicReader struct {
+	buf []byte
+	err error
+	off int
+}
+
+// bytes returns the next count bytes.
+func (r *quicReader) bytes(count int) []byte {
+	if r.err != nil || count < 0 || count > len(r.buf)-r.off {
+		r.err = errQUICMalformedInitial
+		return nil
+	}
+	out := r.buf[r.off : r.off+count]
+	r.off += count
+	return out
+}
+
+// byte returns the next byte.
+func (r *quicReader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// uint16 returns the next big endian uint16.
+func (r *quicReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+// varint returns the next QUIC variable-length integer (RFC 9000, Sect. 16).
+func (r *quicReader) varint() uint64 {
+	first := r.byte()
+	value := uint64(first & 0x3f)
+	for _, b := range r.bytes((1 << (first >> 6)) - 1) {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+// quicHKDFExtract implements HKDF-Extract using SHA-256 (RFC 5869).
+func quicHKDFExtract(salt, secret []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+// quicHKDFExpandLabel implements the TLS 1.3 HKDF-Expand-Label function
+// using SHA-256 and an empty context (RFC 8446, Sect. 7.1). We only
+// support outputs of up to 32 bytes, which is all QUIC Initial needs.
+func quicHKDFExpandLabel(secret []byte, label string, length int) []byte {
+	label = "tls13 " + label
+	info := []byte{byte(length >> 8), byte(length), byte(len(label))}
+	info = append(info, label...)
+	info = append(info, 0, 1) // empty context, HKDF-Expand counter
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(info)
+	return mac.Sum(nil)[:length]
+}
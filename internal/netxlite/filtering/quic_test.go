@@ -0,0 +1,205 @@
+package filtering
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+// quicCaptureClientInitial uses quic-go to send a client Initial for the
+// given SNI and QUIC version to a local UDP socket and returns the
+// first datagram we receive, which contains the client Initial.
+func quicCaptureClientInitial(t *testing.T, sni string, version quic.VersionNumber) []byte {
+	pconn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pconn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan interface{})
+	go func() {
+		defer close(done)
+		tlsConfig := &tls.Config{ServerName: sni, NextProtos: []string{"h3"}}
+		quicConfig := &quic.Config{Versions: []quic.VersionNumber{version}}
+		quic.DialAddrEarlyContext(ctx, pconn.LocalAddr().String(), tlsConfig, quicConfig)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	buffer := make([]byte, 1<<14)
+	pconn.SetDeadline(time.Now().Add(10 * time.Second))
+	count, _, err := pconn.ReadFrom(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer[:count]
+}
+
+func TestQUICParseClientInitialSNI(t *testing.T) {
+	for _, version := range []quic.VersionNumber{quic.Version1, quic.VersionDraft29} {
+		t.Run(version.String(), func(t *testing.T) {
+			datagram := quicCaptureClientInitial(t, "dns.google", version)
+			original := append([]byte{}, datagram...)
+			sni, err := quicParseClientInitialSNI(datagram)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sni != "dns.google" {
+				t.Fatal("unexpected SNI", sni)
+			}
+			if string(original) != string(datagram) {
+				t.Fatal("the datagram has been modified")
+			}
+		})
+	}
+
+	datagram := quicCaptureClientInitial(t, "dns.google", quic.Version1)
+
+	t.Run("with an empty datagram", func(t *testing.T) {
+		_, err := quicParseClientInitialSNI(nil)
+		if !errors.Is(err, errQUICNotClientInitial) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("with a short header packet", func(t *testing.T) {
+		_, err := quicParseClientInitialSNI([]byte{0x40, 1, 2, 3, 4})
+		if !errors.Is(err, errQUICNotClientInitial) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("with a long header packet that is not an Initial", func(t *testing.T) {
+		pkt := append([]byte{}, datagram...)
+		pkt[0] |= 0x20 // Handshake
+		_, err := quicParseClientInitialSNI(pkt)
+		if !errors.Is(err, errQUICNotClientInitial) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("with an unknown version", func(t *testing.T) {
+		pkt := append([]byte{}, datagram...)
+		copy(pkt[1:5], []byte{0x0a, 0x0a, 0x0a, 0x0a})
+		_, err := quicParseClientInitialSNI(pkt)
+		if !errors.Is(err, errQUICNotClientInitial) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("with a truncated header", func(t *testing.T) {
+		_, err := quicParseClientInitialSNI(datagram[:8])
+		if !errors.Is(err, errQUICMalformedInitial) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("with a truncated packet", func(t *testing.T) {
+		_, err := quicParseClientInitialSNI(datagram[:128])
+		if !errors.Is(err, errQUICMalformedInitial) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("with a corrupted payload", func(t *testing.T) {
+		pkt := append([]byte{}, datagram...)
+		pkt[len(pkt)-1] ^= 0xff
+		_, err := quicParseClientInitialSNI(pkt)
+		if !errors.Is(err, errQUICMalformedInitial) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+}
+
+func TestQUICReassembleCrypto(t *testing.T) {
+	t.Run("with shuffled CRYPTO frames and other frames", func(t *testing.T) {
+		payload := []byte{
+			0x01,                       // PING
+			0x06, 0x03, 0x02, 'd', 'e', // CRYPTO offset=3 length=2
+			0x02, 0x05, 0x00, 0x01, 0x00, 0x00, 0x00, // ACK with one range
+			0x03, 0x05, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, // ACK with ECN
+			0x06, 0x00, 0x03, 'a', 'b', 'c', // CRYPTO offset=0 length=3
+			0x06, 0x02, 0x02, 'c', 'd', // CRYPTO overlapping offset=2 length=2
+			0x06, 0x07, 0x01, 'x', // CRYPTO after a gap
+			0x1c, 0x00, 0x00, 0x01, 'r', // CONNECTION_CLOSE
+			0x00, 0x00, 0x00, // PADDING
+		}
+		stream, err := quicReassembleCrypto(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(stream) != "abcde" {
+			t.Fatal("unexpected stream", string(stream))
+		}
+	})
+
+	t.Run("with an unexpected frame", func(t *testing.T) {
+		_, err := quicReassembleCrypto([]byte{0x08}) // STREAM
+		if !errors.Is(err, errQUICMalformedInitial) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("with a truncated frame", func(t *testing.T) {
+		_, err := quicReassembleCrypto([]byte{0x06, 0x00, 0x10, 'a'})
+		if !errors.Is(err, errQUICMalformedInitial) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+}
+
+func TestTLSParseClientHelloSNI(t *testing.T) {
+	// newClientHello returns a minimal ClientHello with the given extensions.
+	newClientHello := func(extensions ...byte) []byte {
+		hello := []byte{0x01, 0x00, 0x00, 0x00, 0x03, 0x03}
+		hello = append(hello, make([]byte, 32)...)    // random
+		hello = append(hello, 0x00)                   // session ID
+		hello = append(hello, 0x00, 0x02, 0x13, 0x01) // cipher suites
+		hello = append(hello, 0x01, 0x00)             // compression methods
+		hello = append(hello, byte(len(extensions)>>8), byte(len(extensions)))
+		return append(hello, extensions...)
+	}
+
+	t.Run("with SNI", func(t *testing.T) {
+		hello := newClientHello(
+			0x00, 0x2b, 0x00, 0x03, 0x02, 0x03, 0x04, // supported_versions
+			0x00, 0x00, 0x00, 0x08, 0x00, 0x06, 0x00, 0x00, 0x03, 'x', '.', 'o', // server_name
+		)
+		sni, err := tlsParseClientHelloSNI(hello)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sni != "x.o" {
+			t.Fatal("unexpected SNI", sni)
+		}
+	})
+
+	t.Run("without SNI", func(t *testing.T) {
+		hello := newClientHello(0x00, 0x2b, 0x00, 0x03, 0x02, 0x03, 0x04)
+		_, err := tlsParseClientHelloSNI(hello)
+		if !errors.Is(err, errQUICNoSNI) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("with a malformed server_name extension", func(t *testing.T) {
+		hello := newClientHello(0x00, 0x00, 0x00, 0x03, 0x00, 0x01, 0x01)
+		_, err := tlsParseClientHelloSNI(hello)
+		if !errors.Is(err, errQUICMalformedInitial) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("with a message that is not a ClientHello", func(t *testing.T) {
+		_, err := tlsParseClientHelloSNI([]byte{0x02, 0x00, 0x00, 0x00})
+		if !errors.Is(err, errQUICMalformedInitial) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package filtering
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// ThrottlingPolicy describes how TProxy should throttle the traffic
+// of a TCP/UDP endpoint or of a TLS/QUIC SNI. All the fields are
+// OPTIONAL and a zero value means "do not apply this kind of throttling".
+type ThrottlingPolicy struct {
+	// Bandwidth is the maximum bandwidth in bytes per second. We
+	// apply this limit separately to each direction of a flow.
+	Bandwidth int64
+
+	// LatencyMillis is the extra latency in milliseconds.
+	LatencyMillis int64
+
+	// JitterMillis is the maximum random extra latency in
+	// milliseconds that we add on top of LatencyMillis.
+	JitterMillis int64
+
+	// Loss is the probability to lose a packet (between 0 and 1). We
+	// drop lost UDP datagrams. For TCP, we cannot drop data, so we
+	// instead delay lost segments by ThrottlingTCPRetransmitDelay,
+	// which is what would happen when TCP retransmits them.
+	Loss float64
+}
+
+// ThrottlingTCPRetransmitDelay is the extra delay we add to lost
+// TCP segments to simulate retransmissions.
+const ThrottlingTCPRetransmitDelay = 200 * time.Millisecond
+
+// throttlingChunkSize is the maximum number of bytes of a TCP stream
+// we throttle at once. By using a small chunk size, the data flows
+// more smoothly, as it would happen on a real throttled link.
+const throttlingChunkSize = 1 << 14
+
+// throttler throttles a single direction of a flow.
+type throttler struct {
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// next is when the link will be free again.
+	next time.Time
+
+	// policy is the throttling policy.
+	policy *ThrottlingPolicy
+
+	// rnd is the random number generator.
+	rnd *rand.Rand
+}
+
+// newThrottler creates a new throttler. This function returns
+// nil if the policy is nil, to indicate there's no throttling.
+func newThrottler(policy *ThrottlingPolicy) *throttler {
+	if policy == nil {
+		return nil
+	}
+	return &throttler{
+		policy: policy,
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// schedule returns the delay after which we should deliver the given
+// number of bytes and whether we should lose them instead.
+func (t *throttler) schedule(count int) (time.Duration, bool) {
+	defer t.mu.Unlock()
+	t.mu.Lock()
+	if t.policy.Loss > 0 && t.rnd.Float64() < t.policy.Loss {
+		return 0, true
+	}
+	now := time.Now()
+	delivery := now
+	if t.policy.Bandwidth > 0 {
+		if t.next.Before(now) {
+			t.next = now
+		}
+		t.next = t.next.Add(time.Duration(count) * time.Second / time.Duration(t.policy.Bandwidth))
+		delivery = t.next
+	}
+	delay := delivery.Sub(now) + time.Duration(t.policy.LatencyMillis)*time.Millisecond
+	if t.policy.JitterMillis > 0 {
+		delay += time.Duration(t.rnd.Int63n(t.policy.JitterMillis+1)) * time.Millisecond
+	}
+	return delay, false
+}
+
+// wait blocks until we can deliver count bytes of a TCP stream.
+func (t *throttler) wait(count int) {
+	delay, lost := t.schedule(count)
+	if lost {
+		delay += ThrottlingTCPRetransmitDelay
+	}
+	time.Sleep(delay)
+}
+
+// throttledRead reads from conn and throttles the read using t,
+// which may be nil, meaning that there's no throttling.
+func throttledRead(conn net.Conn, t *throttler, b []byte) (int, error) {
+	if t == nil {
+		return conn.Read(b)
+	}
+	if len(b) > throttlingChunkSize {
+		b = b[:throttlingChunkSize]
+	}
+	count, err := conn.Read(b)
+	if count > 0 {
+		t.wait(count)
+	}
+	return count, err
+}
+
+// throttledWrite writes b into conn and throttles the write using t,
+// which may be nil, meaning that there's no throttling.
+func throttledWrite(conn net.Conn, t *throttler, b []byte) (int, error) {
+	if t == nil {
+		return conn.Write(b)
+	}
+	var total int
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > throttlingChunkSize {
+			chunk = chunk[:throttlingChunkSize]
+		}
+		t.wait(len(chunk))
+		count, err := conn.Write(chunk)
+		total += count
+		if err != nil {
+			return total, err
+		}
+		b = b[count:]
+	}
+	return total, nil
+}
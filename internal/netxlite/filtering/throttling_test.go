@@ -0,0 +1,182 @@
+package filtering
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
+)
+
+func TestThrottler(t *testing.T) {
+	t.Run("newThrottler with nil policy", func(t *testing.T) {
+		if newThrottler(nil) != nil {
+			t.Fatal("expected nil throttler")
+		}
+	})
+
+	t.Run("schedule with bandwidth", func(t *testing.T) {
+		th := newThrottler(&ThrottlingPolicy{Bandwidth: 1000})
+		first, lost := th.schedule(500)
+		if lost {
+			t.Fatal("did not expect loss")
+		}
+		second, _ := th.schedule(500)
+		if first <= 400*time.Millisecond || first > 500*time.Millisecond {
+			t.Fatal("unexpected first delay", first)
+		}
+		if second <= 900*time.Millisecond || second > time.Second {
+			t.Fatal("unexpected second delay", second)
+		}
+	})
+
+	t.Run("schedule with latency and jitter", func(t *testing.T) {
+		th := newThrottler(&ThrottlingPolicy{LatencyMillis: 100, JitterMillis: 50})
+		for idx := 0; idx < 100; idx++ {
+			delay, lost := th.schedule(1000)
+			if lost {
+				t.Fatal("did not expect loss")
+			}
+			if delay < 100*time.Millisecond || delay > 150*time.Millisecond {
+				t.Fatal("unexpected delay", delay)
+			}
+		}
+	})
+
+	t.Run("schedule with loss", func(t *testing.T) {
+		th := newThrottler(&ThrottlingPolicy{Loss: 1})
+		if _, lost := th.schedule(1000); !lost {
+			t.Fatal("expected loss")
+		}
+		th = newThrottler(&ThrottlingPolicy{Loss: 0})
+		if _, lost := th.schedule(1000); lost {
+			t.Fatal("did not expect loss")
+		}
+	})
+
+	t.Run("wait with loss adds the retransmit delay", func(t *testing.T) {
+		th := newThrottler(&ThrottlingPolicy{Loss: 1})
+		before := time.Now()
+		th.wait(1)
+		if time.Since(before) < ThrottlingTCPRetransmitDelay {
+			t.Fatal("did not wait enough")
+		}
+	})
+}
+
+func TestThrottledReadWrite(t *testing.T) {
+	t.Run("throttledRead", func(t *testing.T) {
+		t.Run("without throttling", func(t *testing.T) {
+			conn := &mocks.Conn{
+				MockRead: func(b []byte) (int, error) {
+					return len(b), nil
+				},
+			}
+			count, err := throttledRead(conn, nil, make([]byte, 1<<17))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 1<<17 {
+				t.Fatal("unexpected count", count)
+			}
+		})
+
+		t.Run("with throttling", func(t *testing.T) {
+			conn := &mocks.Conn{
+				MockRead: func(b []byte) (int, error) {
+					return len(b), nil
+				},
+			}
+			th := newThrottler(&ThrottlingPolicy{LatencyMillis: 10})
+			before := time.Now()
+			count, err := throttledRead(conn, th, make([]byte, 1<<17))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != throttlingChunkSize {
+				t.Fatal("unexpected count", count)
+			}
+			if time.Since(before) < 10*time.Millisecond {
+				t.Fatal("did not wait enough")
+			}
+		})
+
+		t.Run("with throttling and error", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			conn := &mocks.Conn{
+				MockRead: func(b []byte) (int, error) {
+					return 0, expected
+				},
+			}
+			th := newThrottler(&ThrottlingPolicy{LatencyMillis: 10})
+			count, err := throttledRead(conn, th, make([]byte, 128))
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if count != 0 {
+				t.Fatal("unexpected count", count)
+			}
+		})
+	})
+
+	t.Run("throttledWrite", func(t *testing.T) {
+		t.Run("without throttling", func(t *testing.T) {
+			var calls int
+			conn := &mocks.Conn{
+				MockWrite: func(b []byte) (int, error) {
+					calls++
+					return len(b), nil
+				},
+			}
+			count, err := throttledWrite(conn, nil, make([]byte, 1<<17))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 1<<17 || calls != 1 {
+				t.Fatal("unexpected count or calls", count, calls)
+			}
+		})
+
+		t.Run("with throttling", func(t *testing.T) {
+			var calls int
+			conn := &mocks.Conn{
+				MockWrite: func(b []byte) (int, error) {
+					calls++
+					if len(b) > throttlingChunkSize {
+						t.Fatal("chunk is too large")
+					}
+					return len(b), nil
+				},
+			}
+			th := newThrottler(&ThrottlingPolicy{LatencyMillis: 1})
+			count, err := throttledWrite(conn, th, make([]byte, 3*throttlingChunkSize-1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 3*throttlingChunkSize-1 || calls != 3 {
+				t.Fatal("unexpected count or calls", count, calls)
+			}
+		})
+
+		t.Run("with throttling and error", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			var calls int
+			conn := &mocks.Conn{
+				MockWrite: func(b []byte) (int, error) {
+					if calls++; calls > 1 {
+						return 0, expected
+					}
+					return len(b), nil
+				},
+			}
+			th := newThrottler(&ThrottlingPolicy{LatencyMillis: 1})
+			count, err := throttledWrite(conn, th, make([]byte, 3*throttlingChunkSize))
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if count != throttlingChunkSize {
+				t.Fatal("unexpected count", count)
+			}
+		})
+	})
+}
@@ -180,7 +180,13 @@ func (p *TLSProxy) eof(conn net.Conn) {
 }
 
 func (p *TLSProxy) alert(conn net.Conn, code byte) {
-	alertdata := []byte{
+	conn.Write(tlsAlertRecord(code))
+	conn.Close()
+}
+
+// tlsAlertRecord returns a TLS record containing a fatal alert.
+func tlsAlertRecord(code byte) []byte {
+	return []byte{
 		21, // alert
 		3,  // version[0]
 		3,  // version[1]
@@ -189,8 +195,6 @@ func (p *TLSProxy) alert(conn net.Conn, code byte) {
 		2,  // fatal
 		code,
 	}
-	conn.Write(alertdata)
-	conn.Close()
 }
 
 func (p *TLSProxy) proxy(conn net.Conn, sni string, hello []byte) {
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/miekg/dns"
@@ -28,6 +29,15 @@ const (
 	// established TCP/UDP connection.
 	TProxyPolicyDropData = TProxyPolicy("drop-data")
 
+	// TProxyPolicyUDPICMPUnreachable simulates receiving an ICMP port
+	// unreachable message for an UDP endpoint, which causes sending
+	// datagrams to such an endpoint to fail with ECONNREFUSED.
+	TProxyPolicyUDPICMPUnreachable = TProxyPolicy("udp-icmp-unreachable")
+
+	// TProxyPolicyUDPRateLimit drops outgoing UDP datagrams
+	// exceeding the configured RateLimit.
+	TProxyPolicyUDPRateLimit = TProxyPolicy("udp-rate-limit")
+
 	// TProxyPolicyHijackDNS causes the dialer to replace the target
 	// address with the address of the local censored resolver.
 	TProxyPolicyHijackDNS = TProxyPolicy("hijack-dns")
@@ -67,8 +77,36 @@ type TProxyConfig struct {
 	// SNIs contains rules for filtering TLS SNIs.
 	SNIs map[string]TLSAction
 
+	// QUICSNIs contains rules for filtering QUIC by the SNI
+	// we find inside the client's Initial packet.
+	QUICSNIs map[string]QUICAction
+
+	// ThrottleEndpoints contains rules for throttling TCP/UDP endpoints.
+	ThrottleEndpoints map[string]*ThrottlingPolicy
+
+	// ThrottleSNIs contains rules for throttling by the SNI we
+	// find in the TLS ClientHello or in the QUIC client Initial.
+	ThrottleSNIs map[string]*ThrottlingPolicy
+
+	// RateLimit is the number of bytes per second allowed by the
+	// rate-limit policies. If zero, we use DefaultRateLimit.
+	RateLimit int64
+
 	// Hosts contains rules for filtering by HTTP host.
 	Hosts map[string]HTTPAction
+
+	// Hops is the OPTIONAL simulated number of hops between us and
+	// every server. TTL-limited probes (see ListenUDPWithTTL and
+	// NewSimpleDialerWithTTL) with a lower TTL do not reach the
+	// server. If zero, all probes reach the server.
+	Hops int
+
+	// CensorHop is the OPTIONAL simulated hop at which the censor
+	// applies the Domains, Endpoints, and SNIs rules to TTL-limited
+	// probes. TTL-limited probes with a lower TTL do not reach the
+	// censor. If zero, the censor sees all probes. This value
+	// should be lower than Hops.
+	CensorHop int
 }
 
 // NewTProxyConfig reads the TProxyConfig from the given file.
@@ -203,7 +241,11 @@ func (p *TProxy) ListenUDP(network string, laddr *net.UDPAddr) (model.UDPLikeCon
 	if err != nil {
 		return nil, err
 	}
-	return &tProxyUDPLikeConn{UDPLikeConn: pconn, proxy: p}, nil
+	return &tProxyUDPLikeConn{
+		UDPLikeConn: pconn,
+		flows:       make(map[string]*tProxyUDPFlow),
+		proxy:       p,
+	}, nil
 }
 
 // tProxyUDPLikeConn is a TProxy-aware UDPLikeConn.
@@ -211,22 +253,128 @@ type tProxyUDPLikeConn struct {
 	// UDPLikeConn is the underlying conn type.
 	model.UDPLikeConn
 
+	// flows contains the state of the flow towards each endpoint.
+	flows map[string]*tProxyUDPFlow
+
+	// mu protects flows.
+	mu sync.Mutex
+
 	// proxy refers to the TProxy.
 	proxy *TProxy
 }
 
+// tProxyUDPFlow contains the state of the flow towards an UDP endpoint.
+type tProxyUDPFlow struct {
+	// action is the QUIC action, which is empty until we
+	// have seen the client Initial.
+	action QUICAction
+
+	// limiter is the rate limiter for this flow.
+	limiter *rateLimiter
+
+	// reader is the OPTIONAL throttler for incoming datagrams.
+	reader *throttler
+
+	// writer is the OPTIONAL throttler for outgoing datagrams.
+	writer *throttler
+}
+
 // WriteTo implements UDPLikeConn.WriteTo. This function will
 // apply the proper tproxy policies, if required.
 func (c *tProxyUDPLikeConn) WriteTo(pkt []byte, addr net.Addr) (int, error) {
 	endpoint := fmt.Sprintf("%s/%s", addr.String(), addr.Network())
+	flow := c.flow(endpoint, pkt)
 	policy := c.proxy.config.Endpoints[endpoint]
 	switch policy {
 	case TProxyPolicyDropData:
 		c.proxy.logger.Infof("tproxy: WriteTo: %s => %s", endpoint, policy)
 		return len(pkt), nil
-	default:
-		return c.UDPLikeConn.WriteTo(pkt, addr)
+	case TProxyPolicyUDPICMPUnreachable:
+		c.proxy.logger.Infof("tproxy: WriteTo: %s => %s", endpoint, policy)
+		return 0, netxlite.ECONNREFUSED
+	case TProxyPolicyUDPRateLimit:
+		if !flow.limiter.allow(len(pkt)) {
+			c.proxy.logger.Infof("tproxy: WriteTo: %s => %s", endpoint, policy)
+			return len(pkt), nil
+		}
+	}
+	switch flow.action {
+	case QUICActionDrop:
+		return len(pkt), nil
+	case QUICActionICMPUnreachable:
+		return 0, netxlite.ECONNREFUSED
+	case QUICActionRateLimit:
+		if !flow.limiter.allow(len(pkt)) {
+			return len(pkt), nil
+		}
+	}
+	if flow.writer != nil {
+		delay, lost := flow.writer.schedule(len(pkt))
+		if lost {
+			return len(pkt), nil
+		}
+		if delay > 0 {
+			data := append([]byte{}, pkt...) // the caller may reuse pkt
+			time.AfterFunc(delay, func() {
+				c.UDPLikeConn.WriteTo(data, addr)
+			})
+			return len(pkt), nil
+		}
 	}
+	return c.UDPLikeConn.WriteTo(pkt, addr)
+}
+
+// ReadFrom implements UDPLikeConn.ReadFrom. This function will
+// apply the proper tproxy policies, if required.
+func (c *tProxyUDPLikeConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		count, addr, err := c.UDPLikeConn.ReadFrom(b)
+		if err != nil || addr == nil {
+			return count, addr, err
+		}
+		endpoint := fmt.Sprintf("%s/%s", addr.String(), addr.Network())
+		c.mu.Lock()
+		flow := c.flows[endpoint]
+		c.mu.Unlock()
+		if flow == nil || flow.reader == nil {
+			return count, addr, nil
+		}
+		delay, lost := flow.reader.schedule(count)
+		if lost {
+			continue
+		}
+		time.Sleep(delay)
+		return count, addr, nil
+	}
+}
+
+// flow returns the state of the flow towards the given endpoint, which
+// we create when we send the first datagram to such an endpoint. The first
+// client Initial we send to an endpoint determines the QUIC action and
+// the SNI-based throttling for all the subsequent datagrams.
+func (c *tProxyUDPLikeConn) flow(endpoint string, pkt []byte) *tProxyUDPFlow {
+	defer c.mu.Unlock()
+	c.mu.Lock()
+	flow, found := c.flows[endpoint]
+	if !found {
+		flow = &tProxyUDPFlow{limiter: newRateLimiter(c.proxy.config.RateLimit)}
+		if policy := c.proxy.onThrottleEndpoint(endpoint); policy != nil {
+			flow.reader, flow.writer = newThrottler(policy), newThrottler(policy)
+		}
+		c.flows[endpoint] = flow
+	}
+	if flow.action != "" || !c.proxy.filtersBySNI() {
+		return flow // avoid parsing when not needed
+	}
+	sni, err := quicParseClientInitialSNI(pkt)
+	if err != nil {
+		return flow // wait for a client Initial
+	}
+	flow.action = c.proxy.onIncomingQUICSNI(sni)
+	if policy := c.proxy.onThrottleSNI(sni); policy != nil && flow.writer == nil {
+		flow.reader, flow.writer = newThrottler(policy), newThrottler(policy)
+	}
+	return flow
 }
 
 //
@@ -292,7 +440,9 @@ func (d *tProxyDialer) DialContext(ctx context.Context, network, address string)
 	if err != nil {
 		return nil, err
 	}
-	return &tProxyConn{Conn: conn, proxy: d.proxy}, nil
+	tconn := &tProxyConn{Conn: conn, proxy: d.proxy}
+	tconn.throttle(d.proxy.onThrottleEndpoint(endpoint))
+	return tconn, nil
 }
 
 // tProxyConn is a TProxy-aware net.Conn.
@@ -300,8 +450,29 @@ type tProxyConn struct {
 	// Conn is the underlying conn.
 	net.Conn
 
+	// mu protects reader, sniffed, and writer.
+	mu sync.Mutex
+
 	// proxy refers to the TProxy.
 	proxy *TProxy
+
+	// reader is the OPTIONAL throttler for reads.
+	reader *throttler
+
+	// sniffed indicates we've already looked for a ClientHello.
+	sniffed bool
+
+	// writer is the OPTIONAL throttler for writes.
+	writer *throttler
+}
+
+// Read implements Conn.Read. This function will apply
+// the proper tproxy policies, if required.
+func (c *tProxyConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	reader := c.reader
+	c.mu.Unlock()
+	return throttledRead(c.Conn, reader, b)
 }
 
 // Write implements Conn.Write. This function will apply
@@ -315,10 +486,42 @@ func (c *tProxyConn) Write(b []byte) (int, error) {
 		c.proxy.logger.Infof("tproxy: Write: %s => %s", endpoint, policy)
 		return len(b), nil
 	default:
-		return c.Conn.Write(b)
+		return throttledWrite(c.Conn, c.sniff(b), b)
 	}
 }
 
+// throttle configures throttling using the given policy, unless
+// the policy is nil or we're already throttling this conn.
+func (c *tProxyConn) throttle(policy *ThrottlingPolicy) {
+	defer c.mu.Unlock()
+	c.mu.Lock()
+	if policy != nil && c.writer == nil {
+		c.reader, c.writer = newThrottler(policy), newThrottler(policy)
+	}
+}
+
+// sniff looks for the SNI in the first data we write, which may
+// contain a TLS ClientHello, to throttle by SNI. This function
+// returns the throttler that Write should use.
+func (c *tProxyConn) sniff(b []byte) *throttler {
+	c.mu.Lock()
+	sniffed := c.sniffed
+	c.sniffed = true
+	c.mu.Unlock()
+	if !sniffed && len(c.proxy.config.ThrottleSNIs) > 0 {
+		// A TLS record header is five bytes and the content type of a
+		// handshake record is 22. We ignore fragmented ClientHellos.
+		if len(b) > 5 && b[0] == 22 {
+			if sni, err := tlsParseClientHelloSNI(b[5:]); err == nil {
+				c.throttle(c.proxy.onThrottleSNI(sni))
+			}
+		}
+	}
+	defer c.mu.Unlock()
+	c.mu.Lock()
+	return c.writer
+}
+
 //
 // Filtering policies implementation
 //
@@ -345,6 +548,43 @@ func (p *TProxy) onIncomingSNI(sni string) TLSAction {
 	return policy
 }
 
+// onIncomingQUICSNI is called for filtering QUIC SNI values.
+func (p *TProxy) onIncomingQUICSNI(sni string) QUICAction {
+	policy := p.config.QUICSNIs[sni]
+	if policy == "" {
+		policy = QUICActionPass
+	} else {
+		p.logger.Infof("tproxy: QUIC: %s => %s", sni, policy)
+	}
+	return policy
+}
+
+// filtersBySNI returns whether there are QUIC or throttling rules
+// requiring us to inspect QUIC client Initial packets.
+func (p *TProxy) filtersBySNI() bool {
+	return len(p.config.QUICSNIs) > 0 || len(p.config.ThrottleSNIs) > 0
+}
+
+// onThrottleEndpoint returns the throttling policy for the given
+// endpoint or nil if we should not throttle this endpoint.
+func (p *TProxy) onThrottleEndpoint(endpoint string) *ThrottlingPolicy {
+	policy := p.config.ThrottleEndpoints[endpoint]
+	if policy != nil {
+		p.logger.Infof("tproxy: throttle: %s => %+v", endpoint, *policy)
+	}
+	return policy
+}
+
+// onThrottleSNI returns the throttling policy for the given
+// SNI or nil if we should not throttle this SNI.
+func (p *TProxy) onThrottleSNI(sni string) *ThrottlingPolicy {
+	policy := p.config.ThrottleSNIs[sni]
+	if policy != nil {
+		p.logger.Infof("tproxy: throttle: %s => %+v", sni, *policy)
+	}
+	return policy
+}
+
 // onIncomingHost is called for filtering HTTP hosts.
 func (p *TProxy) onIncomingHost(host string) HTTPAction {
 	policy := p.config.Hosts[host]
@@ -355,3 +595,52 @@ func (p *TProxy) onIncomingHost(host string) HTTPAction {
 	}
 	return policy
 }
+
+//
+// Rate limiting
+//
+
+// DefaultRateLimit is the default number of bytes per second
+// allowed by the rate-limit policies.
+const DefaultRateLimit = 16 << 10
+
+// rateLimiter is a token bucket policer. The bucket size is equal
+// to the number of bytes allowed in a second.
+type rateLimiter struct {
+	// last is the last time we updated tokens.
+	last time.Time
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// rate is the number of bytes per second.
+	rate int64
+
+	// tokens is the number of bytes we can currently send.
+	tokens float64
+}
+
+// newRateLimiter creates a new rateLimiter allowing rate bytes per second.
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		rate = DefaultRateLimit
+	}
+	return &rateLimiter{last: time.Now(), rate: rate, tokens: float64(rate)}
+}
+
+// allow returns whether we can send count bytes right now.
+func (rl *rateLimiter) allow(count int) bool {
+	defer rl.mu.Unlock()
+	rl.mu.Lock()
+	now := time.Now()
+	rl.tokens += now.Sub(rl.last).Seconds() * float64(rl.rate)
+	if rl.tokens > float64(rl.rate) {
+		rl.tokens = float64(rl.rate)
+	}
+	rl.last = now
+	if float64(count) > rl.tokens {
+		return false
+	}
+	rl.tokens -= float64(count)
+	return true
+}
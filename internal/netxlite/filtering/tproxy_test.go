@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"io"
 	"net"
 	"net/http"
 	"path/filepath"
@@ -13,6 +14,8 @@ import (
 	"time"
 
 	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/lucas-clemente/quic-go"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/model/mocks"
 	"github.com/ooni/probe-cli/v3/internal/netxlite"
@@ -64,6 +67,25 @@ func TestNewTProxyConfig(t *testing.T) {
 			t.Fatal("did not auto-canonicalize config.DNSCache")
 		}
 	})
+
+	t.Run("with file containing throttling rules", func(t *testing.T) {
+		config, err := NewTProxyConfig(filepath.Join("testdata", "throttling.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := &ThrottlingPolicy{
+			Bandwidth:     32768,
+			LatencyMillis: 100,
+			JitterMillis:  20,
+			Loss:          0.01,
+		}
+		if diff := cmp.Diff(expect, config.ThrottleEndpoints["8.8.8.8:443/tcp"]); diff != "" {
+			t.Fatal(diff)
+		}
+		if config.ThrottleSNIs["dns.google"].Bandwidth != 16384 {
+			t.Fatal("unexpected SNI throttling rule")
+		}
+	})
 }
 
 func TestNewTProxy(t *testing.T) {
@@ -224,6 +246,269 @@ func TestTProxyQUIC(t *testing.T) {
 				t.Fatal("called")
 			}
 		})
+
+		// newProxy creates a TProxy whose ListenUDP returns a conn
+		// that counts the number of datagrams actually sent.
+		newProxy := func(t *testing.T, config *TProxyConfig, count *int) *TProxy {
+			proxy, err := NewTProxy(config, log.Log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proxy.listenUDP = func(network string, laddr *net.UDPAddr) (model.UDPLikeConn, error) {
+				return &mocks.UDPLikeConn{
+					MockWriteTo: func(p []byte, addr net.Addr) (int, error) {
+						*count++
+						return len(p), nil
+					},
+				}, nil
+			}
+			return proxy
+		}
+
+		destAddr := &net.UDPAddr{
+			IP:   net.IPv4(127, 0, 0, 1),
+			Port: 443,
+			Zone: "",
+		}
+
+		t.Run("with the ICMP unreachable policy", func(t *testing.T) {
+			config := &TProxyConfig{
+				Endpoints: map[string]TProxyPolicy{
+					"127.0.0.1:443/udp": TProxyPolicyUDPICMPUnreachable,
+				},
+			}
+			var count int
+			proxy := newProxy(t, config, &count)
+			defer proxy.Close()
+			pconn, err := proxy.ListenUDP("udp", &net.UDPAddr{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			written, err := pconn.WriteTo(make([]byte, 128), destAddr)
+			if !errors.Is(err, netxlite.ECONNREFUSED) {
+				t.Fatal("unexpected err", err)
+			}
+			if written != 0 || count != 0 {
+				t.Fatal("should not have written anything")
+			}
+		})
+
+		t.Run("with the rate limit policy", func(t *testing.T) {
+			config := &TProxyConfig{
+				Endpoints: map[string]TProxyPolicy{
+					"127.0.0.1:443/udp": TProxyPolicyUDPRateLimit,
+				},
+				RateLimit: 1000,
+			}
+			var count int
+			proxy := newProxy(t, config, &count)
+			defer proxy.Close()
+			pconn, err := proxy.ListenUDP("udp", &net.UDPAddr{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for idx := 0; idx < 4; idx++ {
+				written, err := pconn.WriteTo(make([]byte, 400), destAddr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if written != 400 {
+					t.Fatal("unexpected number of bytes written")
+				}
+			}
+			if count != 2 {
+				t.Fatal("expected two datagrams to pass, got", count)
+			}
+		})
+
+		t.Run("with QUIC SNI policies", func(t *testing.T) {
+			initial := quicCaptureClientInitial(t, "dns.google", quic.Version1)
+			other := make([]byte, 128) // not an initial
+
+			t.Run("for an SNI without rules", func(t *testing.T) {
+				config := &TProxyConfig{
+					QUICSNIs: map[string]QUICAction{
+						"example.com": QUICActionDrop,
+					},
+				}
+				var count int
+				proxy := newProxy(t, config, &count)
+				defer proxy.Close()
+				pconn, err := proxy.ListenUDP("udp", &net.UDPAddr{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, pkt := range [][]byte{initial, other} {
+					if _, err := pconn.WriteTo(pkt, destAddr); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if count != 2 {
+					t.Fatal("expected all datagrams to pass")
+				}
+			})
+
+			t.Run("with the drop action", func(t *testing.T) {
+				config := &TProxyConfig{
+					QUICSNIs: map[string]QUICAction{
+						"dns.google": QUICActionDrop,
+					},
+				}
+				var count int
+				proxy := newProxy(t, config, &count)
+				defer proxy.Close()
+				pconn, err := proxy.ListenUDP("udp", &net.UDPAddr{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				// a datagram before the initial passes and the datagrams
+				// after the initial are dropped along with the initial
+				for _, pkt := range [][]byte{other, initial, other} {
+					written, err := pconn.WriteTo(pkt, destAddr)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if written != len(pkt) {
+						t.Fatal("unexpected number of bytes written")
+					}
+				}
+				if count != 1 {
+					t.Fatal("expected a single datagram to pass")
+				}
+			})
+
+			t.Run("with the ICMP unreachable action", func(t *testing.T) {
+				config := &TProxyConfig{
+					QUICSNIs: map[string]QUICAction{
+						"dns.google": QUICActionICMPUnreachable,
+					},
+				}
+				var count int
+				proxy := newProxy(t, config, &count)
+				defer proxy.Close()
+				pconn, err := proxy.ListenUDP("udp", &net.UDPAddr{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, pkt := range [][]byte{initial, other} {
+					written, err := pconn.WriteTo(pkt, destAddr)
+					if !errors.Is(err, netxlite.ECONNREFUSED) {
+						t.Fatal("unexpected err", err)
+					}
+					if written != 0 {
+						t.Fatal("unexpected number of bytes written")
+					}
+				}
+				if count != 0 {
+					t.Fatal("expected no datagram to pass")
+				}
+			})
+
+			t.Run("with the rate limit action", func(t *testing.T) {
+				config := &TProxyConfig{
+					QUICSNIs: map[string]QUICAction{
+						"dns.google": QUICActionRateLimit,
+					},
+					RateLimit: int64(len(initial)) + 200,
+				}
+				var count int
+				proxy := newProxy(t, config, &count)
+				defer proxy.Close()
+				pconn, err := proxy.ListenUDP("udp", &net.UDPAddr{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, pkt := range [][]byte{initial, other, other} {
+					if _, err := pconn.WriteTo(pkt, destAddr); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if count != 2 {
+					t.Fatal("expected two datagrams to pass, got", count)
+				}
+			})
+		})
+	})
+
+	t.Run("QUIC handshake", func(t *testing.T) {
+		// handshake performs a QUIC handshake with a local UDP socket
+		// that never replies using netxlite configured to use the proxy.
+		handshake := func(t *testing.T, config *TProxyConfig) error {
+			proxy, err := NewTProxy(config, log.Log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer proxy.Close()
+			orig := netxlite.TProxy
+			netxlite.TProxy = proxy
+			defer func() {
+				netxlite.TProxy = orig
+			}()
+			server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer server.Close()
+			dialer := netxlite.NewQUICDialerWithoutResolver(netxlite.NewQUICListener(), log.Log)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			tlsConfig := &tls.Config{ServerName: "dns.google", NextProtos: []string{"h3"}}
+			sess, err := dialer.DialContext(
+				ctx, "udp", server.LocalAddr().String(), tlsConfig, &quic.Config{})
+			if sess != nil {
+				t.Fatal("expected nil session")
+			}
+			return err
+		}
+
+		t.Run("with the ICMP unreachable action", func(t *testing.T) {
+			err := handshake(t, &TProxyConfig{
+				QUICSNIs: map[string]QUICAction{
+					"dns.google": QUICActionICMPUnreachable,
+				},
+			})
+			if err == nil || err.Error() != netxlite.FailureConnectionRefused {
+				t.Fatal("unexpected err", err)
+			}
+		})
+
+		t.Run("with the drop action", func(t *testing.T) {
+			err := handshake(t, &TProxyConfig{
+				QUICSNIs: map[string]QUICAction{
+					"dns.google": QUICActionDrop,
+				},
+			})
+			if err == nil || err.Error() != netxlite.FailureGenericTimeoutError {
+				t.Fatal("unexpected err", err)
+			}
+		})
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("with the default rate", func(t *testing.T) {
+		rl := newRateLimiter(0)
+		if rl.rate != DefaultRateLimit {
+			t.Fatal("unexpected rate")
+		}
+	})
+
+	t.Run("refills the bucket over time", func(t *testing.T) {
+		rl := newRateLimiter(1000)
+		if !rl.allow(1000) {
+			t.Fatal("expected to allow a full bucket")
+		}
+		if rl.allow(1) {
+			t.Fatal("expected the bucket to be empty")
+		}
+		rl.last = rl.last.Add(-500 * time.Millisecond)
+		if !rl.allow(400) {
+			t.Fatal("expected the bucket to be refilled")
+		}
+		rl.last = rl.last.Add(-time.Hour)
+		if rl.allow(1001) {
+			t.Fatal("the bucket should not grow beyond the rate")
+		}
 	})
 }
 
@@ -523,6 +808,278 @@ func TestTProxyDial(t *testing.T) {
 	})
 }
 
+func TestTProxyThrottling(t *testing.T) {
+	t.Run("TCP", func(t *testing.T) {
+		// dial creates a TProxy using the config returned by newConfig and
+		// uses it to connect to a local TCP listener that discards all data. We
+		// pass to newConfig the endpoint of the local TCP listener.
+		dial := func(t *testing.T, newConfig func(endpoint string) *TProxyConfig) (*tProxyConn, func()) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go func() {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				netxlite.CopyContext(context.Background(), io.Discard, conn)
+				conn.Close()
+			}()
+			proxy, err := NewTProxy(newConfig(listener.Addr().String()+"/tcp"), log.Log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dialer := proxy.NewSimpleDialer(10 * time.Second)
+			conn, err := dialer.DialContext(context.Background(), "tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return conn.(*tProxyConn), func() {
+				conn.Close()
+				listener.Close()
+				proxy.Close()
+			}
+		}
+
+		// clientHello returns a TLS record containing a ClientHello.
+		clientHello := func(t *testing.T, sni string) []byte {
+			var record []byte
+			expected := errors.New("mocked error")
+			tconn := tls.Client(&mocks.Conn{
+				MockWrite: func(b []byte) (int, error) {
+					record = append([]byte{}, b...)
+					return 0, expected
+				},
+			}, &tls.Config{ServerName: sni})
+			if err := tconn.Handshake(); !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			return record
+		}
+
+		t.Run("without throttling", func(t *testing.T) {
+			conn, cleanup := dial(t, func(endpoint string) *TProxyConfig {
+				return &TProxyConfig{}
+			})
+			defer cleanup()
+			if _, err := conn.Write(clientHello(t, "dns.google")); err != nil {
+				t.Fatal(err)
+			}
+			if conn.reader != nil || conn.writer != nil {
+				t.Fatal("expected no throttling")
+			}
+		})
+
+		t.Run("with endpoint throttling", func(t *testing.T) {
+			conn, cleanup := dial(t, func(endpoint string) *TProxyConfig {
+				return &TProxyConfig{
+					ThrottleEndpoints: map[string]*ThrottlingPolicy{
+						endpoint: {LatencyMillis: 50},
+					},
+				}
+			})
+			defer cleanup()
+			before := time.Now()
+			if _, err := conn.Write([]byte("abc")); err != nil {
+				t.Fatal(err)
+			}
+			if time.Since(before) < 50*time.Millisecond {
+				t.Fatal("did not throttle")
+			}
+		})
+
+		t.Run("with SNI throttling", func(t *testing.T) {
+			conn, cleanup := dial(t, func(endpoint string) *TProxyConfig {
+				return &TProxyConfig{
+					ThrottleSNIs: map[string]*ThrottlingPolicy{
+						"dns.google": {LatencyMillis: 50},
+					},
+				}
+			})
+			defer cleanup()
+			hello := clientHello(t, "dns.google")
+			before := time.Now()
+			if _, err := conn.Write(hello); err != nil {
+				t.Fatal(err)
+			}
+			if time.Since(before) < 50*time.Millisecond {
+				t.Fatal("did not throttle")
+			}
+			if conn.reader == nil || conn.writer == nil {
+				t.Fatal("expected throttling")
+			}
+		})
+
+		t.Run("with SNI throttling and another SNI", func(t *testing.T) {
+			conn, cleanup := dial(t, func(endpoint string) *TProxyConfig {
+				return &TProxyConfig{
+					ThrottleSNIs: map[string]*ThrottlingPolicy{
+						"dns.google": {LatencyMillis: 50},
+					},
+				}
+			})
+			defer cleanup()
+			if _, err := conn.Write(clientHello(t, "example.com")); err != nil {
+				t.Fatal(err)
+			}
+			if conn.reader != nil || conn.writer != nil {
+				t.Fatal("expected no throttling")
+			}
+		})
+
+		t.Run("with SNI throttling we only inspect the first write", func(t *testing.T) {
+			conn, cleanup := dial(t, func(endpoint string) *TProxyConfig {
+				return &TProxyConfig{
+					ThrottleSNIs: map[string]*ThrottlingPolicy{
+						"dns.google": {LatencyMillis: 50},
+					},
+				}
+			})
+			defer cleanup()
+			if _, err := conn.Write([]byte("GET / HTTP/1.1\r\n\r\n")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := conn.Write(clientHello(t, "dns.google")); err != nil {
+				t.Fatal(err)
+			}
+			if conn.reader != nil || conn.writer != nil {
+				t.Fatal("expected no throttling")
+			}
+		})
+	})
+
+	t.Run("UDP", func(t *testing.T) {
+		destAddr := &net.UDPAddr{
+			IP:   net.IPv4(127, 0, 0, 1),
+			Port: 443,
+			Zone: "",
+		}
+
+		// listen creates a TProxy with the given config and returns an UDP
+		// conn that records the written datagrams and that returns a datagram
+		// from destAddr every time we read from it.
+		listen := func(t *testing.T, config *TProxyConfig, written chan<- []byte) *tProxyUDPLikeConn {
+			proxy, err := NewTProxy(config, log.Log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { proxy.Close() })
+			proxy.listenUDP = func(network string, laddr *net.UDPAddr) (model.UDPLikeConn, error) {
+				return &mocks.UDPLikeConn{
+					MockWriteTo: func(p []byte, addr net.Addr) (int, error) {
+						written <- p
+						return len(p), nil
+					},
+					MockReadFrom: func(p []byte) (int, net.Addr, error) {
+						return copy(p, "reply"), destAddr, nil
+					},
+				}, nil
+			}
+			pconn, err := proxy.ListenUDP("udp", &net.UDPAddr{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return pconn.(*tProxyUDPLikeConn)
+		}
+
+		t.Run("with endpoint throttling and latency", func(t *testing.T) {
+			written := make(chan []byte, 1)
+			pconn := listen(t, &TProxyConfig{
+				ThrottleEndpoints: map[string]*ThrottlingPolicy{
+					"127.0.0.1:443/udp": {LatencyMillis: 50},
+				},
+			}, written)
+			pkt := []byte("abc")
+			before := time.Now()
+			count, err := pconn.WriteTo(pkt, destAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != len(pkt) {
+				t.Fatal("unexpected count")
+			}
+			copy(pkt, "xyz") // make sure the proxy copied the datagram
+			if data := <-written; string(data) != "abc" {
+				t.Fatal("unexpected data", string(data))
+			}
+			if time.Since(before) < 50*time.Millisecond {
+				t.Fatal("did not delay the datagram")
+			}
+			before = time.Now()
+			buffer := make([]byte, 128)
+			count, addr, err := pconn.ReadFrom(buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(buffer[:count]) != "reply" || addr != destAddr {
+				t.Fatal("unexpected reply")
+			}
+			if time.Since(before) < 50*time.Millisecond {
+				t.Fatal("did not delay the reply")
+			}
+		})
+
+		t.Run("with endpoint throttling and loss", func(t *testing.T) {
+			written := make(chan []byte, 1)
+			pconn := listen(t, &TProxyConfig{
+				ThrottleEndpoints: map[string]*ThrottlingPolicy{
+					"127.0.0.1:443/udp": {Loss: 1},
+				},
+			}, written)
+			count, err := pconn.WriteTo([]byte("abc"), destAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 3 {
+				t.Fatal("unexpected count")
+			}
+			select {
+			case <-written:
+				t.Fatal("should have lost the datagram")
+			case <-time.After(10 * time.Millisecond):
+			}
+		})
+
+		t.Run("reading from an unknown endpoint", func(t *testing.T) {
+			pconn := listen(t, &TProxyConfig{
+				ThrottleEndpoints: map[string]*ThrottlingPolicy{
+					"127.0.0.1:443/udp": {LatencyMillis: 1000},
+				},
+			}, make(chan []byte, 1))
+			before := time.Now()
+			if _, _, err := pconn.ReadFrom(make([]byte, 128)); err != nil {
+				t.Fatal(err)
+			}
+			if time.Since(before) > 500*time.Millisecond {
+				t.Fatal("should not have delayed the reply")
+			}
+		})
+
+		t.Run("with QUIC SNI throttling", func(t *testing.T) {
+			initial := quicCaptureClientInitial(t, "dns.google", quic.Version1)
+			written := make(chan []byte, 2)
+			pconn := listen(t, &TProxyConfig{
+				ThrottleSNIs: map[string]*ThrottlingPolicy{
+					"dns.google": {Loss: 1},
+				},
+			}, written)
+			for _, pkt := range [][]byte{initial, []byte("abc")} {
+				if _, err := pconn.WriteTo(pkt, destAddr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(written) != 0 {
+				t.Fatal("should have lost all the datagrams")
+			}
+			flow := pconn.flows["127.0.0.1:443/udp"]
+			if flow.action != QUICActionPass || flow.writer == nil {
+				t.Fatal("unexpected flow state")
+			}
+		})
+	})
+}
+
 func TestTProxyDNSCache(t *testing.T) {
 	t.Run("without cache but with the cache rule", func(t *testing.T) {
 		config := &TProxyConfig{
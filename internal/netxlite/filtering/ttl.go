@@ -0,0 +1,228 @@
+package filtering
+
+//
+// TTL-limited probes
+//
+// We simulate a path with config.Hops hops between us and every
+// server and a censor at config.CensorHop. A TTL-limited probe that
+// reaches the censor is subject to the Domains, Endpoints, and SNIs
+// rules, and a probe that does not reach the server expires along
+// the path. A zero TTL means the system's default, which reaches
+// both the censor and the server.
+//
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+var _ model.UnderlyingTTLNetworkLibrary = &TProxy{}
+
+// reachesCensor returns whether a probe with the given TTL reaches the censor.
+func (p *TProxy) reachesCensor(ttl int) bool {
+	return ttl <= 0 || ttl >= p.config.CensorHop
+}
+
+// reachesServer returns whether a probe with the given TTL reaches the server.
+func (p *TProxy) reachesServer(ttl int) bool {
+	return ttl <= 0 || p.config.Hops <= 0 || ttl >= p.config.Hops
+}
+
+//
+// UDP
+//
+
+// ListenUDPWithTTL implements model.UnderlyingTTLNetworkLibrary.ListenUDPWithTTL.
+func (p *TProxy) ListenUDPWithTTL(
+	network string, laddr *net.UDPAddr, ttl int) (model.UDPLikeConn, error) {
+	pconn, err := p.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	return &tProxyTTLUDPLikeConn{UDPLikeConn: pconn, proxy: p, ttl: ttl}, nil
+}
+
+// tProxyTTLUDPLikeConn is a TTL-aware tProxyUDPLikeConn.
+type tProxyTTLUDPLikeConn struct {
+	// UDPLikeConn is the underlying tProxyUDPLikeConn.
+	model.UDPLikeConn
+
+	// proxy refers to the TProxy.
+	proxy *TProxy
+
+	// ttl is the TTL of the datagrams we send.
+	ttl int
+}
+
+// WriteTo implements UDPLikeConn.WriteTo. When the censor sees a DNS
+// query for a filtered domain, we send the query to the local censored
+// resolver, which injects the reply. Otherwise, we drop the datagrams
+// that would not reach the server.
+func (c *tProxyTTLUDPLikeConn) WriteTo(pkt []byte, addr net.Addr) (int, error) {
+	if c.ttl > 0 && c.proxy.reachesCensor(c.ttl) && len(c.proxy.config.Domains) > 0 {
+		if domain, ok := dnsParseQueryName(pkt); ok && c.proxy.onQuery(domain) != DNSActionPass {
+			return c.UDPLikeConn.WriteTo(pkt, c.proxy.dnsListener.LocalAddr())
+		}
+	}
+	if !c.proxy.reachesServer(c.ttl) {
+		c.proxy.logger.Infof("tproxy: WriteTo: %s ttl=%d => time exceeded", addr.String(), c.ttl)
+		return len(pkt), nil
+	}
+	return c.UDPLikeConn.WriteTo(pkt, addr)
+}
+
+// dnsParseQueryName returns the name contained in a DNS query.
+func dnsParseQueryName(pkt []byte) (string, bool) {
+	query := &dns.Msg{}
+	if err := query.Unpack(pkt); err != nil || query.Response || len(query.Question) != 1 {
+		return "", false
+	}
+	return query.Question[0].Name, true
+}
+
+//
+// Dialer
+//
+
+// NewSimpleDialerWithTTL implements model.UnderlyingTTLNetworkLibrary.NewSimpleDialerWithTTL.
+func (p *TProxy) NewSimpleDialerWithTTL(timeout time.Duration, ttl int) model.SimpleDialer {
+	return &tProxyTTLDialer{
+		dialer: &tProxyDialer{dialer: &net.Dialer{Timeout: timeout}, proxy: p},
+		proxy:  p,
+		ttl:    ttl,
+	}
+}
+
+// tProxyTTLDialer is a TTL-aware tProxyDialer.
+type tProxyTTLDialer struct {
+	// dialer is the underlying tProxyDialer.
+	dialer *tProxyDialer
+
+	// proxy refers to the TProxy.
+	proxy *TProxy
+
+	// ttl is the TTL of the SYN segment.
+	ttl int
+}
+
+// DialContext behaves like net.Dialer.DialContext. When the SYN segment
+// does not reach the server, this function fails as if we had received
+// an ICMP time exceeded message, unless the censor filters the SYN.
+func (d *tProxyTTLDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	endpoint := fmt.Sprintf("%s/%s", address, network)
+	policy := d.proxy.config.Endpoints[endpoint]
+	filtersSYN := policy == TProxyPolicyTCPDropSYN || policy == TProxyPolicyTCPRejectSYN
+	if !d.proxy.reachesServer(d.ttl) && !(d.proxy.reachesCensor(d.ttl) && filtersSYN) {
+		d.proxy.logger.Infof("tproxy: DialContext: %s ttl=%d => time exceeded", endpoint, d.ttl)
+		return nil, netxlite.EHOSTUNREACH
+	}
+	conn, err := d.dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &tProxyTTLConn{Conn: conn, proxy: d.proxy, ttl: d.ttl}, nil
+}
+
+// tProxyTTLConn is a TTL-aware tProxyConn.
+type tProxyTTLConn struct {
+	// Conn is the underlying tProxyConn.
+	net.Conn
+
+	// mu protects reader and ttl.
+	mu sync.Mutex
+
+	// proxy refers to the TProxy.
+	proxy *TProxy
+
+	// reader is the OPTIONAL reader returning what the censor injected.
+	reader io.Reader
+
+	// ttl is the TTL of the segments we send.
+	ttl int
+}
+
+// SetTTL implements model.TTLConn.SetTTL.
+func (c *tProxyTTLConn) SetTTL(ttl int) error {
+	defer c.mu.Unlock()
+	c.mu.Lock()
+	c.ttl = ttl
+	return nil
+}
+
+// Read implements net.Conn.Read. We return what the censor injected,
+// if anything, and otherwise we read from the underlying conn.
+func (c *tProxyTTLConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	reader := c.reader
+	c.mu.Unlock()
+	if reader != nil {
+		return reader.Read(b)
+	}
+	return c.Conn.Read(b)
+}
+
+// Write implements net.Conn.Write. When the censor sees a ClientHello
+// for a filtered SNI, we simulate what the censor would do. Otherwise,
+// we drop the segments that would not reach the server.
+func (c *tProxyTTLConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	ttl := c.ttl
+	c.mu.Unlock()
+	if ttl > 0 && c.proxy.reachesCensor(ttl) && len(c.proxy.config.SNIs) > 0 {
+		// A TLS record header is five bytes and the content type of a
+		// handshake record is 22. We ignore fragmented ClientHellos.
+		if len(b) > 5 && b[0] == 22 {
+			if sni, err := tlsParseClientHelloSNI(b[5:]); err == nil {
+				if action := c.proxy.onIncomingSNI(sni); action != TLSActionPass {
+					c.inject(action)
+					return len(b), nil
+				}
+			}
+		}
+	}
+	if !c.proxy.reachesServer(ttl) {
+		c.proxy.logger.Infof("tproxy: Write: %s ttl=%d => time exceeded",
+			c.Conn.RemoteAddr().String(), ttl)
+		return len(b), nil
+	}
+	return c.Conn.Write(b)
+}
+
+// inject simulates the censor's reaction to a ClientHello.
+func (c *tProxyTTLConn) inject(action TLSAction) {
+	var reader io.Reader
+	switch action {
+	case TLSActionTimeout:
+		return // the censor just drops the ClientHello
+	case TLSActionAlertInternalError:
+		reader = bytes.NewReader(tlsAlertRecord(tlsAlertInternalError))
+	case TLSActionAlertUnrecognizedName:
+		reader = bytes.NewReader(tlsAlertRecord(tlsAlertUnrecognizedName))
+	case TLSActionEOF:
+		reader = &tProxyErrReader{err: io.EOF}
+	default:
+		reader = &tProxyErrReader{err: netxlite.ECONNRESET}
+	}
+	defer c.mu.Unlock()
+	c.mu.Lock()
+	c.reader = reader
+}
+
+// tProxyErrReader is an io.Reader that always fails.
+type tProxyErrReader struct {
+	err error
+}
+
+// Read implements io.Reader.Read.
+func (r *tProxyErrReader) Read(b []byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,297 @@
+package filtering
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestTProxyTTLDialer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	address := listener.Addr().String()
+
+	dial := func(config *TProxyConfig, ttl int) (net.Conn, error) {
+		proxy, err := NewTProxy(config, log.Log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer proxy.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		return proxy.NewSimpleDialerWithTTL(time.Second, ttl).DialContext(ctx, "tcp", address)
+	}
+
+	t.Run("without a censor", func(t *testing.T) {
+		config := &TProxyConfig{Hops: 5}
+		for ttl := 1; ttl < 5; ttl++ {
+			conn, err := dial(config, ttl)
+			if !errors.Is(err, netxlite.EHOSTUNREACH) || conn != nil {
+				t.Fatal("unexpected result", ttl, err)
+			}
+		}
+		for _, ttl := range []int{0, 5, 6} {
+			conn, err := dial(config, ttl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := conn.(model.TTLConn); !ok {
+				t.Fatal("not a TTLConn")
+			}
+			conn.Close()
+		}
+	})
+
+	t.Run("with a censor rejecting the SYN", func(t *testing.T) {
+		config := &TProxyConfig{
+			Endpoints: map[string]TProxyPolicy{address + "/tcp": TProxyPolicyTCPRejectSYN},
+			Hops:      5,
+			CensorHop: 3,
+		}
+		conn, err := dial(config, 2)
+		if !errors.Is(err, netxlite.EHOSTUNREACH) || conn != nil {
+			t.Fatal("unexpected result", err)
+		}
+		for _, ttl := range []int{0, 3, 5} {
+			conn, err := dial(config, ttl)
+			if !errors.Is(err, netxlite.ECONNREFUSED) || conn != nil {
+				t.Fatal("unexpected result", ttl, err)
+			}
+		}
+	})
+
+	t.Run("with a censor dropping the SYN", func(t *testing.T) {
+		config := &TProxyConfig{
+			Endpoints: map[string]TProxyPolicy{address + "/tcp": TProxyPolicyTCPDropSYN},
+			Hops:      5,
+			CensorHop: 3,
+		}
+		conn, err := dial(config, 3)
+		if err == nil || !strings.HasSuffix(err.Error(), "i/o timeout") || conn != nil {
+			t.Fatal("unexpected result", err)
+		}
+	})
+}
+
+func TestTProxyTTLConn(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	address := strings.TrimPrefix(srv.URL, "https://")
+	config := &TProxyConfig{
+		SNIs: map[string]TLSAction{
+			"reset.example.com":   TLSActionReset,
+			"timeout.example.com": TLSActionTimeout,
+			"eof.example.com":     TLSActionEOF,
+			"alert.example.com":   TLSActionAlertUnrecognizedName,
+		},
+		Hops:      5,
+		CensorHop: 3,
+	}
+	proxy, err := NewTProxy(config, log.Log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+
+	handshake := func(sni string, ttl int) error {
+		conn, err := proxy.NewSimpleDialerWithTTL(time.Second, 0).DialContext(
+			context.Background(), "tcp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if err := conn.(model.TTLConn).SetTTL(ttl); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(250 * time.Millisecond))
+		return tls.Client(conn, &tls.Config{
+			ServerName:         sni,
+			InsecureSkipVerify: true,
+		}).Handshake()
+	}
+
+	isTimeout := func(err error) bool {
+		var nerr net.Error
+		return errors.As(err, &nerr) && nerr.Timeout()
+	}
+
+	t.Run("the ClientHello does not reach the censor", func(t *testing.T) {
+		if err := handshake("reset.example.com", 2); !isTimeout(err) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("the censor resets the connection", func(t *testing.T) {
+		if err := handshake("reset.example.com", 3); !errors.Is(err, netxlite.ECONNRESET) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("the censor drops the ClientHello", func(t *testing.T) {
+		if err := handshake("timeout.example.com", 3); !isTimeout(err) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("the censor closes the connection", func(t *testing.T) {
+		if err := handshake("eof.example.com", 3); !errors.Is(err, io.EOF) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("the censor sends an alert", func(t *testing.T) {
+		err := handshake("alert.example.com", 4)
+		if err == nil || !strings.HasSuffix(err.Error(), "unrecognized name") {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("the ClientHello does not reach the server", func(t *testing.T) {
+		if err := handshake("www.example.com", 4); !isTimeout(err) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("the ClientHello reaches the server", func(t *testing.T) {
+		for _, ttl := range []int{0, 5} {
+			if err := handshake("www.example.com", ttl); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestTProxyTTLUDPLikeConn(t *testing.T) {
+	server, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go func() {
+		buffer := make([]byte, 1<<12)
+		for {
+			count, addr, err := server.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			query := &dns.Msg{}
+			if err := query.Unpack(buffer[:count]); err != nil {
+				continue
+			}
+			reply := &dns.Msg{}
+			reply.SetReply(query)
+			data, _ := reply.Pack()
+			server.WriteTo(data, addr)
+		}
+	}()
+	config := &TProxyConfig{
+		Domains:   map[string]DNSAction{"example.com.": DNSActionNXDOMAIN},
+		Hops:      5,
+		CensorHop: 3,
+	}
+	proxy, err := NewTProxy(config, log.Log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+
+	exchange := func(pkt []byte, ttl int) (*dns.Msg, error) {
+		pconn, err := proxy.ListenUDPWithTTL("udp4", nil, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pconn.Close()
+		if _, err := pconn.WriteTo(pkt, server.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+		pconn.SetDeadline(time.Now().Add(250 * time.Millisecond))
+		buffer := make([]byte, 1<<12)
+		count, _, err := pconn.ReadFrom(buffer)
+		if err != nil {
+			return nil, err
+		}
+		reply := &dns.Msg{}
+		if err := reply.Unpack(buffer[:count]); err != nil {
+			t.Fatal(err)
+		}
+		return reply, nil
+	}
+	newQuery := func(domain string) []byte {
+		query := &dns.Msg{}
+		query.SetQuestion(dns.Fqdn(domain), dns.TypeA)
+		data, err := query.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	t.Run("the query does not reach the censor", func(t *testing.T) {
+		if reply, err := exchange(newQuery("example.com"), 2); err == nil {
+			t.Fatal("unexpected reply", reply)
+		}
+	})
+
+	t.Run("the censor injects a reply", func(t *testing.T) {
+		for _, ttl := range []int{3, 4} {
+			reply, err := exchange(newQuery("example.com"), ttl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reply.Rcode != dns.RcodeNameError {
+				t.Fatal("unexpected rcode", reply.Rcode)
+			}
+		}
+	})
+
+	t.Run("the query does not reach the server", func(t *testing.T) {
+		for _, pkt := range [][]byte{newQuery("example.org"), []byte("abc")} {
+			if reply, err := exchange(pkt, 4); err == nil {
+				t.Fatal("unexpected reply", reply)
+			}
+		}
+	})
+
+	t.Run("the query reaches the server", func(t *testing.T) {
+		for _, ttl := range []int{0, 5} {
+			reply, err := exchange(newQuery("example.org"), ttl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reply.Rcode != dns.RcodeSuccess {
+				t.Fatal("unexpected rcode", reply.Rcode)
+			}
+		}
+	})
+
+	t.Run("ListenUDPWithTTL failure", func(t *testing.T) {
+		pconn, err := proxy.ListenUDPWithTTL("tcp", nil, 3)
+		if err == nil || pconn != nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
@@ -154,6 +154,7 @@ var Specs = []*ErrorSpec{
 	// want to be upper case in uppercase here. For example,
 	// we must write "DNS" rather than writing "dns".
 	NewLibraryError("DNS_bogon_error"),
+	NewLibraryError("DNS_DNSSEC_bogus"),
 	NewLibraryError("DNS_NXDOMAIN_error"),
 	NewLibraryError("DNS_refused_error"),
 	NewLibraryError("DNS_server_misbehaving"),
@@ -0,0 +1,215 @@
+package netxlite
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// ParallelResolver is a "happy eyeballs" resolver that sends the same
+// query using several DNS transports at the same time and returns the
+// first successful answer to the caller.
+//
+// The answers returned by the other transports (i.e., the "losers")
+// are not discarded. If OnAnswer is set, we invoke it for every answer.
+// By default, we return as soon as we have a winner and the losers
+// continue running in the background using the caller's context, which
+// means they may fail with a context error when the caller cancels
+// the context after we return. Set WaitAll to true to wait for all the
+// transports to complete before returning, which is what you want when
+// you need to record disagreements between transports (e.g., measurex).
+//
+// Each transport uses its own SerialResolver, so the queries sent
+// over a given transport follow the same retry logic of SerialResolver.
+//
+// You should probably use NewParallelResolver to create a new instance.
+type ParallelResolver struct {
+	// OnAnswer is the OPTIONAL callback invoked for each answer. We
+	// serialize the calls to this callback, so it will never run
+	// concurrently, even with concurrent lookups. Unless WaitAll is
+	// true, we may invoke it after LookupHost has returned.
+	OnAnswer func(ans *ParallelResolverAnswer)
+
+	// Resolvers contains the MANDATORY per-transport resolvers.
+	Resolvers []*SerialResolver
+
+	// WaitAll OPTIONALLY indicates that lookups should only return
+	// after every transport has returned an answer. When this field is
+	// true, we invoke OnAnswer for all the answers before returning.
+	WaitAll bool
+
+	// mu serializes the calls to OnAnswer.
+	mu sync.Mutex
+}
+
+// ParallelResolverAnswer is the answer returned by a single transport.
+type ParallelResolverAnswer struct {
+	// Network is the network of the transport (e.g., "udp").
+	Network string
+
+	// Address is the address of the transport (e.g., "8.8.8.8:53").
+	Address string
+
+	// Operation is either "LookupHost" or "LookupHTTPS".
+	Operation string
+
+	// Domain is the domain we were resolving.
+	Domain string
+
+	// Addrs contains the addresses returned by LookupHost.
+	Addrs []string
+
+	// HTTPS contains the result of LookupHTTPS (nil for LookupHost).
+	HTTPS *model.HTTPSSvc
+
+	// Err is the error that occurred (if any). We wrap this error
+	// using ErrWrapper, so it's already a OONI failure.
+	Err error
+
+	// Started is when we started the lookup.
+	Started time.Time
+
+	// Finished is when the lookup terminated.
+	Finished time.Time
+
+	// Winner indicates whether this answer is the one we
+	// returned to the caller of the ParallelResolver.
+	Winner bool
+}
+
+// NewParallelResolver creates a new ParallelResolver instance
+// that uses all the given transports in parallel.
+func NewParallelResolver(txps ...model.DNSTransport) *ParallelResolver {
+	r := &ParallelResolver{}
+	for _, txp := range txps {
+		r.Resolvers = append(r.Resolvers, NewSerialResolver(txp))
+	}
+	return r
+}
+
+var _ model.Resolver = &ParallelResolver{}
+
+// Network returns "parallel".
+func (r *ParallelResolver) Network() string {
+	return "parallel"
+}
+
+// Address returns the comma separated list of transport addresses.
+func (r *ParallelResolver) Address() string {
+	var addrs []string
+	for _, reso := range r.Resolvers {
+		addrs = append(addrs, reso.Address())
+	}
+	return strings.Join(addrs, ",")
+}
+
+// CloseIdleConnections closes idle connections, if any.
+func (r *ParallelResolver) CloseIdleConnections() {
+	for _, reso := range r.Resolvers {
+		reso.CloseIdleConnections()
+	}
+}
+
+// LookupHost runs LookupHost with all the transports in parallel and
+// returns the first successful answer. When all the transports fail,
+// we return the error that occurred first.
+func (r *ParallelResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	ans, err := r.race(ctx, "LookupHost", hostname, func(
+		ctx context.Context, reso *SerialResolver, ans *ParallelResolverAnswer) error {
+		addrs, err := reso.LookupHost(ctx, hostname)
+		ans.Addrs = addrs
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ans.Addrs, nil
+}
+
+// LookupHTTPS is like LookupHost but for HTTPS queries.
+func (r *ParallelResolver) LookupHTTPS(
+	ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+	ans, err := r.race(ctx, "LookupHTTPS", domain, func(
+		ctx context.Context, reso *SerialResolver, ans *ParallelResolverAnswer) error {
+		https, err := reso.LookupHTTPS(ctx, domain)
+		ans.HTTPS = https
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ans.HTTPS, nil
+}
+
+// race runs the given lookup function with all the resolvers in parallel
+// and waits for the first successful answer (or for all the answers
+// when WaitAll is true). The lookup function fills the answer with the
+// lookup results and returns the error that occurred, if any.
+func (r *ParallelResolver) race(ctx context.Context, operation, domain string,
+	lookup func(ctx context.Context, reso *SerialResolver, ans *ParallelResolverAnswer) error,
+) (*ParallelResolverAnswer, error) {
+	outch := make(chan *ParallelResolverAnswer, len(r.Resolvers))
+	for _, reso := range r.Resolvers {
+		go func(reso *SerialResolver) {
+			ans := &ParallelResolverAnswer{
+				Network:   reso.Network(),
+				Address:   reso.Address(),
+				Operation: operation,
+				Domain:    domain,
+				Started:   time.Now(),
+			}
+			if err := lookup(ctx, reso, ans); err != nil {
+				ans.Err = NewErrWrapper(classifyResolverError, ResolveOperation, err)
+			}
+			ans.Finished = time.Now()
+			outch <- ans
+		}(reso)
+	}
+	return r.wait(outch)
+}
+
+// wait waits for the first successful answer. Once we have a winner, we
+// collect the answers returned by the losers, either in the background
+// or synchronously, depending on the value of WaitAll.
+func (r *ParallelResolver) wait(outch <-chan *ParallelResolverAnswer) (*ParallelResolverAnswer, error) {
+	var errorslist []error
+	for idx := 0; idx < len(r.Resolvers); idx++ {
+		ans := <-outch
+		if ans.Err != nil {
+			errorslist = append(errorslist, ans.Err)
+			r.emit(ans)
+			continue
+		}
+		ans.Winner = true
+		r.emit(ans)
+		if remaining := len(r.Resolvers) - idx - 1; r.WaitAll {
+			r.drain(outch, remaining)
+		} else {
+			go r.drain(outch, remaining)
+		}
+		return ans, nil
+	}
+	if len(errorslist) <= 0 {
+		return nil, ErrNoDNSTransport
+	}
+	return nil, errorslist[0]
+}
+
+// drain collects the remaining count answers from outch.
+func (r *ParallelResolver) drain(outch <-chan *ParallelResolverAnswer, count int) {
+	for idx := 0; idx < count; idx++ {
+		r.emit(<-outch)
+	}
+}
+
+// emit passes the answer to OnAnswer, if configured.
+func (r *ParallelResolver) emit(ans *ParallelResolverAnswer) {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	if r.OnAnswer != nil {
+		r.OnAnswer(ans)
+	}
+}
@@ -0,0 +1,278 @@
+package netxlite
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
+)
+
+// parallelResolverNewTransport returns a mocked transport with the given
+// address whose RoundTrip sleeps for delay and then calls fn.
+func parallelResolverNewTransport(address string, delay time.Duration,
+	fn func(query []byte) ([]byte, error)) *mocks.DNSTransport {
+	return &mocks.DNSTransport{
+		MockRoundTrip: func(ctx context.Context, query []byte) ([]byte, error) {
+			time.Sleep(delay)
+			return fn(query)
+		},
+		MockRequiresPadding: func() bool {
+			return false
+		},
+		MockNetwork: func() string {
+			return "udp"
+		},
+		MockAddress: func() string {
+			return address
+		},
+		MockCloseIdleConnections: func() {},
+	}
+}
+
+func TestParallelResolver(t *testing.T) {
+	t.Run("Network, Address, and CloseIdleConnections", func(t *testing.T) {
+		var called int
+		newTxp := func(address string) *mocks.DNSTransport {
+			return &mocks.DNSTransport{
+				MockAddress: func() string {
+					return address
+				},
+				MockCloseIdleConnections: func() {
+					called++
+				},
+			}
+		}
+		r := NewParallelResolver(newTxp("8.8.8.8:53"), newTxp("1.1.1.1:53"))
+		if r.Network() != "parallel" {
+			t.Fatal("invalid network")
+		}
+		if r.Address() != "8.8.8.8:53,1.1.1.1:53" {
+			t.Fatal("invalid address")
+		}
+		r.CloseIdleConnections()
+		if called != 2 {
+			t.Fatal("did not close all transports")
+		}
+	})
+
+	t.Run("LookupHost", func(t *testing.T) {
+		t.Run("without any transport", func(t *testing.T) {
+			r := NewParallelResolver()
+			addrs, err := r.LookupHost(context.Background(), "x.org")
+			if !errors.Is(err, ErrNoDNSTransport) {
+				t.Fatal("unexpected err", err)
+			}
+			if addrs != nil {
+				t.Fatal("expected nil addrs")
+			}
+		})
+
+		t.Run("the fastest successful transport wins", func(t *testing.T) {
+			slow := parallelResolverNewTransport("1.1.1.1:53", 200*time.Millisecond,
+				func(query []byte) ([]byte, error) {
+					return dnsGenLookupHostReplySuccess(t, dns.TypeA, "130.192.91.211"), nil
+				})
+			fast := parallelResolverNewTransport("8.8.8.8:53", 0,
+				func(query []byte) ([]byte, error) {
+					return dnsGenLookupHostReplySuccess(t, dns.TypeA, "10.10.34.35"), nil
+				})
+			r := NewParallelResolver(slow, fast)
+			var (
+				answers []*ParallelResolverAnswer
+				mu      sync.Mutex
+				wg      sync.WaitGroup
+			)
+			wg.Add(2)
+			r.OnAnswer = func(ans *ParallelResolverAnswer) {
+				mu.Lock()
+				answers = append(answers, ans)
+				mu.Unlock()
+				wg.Done()
+			}
+			addrs, err := r.LookupHost(context.Background(), "x.org")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"10.10.34.35"}, addrs); diff != "" {
+				t.Fatal(diff)
+			}
+			wg.Wait() // also wait for the loser
+			if len(answers) != 2 {
+				t.Fatal("unexpected number of answers")
+			}
+			if !answers[0].Winner || answers[0].Address != "8.8.8.8:53" {
+				t.Fatal("unexpected winner", answers[0])
+			}
+			if answers[1].Winner || answers[1].Address != "1.1.1.1:53" {
+				t.Fatal("unexpected loser", answers[1])
+			}
+			if diff := cmp.Diff([]string{"130.192.91.211"}, answers[1].Addrs); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("with WaitAll we wait for the losers", func(t *testing.T) {
+			slow := parallelResolverNewTransport("1.1.1.1:53", 200*time.Millisecond,
+				func(query []byte) ([]byte, error) {
+					return dnsGenLookupHostReplySuccess(t, dns.TypeA, "130.192.91.211"), nil
+				})
+			fast := parallelResolverNewTransport("8.8.8.8:53", 0,
+				func(query []byte) ([]byte, error) {
+					return dnsGenLookupHostReplySuccess(t, dns.TypeA, "10.10.34.35"), nil
+				})
+			r := NewParallelResolver(slow, fast)
+			r.WaitAll = true
+			var answers []*ParallelResolverAnswer
+			r.OnAnswer = func(ans *ParallelResolverAnswer) {
+				answers = append(answers, ans)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			addrs, err := r.LookupHost(ctx, "x.org")
+			cancel() // like measurex does, which must not affect the losers
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"10.10.34.35"}, addrs); diff != "" {
+				t.Fatal(diff)
+			}
+			if len(answers) != 2 {
+				t.Fatal("unexpected number of answers")
+			}
+			if !answers[0].Winner || answers[0].Address != "8.8.8.8:53" {
+				t.Fatal("unexpected winner", answers[0])
+			}
+			if answers[1].Winner || answers[1].Err != nil {
+				t.Fatal("unexpected loser", answers[1])
+			}
+			if diff := cmp.Diff([]string{"130.192.91.211"}, answers[1].Addrs); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("OnAnswer is never called concurrently", func(t *testing.T) {
+			newTxp := func(address string) *mocks.DNSTransport {
+				return parallelResolverNewTransport(address, 10*time.Millisecond,
+					func(query []byte) ([]byte, error) {
+						return dnsGenLookupHostReplySuccess(t, dns.TypeA, "10.10.34.35"), nil
+					})
+			}
+			r := NewParallelResolver(newTxp("1.1.1.1:53"), newTxp("8.8.8.8:53"))
+			r.WaitAll = true
+			var (
+				running int
+				maxseen int
+				mu      sync.Mutex
+			)
+			r.OnAnswer = func(ans *ParallelResolverAnswer) {
+				mu.Lock()
+				running++
+				if running > maxseen {
+					maxseen = running
+				}
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+			}
+			wg := &sync.WaitGroup{}
+			for idx := 0; idx < 4; idx++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					r.LookupHost(context.Background(), "x.org")
+				}()
+			}
+			wg.Wait()
+			if maxseen != 1 {
+				t.Fatal("OnAnswer invoked concurrently")
+			}
+		})
+
+		t.Run("a failed transport does not prevent success", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			failing := parallelResolverNewTransport("1.1.1.1:53", 0,
+				func(query []byte) ([]byte, error) {
+					return nil, expected
+				})
+			working := parallelResolverNewTransport("8.8.8.8:53", 50*time.Millisecond,
+				func(query []byte) ([]byte, error) {
+					return dnsGenLookupHostReplySuccess(t, dns.TypeA, "10.10.34.35"), nil
+				})
+			r := NewParallelResolver(failing, working)
+			addrs, err := r.LookupHost(context.Background(), "x.org")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"10.10.34.35"}, addrs); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("all transports failing", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			newFailing := func(address string) *mocks.DNSTransport {
+				return parallelResolverNewTransport(address, 0,
+					func(query []byte) ([]byte, error) {
+						return nil, expected
+					})
+			}
+			r := NewParallelResolver(newFailing("1.1.1.1:53"), newFailing("8.8.8.8:53"))
+			var count int
+			r.OnAnswer = func(ans *ParallelResolverAnswer) {
+				if ans.Winner || ans.Err == nil {
+					t.Fatal("unexpected answer", ans)
+				}
+				count++
+			}
+			addrs, err := r.LookupHost(context.Background(), "x.org")
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if addrs != nil {
+				t.Fatal("expected nil addrs")
+			}
+			if count != 2 {
+				t.Fatal("unexpected number of answers")
+			}
+		})
+	})
+
+	t.Run("LookupHTTPS", func(t *testing.T) {
+		t.Run("on success", func(t *testing.T) {
+			txp := parallelResolverNewTransport("8.8.8.8:53", 0,
+				func(query []byte) ([]byte, error) {
+					return dnsGenHTTPSReplySuccess(t, []string{"h3"}, nil, nil), nil
+				})
+			r := NewParallelResolver(txp)
+			https, err := r.LookupHTTPS(context.Background(), "x.org")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"h3"}, https.ALPN); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("on failure", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			txp := parallelResolverNewTransport("8.8.8.8:53", 0,
+				func(query []byte) ([]byte, error) {
+					return nil, expected
+				})
+			r := NewParallelResolver(txp)
+			https, err := r.LookupHTTPS(context.Background(), "x.org")
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if https != nil {
+				t.Fatal("expected nil https")
+			}
+		})
+	})
+}
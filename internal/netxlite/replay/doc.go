@@ -0,0 +1,26 @@
+// Package replay records and replays network activity.
+//
+// The Recorder type is a model.UnderlyingNetworkLibrary that wraps
+// another model.UnderlyingNetworkLibrary (typically netxlite's default
+// one) and writes every system lookup, dial, read, write, and UDP
+// datagram into a JSONL file containing Event structures.
+//
+// The Replayer type is a model.UnderlyingNetworkLibrary that reads
+// such a file and serves the recorded events back without using
+// the network. We match dials by network and address and system
+// lookups by domain, in the order in which they were recorded. A
+// read only returns after the code has performed as many writes on
+// the same conn as it had performed when we recorded the read. This
+// makes the replay deterministic, even with concurrent code.
+//
+// The typical usage is to set netxlite.TProxy to a Recorder while
+// running a measurement in the field and then to set netxlite.TProxy
+// to a Replayer to turn such a measurement into a hermetic test. The
+// miniooni --record and --replay flags do exactly that.
+//
+// We replay plaintext protocols (e.g., DNS-over-UDP and HTTP) exactly
+// and we replay failures occurring during TLS and QUIC handshakes
+// (e.g., a connection reset or a timeout after the ClientHello). Yet,
+// we cannot replay successful TLS and QUIC handshakes, because the
+// client's ephemeral keys change every time we run.
+package replay
@@ -0,0 +1,130 @@
+package replay
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// Event is a recorded network event.
+type Event struct {
+	// Op is the operation (one of the OpXXX constants).
+	Op string `json:"op"`
+
+	// ID identifies the conn to which the event belongs. We
+	// assign IDs to conns in the order in which we create them.
+	ID int64 `json:"id,omitempty"`
+
+	// Network is the network (e.g., "tcp", "udp").
+	Network string `json:"network,omitempty"`
+
+	// Address is the dial address (for OpDial) or the remote
+	// address of a datagram (for OpReadFrom and OpWriteTo).
+	Address string `json:"address,omitempty"`
+
+	// Domain is the domain we resolved (for OpLookupHost).
+	Domain string `json:"domain,omitempty"`
+
+	// Addrs contains the resolved addresses (for OpLookupHost).
+	Addrs []string `json:"addrs,omitempty"`
+
+	// LocalAddr is the conn's local address (for OpDial and OpListenUDP).
+	LocalAddr string `json:"local_addr,omitempty"`
+
+	// RemoteAddr is the conn's remote address (for OpDial).
+	RemoteAddr string `json:"remote_addr,omitempty"`
+
+	// Data contains the bytes read or written.
+	Data []byte `json:"data,omitempty"`
+
+	// Writes is the number of writes we had performed on the conn
+	// when we performed this read (for OpRead and OpReadFrom).
+	Writes int64 `json:"writes,omitempty"`
+
+	// Failure is the OONI failure string (nil on success).
+	Failure *string `json:"failure"`
+
+	// T is the time in seconds since we started recording.
+	T float64 `json:"t"`
+}
+
+const (
+	// OpLookupHost is a system resolver lookup.
+	OpLookupHost = "lookup_host"
+
+	// OpDial is a dial.
+	OpDial = "dial"
+
+	// OpRead is a read on a conn.
+	OpRead = "read"
+
+	// OpWrite is a write on a conn.
+	OpWrite = "write"
+
+	// OpListenUDP creates an UDP conn.
+	OpListenUDP = "listen_udp"
+
+	// OpReadFrom reads a datagram from an UDP conn.
+	OpReadFrom = "read_from"
+
+	// OpWriteTo writes a datagram into an UDP conn.
+	OpWriteTo = "write_to"
+)
+
+// newFailure converts an error to a OONI failure string.
+func newFailure(err error) *string {
+	if err == nil {
+		return nil
+	}
+	s := netxlite.NewTopLevelGenericErrWrapper(err).Failure
+	return &s
+}
+
+// newError converts a recorded failure back to an error. We return the
+// errors that the code expects to see for EOF and deadlines and we
+// otherwise return an error that netxlite classifies as the failure.
+func newError(failure *string, operation string) error {
+	switch {
+	case failure == nil:
+		return nil
+	case *failure == netxlite.FailureEOFError:
+		return io.EOF
+	case *failure == netxlite.FailureGenericTimeoutError && operation != netxlite.ConnectOperation:
+		return os.ErrDeadlineExceeded
+	default:
+		return &netxlite.ErrWrapper{
+			Failure:    *failure,
+			Operation:  operation,
+			WrappedErr: errors.New(*failure),
+		}
+	}
+}
+
+// addr is a recorded net.Addr.
+type addr struct {
+	network string
+	address string
+}
+
+var _ net.Addr = &addr{}
+
+// Network implements net.Addr.Network.
+func (a *addr) Network() string {
+	return a.network
+}
+
+// String implements net.Addr.String.
+func (a *addr) String() string {
+	return a.address
+}
+
+// newAddrString returns the string representation of a net.Addr.
+func newAddrString(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	return a.String()
+}
@@ -0,0 +1,236 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+// Recorder is a model.UnderlyingNetworkLibrary that records
+// all the network events. You MUST use NewRecorder to create
+// a new instance of this type.
+type Recorder struct {
+	// begin is when we started recording.
+	begin time.Time
+
+	// encoder writes events.
+	encoder *json.Encoder
+
+	// err is the first error that occurred when writing events.
+	err error
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// nextID is the ID of the next conn.
+	nextID int64
+
+	// underlying is the underlying network library.
+	underlying model.UnderlyingNetworkLibrary
+}
+
+var _ model.UnderlyingNetworkLibrary = &Recorder{}
+
+// NewRecorder creates a new Recorder that uses the given underlying
+// network library and writes events into w as JSONL.
+func NewRecorder(underlying model.UnderlyingNetworkLibrary, w io.Writer) *Recorder {
+	return &Recorder{
+		begin:      time.Now(),
+		encoder:    json.NewEncoder(w),
+		underlying: underlying,
+	}
+}
+
+// Err returns the first error that occurred when writing events.
+func (r *Recorder) Err() error {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	return r.err
+}
+
+// newID returns the ID of a new conn.
+func (r *Recorder) newID() int64 {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	r.nextID++
+	return r.nextID
+}
+
+// write writes the given event.
+func (r *Recorder) write(ev *Event) {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	ev.T = time.Since(r.begin).Seconds()
+	if err := r.encoder.Encode(ev); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+// LookupHost implements model.UnderlyingNetworkLibrary.LookupHost.
+func (r *Recorder) LookupHost(ctx context.Context, domain string) ([]string, error) {
+	addrs, err := r.underlying.LookupHost(ctx, domain)
+	r.write(&Event{
+		Op:      OpLookupHost,
+		Domain:  domain,
+		Addrs:   addrs,
+		Failure: newFailure(err),
+	})
+	return addrs, err
+}
+
+// NewSimpleDialer implements model.UnderlyingNetworkLibrary.NewSimpleDialer.
+func (r *Recorder) NewSimpleDialer(timeout time.Duration) model.SimpleDialer {
+	return &recorderDialer{
+		dialer:   r.underlying.NewSimpleDialer(timeout),
+		recorder: r,
+	}
+}
+
+// recorderDialer is a dialer that records events.
+type recorderDialer struct {
+	dialer   model.SimpleDialer
+	recorder *Recorder
+}
+
+// DialContext implements model.SimpleDialer.DialContext.
+func (d *recorderDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	id := d.recorder.newID()
+	conn, err := d.dialer.DialContext(ctx, network, address)
+	ev := &Event{
+		Op:      OpDial,
+		ID:      id,
+		Network: network,
+		Address: address,
+		Failure: newFailure(err),
+	}
+	if err != nil {
+		d.recorder.write(ev)
+		return nil, err
+	}
+	ev.LocalAddr = newAddrString(conn.LocalAddr())
+	ev.RemoteAddr = newAddrString(conn.RemoteAddr())
+	d.recorder.write(ev)
+	return &recorderConn{Conn: conn, id: id, recorder: d.recorder}, nil
+}
+
+// recorderConn is a net.Conn that records events.
+type recorderConn struct {
+	net.Conn
+	id       int64
+	mu       sync.Mutex
+	recorder *Recorder
+	writes   int64
+}
+
+// Read implements net.Conn.Read.
+func (c *recorderConn) Read(b []byte) (int, error) {
+	count, err := c.Conn.Read(b)
+	if errors.Is(err, net.ErrClosed) {
+		return count, err // we closed the conn, so there's nothing to replay
+	}
+	c.mu.Lock()
+	writes := c.writes
+	c.mu.Unlock()
+	c.recorder.write(&Event{
+		Op:      OpRead,
+		ID:      c.id,
+		Data:    b[:count],
+		Writes:  writes,
+		Failure: newFailure(err),
+	})
+	return count, err
+}
+
+// Write implements net.Conn.Write.
+func (c *recorderConn) Write(b []byte) (int, error) {
+	// We count the write before performing it, such that a concurrent
+	// read returning a reply to this write sees the updated counter.
+	c.mu.Lock()
+	c.writes++
+	c.mu.Unlock()
+	count, err := c.Conn.Write(b)
+	c.recorder.write(&Event{
+		Op:      OpWrite,
+		ID:      c.id,
+		Data:    b[:count],
+		Failure: newFailure(err),
+	})
+	return count, err
+}
+
+// ListenUDP implements model.UnderlyingNetworkLibrary.ListenUDP.
+func (r *Recorder) ListenUDP(network string, laddr *net.UDPAddr) (model.UDPLikeConn, error) {
+	id := r.newID()
+	pconn, err := r.underlying.ListenUDP(network, laddr)
+	ev := &Event{
+		Op:      OpListenUDP,
+		ID:      id,
+		Network: network,
+		Failure: newFailure(err),
+	}
+	if err != nil {
+		r.write(ev)
+		return nil, err
+	}
+	ev.LocalAddr = newAddrString(pconn.LocalAddr())
+	r.write(ev)
+	return &recorderUDPLikeConn{UDPLikeConn: pconn, id: id, recorder: r}, nil
+}
+
+// recorderUDPLikeConn is a model.UDPLikeConn that records events.
+type recorderUDPLikeConn struct {
+	model.UDPLikeConn
+	id       int64
+	mu       sync.Mutex
+	recorder *Recorder
+	writes   int64
+}
+
+// ReadFrom implements model.UDPLikeConn.ReadFrom.
+func (c *recorderUDPLikeConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	count, addr, err := c.UDPLikeConn.ReadFrom(b)
+	if errors.Is(err, net.ErrClosed) {
+		return count, addr, err // we closed the conn, so there's nothing to replay
+	}
+	c.mu.Lock()
+	writes := c.writes
+	c.mu.Unlock()
+	ev := &Event{
+		Op:      OpReadFrom,
+		ID:      c.id,
+		Address: newAddrString(addr),
+		Data:    b[:count],
+		Writes:  writes,
+		Failure: newFailure(err),
+	}
+	if addr != nil {
+		ev.Network = addr.Network()
+	}
+	c.recorder.write(ev)
+	return count, addr, err
+}
+
+// WriteTo implements model.UDPLikeConn.WriteTo.
+func (c *recorderUDPLikeConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	// We count the write before performing it, such that a concurrent
+	// read returning a reply to this write sees the updated counter.
+	c.mu.Lock()
+	c.writes++
+	c.mu.Unlock()
+	count, err := c.UDPLikeConn.WriteTo(b, addr)
+	c.recorder.write(&Event{
+		Op:      OpWriteTo,
+		ID:      c.id,
+		Network: addr.Network(),
+		Address: addr.String(),
+		Data:    b[:count],
+		Failure: newFailure(err),
+	})
+	return count, err
+}
@@ -0,0 +1,287 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+func TestRecordAndReplayHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("deterministic body"))
+	}))
+	URL := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	get := func() (int, string) {
+		client := netxlite.NewHTTPClientStdlib(log.Log)
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest("GET", URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := netxlite.ReadAllContext(context.Background(), resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(data)
+	}
+
+	var recording bytes.Buffer
+	recorder := NewRecorder(&netxlite.TProxyStdlib{}, &recording)
+	orig := netxlite.TProxy
+	netxlite.TProxy = recorder
+	defer func() {
+		netxlite.TProxy = orig
+	}()
+	recordedStatus, recordedBody := get()
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close() // make sure we cannot use the network while replaying
+
+	replayer, err := NewReplayer(&recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	netxlite.TProxy = replayer
+	replayedStatus, replayedBody := get()
+	if recordedStatus != 200 || replayedStatus != recordedStatus {
+		t.Fatal("unexpected status", recordedStatus, replayedStatus)
+	}
+	if recordedBody != "deterministic body" || replayedBody != recordedBody {
+		t.Fatal("unexpected body", recordedBody, replayedBody)
+	}
+}
+
+func TestRecordAndReplayUDP(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buffer := make([]byte, 1024)
+		for {
+			count, addr, err := server.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			server.WriteTo(bytes.ToUpper(buffer[:count]), addr)
+		}
+	}()
+	serverAddr := server.LocalAddr()
+	exchange := func(t *testing.T, pconn net.PacketConn) (string, string) {
+		defer pconn.Close()
+		if _, err := pconn.WriteTo([]byte("ping"), serverAddr); err != nil {
+			t.Fatal(err)
+		}
+		buffer := make([]byte, 1024)
+		count, from, err := pconn.ReadFrom(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buffer[:count]), from.String()
+	}
+
+	var recording bytes.Buffer
+	recorder := NewRecorder(&netxlite.TProxyStdlib{}, &recording)
+	pconn, err := recorder.ListenUDP("udp", &net.UDPAddr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordedData, recordedFrom := exchange(t, pconn)
+	server.Close()
+
+	replayer, err := NewReplayer(&recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pconn, err = replayer.ListenUDP("udp", &net.UDPAddr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayedData, replayedFrom := exchange(t, pconn)
+	if recordedData != "PING" || replayedData != recordedData {
+		t.Fatal("unexpected data", recordedData, replayedData)
+	}
+	if recordedFrom != serverAddr.String() || replayedFrom != recordedFrom {
+		t.Fatal("unexpected from", recordedFrom, replayedFrom)
+	}
+}
+
+// newTestReplayer creates a Replayer from the given JSONL.
+func newTestReplayer(t *testing.T, jsonl string) *Replayer {
+	replayer, err := NewReplayer(strings.NewReader(jsonl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return replayer
+}
+
+// failureOf returns the OONI failure string of err.
+func failureOf(err error) string {
+	return netxlite.NewTopLevelGenericErrWrapper(err).Failure
+}
+
+func TestReplayer(t *testing.T) {
+	t.Run("NewReplayer with invalid JSON", func(t *testing.T) {
+		replayer, err := NewReplayer(strings.NewReader("{"))
+		if err == nil || replayer != nil {
+			t.Fatal("expected an error and a nil replayer")
+		}
+	})
+
+	t.Run("LookupHost", func(t *testing.T) {
+		replayer := newTestReplayer(t, strings.Join([]string{
+			`{"op":"lookup_host","domain":"example.com","addrs":["1.1.1.1"],"failure":null}`,
+			`{"op":"lookup_host","domain":"example.com","failure":"dns_nxdomain_error"}`,
+		}, "\n"))
+		ctx := context.Background()
+		addrs, err := replayer.LookupHost(ctx, "example.com")
+		if err != nil || len(addrs) != 1 || addrs[0] != "1.1.1.1" {
+			t.Fatal("unexpected result", addrs, err)
+		}
+		_, err = replayer.LookupHost(ctx, "example.com")
+		if failureOf(err) != netxlite.FailureDNSNXDOMAINError {
+			t.Fatal("unexpected err", err)
+		}
+		_, err = replayer.LookupHost(ctx, "example.com")
+		if !errors.Is(err, ErrNoRecordedEvent) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("DialContext", func(t *testing.T) {
+		replayer := newTestReplayer(t, strings.Join([]string{
+			`{"op":"dial","id":1,"network":"tcp","address":"1.1.1.1:80","failure":"connection_refused"}`,
+			`{"op":"dial","id":2,"network":"tcp","address":"1.1.1.1:80","local_addr":"10.0.0.1:5555","remote_addr":"1.1.1.1:80","failure":null}`,
+			`{"op":"write","id":2,"data":"cGluZw==","failure":null}`,
+			`{"op":"read","id":2,"data":"cG9uZw==","writes":1,"failure":"eof_error"}`,
+		}, "\n"))
+		dialer := replayer.NewSimpleDialer(time.Second)
+		ctx := context.Background()
+		_, err := dialer.DialContext(ctx, "tcp", "1.1.1.1:80")
+		if failureOf(err) != netxlite.FailureConnectionRefused {
+			t.Fatal("unexpected err", err)
+		}
+		conn, err := dialer.DialContext(ctx, "tcp", "1.1.1.1:80")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if conn.LocalAddr().String() != "10.0.0.1:5555" || conn.RemoteAddr().String() != "1.1.1.1:80" {
+			t.Fatal("unexpected addresses", conn.LocalAddr(), conn.RemoteAddr())
+		}
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(conn)
+		if err != nil || string(data) != "pong" {
+			t.Fatal("unexpected result", string(data), err)
+		}
+		_, err = dialer.DialContext(ctx, "tcp", "1.1.1.1:80")
+		if !errors.Is(err, ErrNoRecordedEvent) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("Read waits for the recorded number of writes", func(t *testing.T) {
+		replayer := newTestReplayer(t, strings.Join([]string{
+			`{"op":"dial","id":1,"network":"tcp","address":"1.1.1.1:80","failure":null}`,
+			`{"op":"read","id":1,"data":"cG9uZw==","writes":1,"failure":null}`,
+			`{"op":"read","id":1,"writes":1,"failure":"generic_timeout_error"}`,
+		}, "\n"))
+		conn, err := replayer.NewSimpleDialer(time.Second).DialContext(
+			context.Background(), "tcp", "1.1.1.1:80")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		buffer := make([]byte, 2)
+		if _, err := conn.Read(buffer); !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatal("unexpected err", err)
+		}
+		conn.SetReadDeadline(time.Time{})
+		conn.Write([]byte("ping"))
+		for _, expected := range []string{"po", "ng"} {
+			count, err := conn.Read(buffer)
+			if err != nil || string(buffer[:count]) != expected {
+				t.Fatal("unexpected result", string(buffer[:count]), err)
+			}
+		}
+		if _, err := conn.Read(buffer); !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("Close unblocks Read", func(t *testing.T) {
+		replayer := newTestReplayer(t,
+			`{"op":"dial","id":1,"network":"tcp","address":"1.1.1.1:80","failure":null}`)
+		conn, err := replayer.NewSimpleDialer(time.Second).DialContext(
+			context.Background(), "tcp", "1.1.1.1:80")
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.AfterFunc(50*time.Millisecond, func() {
+			conn.Close()
+		})
+		if _, err := conn.Read(make([]byte, 8)); !errors.Is(err, net.ErrClosed) {
+			t.Fatal("unexpected err", err)
+		}
+		if _, err := conn.Write([]byte("ping")); !errors.Is(err, net.ErrClosed) {
+			t.Fatal("unexpected err", err)
+		}
+		if err := conn.Close(); !errors.Is(err, net.ErrClosed) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("ListenUDP", func(t *testing.T) {
+		replayer := newTestReplayer(t, strings.Join([]string{
+			`{"op":"listen_udp","id":1,"network":"udp","local_addr":"0.0.0.0:5555","failure":null}`,
+			`{"op":"write_to","id":1,"network":"udp","address":"8.8.8.8:53","failure":"connection_refused"}`,
+			`{"op":"read_from","id":1,"writes":1,"failure":"connection_refused"}`,
+		}, "\n"))
+		pconn, err := replayer.ListenUDP("udp", &net.UDPAddr{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pconn.Close()
+		if pconn.LocalAddr().String() != "0.0.0.0:5555" {
+			t.Fatal("unexpected local address", pconn.LocalAddr())
+		}
+		if err := pconn.SetReadBuffer(1 << 20); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pconn.SyscallConn(); err == nil {
+			t.Fatal("expected an error")
+		}
+		_, err = pconn.WriteTo([]byte("ping"), &net.UDPAddr{})
+		if failureOf(err) != netxlite.FailureConnectionRefused {
+			t.Fatal("unexpected err", err)
+		}
+		_, _, err = pconn.ReadFrom(make([]byte, 8))
+		if failureOf(err) != netxlite.FailureConnectionRefused {
+			t.Fatal("unexpected err", err)
+		}
+		_, err = replayer.ListenUDP("udp", &net.UDPAddr{})
+		if !errors.Is(err, ErrNoRecordedEvent) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+}
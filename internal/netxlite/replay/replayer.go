@@ -0,0 +1,404 @@
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/netxlite"
+)
+
+// ErrNoRecordedEvent indicates that we cannot find a recorded event
+// matching a dial, a lookup, or an UDP listen, which usually means
+// that the replayed code behaves differently from the recorded code.
+var ErrNoRecordedEvent = errors.New("replay: no recorded event")
+
+// Replayer is a model.UnderlyingNetworkLibrary that replays
+// recorded network events. You MUST use NewReplayer to create
+// a new instance of this type.
+type Replayer struct {
+	// dials maps each "network address" to the recorded dials.
+	dials map[string][]*Event
+
+	// listens contains the recorded UDP listens.
+	listens []*Event
+
+	// lookups maps each domain to the recorded lookups.
+	lookups map[string][]*Event
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// reads maps each conn ID to the recorded reads.
+	reads map[int64][]*Event
+
+	// writes maps each conn ID to the recorded writes.
+	writes map[int64][]*Event
+}
+
+var _ model.UnderlyingNetworkLibrary = &Replayer{}
+
+// NewReplayer creates a new Replayer that replays the JSONL
+// events written by a Recorder and read from r.
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	p := &Replayer{
+		dials:   make(map[string][]*Event),
+		lookups: make(map[string][]*Event),
+		reads:   make(map[int64][]*Event),
+		writes:  make(map[int64][]*Event),
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return nil, err
+		}
+		p.add(&ev)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewReplayerFromFile is like NewReplayer but reads the given file.
+func NewReplayerFromFile(filename string) (*Replayer, error) {
+	filep, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer filep.Close()
+	return NewReplayer(filep)
+}
+
+// add adds a recorded event to the replayer.
+func (p *Replayer) add(ev *Event) {
+	switch ev.Op {
+	case OpLookupHost:
+		p.lookups[ev.Domain] = append(p.lookups[ev.Domain], ev)
+	case OpDial:
+		key := ev.Network + " " + ev.Address
+		p.dials[key] = append(p.dials[key], ev)
+	case OpListenUDP:
+		p.listens = append(p.listens, ev)
+	case OpRead, OpReadFrom:
+		if len(ev.Data) > 0 && ev.Failure != nil {
+			// Split a read returning both data and an error into two
+			// reads, such that we can return the error after the data.
+			data := *ev
+			data.Failure = nil
+			p.reads[ev.ID] = append(p.reads[ev.ID], &data)
+			ev.Data = nil
+		}
+		p.reads[ev.ID] = append(p.reads[ev.ID], ev)
+	case OpWrite, OpWriteTo:
+		p.writes[ev.ID] = append(p.writes[ev.ID], ev)
+	}
+}
+
+// pop removes and returns the first event of the given list, if any.
+func (p *Replayer) pop(events map[string][]*Event, key string) *Event {
+	defer p.mu.Unlock()
+	p.mu.Lock()
+	list := events[key]
+	if len(list) <= 0 {
+		return nil
+	}
+	events[key] = list[1:]
+	return list[0]
+}
+
+// newState creates the state of the conn with the given ID.
+func (p *Replayer) newState(id int64) *replayState {
+	defer p.mu.Unlock()
+	p.mu.Lock()
+	return &replayState{
+		changed: make(chan interface{}),
+		reads:   p.reads[id],
+		writes:  p.writes[id],
+	}
+}
+
+// LookupHost implements model.UnderlyingNetworkLibrary.LookupHost.
+func (p *Replayer) LookupHost(ctx context.Context, domain string) ([]string, error) {
+	ev := p.pop(p.lookups, domain)
+	if ev == nil {
+		return nil, fmt.Errorf("%w: lookup %s", ErrNoRecordedEvent, domain)
+	}
+	if err := newError(ev.Failure, netxlite.ResolveOperation); err != nil {
+		return nil, err
+	}
+	return ev.Addrs, nil
+}
+
+// NewSimpleDialer implements model.UnderlyingNetworkLibrary.NewSimpleDialer.
+func (p *Replayer) NewSimpleDialer(timeout time.Duration) model.SimpleDialer {
+	return &replayDialer{replayer: p}
+}
+
+// replayDialer is a dialer that replays events.
+type replayDialer struct {
+	replayer *Replayer
+}
+
+// DialContext implements model.SimpleDialer.DialContext.
+func (d *replayDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	ev := d.replayer.pop(d.replayer.dials, network+" "+address)
+	if ev == nil {
+		return nil, fmt.Errorf("%w: dial %s/%s", ErrNoRecordedEvent, address, network)
+	}
+	if err := newError(ev.Failure, netxlite.ConnectOperation); err != nil {
+		return nil, err
+	}
+	return &replayConn{
+		local:       &addr{network: ev.Network, address: ev.LocalAddr},
+		remote:      &addr{network: ev.Network, address: ev.RemoteAddr},
+		replayState: d.replayer.newState(ev.ID),
+	}, nil
+}
+
+// ListenUDP implements model.UnderlyingNetworkLibrary.ListenUDP.
+func (p *Replayer) ListenUDP(network string, laddr *net.UDPAddr) (model.UDPLikeConn, error) {
+	p.mu.Lock()
+	var ev *Event
+	if len(p.listens) > 0 {
+		ev, p.listens = p.listens[0], p.listens[1:]
+	}
+	p.mu.Unlock()
+	if ev == nil {
+		return nil, fmt.Errorf("%w: listen %s", ErrNoRecordedEvent, network)
+	}
+	if err := newError(ev.Failure, netxlite.ConnectOperation); err != nil {
+		return nil, err
+	}
+	return &replayUDPLikeConn{
+		local:       &addr{network: ev.Network, address: ev.LocalAddr},
+		replayState: p.newState(ev.ID),
+	}, nil
+}
+
+// replayState is the state shared by replayed conns.
+type replayState struct {
+	// changed is closed and replaced whenever the state changes.
+	changed chan interface{}
+
+	// closed indicates whether we've been closed.
+	closed bool
+
+	// deadline is the read deadline.
+	deadline time.Time
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// pending contains the data not returned by the previous read.
+	pending []byte
+
+	// reads contains the recorded reads.
+	reads []*Event
+
+	// writeCount is the number of writes performed so far.
+	writeCount int64
+
+	// writes contains the recorded writes.
+	writes []*Event
+}
+
+// notifyUnlocked notifies the readers that the state changed.
+func (s *replayState) notifyUnlocked() {
+	close(s.changed)
+	s.changed = make(chan interface{})
+}
+
+// read blocks until we can replay the next recorded read and returns
+// such a read. This function returns an error if we have been closed
+// or the deadline expired while we were waiting.
+func (s *replayState) read() (*Event, error) {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil, net.ErrClosed
+		}
+		if len(s.reads) > 0 && s.reads[0].Writes <= s.writeCount {
+			ev := s.reads[0]
+			s.reads = s.reads[1:]
+			s.mu.Unlock()
+			return ev, nil
+		}
+		changed, deadline := s.changed, s.deadline
+		s.mu.Unlock()
+		if err := waitForChange(changed, deadline); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitForChange blocks until changed is closed or the deadline expires.
+func waitForChange(changed <-chan interface{}, deadline time.Time) error {
+	if deadline.IsZero() {
+		<-changed
+		return nil
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-changed:
+		return nil
+	case <-timer.C:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+// write replays the next recorded write and returns its error.
+func (s *replayState) write(operation string) error {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	if s.closed {
+		return net.ErrClosed
+	}
+	s.writeCount++
+	s.notifyUnlocked()
+	if len(s.writes) <= 0 {
+		return nil // the replayed code writes more than the recorded code
+	}
+	ev := s.writes[0]
+	s.writes = s.writes[1:]
+	return newError(ev.Failure, operation)
+}
+
+// Close implements net.Conn.Close.
+func (s *replayState) Close() error {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	if s.closed {
+		return net.ErrClosed
+	}
+	s.closed = true
+	s.notifyUnlocked()
+	return nil
+}
+
+// SetDeadline implements net.Conn.SetDeadline.
+func (s *replayState) SetDeadline(t time.Time) error {
+	return s.SetReadDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn.SetReadDeadline.
+func (s *replayState) SetReadDeadline(t time.Time) error {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	s.deadline = t
+	s.notifyUnlocked()
+	return nil
+}
+
+// SetWriteDeadline implements net.Conn.SetWriteDeadline.
+func (s *replayState) SetWriteDeadline(t time.Time) error {
+	return nil // writes never block
+}
+
+// replayConn is a net.Conn that replays events.
+type replayConn struct {
+	*replayState
+	local  net.Addr
+	remote net.Addr
+}
+
+var _ net.Conn = &replayConn{}
+
+// Read implements net.Conn.Read.
+func (c *replayConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	if len(c.pending) > 0 && !c.closed {
+		count := copy(b, c.pending)
+		c.pending = c.pending[count:]
+		c.mu.Unlock()
+		return count, nil
+	}
+	c.mu.Unlock()
+	ev, err := c.read()
+	if err != nil {
+		return 0, err
+	}
+	count := copy(b, ev.Data)
+	c.mu.Lock()
+	c.pending = ev.Data[count:]
+	c.mu.Unlock()
+	return count, newError(ev.Failure, netxlite.ReadOperation)
+}
+
+// Write implements net.Conn.Write.
+func (c *replayConn) Write(b []byte) (int, error) {
+	if err := c.write(netxlite.WriteOperation); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// LocalAddr implements net.Conn.LocalAddr.
+func (c *replayConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// RemoteAddr implements net.Conn.RemoteAddr.
+func (c *replayConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// replayUDPLikeConn is a model.UDPLikeConn that replays events.
+type replayUDPLikeConn struct {
+	*replayState
+	local net.Addr
+}
+
+var _ model.UDPLikeConn = &replayUDPLikeConn{}
+
+// ReadFrom implements model.UDPLikeConn.ReadFrom.
+func (c *replayUDPLikeConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	ev, err := c.read()
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := newError(ev.Failure, netxlite.ReadFromOperation); err != nil {
+		return 0, nil, err
+	}
+	var from net.Addr = &addr{network: ev.Network, address: ev.Address}
+	if udpAddr, err := net.ResolveUDPAddr(ev.Network, ev.Address); err == nil {
+		from = udpAddr // the address is always an IP address and port
+	}
+	return copy(b, ev.Data), from, nil
+}
+
+// WriteTo implements model.UDPLikeConn.WriteTo.
+func (c *replayUDPLikeConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if err := c.write(netxlite.WriteToOperation); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// LocalAddr implements model.UDPLikeConn.LocalAddr.
+func (c *replayUDPLikeConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// SetReadBuffer implements model.UDPLikeConn.SetReadBuffer.
+func (c *replayUDPLikeConn) SetReadBuffer(bytes int) error {
+	return nil
+}
+
+// SyscallConn implements model.UDPLikeConn.SyscallConn.
+func (c *replayUDPLikeConn) SyscallConn() (syscall.RawConn, error) {
+	return nil, errors.New("replay: SyscallConn not supported")
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"golang.org/x/net/idna"
 )
@@ -37,6 +38,18 @@ func NewResolverUDP(logger model.DebugLogger, dialer model.Dialer, address strin
 	))
 }
 
+// NewResolverParallel creates a new Resolver that races
+// the given DNS transports using a ParallelResolver.
+//
+// Arguments:
+//
+// - logger is the logger to use
+//
+// - txps contains the transports to use (e.g., UDP, DoT, DoH)
+func NewResolverParallel(logger model.DebugLogger, txps ...model.DNSTransport) model.Resolver {
+	return WrapResolver(logger, NewParallelResolver(txps...))
+}
+
 // WrapResolver creates a new resolver that wraps an
 // existing resolver to add these properties:
 //
@@ -72,7 +85,7 @@ type resolverSystem struct {
 	testableLookupHost func(ctx context.Context, domain string) ([]string, error)
 }
 
-var _ model.Resolver = &resolverSystem{}
+var _ model.RawResolver = &resolverSystem{}
 
 func (r *resolverSystem) LookupHost(ctx context.Context, hostname string) ([]string, error) {
 	// This code forces adding a shorter timeout to the domain name
@@ -131,13 +144,30 @@ func (r *resolverSystem) LookupHTTPS(
 	return nil, ErrNoDNSTransport
 }
 
+func (r *resolverSystem) LookupRaw(
+	ctx context.Context, hostname string, qtype uint16) (*model.DNSReply, error) {
+	return nil, ErrNoDNSTransport
+}
+
+// LookupRaw calls the LookupRaw method of the given resolver if it
+// is a model.RawResolver and otherwise returns ErrNoDNSTransport. Resolvers
+// wrapping another resolver use this function to implement LookupRaw.
+func LookupRaw(ctx context.Context, reso model.Resolver,
+	hostname string, qtype uint16) (*model.DNSReply, error) {
+	rr, good := reso.(model.RawResolver)
+	if !good {
+		return nil, ErrNoDNSTransport
+	}
+	return rr.LookupRaw(ctx, hostname, qtype)
+}
+
 // resolverLogger is a resolver that emits events
 type resolverLogger struct {
 	model.Resolver
 	Logger model.DebugLogger
 }
 
-var _ model.Resolver = &resolverLogger{}
+var _ model.RawResolver = &resolverLogger{}
 
 func (r *resolverLogger) LookupHost(ctx context.Context, hostname string) ([]string, error) {
 	prefix := fmt.Sprintf("resolve[A,AAAA] %s with %s (%s)", hostname, r.Network(), r.Address())
@@ -171,6 +201,22 @@ func (r *resolverLogger) LookupHTTPS(
 	return https, nil
 }
 
+func (r *resolverLogger) LookupRaw(
+	ctx context.Context, hostname string, qtype uint16) (*model.DNSReply, error) {
+	prefix := fmt.Sprintf("resolve[%s] %s with %s (%s)",
+		dns.TypeToString[qtype], hostname, r.Network(), r.Address())
+	r.Logger.Debugf("%s...", prefix)
+	start := time.Now()
+	reply, err := LookupRaw(ctx, r.Resolver, hostname, qtype)
+	elapsed := time.Since(start)
+	if err != nil {
+		r.Logger.Debugf("%s... %s in %s", prefix, err, elapsed)
+		return reply, err
+	}
+	r.Logger.Debugf("%s... %d answers in %s", prefix, len(reply.Answer), elapsed)
+	return reply, nil
+}
+
 // resolverIDNA supports resolving Internationalized Domain Names.
 //
 // See RFC3492 for more information.
@@ -195,6 +241,15 @@ func (r *resolverIDNA) LookupHTTPS(
 	return r.Resolver.LookupHTTPS(ctx, host)
 }
 
+func (r *resolverIDNA) LookupRaw(
+	ctx context.Context, hostname string, qtype uint16) (*model.DNSReply, error) {
+	host, err := idna.ToASCII(hostname)
+	if err != nil {
+		return nil, err
+	}
+	return LookupRaw(ctx, r.Resolver, host, qtype)
+}
+
 // resolverShortCircuitIPAddr recognizes when the input hostname is an
 // IP address and returns it immediately to the caller.
 type resolverShortCircuitIPAddr struct {
@@ -208,6 +263,11 @@ func (r *resolverShortCircuitIPAddr) LookupHost(ctx context.Context, hostname st
 	return r.Resolver.LookupHost(ctx, hostname)
 }
 
+func (r *resolverShortCircuitIPAddr) LookupRaw(
+	ctx context.Context, hostname string, qtype uint16) (*model.DNSReply, error) {
+	return LookupRaw(ctx, r.Resolver, hostname, qtype)
+}
+
 // ErrNoResolver is the type of error returned by "without resolver"
 // dialer when asked to dial for and endpoint containing a domain name,
 // since they can only dial for endpoints containing IP addresses.
@@ -243,7 +303,7 @@ type resolverErrWrapper struct {
 	model.Resolver
 }
 
-var _ model.Resolver = &resolverErrWrapper{}
+var _ model.RawResolver = &resolverErrWrapper{}
 
 func (r *resolverErrWrapper) LookupHost(ctx context.Context, hostname string) ([]string, error) {
 	addrs, err := r.Resolver.LookupHost(ctx, hostname)
@@ -261,3 +321,12 @@ func (r *resolverErrWrapper) LookupHTTPS(
 	}
 	return out, nil
 }
+
+func (r *resolverErrWrapper) LookupRaw(
+	ctx context.Context, hostname string, qtype uint16) (*model.DNSReply, error) {
+	reply, err := LookupRaw(ctx, r.Resolver, hostname, qtype)
+	if err != nil {
+		return reply, NewErrWrapper(classifyResolverError, ResolveOperation, err)
+	}
+	return reply, nil
+}
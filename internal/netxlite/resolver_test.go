@@ -11,6 +11,7 @@ import (
 
 	"github.com/apex/log"
 	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-cli/v3/internal/model"
 	"github.com/ooni/probe-cli/v3/internal/model/mocks"
 )
@@ -44,6 +45,25 @@ func TestNewResolverUDP(t *testing.T) {
 	}
 }
 
+func TestNewResolverParallel(t *testing.T) {
+	txp := NewDNSOverUDP(NewDialerWithoutResolver(log.Log), "1.1.1.1:53")
+	resolver := NewResolverParallel(log.Log, txp)
+	idna := resolver.(*resolverIDNA)
+	logger := idna.Resolver.(*resolverLogger)
+	if logger.Logger != log.Log {
+		t.Fatal("invalid logger")
+	}
+	shortCircuit := logger.Resolver.(*resolverShortCircuitIPAddr)
+	errWrapper := shortCircuit.Resolver.(*resolverErrWrapper)
+	parallel := errWrapper.Resolver.(*ParallelResolver)
+	if len(parallel.Resolvers) != 1 {
+		t.Fatal("invalid number of resolvers")
+	}
+	if parallel.Resolvers[0].Transport() != txp {
+		t.Fatal("invalid transport")
+	}
+}
+
 func TestResolverSystem(t *testing.T) {
 	t.Run("Network and Address", func(t *testing.T) {
 		r := &resolverSystem{}
@@ -166,6 +186,17 @@ func TestResolverSystem(t *testing.T) {
 			t.Fatal("expected nil result")
 		}
 	})
+
+	t.Run("LookupRaw", func(t *testing.T) {
+		r := &resolverSystem{}
+		reply, err := r.LookupRaw(context.Background(), "x.org", dns.TypeCNAME)
+		if !errors.Is(err, ErrNoDNSTransport) {
+			t.Fatal("not the error we expected")
+		}
+		if reply != nil {
+			t.Fatal("expected nil result")
+		}
+	})
 }
 
 func TestResolverLogger(t *testing.T) {
@@ -312,6 +343,82 @@ func TestResolverLogger(t *testing.T) {
 		})
 	})
 
+	t.Run("LookupRaw", func(t *testing.T) {
+		t.Run("with success", func(t *testing.T) {
+			var count int
+			lo := &mocks.Logger{
+				MockDebugf: func(format string, v ...interface{}) {
+					count++
+				},
+			}
+			expected := &model.DNSReply{
+				Answer: []*model.DNSRecord{{
+					Name: "www.x.org.",
+					Type: "CNAME",
+					TTL:  300,
+					Data: "x.org.",
+				}},
+			}
+			r := &resolverLogger{
+				Logger: lo,
+				Resolver: &mocks.Resolver{
+					MockLookupRaw: func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+						return expected, nil
+					},
+					MockNetwork: func() string {
+						return "udp"
+					},
+					MockAddress: func() string {
+						return "8.8.8.8:53"
+					},
+				},
+			}
+			reply, err := r.LookupRaw(context.Background(), "www.x.org", dns.TypeCNAME)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(expected, reply); diff != "" {
+				t.Fatal(diff)
+			}
+			if count != 2 {
+				t.Fatal("unexpected count")
+			}
+		})
+
+		t.Run("with failure", func(t *testing.T) {
+			var count int
+			lo := &mocks.Logger{
+				MockDebugf: func(format string, v ...interface{}) {
+					count++
+				},
+			}
+			expected := errors.New("mocked error")
+			r := &resolverLogger{
+				Logger: lo,
+				Resolver: &mocks.Resolver{
+					MockLookupRaw: func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+						return nil, expected
+					},
+					MockNetwork: func() string {
+						return "udp"
+					},
+					MockAddress: func() string {
+						return "8.8.8.8:53"
+					},
+				},
+			}
+			reply, err := r.LookupRaw(context.Background(), "www.x.org", dns.TypeCNAME)
+			if !errors.Is(err, expected) {
+				t.Fatal("not the error we expected", err)
+			}
+			if reply != nil {
+				t.Fatal("expected nil reply here")
+			}
+			if count != 2 {
+				t.Fatal("unexpected count")
+			}
+		})
+	})
 }
 
 func TestResolverIDNA(t *testing.T) {
@@ -400,6 +507,47 @@ func TestResolverIDNA(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("LookupRaw", func(t *testing.T) {
+		t.Run("with valid IDNA in input", func(t *testing.T) {
+			expected := &model.DNSReply{}
+			r := &resolverIDNA{
+				Resolver: &mocks.Resolver{
+					MockLookupRaw: func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+						if domain != "xn--d1acpjx3f.xn--p1ai" {
+							return nil, errors.New("passed invalid domain")
+						}
+						return expected, nil
+					},
+				},
+			}
+			ctx := context.Background()
+			reply, err := r.LookupRaw(ctx, "яндекс.рф", dns.TypeNS)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reply != expected {
+				t.Fatal("not the reply we expected")
+			}
+		})
+
+		t.Run("with invalid punycode", func(t *testing.T) {
+			r := &resolverIDNA{Resolver: &mocks.Resolver{
+				MockLookupRaw: func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+					return nil, errors.New("should not happen")
+				},
+			}}
+			// See https://www.farsightsecurity.com/blog/txt-record/punycode-20180711/
+			ctx := context.Background()
+			reply, err := r.LookupRaw(ctx, "xn--0000h", dns.TypeNS)
+			if err == nil || !strings.HasPrefix(err.Error(), "idna: invalid label") {
+				t.Fatal("not the error we expected")
+			}
+			if reply != nil {
+				t.Fatal("expected no response here")
+			}
+		})
+	})
 }
 
 func TestResolverShortCircuitIPAddr(t *testing.T) {
@@ -440,6 +588,25 @@ func TestResolverShortCircuitIPAddr(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("LookupRaw", func(t *testing.T) {
+		expected := &model.DNSReply{}
+		r := &resolverShortCircuitIPAddr{
+			Resolver: &mocks.Resolver{
+				MockLookupRaw: func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+					return expected, nil
+				},
+			},
+		}
+		ctx := context.Background()
+		reply, err := r.LookupRaw(ctx, "dns.google", dns.TypeNS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply != expected {
+			t.Fatal("not the reply we expected")
+		}
+	})
 }
 
 func TestNullResolver(t *testing.T) {
@@ -607,4 +774,72 @@ func TestResolverErrWrapper(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("LookupRaw", func(t *testing.T) {
+		t.Run("on success", func(t *testing.T) {
+			expected := &model.DNSReply{}
+			reso := &resolverErrWrapper{
+				Resolver: &mocks.Resolver{
+					MockLookupRaw: func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+						return expected, nil
+					},
+				},
+			}
+			ctx := context.Background()
+			reply, err := reso.LookupRaw(ctx, "", dns.TypeNS)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reply != expected {
+				t.Fatal("not the reply we expected")
+			}
+		})
+
+		t.Run("on failure with reply", func(t *testing.T) {
+			expected := &model.DNSReply{}
+			reso := &resolverErrWrapper{
+				Resolver: &mocks.Resolver{
+					MockLookupRaw: func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+						return expected, ErrOODNSNoSuchHost
+					},
+				},
+			}
+			ctx := context.Background()
+			reply, err := reso.LookupRaw(ctx, "", dns.TypeNS)
+			if err == nil || err.Error() != FailureDNSNXDOMAINError {
+				t.Fatal("unexpected err", err)
+			}
+			if reply != expected {
+				t.Fatal("not the reply we expected")
+			}
+		})
+	})
+}
+
+func TestLookupRaw(t *testing.T) {
+	t.Run("with a resolver not implementing LookupRaw", func(t *testing.T) {
+		reply, err := LookupRaw(context.Background(), &nullResolver{}, "x.org", dns.TypeNS)
+		if !errors.Is(err, ErrNoDNSTransport) {
+			t.Fatal("not the error we expected", err)
+		}
+		if reply != nil {
+			t.Fatal("expected nil reply")
+		}
+	})
+
+	t.Run("with a resolver implementing LookupRaw", func(t *testing.T) {
+		expected := &model.DNSReply{}
+		reso := &mocks.Resolver{
+			MockLookupRaw: func(ctx context.Context, domain string, qtype uint16) (*model.DNSReply, error) {
+				return expected, nil
+			},
+		}
+		reply, err := LookupRaw(context.Background(), reso, "x.org", dns.TypeNS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply != expected {
+			t.Fatal("not the reply we expected")
+		}
+	})
 }
@@ -39,6 +39,8 @@ func NewSerialResolver(t model.DNSTransport) *SerialResolver {
 	}
 }
 
+var _ model.RawResolver = &SerialResolver{}
+
 // Transport returns the transport being used.
 func (r *SerialResolver) Transport() model.DNSTransport {
 	return r.Txp
@@ -90,6 +92,20 @@ func (r *SerialResolver) LookupHTTPS(
 	return r.Decoder.DecodeHTTPS(replydata)
 }
 
+// LookupRaw implements model.RawResolver.LookupRaw.
+func (r *SerialResolver) LookupRaw(
+	ctx context.Context, hostname string, qtype uint16) (*model.DNSReply, error) {
+	querydata, err := r.Encoder.Encode(hostname, qtype, r.Txp.RequiresPadding())
+	if err != nil {
+		return nil, err
+	}
+	replydata, err := r.Txp.RoundTrip(ctx, querydata)
+	if err != nil {
+		return nil, err
+	}
+	return r.Decoder.DecodeReply(replydata)
+}
+
 func (r *SerialResolver) lookupHostWithRetry(
 	ctx context.Context, hostname string, qtype uint16) ([]string, error) {
 	var errorslist []error
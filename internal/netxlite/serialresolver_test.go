@@ -273,4 +273,131 @@ func TestSerialResolver(t *testing.T) {
 			}
 		})
 	})
+	t.Run("LookupRaw", func(t *testing.T) {
+		t.Run("for encoding error", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			r := &SerialResolver{
+				Encoder: &mocks.DNSEncoder{
+					MockEncode: func(domain string, qtype uint16, padding bool) ([]byte, error) {
+						return nil, expected
+					},
+				},
+				Decoder:     nil,
+				NumTimeouts: &atomicx.Int64{},
+				Txp: &mocks.DNSTransport{
+					MockRequiresPadding: func() bool {
+						return false
+					},
+				},
+			}
+			ctx := context.Background()
+			reply, err := r.LookupRaw(ctx, "example.com", dns.TypeCNAME)
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if reply != nil {
+				t.Fatal("unexpected result")
+			}
+		})
+
+		t.Run("for round-trip error", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			r := &SerialResolver{
+				Encoder: &mocks.DNSEncoder{
+					MockEncode: func(domain string, qtype uint16, padding bool) ([]byte, error) {
+						return make([]byte, 64), nil
+					},
+				},
+				Decoder:     nil,
+				NumTimeouts: &atomicx.Int64{},
+				Txp: &mocks.DNSTransport{
+					MockRoundTrip: func(ctx context.Context, query []byte) (reply []byte, err error) {
+						return nil, expected
+					},
+					MockRequiresPadding: func() bool {
+						return false
+					},
+				},
+			}
+			ctx := context.Background()
+			reply, err := r.LookupRaw(ctx, "example.com", dns.TypeCNAME)
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if reply != nil {
+				t.Fatal("unexpected result")
+			}
+		})
+
+		t.Run("for decode error", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			r := &SerialResolver{
+				Encoder: &mocks.DNSEncoder{
+					MockEncode: func(domain string, qtype uint16, padding bool) ([]byte, error) {
+						return make([]byte, 64), nil
+					},
+				},
+				Decoder: &mocks.DNSDecoder{
+					MockDecodeReply: func(reply []byte) (*model.DNSReply, error) {
+						return nil, expected
+					},
+				},
+				NumTimeouts: &atomicx.Int64{},
+				Txp: &mocks.DNSTransport{
+					MockRoundTrip: func(ctx context.Context, query []byte) (reply []byte, err error) {
+						return make([]byte, 128), nil
+					},
+					MockRequiresPadding: func() bool {
+						return false
+					},
+				},
+			}
+			ctx := context.Background()
+			reply, err := r.LookupRaw(ctx, "example.com", dns.TypeCNAME)
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if reply != nil {
+				t.Fatal("unexpected result")
+			}
+		})
+
+		t.Run("for NXDOMAIN", func(t *testing.T) {
+			r := NewSerialResolver(&mocks.DNSTransport{
+				MockRoundTrip: func(ctx context.Context, query []byte) (reply []byte, err error) {
+					return dnsGenReplyWithError(t, dns.TypeNS, dns.RcodeNameError), nil
+				},
+				MockRequiresPadding: func() bool {
+					return false
+				},
+			})
+			ctx := context.Background()
+			reply, err := r.LookupRaw(ctx, "x.org", dns.TypeNS)
+			if !errors.Is(err, ErrOODNSNoSuchHost) {
+				t.Fatal("unexpected err", err)
+			}
+			if reply == nil {
+				t.Fatal("expected non-nil reply")
+			}
+		})
+
+		t.Run("for success", func(t *testing.T) {
+			r := NewSerialResolver(&mocks.DNSTransport{
+				MockRoundTrip: func(ctx context.Context, query []byte) (reply []byte, err error) {
+					return dnsGenLookupHostReplySuccess(t, dns.TypeA, "8.8.8.8"), nil
+				},
+				MockRequiresPadding: func() bool {
+					return false
+				},
+			})
+			ctx := context.Background()
+			reply, err := r.LookupRaw(ctx, "x.org", dns.TypeA)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(reply.Answer) != 1 || reply.Answer[0].Data != "8.8.8.8" {
+				t.Fatal("unexpected result")
+			}
+		})
+	})
 }
@@ -0,0 +1,385 @@
+package netxlite
+
+//
+// TLS ClientHello fragmentation
+//
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+	utls "gitlab.com/yawning/utls.git"
+)
+
+const (
+	// TLSFragmentationPadding adds a padding extension to the ClientHello. Only
+	// NewTLSHandshakerFragmenting implements this strategy, because the padding
+	// is part of the handshake transcript and the TLS library must know about it.
+	TLSFragmentationPadding = "padding"
+
+	// TLSFragmentationTLSRecord splits the ClientHello across
+	// several TLS records (by default, in the middle of the SNI).
+	TLSFragmentationTLSRecord = "tls-record"
+
+	// TLSFragmentationTCPSegments splits the ClientHello across
+	// several TCP segments of fixed size.
+	TLSFragmentationTCPSegments = "tcp-segments"
+
+	// TLSFragmentationSNISplit splits the ClientHello across two
+	// TCP segments in the middle of the SNI.
+	TLSFragmentationSNISplit = "sni-split"
+)
+
+// Defaults used by TLSFragmentationConfig.
+const (
+	// DefaultTLSFragmentationPaddingSize is the default number of padding
+	// bytes, which is enough for the ClientHello to exceed a typical MTU.
+	DefaultTLSFragmentationPaddingSize = 1500
+
+	// DefaultTLSFragmentationSegmentSize is the default size of each
+	// TCP segment when using TLSFragmentationTCPSegments.
+	DefaultTLSFragmentationSegmentSize = 16
+)
+
+// ErrUnknownTLSFragmentationStrategy indicates that a TLS
+// fragmentation strategy name is not known.
+var ErrUnknownTLSFragmentationStrategy = errors.New("unknown TLS fragmentation strategy")
+
+// ParseTLSFragmentationStrategies parses a comma-separated list of
+// TLS fragmentation strategies (e.g., "padding,sni-split"). We return
+// a nil list when value is empty.
+func ParseTLSFragmentationStrategies(value string) ([]string, error) {
+	var out []string
+	for _, s := range strings.Split(value, ",") {
+		switch s = strings.TrimSpace(s); s {
+		case "":
+			// nothing
+		case TLSFragmentationPadding, TLSFragmentationTLSRecord,
+			TLSFragmentationTCPSegments, TLSFragmentationSNISplit:
+			out = append(out, s)
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownTLSFragmentationStrategy, s)
+		}
+	}
+	return out, nil
+}
+
+// TLSFragmentationConfig configures how we fragment the ClientHello. We
+// first apply TLSFragmentationTLSRecord and then we split the result in TCP
+// segments using the union of the split points of TLSFragmentationTCPSegments
+// and TLSFragmentationSNISplit. See TLSFragmentationPadding for padding.
+type TLSFragmentationConfig struct {
+	// Strategies contains the strategies to apply.
+	Strategies []string
+
+	// Delay is the OPTIONAL delay between TCP segments.
+	Delay time.Duration
+
+	// PaddingSize is the OPTIONAL number of padding bytes. If zero or
+	// negative, we use DefaultTLSFragmentationPaddingSize.
+	PaddingSize int
+
+	// RecordSize is the OPTIONAL maximum size of each TLS record's
+	// payload. If zero or negative, we split the ClientHello into two
+	// records in the middle of the SNI.
+	RecordSize int
+
+	// SegmentSize is the OPTIONAL size of each TCP segment. If zero
+	// or negative, we use DefaultTLSFragmentationSegmentSize.
+	SegmentSize int
+}
+
+// has returns whether the config contains the given strategy.
+func (c *TLSFragmentationConfig) has(strategy string) bool {
+	for _, s := range c.Strategies {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// fragment fragments the given ClientHello record according to the config
+// and returns the TCP segments to write. We return b as the only segment if
+// b is not a ClientHello we know how to parse.
+func (c *TLSFragmentationConfig) fragment(b []byte) [][]byte {
+	info, err := tlsParseClientHelloRecord(b)
+	if err != nil {
+		return [][]byte{b}
+	}
+	// mid is the offset where we split "in the middle of the SNI"
+	mid := len(b) / 2
+	if info.sniLength > 0 {
+		mid = info.sniOffset + info.sniLength/2
+	}
+	if c.has(TLSFragmentationTLSRecord) {
+		cuts := []int{mid - 5}
+		if c.RecordSize > 0 {
+			cuts = tlsFragmentationCuts(len(b)-5, c.RecordSize)
+		}
+		b, mid = tlsFragmentRecord(b, cuts, mid)
+	}
+	var cuts []int
+	if c.has(TLSFragmentationTCPSegments) {
+		size := c.SegmentSize
+		if size <= 0 {
+			size = DefaultTLSFragmentationSegmentSize
+		}
+		cuts = append(cuts, tlsFragmentationCuts(len(b), size)...)
+	}
+	if c.has(TLSFragmentationSNISplit) {
+		cuts = append(cuts, mid)
+	}
+	return tlsSplitAt(b, cuts)
+}
+
+// NewTLSFragmentingDialer wraps a dialer such that the first write on
+// each conn, which must be a ClientHello, is fragmented according to the
+// given config. Writes that are not a ClientHello are unaffected. This
+// dialer ignores TLSFragmentationPadding (see its documentation).
+func NewTLSFragmentingDialer(dialer model.Dialer, config *TLSFragmentationConfig) model.Dialer {
+	return &tlsFragmentingDialer{Dialer: dialer, config: config}
+}
+
+// tlsFragmentingDialer is the dialer returned by NewTLSFragmentingDialer.
+type tlsFragmentingDialer struct {
+	model.Dialer
+	config *TLSFragmentationConfig
+}
+
+var _ model.Dialer = &tlsFragmentingDialer{}
+
+// DialContext implements model.Dialer.DialContext.
+func (d *tlsFragmentingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.Dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &tlsFragmentingConn{Conn: conn, config: d.config}, nil
+}
+
+// NewTLSFragmentingHandshaker wraps a TLS handshaker such that the
+// ClientHello is fragmented according to the given config. This
+// handshaker ignores TLSFragmentationPadding (see its documentation).
+func NewTLSFragmentingHandshaker(th model.TLSHandshaker, config *TLSFragmentationConfig) model.TLSHandshaker {
+	return &tlsFragmentingHandshaker{TLSHandshaker: th, config: config}
+}
+
+// tlsFragmentingHandshaker is the handshaker returned by NewTLSFragmentingHandshaker.
+type tlsFragmentingHandshaker struct {
+	model.TLSHandshaker
+	config *TLSFragmentationConfig
+}
+
+var _ model.TLSHandshaker = &tlsFragmentingHandshaker{}
+
+// Handshake implements model.TLSHandshaker.Handshake.
+func (h *tlsFragmentingHandshaker) Handshake(
+	ctx context.Context, conn net.Conn, config *tls.Config,
+) (net.Conn, tls.ConnectionState, error) {
+	return h.TLSHandshaker.Handshake(ctx, &tlsFragmentingConn{Conn: conn, config: h.config}, config)
+}
+
+// NewTLSHandshakerFragmenting creates a new TLS handshaker that fragments
+// the ClientHello according to the given config. We use the standard library
+// unless the config contains TLSFragmentationPadding, in which case we use a
+// Chrome-like utls ClientHello with a padding extension of the configured size.
+//
+// The handshaker guarantees:
+//
+// 1. logging
+//
+// 2. error wrapping
+func NewTLSHandshakerFragmenting(logger model.DebugLogger, config *TLSFragmentationConfig) model.TLSHandshaker {
+	th := &tlsHandshakerConfigurable{}
+	if config.has(TLSFragmentationPadding) {
+		size := config.PaddingSize
+		if size <= 0 {
+			size = DefaultTLSFragmentationPaddingSize
+		}
+		th.NewConn = newConnUTLSPadding(size)
+	}
+	return newTLSHandshaker(NewTLSFragmentingHandshaker(th, config), logger)
+}
+
+// newConnUTLSPadding returns a NewConn function for creating utlsConn
+// instances using a ClientHello with a padding extension of the given size.
+func newConnUTLSPadding(size int) func(conn net.Conn, config *tls.Config) TLSConn {
+	newConn := newConnUTLS(&utls.HelloChrome_Auto)
+	return func(conn net.Conn, config *tls.Config) TLSConn {
+		tlsConn := newConn(conn, config).(*utlsConn)
+		// Note: on failure, we'll retry building the state during
+		// the handshake and we'll fail the handshake.
+		if err := tlsConn.BuildHandshakeState(); err != nil {
+			return tlsConn
+		}
+		for _, ext := range tlsConn.Extensions {
+			if padding, ok := ext.(*utls.UtlsPaddingExtension); ok {
+				padding.GetPaddingLen = func(int) (int, bool) {
+					return size, true
+				}
+			}
+		}
+		tlsConn.MarshalClientHello()
+		return tlsConn
+	}
+}
+
+// tlsFragmentingConn is a net.Conn that fragments the first write.
+type tlsFragmentingConn struct {
+	net.Conn
+	config  *TLSFragmentationConfig
+	mu      sync.Mutex
+	written bool
+}
+
+// Write implements net.Conn.Write.
+func (c *tlsFragmentingConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	first := !c.written
+	c.written = true
+	c.mu.Unlock()
+	if !first {
+		return c.Conn.Write(b)
+	}
+	for idx, segment := range c.config.fragment(b) {
+		if idx > 0 && c.config.Delay > 0 {
+			time.Sleep(c.config.Delay)
+		}
+		if _, err := c.Conn.Write(segment); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// errTLSNotClientHello indicates that a buffer does not contain
+// a single TLS record containing a whole ClientHello.
+var errTLSNotClientHello = errors.New("netxlite: not a ClientHello record")
+
+// tlsClientHelloInfo contains information about a ClientHello record.
+type tlsClientHelloInfo struct {
+	// sniLength is the length of the SNI (zero if there is no SNI).
+	sniLength int
+
+	// sniOffset is the offset of the SNI.
+	sniOffset int
+}
+
+// tlsParseClientHelloRecord parses a TLS record containing a whole ClientHello.
+func tlsParseClientHelloRecord(b []byte) (*tlsClientHelloInfo, error) {
+	if len(b) < 9 || b[0] != 22 || int(binary.BigEndian.Uint16(b[3:5])) != len(b)-5 {
+		return nil, errTLSNotClientHello
+	}
+	if b[5] != 1 || int(b[6])<<16|int(b[7])<<8|int(b[8]) != len(b)-9 {
+		return nil, errTLSNotClientHello
+	}
+	// skip legacy_version and random, then session ID, cipher suites, compression
+	off := 9 + 2 + 32
+	for _, lengthSize := range []int{1, 2, 1} {
+		var err error
+		if off, err = tlsSkipVector(b, off, lengthSize); err != nil {
+			return nil, err
+		}
+	}
+	info := &tlsClientHelloInfo{}
+	if off == len(b) {
+		return info, nil // no extensions
+	}
+	if off+2 > len(b) || off+2+int(binary.BigEndian.Uint16(b[off:])) != len(b) {
+		return nil, errTLSNotClientHello
+	}
+	for off += 2; off < len(b); {
+		if off+4 > len(b) {
+			return nil, errTLSNotClientHello
+		}
+		kind := binary.BigEndian.Uint16(b[off:])
+		length := int(binary.BigEndian.Uint16(b[off+2:]))
+		off += 4
+		if off+length > len(b) {
+			return nil, errTLSNotClientHello
+		}
+		if kind == 0 { // server_name
+			// list length (2), name type (1), name length (2), name
+			if length < 5 || b[off+2] != 0 {
+				return nil, errTLSNotClientHello
+			}
+			info.sniLength = int(binary.BigEndian.Uint16(b[off+3:]))
+			info.sniOffset = off + 5
+			if info.sniLength > length-5 {
+				return nil, errTLSNotClientHello
+			}
+		}
+		off += length
+	}
+	return info, nil
+}
+
+// tlsSkipVector skips a TLS vector whose length uses lengthSize bytes.
+func tlsSkipVector(b []byte, off, lengthSize int) (int, error) {
+	if off+lengthSize > len(b) {
+		return 0, errTLSNotClientHello
+	}
+	var length int
+	for _, v := range b[off : off+lengthSize] {
+		length = length<<8 | int(v)
+	}
+	off += lengthSize + length
+	if off > len(b) {
+		return 0, errTLSNotClientHello
+	}
+	return off, nil
+}
+
+// tlsFragmentRecord splits the TLS record in b into several records such
+// that each record ends at one of the given payload offsets. This function
+// also returns the new offset of the byte that was at offset mid.
+func tlsFragmentRecord(b []byte, cuts []int, mid int) ([]byte, int) {
+	header, payload := b[:3], b[5:]
+	out := make([]byte, 0, len(b)+5*len(cuts))
+	newMid, pos := mid, 0
+	for idx, chunk := range tlsSplitAt(payload, cuts) {
+		if idx > 0 && pos <= mid-5 {
+			newMid += 5 // the byte at mid follows this new record header
+		}
+		out = append(out, header...)
+		out = append(out, byte(len(chunk)>>8), byte(len(chunk)))
+		out = append(out, chunk...)
+		pos += len(chunk)
+	}
+	return out, newMid
+}
+
+// tlsFragmentationCuts returns the offsets at which we should split
+// a buffer of the given length to obtain chunks of the given size.
+func tlsFragmentationCuts(length, size int) (cuts []int) {
+	for off := size; off < length; off += size {
+		cuts = append(cuts, off)
+	}
+	return
+}
+
+// tlsSplitAt splits b at the given offsets, ignoring the offsets that
+// are out of range and returning b unchanged if there are no offsets.
+func tlsSplitAt(b []byte, cuts []int) (out [][]byte) {
+	sorted := append([]int{}, cuts...)
+	sort.Ints(sorted)
+	var prev int
+	for _, cut := range sorted {
+		if cut <= prev || cut >= len(b) {
+			continue
+		}
+		out = append(out, b[prev:cut])
+		prev = cut
+	}
+	return append(out, b[prev:])
+}
@@ -0,0 +1,338 @@
+package netxlite
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
+)
+
+// tlsCaptureClientHello returns the ClientHello record that crypto/tls
+// sends when performing a handshake using the given SNI.
+func tlsCaptureClientHello(t *testing.T, sni string) []byte {
+	var hello []byte
+	conn := &mocks.Conn{
+		MockWrite: func(b []byte) (int, error) {
+			hello = append([]byte{}, b...)
+			return 0, errors.New("mocked error")
+		},
+		MockClose: func() error {
+			return nil
+		},
+	}
+	tls.Client(conn, &tls.Config{ServerName: sni}).Handshake()
+	if len(hello) <= 0 {
+		t.Fatal("did not capture the ClientHello")
+	}
+	return hello
+}
+
+// tlsRecordsPayload returns the concatenated payload of the given TLS
+// records along with the number of records.
+func tlsRecordsPayload(t *testing.T, b []byte) ([]byte, int) {
+	var (
+		payload []byte
+		count   int
+	)
+	for len(b) > 0 {
+		if len(b) < 5 || b[0] != 22 {
+			t.Fatal("not a handshake record")
+		}
+		length := int(binary.BigEndian.Uint16(b[3:]))
+		payload = append(payload, b[5:5+length]...)
+		b = b[5+length:]
+		count++
+	}
+	return payload, count
+}
+
+func TestParseTLSFragmentationStrategies(t *testing.T) {
+	t.Run("with empty value", func(t *testing.T) {
+		out, err := ParseTLSFragmentationStrategies("")
+		if err != nil || out != nil {
+			t.Fatal("unexpected result", out, err)
+		}
+	})
+
+	t.Run("with valid strategies", func(t *testing.T) {
+		out, err := ParseTLSFragmentationStrategies("padding, tls-record,tcp-segments,sni-split")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != 4 || out[1] != TLSFragmentationTLSRecord {
+			t.Fatal("unexpected result", out)
+		}
+	})
+
+	t.Run("with unknown strategy", func(t *testing.T) {
+		out, err := ParseTLSFragmentationStrategies("padding,antani")
+		if !errors.Is(err, ErrUnknownTLSFragmentationStrategy) || out != nil {
+			t.Fatal("unexpected result", out, err)
+		}
+	})
+}
+
+func TestTLSParseClientHelloRecord(t *testing.T) {
+	t.Run("with a real ClientHello", func(t *testing.T) {
+		hello := tlsCaptureClientHello(t, "example.com")
+		info, err := tlsParseClientHelloRecord(hello)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sni := string(hello[info.sniOffset : info.sniOffset+info.sniLength]); sni != "example.com" {
+			t.Fatal("unexpected SNI", sni)
+		}
+	})
+
+	t.Run("with invalid input", func(t *testing.T) {
+		hello := tlsCaptureClientHello(t, "example.com")
+		inputs := [][]byte{
+			nil,
+			[]byte("GET / HTTP/1.1\r\n\r\n"),
+			hello[:len(hello)-1],                  // record length mismatch
+			append(append([]byte{}, hello...), 0), // trailing data
+		}
+		for _, input := range inputs {
+			if _, err := tlsParseClientHelloRecord(input); !errors.Is(err, errTLSNotClientHello) {
+				t.Fatal("unexpected err", err)
+			}
+		}
+	})
+}
+
+func TestTLSFragmentationConfig(t *testing.T) {
+	hello := tlsCaptureClientHello(t, "example.com")
+
+	t.Run("without strategies", func(t *testing.T) {
+		out := (&TLSFragmentationConfig{}).fragment(hello)
+		if len(out) != 1 || !bytes.Equal(out[0], hello) {
+			t.Fatal("unexpected output")
+		}
+	})
+
+	t.Run("with a non-ClientHello buffer", func(t *testing.T) {
+		data := []byte("GET / HTTP/1.1\r\n\r\n")
+		config := &TLSFragmentationConfig{Strategies: []string{TLSFragmentationTCPSegments}}
+		out := config.fragment(data)
+		if len(out) != 1 || !bytes.Equal(out[0], data) {
+			t.Fatal("unexpected output")
+		}
+	})
+
+	t.Run("with sni-split", func(t *testing.T) {
+		config := &TLSFragmentationConfig{Strategies: []string{TLSFragmentationSNISplit}}
+		out := config.fragment(hello)
+		if len(out) != 2 || !bytes.Equal(bytes.Join(out, nil), hello) {
+			t.Fatal("unexpected output")
+		}
+		if !bytes.HasSuffix(out[0], []byte("examp")) || !bytes.HasPrefix(out[1], []byte("le.com")) {
+			t.Fatal("did not split in the middle of the SNI")
+		}
+	})
+
+	t.Run("with tcp-segments", func(t *testing.T) {
+		config := &TLSFragmentationConfig{Strategies: []string{TLSFragmentationTCPSegments}}
+		out := config.fragment(hello)
+		if !bytes.Equal(bytes.Join(out, nil), hello) {
+			t.Fatal("unexpected output")
+		}
+		for idx, segment := range out {
+			if idx < len(out)-1 && len(segment) != DefaultTLSFragmentationSegmentSize {
+				t.Fatal("unexpected segment size", len(segment))
+			}
+		}
+	})
+
+	t.Run("with tls-record", func(t *testing.T) {
+		config := &TLSFragmentationConfig{Strategies: []string{TLSFragmentationTLSRecord}}
+		out := config.fragment(hello)
+		if len(out) != 1 {
+			t.Fatal("unexpected number of segments")
+		}
+		payload, count := tlsRecordsPayload(t, out[0])
+		if count != 2 || !bytes.Equal(payload, hello[5:]) {
+			t.Fatal("unexpected records", count)
+		}
+		second := out[0][5+int(binary.BigEndian.Uint16(out[0][3:]))+5:]
+		if !bytes.HasPrefix(second, []byte("le.com")) {
+			t.Fatal("did not split in the middle of the SNI")
+		}
+	})
+
+	t.Run("with tls-record and sni-split", func(t *testing.T) {
+		config := &TLSFragmentationConfig{Strategies: []string{
+			TLSFragmentationTLSRecord, TLSFragmentationSNISplit,
+		}}
+		out := config.fragment(hello)
+		if len(out) != 2 {
+			t.Fatal("unexpected number of segments")
+		}
+		if !bytes.HasPrefix(out[1], []byte("le.com")) {
+			t.Fatal("did not split in the middle of the SNI")
+		}
+		if _, count := tlsRecordsPayload(t, bytes.Join(out, nil)); count != 2 {
+			t.Fatal("unexpected number of records", count)
+		}
+	})
+
+	t.Run("with tls-record and RecordSize", func(t *testing.T) {
+		config := &TLSFragmentationConfig{
+			Strategies: []string{TLSFragmentationTLSRecord},
+			RecordSize: 32,
+		}
+		payload, count := tlsRecordsPayload(t, config.fragment(hello)[0])
+		if expected := (len(hello) - 5 + 31) / 32; count != expected {
+			t.Fatal("unexpected number of records", count, expected)
+		}
+		if !bytes.Equal(payload, hello[5:]) {
+			t.Fatal("unexpected payload")
+		}
+	})
+}
+
+func TestTLSFragmentingConn(t *testing.T) {
+	t.Run("fragments only the first write", func(t *testing.T) {
+		var writes [][]byte
+		conn := &tlsFragmentingConn{
+			Conn: &mocks.Conn{
+				MockWrite: func(b []byte) (int, error) {
+					writes = append(writes, b)
+					return len(b), nil
+				},
+			},
+			config: &TLSFragmentationConfig{
+				Strategies: []string{TLSFragmentationSNISplit},
+				Delay:      10 * time.Millisecond,
+			},
+		}
+		hello := tlsCaptureClientHello(t, "example.com")
+		before := time.Now()
+		for idx := 0; idx < 2; idx++ {
+			count, err := conn.Write(hello)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != len(hello) {
+				t.Fatal("unexpected count", count)
+			}
+		}
+		if len(writes) != 3 {
+			t.Fatal("unexpected number of writes", len(writes))
+		}
+		if time.Since(before) < 10*time.Millisecond {
+			t.Fatal("did not wait between segments")
+		}
+	})
+
+	t.Run("with write error", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		conn := &tlsFragmentingConn{
+			Conn: &mocks.Conn{
+				MockWrite: func(b []byte) (int, error) {
+					return 0, expected
+				},
+			},
+			config: &TLSFragmentationConfig{Strategies: []string{TLSFragmentationSNISplit}},
+		}
+		count, err := conn.Write(tlsCaptureClientHello(t, "example.com"))
+		if !errors.Is(err, expected) || count != 0 {
+			t.Fatal("unexpected result", count, err)
+		}
+	})
+}
+
+func TestNewTLSFragmentingDialer(t *testing.T) {
+	t.Run("on failure", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		dialer := NewTLSFragmentingDialer(&mocks.Dialer{
+			MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return nil, expected
+			},
+		}, &TLSFragmentationConfig{})
+		conn, err := dialer.DialContext(context.Background(), "tcp", "8.8.8.8:443")
+		if !errors.Is(err, expected) || conn != nil {
+			t.Fatal("unexpected result", conn, err)
+		}
+	})
+
+	t.Run("on success", func(t *testing.T) {
+		expected := &mocks.Conn{}
+		config := &TLSFragmentationConfig{}
+		dialer := NewTLSFragmentingDialer(&mocks.Dialer{
+			MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return expected, nil
+			},
+		}, config)
+		conn, err := dialer.DialContext(context.Background(), "tcp", "8.8.8.8:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fconn := conn.(*tlsFragmentingConn)
+		if fconn.Conn != expected || fconn.config != config {
+			t.Fatal("unexpected conn")
+		}
+	})
+}
+
+func TestNewTLSHandshakerFragmenting(t *testing.T) {
+	handler := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(200)
+	})
+	srvr := httptest.NewTLSServer(handler)
+	defer srvr.Close()
+	URL, err := url.Parse(srvr.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strategies := [][]string{
+		{TLSFragmentationPadding},
+		{TLSFragmentationTLSRecord},
+		{TLSFragmentationTCPSegments},
+		{TLSFragmentationSNISplit},
+		{TLSFragmentationPadding, TLSFragmentationTLSRecord,
+			TLSFragmentationTCPSegments, TLSFragmentationSNISplit},
+	}
+	for _, s := range strategies {
+		conn, err := net.Dial("tcp", URL.Host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var hello []byte
+		saver := &mocks.Conn{
+			MockWrite: func(b []byte) (int, error) {
+				if hello == nil {
+					hello = append([]byte{}, b...)
+				}
+				return conn.Write(b)
+			},
+			MockRead:             conn.Read,
+			MockClose:            conn.Close,
+			MockSetDeadline:      conn.SetDeadline,
+			MockSetReadDeadline:  conn.SetReadDeadline,
+			MockSetWriteDeadline: conn.SetWriteDeadline,
+		}
+		handshaker := NewTLSHandshakerFragmenting(log.Log, &TLSFragmentationConfig{Strategies: s})
+		config := &tls.Config{
+			InsecureSkipVerify: true,
+			ServerName:         "example.com",
+		}
+		tlsConn, _, err := handshaker.Handshake(context.Background(), saver, config)
+		if err != nil {
+			t.Fatal(s, err)
+		}
+		tlsConn.Close()
+		if len(s) == 1 && s[0] == TLSFragmentationPadding && len(hello) < DefaultTLSFragmentationPaddingSize {
+			t.Fatal("the ClientHello does not seem padded", len(hello))
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package netxlite
+
+//
+// TTL-limited conns
+//
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+)
+
+var _ model.UnderlyingTTLNetworkLibrary = &TProxyStdlib{}
+
+// ErrNoTTLSupport indicates that we cannot set the TTL of a conn.
+var ErrNoTTLSupport = errors.New("netxlite: cannot set the TTL")
+
+// ListenUDPWithTTL calls net.ListenUDP and then sets the TTL.
+func (*TProxyStdlib) ListenUDPWithTTL(
+	network string, laddr *net.UDPAddr, ttl int) (model.UDPLikeConn, error) {
+	pconn, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		ipv6 := strings.HasSuffix(network, "6")
+		if err := ttlSetRawConn(pconn, ipv6, ttl); err != nil {
+			pconn.Close()
+			return nil, err
+		}
+	}
+	return pconn, nil
+}
+
+// NewSimpleDialerWithTTL returns a dialer based on net.Dialer that
+// sets the TTL before connecting and returns model.TTLConn conns.
+func (*TProxyStdlib) NewSimpleDialerWithTTL(timeout time.Duration, ttl int) model.SimpleDialer {
+	dialer := &net.Dialer{Timeout: timeout}
+	if ttl > 0 {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			return ttlControl(c, strings.HasSuffix(network, "6"), ttl)
+		}
+	}
+	return &ttlDialer{dialer: dialer}
+}
+
+// ttlDialer is the dialer returned by NewSimpleDialerWithTTL.
+type ttlDialer struct {
+	dialer *net.Dialer
+}
+
+// DialContext implements model.SimpleDialer.DialContext.
+func (d *ttlDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &ttlConn{Conn: conn}, nil
+}
+
+// ttlConn is the model.TTLConn returned by ttlDialer.
+type ttlConn struct {
+	net.Conn
+}
+
+// SetTTL implements model.TTLConn.SetTTL.
+func (c *ttlConn) SetTTL(ttl int) error {
+	sc, ok := c.Conn.(syscall.Conn)
+	if !ok {
+		return ErrNoTTLSupport
+	}
+	addr, ok := c.Conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return ErrNoTTLSupport
+	}
+	return ttlSetRawConn(sc, addr.IP.To4() == nil, ttl)
+}
+
+// ttlSetRawConn sets the TTL of the given syscall.Conn.
+func ttlSetRawConn(sc syscall.Conn, ipv6 bool, ttl int) error {
+	c, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return ttlControl(c, ipv6, ttl)
+}
+
+// ttlControl sets the TTL of the socket wrapped by c.
+func ttlControl(c syscall.RawConn, ipv6 bool, ttl int) error {
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		if ipv6 {
+			serr = ttlSetsockopt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, ttl)
+			return
+		}
+		serr = ttlSetsockopt(fd, syscall.IPPROTO_IP, syscall.IP_TTL, ttl)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,101 @@
+package netxlite
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ooni/probe-cli/v3/internal/model"
+	"github.com/ooni/probe-cli/v3/internal/model/mocks"
+)
+
+func TestTProxyStdlibTTL(t *testing.T) {
+	t.Run("NewSimpleDialerWithTTL", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		for _, ttl := range []int{0, 64} {
+			d := (&TProxyStdlib{}).NewSimpleDialerWithTTL(time.Second, ttl)
+			conn, err := d.DialContext(context.Background(), "tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			tconn, ok := conn.(model.TTLConn)
+			if !ok {
+				t.Fatal("not a TTLConn")
+			}
+			if err := tconn.SetTTL(3); err != nil {
+				t.Fatal(err)
+			}
+			conn.Close()
+		}
+	})
+
+	t.Run("NewSimpleDialerWithTTL with an invalid TTL", func(t *testing.T) {
+		d := (&TProxyStdlib{}).NewSimpleDialerWithTTL(time.Second, 1<<20)
+		conn, err := d.DialContext(context.Background(), "tcp", "127.0.0.1:1")
+		if err == nil || conn != nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("NewSimpleDialerWithTTL with a dial failure", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listener.Close() // now connecting fails
+		d := (&TProxyStdlib{}).NewSimpleDialerWithTTL(time.Second, 64)
+		conn, err := d.DialContext(context.Background(), "tcp", listener.Addr().String())
+		if err == nil || conn != nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("SetTTL with a conn without a socket", func(t *testing.T) {
+		conn := &ttlConn{Conn: &mocks.Conn{}}
+		if err := conn.SetTTL(3); !errors.Is(err, ErrNoTTLSupport) {
+			t.Fatal("unexpected err", err)
+		}
+	})
+
+	t.Run("ListenUDPWithTTL", func(t *testing.T) {
+		server, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Close()
+		pconn, err := (&TProxyStdlib{}).ListenUDPWithTTL("udp4", nil, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pconn.Close()
+		if _, err := pconn.WriteTo([]byte("abc"), server.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+		buffer := make([]byte, 8)
+		server.SetDeadline(time.Now().Add(time.Second))
+		count, _, err := server.ReadFrom(buffer)
+		if err != nil || string(buffer[:count]) != "abc" {
+			t.Fatal("unexpected result", count, err)
+		}
+	})
+
+	t.Run("ListenUDPWithTTL with an invalid TTL", func(t *testing.T) {
+		pconn, err := (&TProxyStdlib{}).ListenUDPWithTTL("udp6", nil, 1<<20)
+		if err == nil || pconn != nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("ListenUDPWithTTL with an invalid network", func(t *testing.T) {
+		pconn, err := (&TProxyStdlib{}).ListenUDPWithTTL("tcp", nil, 3)
+		if err == nil || pconn != nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package netxlite
+
+import "syscall"
+
+// ttlSetsockopt calls setsockopt with an integer value.
+func ttlSetsockopt(fd uintptr, level, opt, value int) error {
+	return syscall.SetsockoptInt(int(fd), level, opt, value)
+}
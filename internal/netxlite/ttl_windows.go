@@ -0,0 +1,8 @@
+package netxlite
+
+import "syscall"
+
+// ttlSetsockopt calls setsockopt with an integer value.
+func ttlSetsockopt(fd uintptr, level, opt, value int) error {
+	return syscall.SetsockoptInt(syscall.Handle(fd), level, opt, value)
+}
@@ -0,0 +1,92 @@
+package pagefingerprint
+
+//
+// Blockpage signatures
+//
+
+// DefaultMaxDistance is the default maximum simhash distance
+// between a fingerprint and a matching Signature.
+const DefaultMaxDistance = 6
+
+// Signature is the signature of a known blockpage.
+type Signature struct {
+	// ID is the MANDATORY blockpage identifier (e.g., "ir-dci").
+	ID string `json:"id"`
+
+	// Description is the OPTIONAL blockpage description.
+	Description string `json:"description,omitempty"`
+
+	// SimHash is the MANDATORY simhash of the blockpage's visible text.
+	SimHash uint64 `json:"simhash,string"`
+
+	// DOMHash is the OPTIONAL hash of the blockpage's DOM. When
+	// set, a page only matches if it has the same DOMHash.
+	DOMHash uint64 `json:"domhash,string,omitempty"`
+
+	// MaxDistance is the OPTIONAL maximum simhash distance for a page
+	// to match. If zero, we use DefaultMaxDistance.
+	MaxDistance int `json:"max_distance,omitempty"`
+}
+
+// NewSignature creates the signature of the blockpage with the
+// given ID using a sample of its body.
+func NewSignature(id string, body []byte) *Signature {
+	fp := Compute(body)
+	return &Signature{ID: id, SimHash: fp.SimHash, DOMHash: fp.DOMHash}
+}
+
+// maxDistance returns the maximum distance for this signature.
+func (s *Signature) maxDistance() int {
+	if s.MaxDistance > 0 {
+		return s.MaxDistance
+	}
+	return DefaultMaxDistance
+}
+
+// DB is a database of blockpage signatures. A nil DB is
+// valid and does not contain any signature.
+type DB struct {
+	signatures []*Signature
+}
+
+// NewDB creates a new DB containing the given signatures. We
+// ignore signatures without an ID or without a SimHash.
+func NewDB(signatures ...*Signature) *DB {
+	db := &DB{}
+	for _, s := range signatures {
+		if s != nil && s.ID != "" && s.SimHash != 0 {
+			db.signatures = append(db.signatures, s)
+		}
+	}
+	return db
+}
+
+// Len returns the number of signatures in the DB.
+func (db *DB) Len() int {
+	if db == nil {
+		return 0
+	}
+	return len(db.signatures)
+}
+
+// Match returns the signature closest to the given fingerprint
+// or nil if no signature matches the fingerprint.
+func (db *DB) Match(fp *Fingerprint) (out *Signature) {
+	if db == nil || fp == nil || fp.SimHash == 0 {
+		return nil
+	}
+	best := 0
+	for _, s := range db.signatures {
+		if s.DOMHash != 0 && s.DOMHash != fp.DOMHash {
+			continue
+		}
+		distance := Distance(s.SimHash, fp.SimHash)
+		if distance > s.maxDistance() {
+			continue
+		}
+		if out == nil || distance < best {
+			out, best = s, distance
+		}
+	}
+	return
+}
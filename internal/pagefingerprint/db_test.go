@@ -0,0 +1,68 @@
+package pagefingerprint
+
+import (
+	"testing"
+)
+
+// blockpage returns a sample blockpage for the given URL.
+func blockpage(URL string) []byte {
+	return []byte(`<html><head><title>Blocked</title></head><body>
+<h1>Access denied</h1>
+<p>Access to ` + URL + ` has been restricted in accordance with the
+decision of the competent authority. If you believe this is a mistake
+please contact your Internet service provider customer care.</p>
+</body></html>`)
+}
+
+func TestDB(t *testing.T) {
+	sig := NewSignature("xx-isp", blockpage("http://www.example.com/"))
+	db := NewDB(sig, nil, &Signature{ID: "no-simhash"}, &Signature{SimHash: 1})
+	if db.Len() != 1 {
+		t.Fatal("unexpected number of signatures", db.Len())
+	}
+
+	t.Run("the blockpage for another URL matches", func(t *testing.T) {
+		if m := db.Match(Compute(blockpage("http://www.example.org/a/b"))); m != sig {
+			t.Fatal("expected to match the signature")
+		}
+	})
+
+	t.Run("a normal page does not match", func(t *testing.T) {
+		if m := db.Match(Compute(samplePage(sampleParagraph))); m != nil {
+			t.Fatal("unexpected match", m.ID)
+		}
+	})
+
+	t.Run("an empty page does not match", func(t *testing.T) {
+		if m := db.Match(Compute(nil)); m != nil {
+			t.Fatal("unexpected match", m.ID)
+		}
+		if m := db.Match(nil); m != nil {
+			t.Fatal("unexpected match", m.ID)
+		}
+	})
+
+	t.Run("a different DOM does not match", func(t *testing.T) {
+		body := []byte("<div>" + string(blockpage("http://www.example.com/")) + "</div>")
+		if m := db.Match(Compute(body)); m != nil {
+			t.Fatal("unexpected match", m.ID)
+		}
+	})
+
+	t.Run("we return the closest signature", func(t *testing.T) {
+		fp := Compute(blockpage("http://www.example.com/"))
+		far := &Signature{ID: "far", SimHash: fp.SimHash ^ 0b11, MaxDistance: 10}
+		close := &Signature{ID: "close", SimHash: fp.SimHash ^ 0b1}
+		db := NewDB(far, close)
+		if m := db.Match(fp); m != close {
+			t.Fatal("unexpected match", m)
+		}
+	})
+
+	t.Run("a nil DB is empty", func(t *testing.T) {
+		var db *DB
+		if db.Len() != 0 || db.Match(Compute(blockpage("x"))) != nil {
+			t.Fatal("a nil DB should be empty")
+		}
+	})
+}
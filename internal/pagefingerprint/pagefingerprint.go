@@ -0,0 +1,150 @@
+// Package pagefingerprint computes fingerprints of web pages.
+//
+// A fingerprint contains a simhash of the page's visible text and
+// a hash of the page's DOM structure. Pages with similar text have
+// simhashes differing in few bits, so we can tell whether two pages
+// are similar (e.g., the page fetched by the probe and the one
+// fetched by the test helper) more robustly than by comparing their
+// lengths. We can also recognize a known blockpage even when it
+// embeds variable data such as the blocked URL (see DB).
+package pagefingerprint
+
+import (
+	"bytes"
+	"hash/fnv"
+	"io"
+	"math/bits"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Fingerprint is the fingerprint of a web page.
+type Fingerprint struct {
+	// SimHash is the simhash of the page's visible text. It is
+	// zero when the page does not contain any visible text.
+	SimHash uint64 `json:"simhash,string"`
+
+	// DOMHash is the hash of the sequence of the page's tags, which
+	// ignores attributes and text. It is zero for a page without tags.
+	DOMHash uint64 `json:"domhash,string"`
+
+	// Title is the page's title, if any.
+	Title string `json:"title"`
+
+	// Length is the length of the page's body.
+	Length int64 `json:"length"`
+}
+
+// Compute computes the fingerprint of the given body. We tolerate
+// malformed and truncated HTML as well as non-HTML bodies.
+func Compute(body []byte) *Fingerprint {
+	var (
+		domHash = fnv.New64a()
+		skip    int
+		tags    int
+		text    []string
+		title   strings.Builder
+		inTitle bool
+	)
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			break // io.EOF or truncated input
+		}
+		token := tokenizer.Token()
+		switch tt {
+		case html.StartTagToken:
+			tags++
+			io.WriteString(domHash, "<"+token.Data)
+			if isInvisibleTag(token.Data) {
+				skip++
+			}
+			inTitle = token.Data == "title"
+		case html.SelfClosingTagToken:
+			tags++
+			io.WriteString(domHash, "<"+token.Data+"/")
+		case html.EndTagToken:
+			tags++
+			io.WriteString(domHash, "</"+token.Data)
+			if isInvisibleTag(token.Data) && skip > 0 {
+				skip--
+			}
+			inTitle = false
+		case html.TextToken:
+			if inTitle && title.Len() <= 0 {
+				title.WriteString(strings.TrimSpace(token.Data))
+			}
+			if skip <= 0 && !inTitle {
+				text = append(text, token.Data)
+			}
+		}
+	}
+	fp := &Fingerprint{
+		SimHash: SimHash(strings.Join(text, " ")),
+		Title:   title.String(),
+		Length:  int64(len(body)),
+	}
+	if tags > 0 {
+		fp.DOMHash = domHash.Sum64()
+	}
+	return fp
+}
+
+// isInvisibleTag returns whether the content of the given
+// tag is not part of the page's visible text.
+func isInvisibleTag(name string) bool {
+	switch name {
+	case "script", "style", "noscript", "template":
+		return true
+	default:
+		return false
+	}
+}
+
+// SimHash computes the 64 bit simhash of the given text. We use
+// words as features, ignoring case and spacing, because, for short
+// texts such as blockpages, changing a word changes a significant
+// fraction of longer features. Returns zero if the text has no words.
+func SimHash(text string) uint64 {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) <= 0 {
+		return 0
+	}
+	var weights [64]int
+	for _, word := range words {
+		h := fnv.New64a()
+		io.WriteString(h, word)
+		v := h.Sum64()
+		for i := 0; i < 64; i++ {
+			if v&(1<<uint(i)) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+	var out uint64
+	for i := 0; i < 64; i++ {
+		if weights[i] > 0 {
+			out |= 1 << uint(i)
+		}
+	}
+	return out
+}
+
+// Distance returns the number of bits by which two simhashes differ.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Similarity returns how similar is the visible text of the two
+// given fingerprints, between 0 (different) and 1 (same).
+func Similarity(a, b *Fingerprint) float64 {
+	return 1 - float64(Distance(a.SimHash, b.SimHash))/64
+}
+
+// SimilarityThreshold is the Similarity above which we consider
+// two web pages to be the same web page.
+const SimilarityThreshold = 0.9
@@ -0,0 +1,149 @@
+package pagefingerprint
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// samplePage returns a sample web page with the given paragraph.
+func samplePage(paragraph string) []byte {
+	return []byte(`<!DOCTYPE html>
+<html>
+<head>
+<title> Example Domain </title>
+<style>body { background-color: #f0f0f2; }</style>
+<script>var tracking = "this text is not visible";</script>
+</head>
+<body>
+<div>
+<h1>Example Domain</h1>
+<p>` + paragraph + `</p>
+<p><a href="https://www.iana.org/domains/example">More information...</a><br/></p>
+</div>
+</body>
+</html>`)
+}
+
+const sampleParagraph = `This domain is for use in illustrative examples in documents.
+You may use this domain in literature without prior coordination or asking for
+permission. We maintain this domain for the benefit of the whole community.`
+
+func TestCompute(t *testing.T) {
+	t.Run("with an HTML page", func(t *testing.T) {
+		body := samplePage(sampleParagraph)
+		fp := Compute(body)
+		if fp.Title != "Example Domain" {
+			t.Fatal("unexpected title", fp.Title)
+		}
+		if fp.Length != int64(len(body)) {
+			t.Fatal("unexpected length", fp.Length)
+		}
+		if fp.SimHash == 0 || fp.DOMHash == 0 {
+			t.Fatal("expected nonzero hashes", fp)
+		}
+	})
+
+	t.Run("we ignore invisible text", func(t *testing.T) {
+		other := strings.Replace(string(samplePage(sampleParagraph)),
+			"this text is not visible", "some other invisible text", 1)
+		a, b := Compute(samplePage(sampleParagraph)), Compute([]byte(other))
+		if a.SimHash != b.SimHash || a.DOMHash != b.DOMHash {
+			t.Fatal("invisible text changed the fingerprint")
+		}
+	})
+
+	t.Run("we ignore attributes", func(t *testing.T) {
+		other := strings.Replace(string(samplePage(sampleParagraph)),
+			"https://www.iana.org/domains/example", "https://example.org/", 1)
+		a, b := Compute(samplePage(sampleParagraph)), Compute([]byte(other))
+		if a.SimHash != b.SimHash || a.DOMHash != b.DOMHash {
+			t.Fatal("attributes changed the fingerprint")
+		}
+	})
+
+	t.Run("the DOM hash depends on the structure", func(t *testing.T) {
+		other := strings.Replace(string(samplePage(sampleParagraph)), "<div>", "<section>", 1)
+		a, b := Compute(samplePage(sampleParagraph)), Compute([]byte(other))
+		if a.SimHash != b.SimHash {
+			t.Fatal("the tag name changed the simhash")
+		}
+		if a.DOMHash == b.DOMHash {
+			t.Fatal("the tag name did not change the DOM hash")
+		}
+	})
+
+	t.Run("with a non-HTML body", func(t *testing.T) {
+		fp := Compute([]byte("just some text"))
+		if fp.SimHash == 0 || fp.DOMHash != 0 || fp.Title != "" {
+			t.Fatal("unexpected fingerprint", fp)
+		}
+	})
+
+	t.Run("with an empty body", func(t *testing.T) {
+		expected := &Fingerprint{}
+		if diff := cmp.Diff(expected, Compute(nil)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with a truncated body", func(t *testing.T) {
+		body := samplePage(sampleParagraph)
+		fp := Compute(body[:len(body)/2])
+		if fp.Title != "Example Domain" || fp.DOMHash == 0 {
+			t.Fatal("unexpected fingerprint", fp)
+		}
+	})
+
+	t.Run("JSON serialization", func(t *testing.T) {
+		fp := Compute(samplePage(sampleParagraph))
+		data, err := json.Marshal(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var other Fingerprint
+		if err := json.Unmarshal(data, &other); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(fp, &other); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestSimHash(t *testing.T) {
+	if SimHash("") != 0 || SimHash(" \t\n") != 0 {
+		t.Fatal("expected zero simhash for text without words")
+	}
+	if SimHash("two words") == 0 {
+		t.Fatal("expected nonzero simhash for short text")
+	}
+	if SimHash("Hello,   World  again") != SimHash("hello, world\nagain") {
+		t.Fatal("simhash depends on case or spacing")
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	original := Compute(samplePage(sampleParagraph))
+	similar := Compute(samplePage(strings.Replace(
+		sampleParagraph, "whole community", "entire community", 1)))
+	different := Compute(samplePage(`Access to this website has been
+restricted in accordance with the decision of the competent authority.`))
+	if v := Similarity(original, original); v != 1 {
+		t.Fatal("unexpected self similarity", v)
+	}
+	if v := Similarity(original, similar); v < SimilarityThreshold {
+		t.Fatal("expected similar pages", v)
+	}
+	if v := Similarity(original, different); v >= SimilarityThreshold {
+		t.Fatal("expected different pages", v)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	if Distance(0, 0) != 0 || Distance(0, 0xff) != 8 || Distance(1<<63, 1) != 2 {
+		t.Fatal("unexpected distance")
+	}
+}
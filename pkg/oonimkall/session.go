@@ -85,6 +85,13 @@ type SessionConfig struct {
 	// should only be used for implementing integration tests.
 	ProbeServicesURL string
 
+	// QueueFailedSubmissions is optional. If true, Submit will store
+	// the measurements it fails to submit into a persistent queue
+	// inside StateDir, which you can flush using FlushSubmissions.
+	// Do not enable this setting if the app retries failed
+	// submissions on its own, to avoid duplicate submissions.
+	QueueFailedSubmissions bool
+
 	// SoftwareName is the mandatory name of the application
 	// that will be using the new Session.
 	SoftwareName string
@@ -127,6 +134,7 @@ type Session struct {
 
 	cl        []context.CancelFunc
 	mtx       sync.Mutex
+	queue     bool
 	submitter *probeservices.Submitter
 	sessp     *engine.Session
 }
@@ -194,7 +202,7 @@ func newSessionWithContext(ctx context.Context, config *SessionConfig) (*Session
 	if err != nil {
 		return nil, err
 	}
-	sess := &Session{sessp: sessp}
+	sess := &Session{queue: config.QueueFailedSubmissions, sessp: sessp}
 	// We use finalizers to reduce the burden of managing the
 	// session from languages with a garbage collector.
 	runtime.SetFinalizer(sess, sessionFinalizer)
@@ -312,18 +320,16 @@ type SubmitMeasurementResults struct {
 func (sess *Session) Submit(ctx *Context, measurement string) (*SubmitMeasurementResults, error) {
 	sess.mtx.Lock()
 	defer sess.mtx.Unlock()
-	if sess.submitter == nil {
-		psc, err := sess.sessp.NewProbeServicesClient(ctx.ctx)
-		if err != nil {
-			return nil, err
-		}
-		sess.submitter = probeservices.NewSubmitter(psc, sess.sessp.Logger())
-	}
 	var mm model.Measurement
 	if err := json.Unmarshal([]byte(measurement), &mm); err != nil {
 		return nil, err
 	}
-	if err := sess.submitter.Submit(ctx.ctx, &mm); err != nil {
+	if err := sess.submit(ctx.ctx, &mm); err != nil {
+		if sess.queue {
+			if err := sess.sessp.SubmitQueue().Add(&mm, err); err != nil {
+				sess.sessp.Logger().Warnf("cannot queue measurement: %s", err.Error())
+			}
+		}
 		return nil, err
 	}
 	data, err := json.Marshal(mm)
@@ -334,6 +340,38 @@ func (sess *Session) Submit(ctx *Context, measurement string) (*SubmitMeasuremen
 	}, nil
 }
 
+// submit submits the given measurement. This function assumes
+// that the caller is holding the session's mutex.
+func (sess *Session) submit(ctx context.Context, mm *model.Measurement) error {
+	if sess.submitter == nil {
+		psc, err := sess.sessp.NewProbeServicesClient(ctx)
+		if err != nil {
+			return err
+		}
+		sess.submitter = probeservices.NewSubmitter(psc, sess.sessp.Logger())
+	}
+	return sess.submitter.Submit(ctx, mm)
+}
+
+// PendingSubmissions returns the number of measurements in the
+// persistent queue of measurements that we could not submit.
+func (sess *Session) PendingSubmissions() (int64, error) {
+	pending, err := sess.sessp.SubmitQueue().Pending()
+	return int64(pending), err
+}
+
+// FlushSubmissions submits the queued measurements whose next
+// attempt is due and returns the number of submitted measurements.
+//
+// This function locks the session until it's done. That is, no other operation
+// can be performed as long as this function is pending.
+func (sess *Session) FlushSubmissions(ctx *Context) (int64, error) {
+	sess.mtx.Lock()
+	defer sess.mtx.Unlock()
+	submitted, err := sess.sessp.SubmitQueue().Flush(ctx.ctx)
+	return int64(submitted), err
+}
+
 // CheckInConfigWebConnectivity contains WebConnectivity
 // configuration for the check-in API.
 type CheckInConfigWebConnectivity struct {